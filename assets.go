@@ -0,0 +1,114 @@
+package trygo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Assets are non-source files which packages read at runtime or in tests such as files in testdata
+// directory or templates. They are copied to output directories when CopyAssets is enabled.
+
+// isHiddenName returns true when the file or directory is ignored by `go build`.
+func isHiddenName(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// isAssetFile returns true when the file is not a source of `go build`.
+func isAssetFile(name string) bool {
+	if isHiddenName(name) || strings.HasSuffix(name, ".go") {
+		return false
+	}
+	_, ok := companionExts[filepath.Ext(name)]
+	return !ok
+}
+
+// containsGoFiles returns true when the directory tree contains some Go file. Such directory contains
+// other packages and is not an asset directory.
+func containsGoFiles(dir string) bool {
+	found := false
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || found {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".go") {
+			found = true
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found
+}
+
+// copyDir copies all files in the directory tree recursively. Directory at skip is not copied.
+func copyDir(src, dst, skip string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == skip {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		to := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(to, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(path, to)
+	})
+}
+
+// copyAssets copies assets in package directories of given packages into their output directories.
+// Non-source files directly in the package directory, testdata directory and directories which contain
+// no Go file are copied.
+func (gen *Gen) copyAssets(pkgs []*Package) error {
+	lg := gen.lg()
+	done := map[string]struct{}{}
+	for _, pkg := range pkgs {
+		if _, ok := done[pkg.Birth]; ok {
+			continue
+		}
+		done[pkg.Birth] = struct{}{}
+		if pkg.Path == pkg.Birth {
+			continue // Generated next to sources in dual-build layout
+		}
+
+		entries, err := ioutil.ReadDir(pkg.Birth)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			src := filepath.Join(pkg.Birth, name)
+			dst := filepath.Join(pkg.Path, name)
+			if src == gen.OutDir {
+				continue
+			}
+			if !e.IsDir() {
+				if !isAssetFile(name) || !e.Mode().IsRegular() {
+					continue
+				}
+				lg.log("Copy asset file", relpath(src), "->", relpath(dst))
+				if err := copyFile(src, dst); err != nil {
+					return err
+				}
+				continue
+			}
+			if isHiddenName(name) || (name != "testdata" && containsGoFiles(src)) {
+				continue
+			}
+			lg.log("Copy asset directory", relpath(src), "->", relpath(dst))
+			if err := copyDir(src, dst, gen.OutDir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
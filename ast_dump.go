@@ -0,0 +1,88 @@
+package trygo
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	astStageBefore = "0-before"
+	astStagePhase1 = "1-phase1"
+	astStagePhase2 = "2-phase2"
+)
+
+// dumpName returns a name of the package used for debug dumps. Path of the source directory is flattened
+// so that packages with the same name do not conflict.
+func (pkg *Package) dumpName() string {
+	name := strings.TrimPrefix(filepath.ToSlash(relpath(pkg.Birth)), "./")
+	name = strings.Trim(strings.Replace(name, "/", "_", -1), "_.")
+	if name == "" {
+		name = pkg.Node.Name
+	}
+	return name
+}
+
+// dumpAST writes AST of each file in the package to '{EmitASTDir}/{pkgdir}/{file}.{stage}.ast' with
+// ast.Fprint(). It does nothing when EmitASTDir is not set.
+func (pkg *Package) dumpAST(stage string) error {
+	if pkg.emitASTDir == "" {
+		return nil
+	}
+	dir := filepath.Join(pkg.emitASTDir, pkg.dumpName())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "Cannot create directory to dump AST %q", dir)
+	}
+	for _, path := range sortedFilePaths(pkg.Node.Files) {
+		out := filepath.Join(dir, filepath.Base(path)+"."+stage+".ast")
+		if err := dumpASTFile(out, pkg, pkg.Node.Files[path]); err != nil {
+			return err
+		}
+		pkg.lg.log("AST", pkg.lg.hi(stage), "was dumped to", relpath(out))
+	}
+	return nil
+}
+
+// dumpPhase1Source writes Go source of each file in the package after phase-1 to
+// '{EmitPhase1Dir}/{pkgdir}/{file}'. Eliminated try() calls remain as `x, _ := f()` form since nil checks
+// are not inserted yet. It does nothing when EmitPhase1Dir is not set.
+func (pkg *Package) dumpPhase1Source() error {
+	if pkg.emitPhase1Dir == "" {
+		return nil
+	}
+	dir := filepath.Join(pkg.emitPhase1Dir, pkg.dumpName())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "Cannot create directory to emit source after phase-1 %q", dir)
+	}
+	for _, path := range sortedFilePaths(pkg.Node.Files) {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, pkg.Files, pkg.Node.Files[path]); err != nil {
+			return errors.Wrapf(err, "Cannot format source of %s after phase-1", path)
+		}
+		out := filepath.Join(dir, filepath.Base(path))
+		if err := ioutil.WriteFile(out, buf.Bytes(), 0644); err != nil {
+			return errors.Wrapf(err, "Cannot write source after phase-1 to %q", out)
+		}
+		pkg.lg.log("Source after phase-1 was written to", relpath(out))
+	}
+	return nil
+}
+
+func dumpASTFile(path string, pkg *Package, file *ast.File) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot create file to dump AST %q", path)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := ast.Fprint(w, pkg.Files, file, ast.NotNilFilter); err != nil {
+		return errors.Wrapf(err, "Cannot dump AST to %q", path)
+	}
+	return errors.Wrapf(w.Flush(), "Cannot write AST to %q", path)
+}
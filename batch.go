@@ -0,0 +1,251 @@
+package trygo
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/token"
+	"os/exec"
+	"sort"
+	"strconv"
+)
+
+// When Gen.BatchSize is set, packages are generated in batches to keep memory bounded on very large inputs.
+// All packages are parsed once in advance to collect their stubs, which keep only what import fixing needs:
+// source and output directories, package name and exported names. Then each batch is translated with the
+// stubs of other packages, written and released before the next batch.
+
+// stubOf returns a stub of the package which does not retain its AST, type information and file set.
+func stubOf(pkg *Package) *Package {
+	files := make(map[string]*ast.File, len(pkg.Node.Files))
+	for path, f := range pkg.Node.Files {
+		scope := ast.NewScope(nil)
+		for name, obj := range f.Scope.Objects {
+			if ast.IsExported(name) {
+				scope.Insert(ast.NewObj(obj.Kind, name))
+			}
+		}
+		files[path] = &ast.File{Name: ast.NewIdent(f.Name.Name), Scope: scope}
+	}
+	return &Package{
+		Files:    token.NewFileSet(),
+		Node:     &ast.Package{Name: pkg.Node.Name, Files: files},
+		Path:     pkg.Path,
+		Birth:    pkg.Birth,
+		modified: pkg.modified,
+		targets:  pkg.targets,
+		sources:  pkg.sources,
+		lg:       pkg.lg,
+		warnings: pkg.warnings,
+		timings:  pkg.timings,
+	}
+}
+
+// importPathsOfDirs returns a map from package directory to its import path with one `go list` command.
+// Directories whose import paths cannot be known are not included.
+func importPathsOfDirs(dirs []string) map[string]string {
+	paths := map[string]string{}
+	args := append([]string{"list", "-e", "-find", "-json", "--"}, dirs...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = cwd
+	out, err := cmd.Output()
+	if err != nil {
+		return paths
+	}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg goListPackage
+		if err := dec.Decode(&pkg); err != nil {
+			break
+		}
+		if pkg.Error == nil && pkg.Dir != "" && pkg.ImportPath != "" {
+			paths[pkg.Dir] = pkg.ImportPath
+		}
+	}
+	return paths
+}
+
+// dependenciesOfDirs returns a map from package directory to a set of directories of packages imported by
+// it. imports is a map from package directory to a set of its import paths.
+func dependenciesOfDirs(dirs []string, imports map[string]map[string]struct{}) map[string]map[string]struct{} {
+	dirOf := map[string]string{}
+	for dir, path := range importPathsOfDirs(dirs) {
+		dirOf[path] = dir
+	}
+	deps := map[string]map[string]struct{}{}
+	for _, dir := range dirs {
+		deps[dir] = map[string]struct{}{}
+		for path := range imports[dir] {
+			if d, ok := dirOf[path]; ok && d != dir {
+				deps[dir][d] = struct{}{}
+			}
+		}
+	}
+	return deps
+}
+
+// orderByDependencies sorts the package directories so that directories of imported packages come before
+// directories importing them. deps is a map from directory to a set of directories imported by it.
+// Directories in import cycles, which are possible with external test packages, are put in sorted order
+// after the others.
+func orderByDependencies(dirs []string, deps map[string]map[string]struct{}) []string {
+	// waiting[dir] is the number of directories imported by dir which are not sorted yet. importers is
+	// the reverse of deps
+	waiting := map[string]int{}
+	importers := map[string][]string{}
+	for _, dir := range dirs {
+		for d := range deps[dir] {
+			waiting[dir]++
+			importers[d] = append(importers[d], dir)
+		}
+	}
+
+	sorted := make([]string, 0, len(dirs))
+	done := map[string]struct{}{}
+	ready := []string{}
+	for _, dir := range dirs {
+		if waiting[dir] == 0 {
+			ready = append(ready, dir)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		dir := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, dir)
+		done[dir] = struct{}{}
+		for _, importer := range importers[dir] {
+			waiting[importer]--
+			if waiting[importer] == 0 {
+				ready = append(ready, importer)
+			}
+		}
+	}
+
+	rest := []string{}
+	for _, dir := range dirs {
+		if _, ok := done[dir]; !ok {
+			rest = append(rest, dir)
+		}
+	}
+	sort.Strings(rest)
+	return append(sorted, rest...)
+}
+
+// parseStubs parses the package directories in batches and returns stubs of the packages and import paths
+// of each directory.
+func (gen *Gen) parseStubs(pkgDirs []string) (map[string][]*Package, map[string]map[string]struct{}, error) {
+	stubs := map[string][]*Package{}
+	imports := map[string]map[string]struct{}{}
+	for i := 0; i < len(pkgDirs); i += gen.BatchSize {
+		end := i + gen.BatchSize
+		if end > len(pkgDirs) {
+			end = len(pkgDirs)
+		}
+		pkgs, err := gen.ParsePackages(pkgDirs[i:end])
+		if err != nil {
+			if _, ok := err.(*PartialError); !ok {
+				return nil, nil, err
+			}
+			// Errors are reported again when generating the batch
+		}
+		for _, pkg := range pkgs {
+			stubs[pkg.Birth] = append(stubs[pkg.Birth], stubOf(pkg))
+			if _, ok := imports[pkg.Birth]; !ok {
+				imports[pkg.Birth] = map[string]struct{}{}
+			}
+			for _, f := range pkg.Node.Files {
+				for _, spec := range f.Imports {
+					if p, err := strconv.Unquote(spec.Path.Value); err == nil {
+						imports[pkg.Birth][p] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+	return stubs, imports, nil
+}
+
+// generateInBatches generates packages in batches of Gen.BatchSize package directories. It is called by
+// GeneratePackages when Gen.BatchSize is set.
+func (gen *Gen) generateInBatches(pkgDirs []string, verify bool) error {
+	lg := gen.lg()
+	if gen.Flatten || gen.Build {
+		return errors.New("Generating packages in batches cannot be used with flattening output directory nor building output")
+	}
+
+	stubs, imports, err := gen.parseStubs(pkgDirs)
+	if err != nil {
+		return err
+	}
+	all := []*Package{}
+	for _, ps := range stubs {
+		all = append(all, ps...)
+	}
+	if err := gen.checkOutputCollisions(all); err != nil {
+		return err
+	}
+
+	gen.batchStubs = stubs
+	defer func() { gen.batchStubs = nil }()
+
+	var m *Manifest
+	base := ""
+	if gen.ManifestPath != "" {
+		if base, err = gen.manifestBase(); err != nil {
+			return err
+		}
+		m = &Manifest{Files: []*ManifestFile{}}
+	}
+
+	ordered := orderByDependencies(pkgDirs, dependenciesOfDirs(pkgDirs, imports))
+	generated := []*Package{}
+	var failed []error
+	for i := 0; i < len(ordered); i += gen.BatchSize {
+		end := i + gen.BatchSize
+		if end > len(ordered) {
+			end = len(ordered)
+		}
+		batch := ordered[i:end]
+		lg.log("Generate batch", lg.hi(i/gen.BatchSize+1), "of", len(batch), "package directories:", batch)
+
+		pkgs, err := gen.generatePackages(batch)
+		if err != nil {
+			p, ok := err.(*PartialError)
+			if !ok {
+				return err
+			}
+			failed = append(failed, p.Errs...)
+		}
+		if err := gen.finishBatch(pkgs, verify); err != nil {
+			return err
+		}
+		if m != nil {
+			bm, err := newManifest(pkgs, base)
+			if err != nil {
+				return err
+			}
+			m.Files = append(m.Files, bm.Files...)
+		}
+
+		// Release ASTs and type information of the batch
+		for _, pkg := range pkgs {
+			generated = append(generated, stubOf(pkg))
+		}
+	}
+
+	if m != nil {
+		sort.Slice(m.Files, func(i, j int) bool {
+			return m.Files[i].Source < m.Files[j].Source
+		})
+	}
+	if err := gen.finishGeneration(generated, m); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return &PartialError{failed, generated}
+	}
+	return nil
+}
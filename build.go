@@ -0,0 +1,27 @@
+package trygo
+
+import (
+	"github.com/pkg/errors"
+	"os/exec"
+	"strings"
+)
+
+// buildOutput runs `go build ./...` in output directory to check generated packages can be built.
+// Type check while verification does not detect all errors which compiler reports. Positions in
+// compiler errors are mapped back to TryGo sources.
+func (gen *Gen) buildOutput(pkgs []*Package) error {
+	lg := gen.lg()
+	lg.log("Build generated packages in", relpath(gen.OutDir))
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = gen.OutDir
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		lg.log("Build OK")
+		return nil
+	}
+	msg := strings.TrimSpace(remapOutput(pkgs, gen.OutDir, string(out)))
+	if msg == "" {
+		return errors.Wrap(err, "Cannot build generated packages")
+	}
+	return errors.Errorf("Build of generated packages failed:\n%s", msg)
+}
@@ -0,0 +1,250 @@
+package trygo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Translation results are cached per package in files under CacheDir so that unchanged packages are not
+// translated again in later invocations such as separate `go generate` runs. The key is a hash of the
+// trygo version, the Go version, options affecting translation, and contents of Go files in the package
+// and in packages directly imported by it. Translated ASTs are cached before fixing imports since import
+// paths depend on which packages are translated together.
+
+// cacheEntry is a translation result of one package stored in the cache directory.
+type cacheEntry struct {
+	// Modified is true when the package was modified by translation.
+	Modified bool `json:"modified"`
+	// Files is a map from base name of source file to its translated Go source.
+	Files map[string]string `json:"files"`
+	// Warnings is a list of warnings found while translating the package.
+	Warnings []*Warning `json:"warnings"`
+}
+
+var (
+	toolVersionOnce sync.Once
+	toolVersionStr  string
+)
+
+// toolVersion returns a string identifying the build of trygo. Module version is used when available.
+// Development builds are identified by hash of their executables. It returns empty string when the
+// build cannot be identified.
+func toolVersion() string {
+	toolVersionOnce.Do(func() {
+		const mod = "github.com/rhysd/trygo"
+		if info, ok := debug.ReadBuildInfo(); ok {
+			if info.Main.Path == mod && info.Main.Version != "" && info.Main.Version != "(devel)" {
+				toolVersionStr = info.Main.Version
+				return
+			}
+			for _, d := range info.Deps {
+				if d.Path == mod && d.Replace == nil {
+					toolVersionStr = d.Version
+					return
+				}
+			}
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return
+		}
+		b, err := ioutil.ReadFile(exe)
+		if err != nil {
+			return
+		}
+		sum := sha256.Sum256(b)
+		toolVersionStr = "exe-" + hex.EncodeToString(sum[:])
+	})
+	return toolVersionStr
+}
+
+// DefaultCacheDir returns a directory path for caching translation results. It is 'trygo' directory in
+// the user's cache directory returned by os.UserCacheDir().
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "Cannot find cache directory")
+	}
+	return filepath.Join(dir, "trygo"), nil
+}
+
+// CleanCache removes all translation results cached in the directory. It is not an error when the
+// directory does not exist.
+func CleanCache(dir string) error {
+	if dir == "" {
+		return errors.New("Cache directory is empty")
+	}
+	return errors.Wrapf(os.RemoveAll(dir), "Cannot remove cache directory %q", dir)
+}
+
+// cacheable returns whether translation results can be cached with the configuration. Results are not
+// cached when translation depends on things which cannot be hashed such as hooks and plugins, or when
+// later steps need translation points which are not cached.
+func (gen *Gen) cacheable() bool {
+	return gen.CacheDir != "" &&
+		gen.cacheGenerated &&
+		gen.OnTranslate == nil &&
+		gen.Passes == nil &&
+		len(gen.Plugins) == 0 &&
+		!gen.Explain &&
+		!gen.Build &&
+		gen.ManifestPath == "" &&
+		gen.EmitASTDir == "" &&
+		gen.DumpBlocksDir == "" &&
+		gen.EmitPhase1Dir == "" &&
+		toolVersion() != ""
+}
+
+// hashGoFiles writes names and contents of the Go files in the directory to the hash input.
+func hashGoFiles(buf *bytes.Buffer, dir string, names []string) error {
+	sort.Strings(names)
+	for _, name := range names {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "file %s %d\n", name, len(b))
+		buf.Write(b)
+	}
+	return nil
+}
+
+// cacheKey returns a key of the cache entry for the package.
+func (gen *Gen) cacheKey(pkg *Package) (string, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "trygo %s\ngo %s\n", toolVersion(), runtime.Version())
+	fmt.Fprintf(&buf, "ok-error %q\nnot-found-error %q\nclosed-error %q\nexpect-handler %q\n", gen.OkError, gen.NotFoundError, gen.ClosedError, gen.ExpectHandler)
+	fmt.Fprintf(&buf, "wrap %v\nstrict %v\nno-typecheck %v\nstandalone %v\nruntime-helpers %v\npreflight %v\n", gen.WrapReplacedError, gen.Strict, gen.NoTypeCheck, gen.Standalone, gen.RuntimeHelpers, gen.PreflightTypeCheck)
+	fmt.Fprintf(&buf, "package %s %s\n", pkg.Node.Name, pkg.Birth)
+
+	names := make([]string, 0, len(pkg.Node.Files))
+	imports := map[string]struct{}{}
+	for path, f := range pkg.Node.Files {
+		names = append(names, filepath.Base(path))
+		for _, spec := range f.Imports {
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil && p != "C" {
+				imports[p] = struct{}{}
+			}
+		}
+	}
+	if err := hashGoFiles(&buf, pkg.Birth, names); err != nil {
+		return "", err
+	}
+
+	// Results of functions in imported packages decide how try() calls are translated. Standard library
+	// is identified by Go version
+	paths := make([]string, 0, len(imports))
+	for p := range imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(&buf, "import %s\n", p)
+		imported, err := build.Default.Import(p, pkg.Birth, 0)
+		if err != nil || imported.Goroot {
+			continue
+		}
+		if err := hashGoFiles(&buf, imported.Dir, imported.GoFiles); err != nil {
+			return "", err
+		}
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (gen *Gen) cachePath(key string) string {
+	return filepath.Join(gen.CacheDir, key[:2], key+".json")
+}
+
+// loadCache restores translated ASTs of the package from the cache entry. It returns false when the
+// entry is not found or broken.
+func (gen *Gen) loadCache(pkg *Package, key string) bool {
+	lg := gen.lg()
+	b, err := ioutil.ReadFile(gen.cachePath(key))
+	if err != nil {
+		return false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		lg.log("Ignore broken cache entry", key, err)
+		return false
+	}
+
+	paths := sortedFilePaths(pkg.Node.Files)
+	if len(entry.Files) != len(paths) {
+		lg.log("Ignore cache entry with unexpected files", key)
+		return false
+	}
+	for _, path := range paths {
+		src, ok := entry.Files[filepath.Base(path)]
+		if !ok {
+			lg.log("Ignore cache entry without file", filepath.Base(path), key)
+			return false
+		}
+		f, err := parser.ParseFile(pkg.Files, path, src, parser.ParseComments)
+		if err != nil {
+			lg.log("Ignore cache entry with broken source", key, err)
+			return false
+		}
+		pkg.Node.Files[path] = f
+	}
+	pkg.modified = entry.Modified
+	pkg.warnings = entry.Warnings
+	return true
+}
+
+// storeCache stores translated ASTs of the package as the cache entry. The entry is written to a temporary
+// file and renamed so that concurrent invocations never read a partially written entry.
+func (gen *Gen) storeCache(pkg *Package, key string) error {
+	entry := &cacheEntry{
+		Modified: pkg.modified,
+		Files:    make(map[string]string, len(pkg.Node.Files)),
+		Warnings: pkg.warnings,
+	}
+	for path, f := range pkg.Node.Files {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, pkg.Files, f); err != nil {
+			return err
+		}
+		entry.Files[filepath.Base(path)] = buf.String()
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := gen.cachePath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
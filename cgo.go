@@ -0,0 +1,110 @@
+package trygo
+
+import (
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+)
+
+// Files using cgo carry C code in the comment immediately preceding `import "C"`, called preamble.
+// Packages parsed by Gen always keep the preamble since comments are parsed. But ASTs given to Translate()
+// or TranslateAST() may be parsed without comments. Then the preamble is missing in AST and generated Go
+// file no longer builds. Preambles are restored from source files verbatim before translation.
+
+// cgoImportOf returns `import "C"` declaration and its spec in the file. When the file does not use cgo,
+// it returns nils.
+func cgoImportOf(file *ast.File) (*ast.GenDecl, *ast.ImportSpec) {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil && p == "C" {
+				return gen, spec
+			}
+		}
+	}
+	return nil, nil
+}
+
+// cgoPreambleOf returns the comment group of preamble of `import "C"`.
+func cgoPreambleOf(decl *ast.GenDecl, spec *ast.ImportSpec) *ast.CommentGroup {
+	if spec.Doc != nil {
+		return spec.Doc
+	}
+	if !decl.Lparen.IsValid() {
+		// Doc comment of `import "C"` is set to the declaration node
+		return decl.Doc
+	}
+	return nil
+}
+
+// restoreCgoPreamble restores the preamble of cgo file from the source file when it is missing in AST.
+// Positions of the restored comments are calculated from offsets in the source.
+func restoreCgoPreamble(fset *token.FileSet, fpath string, file *ast.File, lg logger) error {
+	decl, spec := cgoImportOf(file)
+	if spec == nil || cgoPreambleOf(decl, spec) != nil {
+		return nil
+	}
+
+	src := token.NewFileSet()
+	f, err := parser.ParseFile(src, fpath, nil, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	d, s := cgoImportOf(f)
+	if s == nil {
+		return nil
+	}
+	preamble := cgoPreambleOf(d, s)
+	if preamble == nil {
+		lg.log("No preamble for cgo in", relpath(fpath))
+		return nil
+	}
+
+	base := fset.File(file.Pos()).Base()
+	restored := &ast.CommentGroup{List: make([]*ast.Comment, 0, len(preamble.List))}
+	for _, c := range preamble.List {
+		pos := token.Pos(base + src.Position(c.Slash).Offset)
+		restored.List = append(restored.List, &ast.Comment{Slash: pos, Text: c.Text})
+	}
+
+	if !decl.Lparen.IsValid() {
+		decl.Doc = restored
+	} else {
+		spec.Doc = restored
+	}
+	file.Comments = append(file.Comments, restored)
+	sort.Slice(file.Comments, func(i, j int) bool {
+		return file.Comments[i].Pos() < file.Comments[j].Pos()
+	})
+
+	lg.log("Restored preamble for cgo in", relpath(fpath))
+	return nil
+}
+
+// isCgoCall returns true when given call expression calls C function like C.f(...).
+func isCgoCall(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	i, ok := sel.X.(*ast.Ident)
+	return ok && i.Name == "C"
+}
+
+// restoreCgoPreambles restores preambles of all cgo files in the package.
+func restoreCgoPreambles(pkg *Package) error {
+	for _, fpath := range sortedFilePaths(pkg.Node.Files) {
+		file := pkg.Node.Files[fpath]
+		if err := restoreCgoPreamble(pkg.Files, fpath, file, pkg.lg); err != nil {
+			return errors.Wrapf(err, "Cannot restore preamble for cgo in %s", fpath)
+		}
+	}
+	return nil
+}
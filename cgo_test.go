@@ -0,0 +1,41 @@
+package trygo
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreCgoPreamble(t *testing.T) {
+	fpath := filepath.Join("testdata", "trans", "ok", "cgo", "src", "ok.go")
+	fset := token.NewFileSet()
+	// Parse without comments. Preamble is lost
+	file, err := parser.ParseFile(fset, fpath, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restoreCgoPreamble(fset, fpath, file, logger{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	have := buf.String()
+
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(b)
+
+	if have != want {
+		t.Fatalf("Preamble was not restored.\nWanted:\n%s\n\nHave:\n%s\n", want, have)
+	}
+}
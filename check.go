@@ -0,0 +1,200 @@
+package trygo
+
+import (
+	"github.com/pkg/errors"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// Diagnostic is a problem in TryGo source found by check.
+type Diagnostic struct {
+	// Pos is a position where the problem was found. It may be invalid when the problem is not related
+	// to any specific position.
+	Pos token.Position
+	// Package is a name of package where the problem was found.
+	Package string
+	// Phase is a phase of check where the problem was found. It is "try() call elimination" or "type check".
+	Phase string
+	// Message is a description of the problem.
+	Message string
+	// Translation is true when the problem was caused by translation of pseudo-function call such as
+	// try(). When false, the problem exists in TryGo source regardless of the translation.
+	Translation bool
+	// Fixes is a list of fixes of the problem which editors can apply to TryGo source. It is empty when
+	// no fix is known for the problem.
+	Fixes []*SuggestedFix
+}
+
+// TextEdit is an edit of TryGo source. Text between Pos and End is replaced with NewText. When Pos and
+// End are the same, NewText is inserted at the position.
+type TextEdit struct {
+	Pos     token.Position
+	End     token.Position
+	NewText string
+}
+
+// SuggestedFix is a fix of a problem found by check. Edits in the fix do not overlap each other.
+type SuggestedFix struct {
+	// Message is a description of the fix such as "Add error to the result list".
+	Message string
+	// Edits is a list of edits to apply. Edits are sorted by their positions.
+	Edits []*TextEdit
+}
+
+func (diag *Diagnostic) Error() string {
+	if !diag.Pos.IsValid() {
+		return diag.Package + ": Error: " + diag.Message
+	}
+	return diag.Pos.String() + ": " + diag.Package + ": Error: " + diag.Message
+}
+
+const (
+	checkPhaseTryCall   = "try() call elimination"
+	checkPhaseTypeCheck = "type check"
+)
+
+// Rules of diagnostics in reports. Diagnostics are classified by their phases.
+const (
+	ruleUntranslatable       = "untranslatable-call"
+	ruleTranslationTypeError = "translation-type-error"
+	ruleTypeError            = "type-error"
+)
+
+// rule returns the ID of rule of the diagnostic in reports such as SARIF.
+func (diag *Diagnostic) rule() string {
+	switch {
+	case diag.Phase == checkPhaseTryCall:
+		return ruleUntranslatable
+	case diag.Translation:
+		return ruleTranslationTypeError
+	default:
+		return ruleTypeError
+	}
+}
+
+// typeDiagnostics type-checks the package and returns all type errors as diagnostics. When no type
+// error was found, types of errors at the translation points are checked. hasOkErr is true when error
+// for ok() is configured. wrap is true when error replacing original error in try() wraps it.
+func typeDiagnostics(pkg *Package, transPts []*transPoint, hasOkErr, wrap bool) []*Diagnostic {
+	lg := pkg.lg
+	diags := []*Diagnostic{}
+	info := newTypeInfo(transPts)
+	cfg := &types.Config{
+		Importer:    pkg.typesImporter(),
+		FakeImportC: true,
+		Error: func(err error) {
+			err = typeErrorAtTrans(err, transPts, info)
+			lg.log(lg.ftl(err))
+			diag := &Diagnostic{Package: pkg.Node.Name, Phase: checkPhaseTypeCheck, Message: err.Error()}
+			if terr, ok := err.(*translationTypeError); ok {
+				err = terr.err
+				diag.Translation = true
+			}
+			if terr, ok := err.(types.Error); ok {
+				diag.Pos = terr.Fset.Position(terr.Pos)
+				diag.Message = terr.Msg
+			}
+			diags = append(diags, diag)
+		},
+	}
+
+	cfg.Check(pkg.Birth, pkg.Files, pkg.fileNodes(), info)
+	if len(diags) > 0 {
+		return diags
+	}
+
+	return transTypeDiagnostics(pkg, transPts, info, hasOkErr, wrap)
+}
+
+// CheckPackages runs all checks against given already parsed packages and returns problems found by
+// the checks as diagnostics. It eliminates try() calls in each package then runs type check against
+// it. Nothing is read from or written to filesystem other than imported packages. AST of given
+// packages is modified by the check. Returning an empty slice means check was OK.
+func (gen *Gen) CheckPackages(pkgs []*Package) []*Diagnostic {
+	lg := gen.lg()
+	lg.log("Check parsed packages:", pkgs)
+	diags := []*Diagnostic{}
+	for _, pkg := range pkgs {
+		pkg.lg = lg
+		pkg.importer = gen.Importer
+		lg.log("Checking packages at", pkg.Birth)
+		tce := &tryCallElimination{
+			pkg:     pkg.Node,
+			fileset: pkg.Files,
+			lg:      lg,
+			strict:  gen.Strict,
+		}
+		walkFiles(tce, pkg.Node)
+		tce.finish()
+		if len(tce.errs) > 0 {
+			// All problems were collected in strict mode
+			diags = append(diags, tce.errs...)
+			continue
+		}
+		if tce.err != nil {
+			diags = append(diags, &Diagnostic{
+				Pos:     tce.errPos,
+				Package: pkg.Node.Name,
+				Phase:   checkPhaseTryCall,
+				Message: tce.errMsg,
+				Fixes:   tce.errFixes,
+			})
+			// Type check is not available since try() calls remain in AST
+			continue
+		}
+		tce.assertPostCondition()
+
+		transPts := []*transPoint{}
+		for _, root := range tce.roots {
+			transPts = append(transPts, root.collectTransPoints()...)
+		}
+		ds := typeDiagnostics(pkg, transPts, gen.OkError != "", gen.WrapReplacedError)
+		lg.log("Check done:", pkg.Birth, "Diagnostics:", lg.hi(len(ds)))
+		diags = append(diags, ds...)
+	}
+
+	sortDiagnostics(diags)
+	return diags
+}
+
+// sortDiagnostics sorts diagnostics by their positions.
+func sortDiagnostics(diags []*Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		l, r := diags[i].Pos, diags[j].Pos
+		if l.Filename != r.Filename {
+			return l.Filename < r.Filename
+		}
+		return l.Offset < r.Offset
+	})
+}
+
+// unifyUntranslatable unifies diagnostics of untranslatable pseudo-function calls found in strict mode
+// into one error.
+func unifyUntranslatable(diags []*Diagnostic) error {
+	msgs := make([]string, 0, len(diags))
+	for _, diag := range diags {
+		msgs = append(msgs, diag.Error())
+	}
+	return errors.Errorf("%d untranslatable pseudo-function call(s) were found:\n  %s", len(diags), strings.Join(msgs, "\n  "))
+}
+
+// transTypeDiagnostics checks types at all the translation points and returns problems as diagnostics.
+// hasOkErr is true when error for ok() is configured. wrap is true when error replacing original error
+// in try() wraps it.
+func transTypeDiagnostics(pkg *Package, transPts []*transPoint, info *types.Info, hasOkErr, wrap bool) []*Diagnostic {
+	diags := []*Diagnostic{}
+	for _, trans := range transPts {
+		if msg := checkTransTypes(trans, info, hasOkErr, wrap); msg != "" {
+			diags = append(diags, &Diagnostic{
+				Pos:         pkg.Files.Position(trans.pos),
+				Package:     pkg.Node.Name,
+				Phase:       checkPhaseTypeCheck,
+				Message:     msg,
+				Translation: true,
+			})
+		}
+	}
+	return diags
+}
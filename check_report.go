@@ -0,0 +1,194 @@
+package trygo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// checkResult is a result of check of one package.
+type checkResult struct {
+	pkg   *Package
+	diags []*Diagnostic
+}
+
+// reportWriters maps formats of reports to functions to write the reports.
+var reportWriters = map[string]func(io.Writer, []*checkResult) error{
+	"sarif":      writeSARIFReport,
+	"checkstyle": writeCheckstyleReport,
+	"junit":      writeJUnitReport,
+	"github":     writeGitHubReport,
+}
+
+// reportPath returns the path relative to the current directory with slashes. It returns false when the
+// path is outside the current directory.
+func reportPath(path string) (string, bool) {
+	rel, err := filepath.Rel(cwd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(path), false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func writeSARIFReport(w io.Writer, results []*checkResult) error {
+	diags := []*Diagnostic{}
+	for _, r := range results {
+		diags = append(diags, r.diags...)
+	}
+	return WriteSARIF(w, diags)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Checkstyle XML report. Diagnostics are grouped by files. Diagnostics without position are put in a
+// file element with empty name.
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+type checkstyleFile struct {
+	Name   string             `xml:"name,attr"`
+	Errors []*checkstyleError `xml:"error"`
+}
+
+type checkstyleReport struct {
+	XMLName xml.Name          `xml:"checkstyle"`
+	Version string            `xml:"version,attr"`
+	Files   []*checkstyleFile `xml:"file"`
+}
+
+func writeCheckstyleReport(w io.Writer, results []*checkResult) error {
+	report := &checkstyleReport{Version: "4.3", Files: []*checkstyleFile{}}
+	files := map[string]*checkstyleFile{}
+	for _, r := range results {
+		for _, d := range r.diags {
+			name := ""
+			if d.Pos.IsValid() {
+				name, _ = reportPath(d.Pos.Filename)
+			}
+			f, ok := files[name]
+			if !ok {
+				f = &checkstyleFile{Name: name}
+				files[name] = f
+				report.Files = append(report.Files, f)
+			}
+			f.Errors = append(f.Errors, &checkstyleError{
+				Line:     d.Pos.Line,
+				Column:   d.Pos.Column,
+				Severity: "error",
+				Message:  d.Message,
+				Source:   "trygo." + d.rule(),
+			})
+		}
+	}
+	return writeXML(w, report)
+}
+
+// JUnit XML report. Each package is a test case which fails when some problem was found in it.
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitReport struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+func writeJUnitReport(w io.Writer, results []*checkResult) error {
+	suite := &junitTestSuite{Name: "trygo check", Tests: len(results), TestCases: []*junitTestCase{}}
+	for _, r := range results {
+		path, _ := reportPath(r.pkg.Birth)
+		c := &junitTestCase{Name: path, ClassName: r.pkg.Node.Name}
+		if len(r.diags) > 0 {
+			msgs := make([]string, 0, len(r.diags))
+			for _, d := range r.diags {
+				msg := d.Message
+				if d.Pos.IsValid() {
+					file, _ := reportPath(d.Pos.Filename)
+					msg = fmt.Sprintf("%s:%d:%d: %s", file, d.Pos.Line, d.Pos.Column, msg)
+				}
+				msgs = append(msgs, msg)
+			}
+			c.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d problem(s) were found", len(r.diags)),
+				Type:    "check",
+				Text:    strings.Join(msgs, "\n"),
+			}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, c)
+	}
+	report := &junitReport{
+		Name:     "trygo",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []*junitTestSuite{suite},
+	}
+	return writeXML(w, report)
+}
+
+// GitHub Actions workflow commands. Each diagnostic is output as `::error` command so that it is shown as
+// an annotation on the source in pull requests.
+// https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions
+
+var (
+	githubDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+func writeGitHubReport(w io.Writer, results []*checkResult) error {
+	for _, r := range results {
+		for _, d := range r.diags {
+			props := []string{"title=" + githubPropertyEscaper.Replace("trygo ("+d.rule()+")")}
+			if d.Pos.IsValid() {
+				file, _ := reportPath(d.Pos.Filename)
+				props = append(props,
+					"file="+githubPropertyEscaper.Replace(file),
+					fmt.Sprintf("line=%d", d.Pos.Line),
+					fmt.Sprintf("col=%d", d.Pos.Column),
+				)
+			}
+			if _, err := fmt.Fprintf(w, "::error %s::%s\n", strings.Join(props, ","), githubDataEscaper.Replace(d.Message)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+//go:build js && wasm
+// +build js,wasm
+
+// trygo-wasm exports TryGo translation to JavaScript for in-browser playground. It is built with
+// GOOS=js GOARCH=wasm and defines global trygoTranslate(source) function which returns an object
+// {code: string, errors: string[]}. Since imports cannot be resolved in browser, the source is
+// translated without type check in standalone mode.
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rhysd/trygo"
+	"go/scanner"
+	"io/ioutil"
+	"syscall/js"
+)
+
+func translate(src string) map[string]interface{} {
+	gen := &trygo.Gen{
+		Out:         ioutil.Discard,
+		Warn:        ioutil.Discard,
+		NoTypeCheck: true,
+	}
+	code, err := gen.TranslateFile("prog.go", []byte(src))
+	errs := []interface{}{}
+	if err != nil {
+		if list, ok := errors.Cause(err).(scanner.ErrorList); ok {
+			for _, e := range list {
+				errs = append(errs, e.Error())
+			}
+		} else {
+			errs = append(errs, err.Error())
+		}
+	}
+	return map[string]interface{}{
+		"code":   string(code),
+		"errors": errs,
+	}
+}
+
+func main() {
+	f := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 1 || args[0].Type() != js.TypeString {
+			return map[string]interface{}{
+				"code":   "",
+				"errors": []interface{}{"trygoTranslate() takes one string argument"},
+			}
+		}
+		return translate(args[0].String())
+	})
+	defer f.Release()
+	js.Global().Set("trygoTranslate", f)
+	select {} // Keep running to serve calls from JavaScript
+}
@@ -6,21 +6,184 @@ import (
 	"github.com/fatih/color"
 	"github.com/mattn/go-colorable"
 	"github.com/rhysd/trygo"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
-const usageHeader = `Usage: trygo [flags] {dirs...}
+const usageHeader = `Usage: trygo [flags] {paths...}
+       trygo test [flags] {paths...} [-- {go test args...}]
+       trygo build [flags] {paths...} [-- {go build args...}]
+       trygo serve [-http {addr}] [-debug]
+       trygo daemon [-debug]
+       trygo clean -cache
 
   trygo is a translator from TryGo sources into Go sources. Directory
+  paths or Go file paths can be given. When a file path is given, only
+  the file is translated within its package.
+
+  'trygo test' translates TryGo packages into a temporary directory and
+  runs 'go test' for them. Positions in the output are mapped back to
+  TryGo sources.
+
+  'trygo build' translates TryGo packages into a temporary directory and
+  runs 'go build' for them. Built executables are copied to the
+  directory given by -o (default: current directory).
+
+  'trygo serve' runs an HTTP server for web playground. POST request
+  with JSON {"source": "..."} returns translated Go source and
+  diagnostics as JSON.
+
+  'trygo daemon' runs a daemon for editor integration. It speaks
+  JSON-RPC 2.0 via stdin and stdout. Methods are 'translate', 'check'
+  and 'shutdown'.
+
+  'trygo clean -cache' removes all translation results cached by -cache.
 
 Flags:`
 
 var (
 	outDir = flag.String("o", "", "Output directory path")
 	check  = flag.Bool("c", false, "Check only")
+	format = flag.String("format", "text", "Output format of check with -c. \"text\", \"sarif\" (SARIF 2.1.0 log for code scanning), \"checkstyle\" (checkstyle XML), \"junit\" (JUnit XML) or \"github\" (GitHub Actions annotations)")
 	debug  = flag.Bool("debug", false, "Output debug log")
+	golist = flag.Bool("golist", false, "Discover packages with 'go list' so that build constraints and patterns like ./... are handled as the go tool does")
+	follow = flag.Bool("follow-symlinks", false, "Follow symbolic links while collecting packages")
+	gofile = flag.Bool("gofile-only", false, "Generate only $GOFILE when run from `go generate`")
+	quiet  = flag.Bool("q", false, "Quiet mode. Do not output paths of generated packages")
+	manif  = flag.String("manifest", "", "File path to write JSON manifest of generated files")
+	flat   = flag.Bool("flatten", false, "Write all generated files directly in output directory")
+	outTpl = flag.String("out-path", "", "Template of generated file paths with {outdir}, {relpkg}, {pkgdir}, {pkgname} and {filename} (e.g. {pkgdir}/gen/{filename})")
+	dualBd = flag.Bool("dual-build", false, "Write generated files next to sources tagged with '//go:build trygo'. Output directory is not necessary")
+	rdeps  = flag.Bool("reverse-deps", false, "Warn packages which are not translated but import translated packages")
+	assets = flag.Bool("copy-assets", false, "Copy non-source files such as testdata to output directories")
+	build  = flag.Bool("build", false, "Run `go build ./...` in output directory after generation")
+	okErr  = flag.String("ok-error", "", "Go expression of error returned when ok() gets false (e.g. ErrNotFound). When empty, ok() returns zero values")
+	nfErr  = flag.String("not-found-error", "", "Go expression of error returned when try() takes map index and the key is not found")
+	clsErr = flag.String("closed-error", "", "Go expression of error returned when try() takes channel receive and the channel is closed (e.g. io.EOF)")
+	expHdl = flag.String("expect-handler", "", "Go expression of function called with error caught by expect() (e.g. metrics.ReportError). When empty, the error is logged")
+	wrapEr = flag.Bool("wrap-replaced-error", false, "Wrap original error with error passed to try() as second argument like try(f(), ErrFoo)")
+	prefl  = flag.Bool("preflight", false, "Type-check TryGo source before translation to report type errors in the source clearly")
+	keepGo = flag.Bool("keep-going", false, "Continue translating other packages when some packages failed")
+	strict = flag.Bool("strict", false, "Report all untranslatable try() calls with reasons instead of stopping at the first one")
+	emtAST = flag.String("emit-ast", "", "Directory path to dump AST before phase-1, after phase-1 and after phase-2 for debugging")
+	dmpBlk = flag.String("dump-blocks", "", "Directory path to dump Graphviz DOT graph of blocks and translation points for debugging")
+	emtPh1 = flag.String("emit-phase1", "", "Directory path to write source after try() elimination and before nil check insertion for debugging")
+	rthelp = flag.Bool("runtime-helpers", false, "Generate shorter code using helpers in github.com/rhysd/trygo/trygoruntime package")
+	notych = flag.Bool("no-typecheck", false, "Skip type check for low latency. Generated code may not compile when types cannot be guessed")
+	stdaln = flag.Bool("standalone", false, "Translate each given file alone without resolving imports and output it to stdout (best-effort)")
+	timing = flag.Bool("trace-timings", false, "Output elapsed times of phases (parse, phase-1, typecheck, phase-2, write) of each package to stderr")
+	expln  = flag.Bool("explain", false, "Output position, kind and generated code of each translated try() call")
+	onsave = flag.Bool("on-save", false, "Editor on-save hook mode. Generate given file silently and output only terse diagnostics on failure")
+	staged = flag.Bool("staged", false, "Process only packages containing Go files staged in git for pre-commit hooks. Paths must not be given")
+	since  = flag.String("since", "", "Process only packages containing Go files changed since the git ref and packages depending on them for incremental CI. Paths must not be given")
+	batchN = flag.Int("batch", 0, "Generate packages in batches of the number of package directories to keep memory bounded on large inputs. 0 means all at once")
+	cached = flag.Bool("cache", false, "Cache translation results in user's cache directory and reuse them while sources are unchanged. Remove them by 'trygo clean -cache'")
+	naming = flag.String("name", "", "Template of generated file names. {name} is replaced with source file name without .go (e.g. {name}_trygo.go)")
+)
+
+type importMapFlag map[string]string
+
+func (m importMapFlag) String() string {
+	ss := make([]string, 0, len(m))
+	for k, v := range m {
+		ss = append(ss, k+"="+v)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
+
+func (m importMapFlag) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return fmt.Errorf("-importmap must be in form of old/prefix=new/prefix but got %q", v)
+	}
+	m[kv[0]] = kv[1]
+	return nil
+}
+
+var importMap = importMapFlag{}
+
+func init() {
+	flag.Var(importMap, "importmap", "Map import path prefix of translated packages to new prefix in form of old/prefix=new/prefix (can be repeated)")
+}
+
+type importRewritesFlag []trygo.ImportRewrite
+
+func (rs *importRewritesFlag) String() string {
+	ss := make([]string, 0, len(*rs))
+	for _, r := range *rs {
+		ss = append(ss, r.From+"="+r.To)
+	}
+	return strings.Join(ss, ",")
+}
+
+func (rs *importRewritesFlag) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return fmt.Errorf("-rewrite-import must be in form of from/path=to/path but got %q", v)
+	}
+	*rs = append(*rs, trygo.ImportRewrite{From: kv[0], To: kv[1]})
+	return nil
+}
+
+var importRewrites importRewritesFlag
+
+func init() {
+	flag.Var(&importRewrites, "rewrite-import", "Rewrite import path in generated files in form of from/path=to/path (can be repeated)")
+}
+
+type pluginsFlag []string
+
+func (ps *pluginsFlag) String() string {
+	return strings.Join(*ps, ",")
+}
+
+func (ps *pluginsFlag) Set(v string) error {
+	*ps = append(*ps, v)
+	return nil
+}
+
+var plugins pluginsFlag
+
+func init() {
+	flag.Var(&plugins, "plugin", "Path to Go plugin which rewrites AST between try() elimination and nil check insertion (can be repeated)")
+}
+
+type hooksFlag []trygo.Hook
+
+func (hs *hooksFlag) String() string {
+	ss := make([]string, 0, len(*hs))
+	for _, h := range *hs {
+		ss = append(ss, h.String())
+	}
+	return strings.Join(ss, ",")
+}
+
+func (hs *hooksFlag) Set(v string) error {
+	cmd := strings.Fields(v)
+	if len(cmd) == 0 {
+		return fmt.Errorf("Hook command must not be empty")
+	}
+	*hs = append(*hs, trygo.Hook{Command: cmd})
+	return nil
+}
+
+var (
+	preHooks  hooksFlag
+	postHooks hooksFlag
+	hookStdin = flag.Bool("hook-stdin", false, "Pass paths of generated files to hooks via stdin instead of arguments")
 )
 
+func init() {
+	flag.Var(&preHooks, "pre-hook", "Command run before writing generated files. Paths of the files are passed (can be repeated)")
+	flag.Var(&postHooks, "post-hook", "Command run after writing generated files. Paths of the files are passed (can be repeated)")
+}
+
 func exit(err error) {
 	if err != nil {
 		fmt.Fprintln(colorable.NewColorableStderr(), color.RedString("trygo: error:"), err)
@@ -29,29 +192,301 @@ func exit(err error) {
 	os.Exit(0)
 }
 
+// gitPaths returns package directories of Go files staged in git for -staged or changed since the ref
+// for -since. It exits successfully when no Go file was changed since there is nothing to do.
+func gitPaths(gen *trygo.Gen, args []string) []string {
+	if *staged && *since != "" {
+		exit(fmt.Errorf("-staged and -since cannot be used together"))
+	}
+	if len(args) > 0 {
+		exit(fmt.Errorf("-staged and -since do not take paths but got %q", args))
+	}
+	var paths []string
+	var err error
+	if *staged {
+		paths, err = gen.StagedPaths(".")
+	} else {
+		paths, err = gen.ChangedPaths(".", *since)
+	}
+	if err != nil {
+		exit(err)
+	}
+	if len(paths) == 0 {
+		os.Exit(0)
+	}
+	return paths
+}
+
+func logger(debug bool) trygo.Logger {
+	if !debug {
+		return nil
+	}
+	return trygo.NewLogger(os.Stderr)
+}
+
 func usage() {
 	fmt.Fprintln(os.Stderr, usageHeader)
 	flag.PrintDefaults()
 }
 
+func runTest(args []string) {
+	testArgs := []string{}
+	for i, a := range args {
+		if a == "--" {
+			args, testArgs = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	fs.Usage = usage
+	debug := fs.Bool("debug", false, "Output debug log")
+	follow := fs.Bool("follow-symlinks", false, "Follow symbolic links while collecting packages")
+	fs.Parse(args)
+
+	gen := &trygo.Gen{Out: os.Stdout, FollowSymlinks: *follow, Logger: logger(*debug)}
+	exit(gen.Test(fs.Args(), testArgs))
+}
+
+func runBuild(args []string) {
+	buildArgs := []string{}
+	for i, a := range args {
+		if a == "--" {
+			args, buildArgs = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	fs.Usage = usage
+	binDir := fs.String("o", "", "Directory to put built executables")
+	debug := fs.Bool("debug", false, "Output debug log")
+	follow := fs.Bool("follow-symlinks", false, "Follow symbolic links while collecting packages")
+	fs.Parse(args)
+
+	gen := &trygo.Gen{Out: os.Stdout, FollowSymlinks: *follow, Logger: logger(*debug)}
+	exit(gen.GoBuild(fs.Args(), buildArgs, *binDir))
+}
+
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = usage
+	addr := fs.String("http", ":8080", "Address to listen for HTTP requests")
+	debug := fs.Bool("debug", false, "Output debug log")
+	fs.Parse(args)
+
+	gen := &trygo.Gen{Logger: logger(*debug)}
+	fmt.Fprintln(os.Stderr, "Serving playground at", *addr)
+	exit(http.ListenAndServe(*addr, gen.PlaygroundHandler()))
+}
+
+func runDaemon(args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	fs.Usage = usage
+	debug := fs.Bool("debug", false, "Output debug log")
+	fs.Parse(args)
+
+	gen := &trygo.Gen{Logger: logger(*debug)}
+	exit(gen.Daemon(os.Stdin, os.Stdout))
+}
+
+func runClean(args []string) {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	fs.Usage = usage
+	cache := fs.Bool("cache", false, "Remove all cached translation results")
+	fs.Parse(args)
+
+	if !*cache {
+		exit(fmt.Errorf("Nothing to clean. Specify -cache to remove cached translation results"))
+	}
+	dir, err := trygo.DefaultCacheDir()
+	if err != nil {
+		exit(err)
+	}
+	exit(trygo.CleanCache(dir))
+}
+
+func translateStandalone(gen *trygo.Gen, paths []string) error {
+	for _, p := range paths {
+		src, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		out, err := gen.TranslateFile(p, src)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stdout.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onSave generates the saved file and writes diagnostics in the file to w one per line on failure so that
+// editors can parse them. Diagnostics in other files are not written. It returns whether the generation
+// succeeded.
+func onSave(gen *trygo.Gen, path string, w io.Writer) bool {
+	gen.Quiet = true
+	gen.Out = ioutil.Discard
+	gen.Warn = ioutil.Discard
+
+	err := gen.Generate([]string{path}, false)
+	if err == nil {
+		return true
+	}
+
+	// Collect diagnostics from check since the error is not structured
+	var diags []*trygo.Diagnostic
+	if dirs, derr := gen.PackageDirs([]string{path}); derr == nil {
+		if pkgs, perr := gen.ParsePackages(dirs); perr == nil {
+			saved, _ := filepath.Abs(path)
+			for _, d := range gen.CheckPackages(pkgs) {
+				if d.Pos.IsValid() && d.Pos.Filename == saved {
+					diags = append(diags, d)
+				}
+			}
+		}
+	}
+	if len(diags) == 0 {
+		fmt.Fprintln(w, err)
+	}
+	for _, d := range diags {
+		fmt.Fprintf(w, "%s: %s\n", d.Pos, d.Message)
+	}
+	return false
+}
+
+// generateOnSave generates the file saved in editor. Nothing is output on success. On failure, diagnostics
+// in the file are output one per line.
+func generateOnSave(gen *trygo.Gen, paths []string) {
+	if len(paths) != 1 || !strings.HasSuffix(paths[0], ".go") {
+		fmt.Fprintln(os.Stderr, "trygo: -on-save takes exactly one Go file path")
+		os.Exit(2)
+	}
+	if !onSave(gen, paths[0], os.Stderr) {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		runTest(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		runBuild(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		runDaemon(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "clean" {
+		runClean(os.Args[2:])
+		return
+	}
+
 	flag.Usage = usage
 	flag.Parse()
 
-	trygo.InitLog(*debug)
-
 	if *check {
 		// Do not use trygo.NewGen() since output directory check is not necessary
-		gen := &trygo.Gen{Writer: os.Stdout}
-		exit(gen.Check(flag.Args()))
+		gen := &trygo.Gen{Out: os.Stdout, FollowSymlinks: *follow, Logger: logger(*debug), Strict: *strict, GoList: *golist}
+		paths := flag.Args()
+		if *staged || *since != "" {
+			paths = gitPaths(gen, paths)
+		}
+		if *format == "text" {
+			exit(gen.Check(paths))
+		}
+		exit(gen.CheckReport(paths, *format, os.Stdout))
+	}
+
+	if *stdaln {
+		// Output directory is not necessary since translated sources are output to stdout
+		gen := &trygo.Gen{
+			Logger:            logger(*debug),
+			OkError:           *okErr,
+			NotFoundError:     *nfErr,
+			ClosedError:       *clsErr,
+			ExpectHandler:     *expHdl,
+			WrapReplacedError: *wrapEr,
+			Strict:            *strict,
+			NoTypeCheck:       *notych,
+			RuntimeHelpers:    *rthelp,
+		}
+		exit(translateStandalone(gen, flag.Args()))
 	}
 
-	gen, err := trygo.NewGen(*outDir)
+	dir := *outDir
+	if *dualBd && dir == "" {
+		// Generated files are put next to sources
+		dir = "."
+	}
+	gen, err := trygo.NewGen(dir)
 	if err != nil {
 		exit(err)
 	}
+	gen.Logger = logger(*debug)
+	gen.FollowSymlinks = *follow
+	gen.GoList = *golist
+	gen.BatchSize = *batchN
+	gen.GoGenerateFileOnly = *gofile
+	gen.Quiet = *quiet
+	gen.ManifestPath = *manif
+	gen.FileNameTemplate = *naming
+	gen.Flatten = *flat
+	gen.OutPathTemplate = *outTpl
+	gen.DualBuild = *dualBd
+	gen.CheckReverseDeps = *rdeps
+	gen.CopyAssets = *assets
+	gen.Build = *build
+	gen.OkError = *okErr
+	gen.NotFoundError = *nfErr
+	gen.ClosedError = *clsErr
+	gen.ExpectHandler = *expHdl
+	gen.WrapReplacedError = *wrapEr
+	gen.PreflightTypeCheck = *prefl
+	gen.KeepGoing = *keepGo
+	gen.Strict = *strict
+	gen.Explain = *expln
+	gen.NoTypeCheck = *notych
+	gen.RuntimeHelpers = *rthelp
+	gen.EmitASTDir = *emtAST
+	gen.DumpBlocksDir = *dmpBlk
+	gen.EmitPhase1Dir = *emtPh1
+	gen.TraceTimings = *timing
+	gen.ImportMap = importMap
+	gen.ImportRewrites = importRewrites
+	if *cached {
+		if gen.CacheDir, err = trygo.DefaultCacheDir(); err != nil {
+			exit(err)
+		}
+	}
+	for _, hs := range []hooksFlag{preHooks, postHooks} {
+		for i := range hs {
+			hs[i].Stdin = *hookStdin
+		}
+	}
+	gen.Plugins = plugins
+	gen.PreHooks = preHooks
+	gen.PostHooks = postHooks
 
-	if err := gen.Generate(flag.Args(), *debug); err != nil {
+	if *onsave {
+		generateOnSave(gen, flag.Args())
+	}
+
+	paths := flag.Args()
+	if *staged || *since != "" {
+		paths = gitPaths(gen, paths)
+	}
+	if err := gen.Generate(paths, *debug); err != nil {
 		exit(err)
 	}
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"github.com/rhysd/trygo"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOnSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trygo-on-save-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) string {
+		p := filepath.Join(root, "src", name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	write("go.mod", "module example.com/onsave\n")
+	saved := write("a.go", "package onsave\n\nimport \"os\"\n\nfunc Rm() error {\n\ttry(os.Remove(\"a\"))\n\treturn nil\n}\n")
+	other := write("b.go", "package onsave\n\nfunc B() int {\n\treturn 1\n}\n")
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if !onSave(gen, saved, &buf) {
+		t.Fatal("Generation should succeed:", buf.String())
+	}
+	if buf.Len() != 0 {
+		t.Fatal("Nothing should be output on success:", buf.String())
+	}
+
+	// Both files have type errors but only the error in the saved file is output
+	write("a.go", "package onsave\n\nimport \"os\"\n\nfunc Rm() error {\n\ttry(os.Remove(\"a\"))\n\tvar i int = \"a\"\n\t_ = i\n\treturn nil\n}\n")
+	write("b.go", "package onsave\n\nfunc B() int {\n\treturn \"b\"\n}\n")
+	buf.Reset()
+	if onSave(gen, saved, &buf) {
+		t.Fatal("Generation should fail")
+	}
+	out := buf.String()
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Only one diagnostic should be output: %q", out)
+	}
+	if want := saved + ":7:14: "; !strings.HasPrefix(lines[0], want) {
+		t.Fatalf("Diagnostic should start with %q: %q", want, lines[0])
+	}
+	if strings.Contains(out, other) {
+		t.Fatalf("Diagnostic in other file should not be output: %q", out)
+	}
+}
@@ -2,7 +2,9 @@ package trygo_test
 
 import (
 	"github.com/rhysd/trygo"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -35,3 +37,43 @@ func skipOnCI(t *testing.T) {
 		t.Skip("because this test case cannot be run on CI")
 	}
 }
+
+// writeFiles writes the files under the root directory. Keys of files are slash-separated paths relative
+// to the root and values are their contents. Parent directories are created as needed.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for path, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeTree creates a temporary directory and writes the files in it. The directory should be removed
+// by the caller.
+func writeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "trygo-tree-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	writeFiles(t, root, files)
+	return root
+}
+
+// moduleFiles returns files of a module where package user calls a function of package lib which uses
+// try().
+func moduleFiles() map[string]string {
+	return map[string]string{
+		"go.mod":       "module example.com/mod\n",
+		"lib/lib.go":   "package lib\n\nimport \"os\"\n\nfunc Mkdir() error {\n\ttry(os.Mkdir(\"lib\", 0755))\n\treturn nil\n}\n",
+		"user/user.go": "package user\n\nimport \"example.com/mod/lib\"\n\nfunc Run() error {\n\treturn lib.Mkdir()\n}\n",
+	}
+}
@@ -0,0 +1,117 @@
+package trygo
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Companion files are non-Go source files in a package directory which are inputs of `go build` such as
+// assembly, C sources or object files. Translated package cannot be built without them so they are
+// copied to the output package directory as-is.
+
+var companionExts = map[string]struct{}{
+	".c":       {},
+	".h":       {},
+	".cc":      {},
+	".cpp":     {},
+	".cxx":     {},
+	".hh":      {},
+	".hpp":     {},
+	".hxx":     {},
+	".m":       {},
+	".s":       {},
+	".S":       {},
+	".sx":      {},
+	".f":       {},
+	".F":       {},
+	".for":     {},
+	".f90":     {},
+	".swig":    {},
+	".swigcxx": {},
+	".syso":    {},
+}
+
+// companionFiles returns sorted paths of companion files in given package directory.
+func companionFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot read package directory %s", dir)
+	}
+	paths := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if _, ok := companionExts[filepath.Ext(e.Name())]; ok {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// copyFile copies the file at src to dst keeping its permission.
+func copyFile(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot open file to copy: %s", src)
+	}
+	defer r.Close()
+
+	info, err := r.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "Cannot stat file to copy: %s", src)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return errors.Wrapf(err, "Cannot create file to copy: %s", dst)
+	}
+	defer w.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return errors.Wrapf(err, "Cannot copy file %s to %s", src, dst)
+	}
+	return nil
+}
+
+// copyCompanionFiles copies companion files of given packages into their output directories.
+func (gen *Gen) copyCompanionFiles(pkgs []*Package) error {
+	copied := map[string]string{}
+	done := map[string]struct{}{}
+	for _, pkg := range pkgs {
+		// Packages in the same directory (e.g. foo and foo_test) share companion files
+		if _, ok := done[pkg.Birth]; ok {
+			continue
+		}
+		done[pkg.Birth] = struct{}{}
+		if pkg.Path == pkg.Birth {
+			continue // Generated next to sources in dual-build layout
+		}
+
+		srcs, err := companionFiles(pkg.Birth)
+		if err != nil {
+			return err
+		}
+		for _, src := range srcs {
+			dst := filepath.Join(pkg.Path, filepath.Base(src))
+			if prev, ok := copied[dst]; ok {
+				return errors.Errorf("Companion file %s cannot be copied to %s since %s was already copied to the path", src, dst, prev)
+			}
+			gen.lg().log("Copy companion file", relpath(src), "->", relpath(dst))
+			if err := copyFile(src, dst); err != nil {
+				return err
+			}
+			copied[dst] = src
+		}
+	}
+	return nil
+}
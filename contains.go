@@ -0,0 +1,70 @@
+package trygo
+
+import (
+	"bytes"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+)
+
+// ContainsTry returns true when the file contains a call of pseudo-function such as try(). It only walks
+// AST without type check, so it is cheap enough to decide whether the file needs translation before
+// running the translation. Since pseudo-function names may be declared in other files of the same package,
+// calls to them may be reported though they are not pseudo-functions.
+func ContainsTry(file *ast.File) bool {
+	found := false
+	ast.Inspect(file, func(node ast.Node) bool {
+		if found {
+			return false
+		}
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := call.Fun.(*ast.Ident)
+		if !ok || !isPseudoFuncName(ident.Name) {
+			return true
+		}
+		found = ident.Obj == nil && (file.Scope == nil || file.Scope.Lookup(ident.Name) == nil)
+		return !found
+	})
+	return found
+}
+
+// ContainsTrySource is the same as ContainsTry but checks source of a file without parsing it. Tokens in
+// the source are scanned and an identifier of pseudo-function followed by '(' is looked for. Since names
+// are not resolved, it may return true for source which calls functions declared with the same names
+// as pseudo-functions, but it never returns false for source which needs translation.
+func ContainsTrySource(src []byte) bool {
+	names := [][]byte{[]byte("try"), []byte("ok"), []byte("expect"), []byte("tryOr"), []byte("throw")}
+	maybe := false
+	for _, n := range names {
+		if bytes.Contains(src, n) {
+			maybe = true
+			break
+		}
+	}
+	if !maybe {
+		return false
+	}
+
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, 0)
+	prev, ident := token.ILLEGAL, ""
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return false
+		}
+		if tok == token.LPAREN && ident != "" {
+			return true
+		}
+		ident = ""
+		// Method calls like x.try() and declarations like func try() are not pseudo-function calls
+		if tok == token.IDENT && isPseudoFuncName(lit) && prev != token.PERIOD && prev != token.FUNC {
+			ident = lit
+		}
+		prev = tok
+	}
+}
@@ -0,0 +1,236 @@
+package trygo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// JSON-RPC error codes
+const (
+	rpcCodeParseError     = -32700
+	rpcCodeInvalidRequest = -32600
+	rpcCodeMethodNotFound = -32601
+	rpcCodeInvalidParams  = -32602
+	rpcCodeFailed         = -32000
+)
+
+type rpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// DaemonFileParams is parameters of "translate" and "check" methods of daemon.
+type DaemonFileParams struct {
+	// Path is a path to TryGo source file. Other files in the same directory are parsed as the same
+	// package.
+	Path string `json:"path"`
+	// Source is content of the file. It is useful to send unsaved buffer of editor. When nil, the file
+	// is read from filesystem.
+	Source *string `json:"source,omitempty"`
+}
+
+// DaemonTranslateResult is a result of "translate" method of daemon.
+type DaemonTranslateResult struct {
+	// Code is translated Go source of the file.
+	Code string `json:"code"`
+	// Warnings is a list of warnings found while translating the package.
+	Warnings []*Warning `json:"warnings"`
+}
+
+// DaemonCheckResult is a result of "check" method of daemon.
+type DaemonCheckResult struct {
+	// Diagnostics is a list of problems found in the package. It is empty when check was OK.
+	Diagnostics []*Diagnostic `json:"diagnostics"`
+}
+
+type daemon struct {
+	gen Gen
+	out *json.Encoder
+}
+
+// parsePackageOf parses the package containing the file. Content of the file is replaced with source
+// when it is not nil.
+func (d *daemon) parsePackageOf(params *DaemonFileParams) (*Package, string, error) {
+	path, err := filepath.Abs(params.Path)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "Cannot resolve file path %q", params.Path)
+	}
+	dir, base := filepath.Split(path)
+	dir = filepath.Clean(dir)
+
+	fset := token.NewFileSet()
+	var src interface{}
+	if params.Source != nil {
+		src = *params.Source
+	}
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "Cannot parse %s", path)
+	}
+
+	// Parse other files of the package. The file itself is replaced with the given source
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return fi.Name() != base
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "Cannot parse package directory %s", dir)
+	}
+	name := file.Name.Name
+	node, ok := pkgs[name]
+	if !ok {
+		node = &ast.Package{Name: name, Files: map[string]*ast.File{}}
+	}
+	node.Files[path] = file
+
+	pkg := NewPackage(node, dir, dir, fset)
+	pkg.lg = d.gen.lg()
+	return pkg, path, nil
+}
+
+func (d *daemon) translate(params *DaemonFileParams) (interface{}, error) {
+	pkg, path, err := d.parsePackageOf(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.gen.translate([]*Package{pkg}); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := pkg.writeGo(&buf, pkg.Node.Files[path]); err != nil {
+		return nil, err
+	}
+	return &DaemonTranslateResult{buf.String(), pkg.Warnings()}, nil
+}
+
+func (d *daemon) check(params *DaemonFileParams) (interface{}, error) {
+	pkg, _, err := d.parsePackageOf(params)
+	if err != nil {
+		return nil, err
+	}
+	return &DaemonCheckResult{d.gen.CheckPackages([]*Package{pkg})}, nil
+}
+
+func (d *daemon) respond(id json.RawMessage, result interface{}, code int, msg string) error {
+	if len(id) == 0 {
+		return nil // Notification does not need a response
+	}
+	res := &rpcResponse{Version: "2.0", ID: id}
+	if msg != "" {
+		res.Error = &rpcError{code, msg}
+	} else {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return errors.Wrap(err, "Cannot encode result of JSON-RPC")
+		}
+		res.Result = b
+	}
+	if err := d.out.Encode(res); err != nil {
+		return errors.Wrap(err, "Cannot write JSON-RPC response")
+	}
+	return nil
+}
+
+// call calls the handler of the request. A panic due to internal error such as broken translated AST is
+// returned as an error so that one bad request does not bring down the daemon.
+func (d *daemon) call(handler func(*DaemonFileParams) (interface{}, error), params *DaemonFileParams) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, errors.Errorf("Internal error while handling request for %s: %v", params.Path, r)
+		}
+	}()
+	return handler(params)
+}
+
+// handle handles one JSON-RPC request and returns true when the daemon should shut down.
+func (d *daemon) handle(line []byte) (bool, error) {
+	lg := d.gen.lg()
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return false, d.respond(json.RawMessage("null"), nil, rpcCodeParseError, "Cannot parse JSON-RPC request: "+err.Error())
+	}
+	lg.log("Daemon request:", lg.hi(req.Method))
+	if req.Version != "2.0" {
+		return false, d.respond(req.ID, nil, rpcCodeInvalidRequest, "JSON-RPC version must be 2.0")
+	}
+
+	var handler func(*DaemonFileParams) (interface{}, error)
+	switch req.Method {
+	case "translate":
+		handler = d.translate
+	case "check":
+		handler = d.check
+	case "shutdown":
+		return true, d.respond(req.ID, nil, 0, "")
+	default:
+		return false, d.respond(req.ID, nil, rpcCodeMethodNotFound, "Unknown method: "+req.Method)
+	}
+
+	var params DaemonFileParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.Path == "" {
+		return false, d.respond(req.ID, nil, rpcCodeInvalidParams, "Params must be an object with \"path\" field")
+	}
+	result, err := d.call(handler, &params)
+	if err != nil {
+		lg.log(lg.ftl(err))
+		return false, d.respond(req.ID, nil, rpcCodeFailed, err.Error())
+	}
+	return false, d.respond(req.ID, result, 0, "")
+}
+
+// Daemon runs a long-running daemon for editor integration. It reads JSON-RPC 2.0 requests from the
+// reader and writes responses to the writer. Each message is one line of JSON. Supported methods are
+// "translate" (params: DaemonFileParams, result: DaemonTranslateResult), "check" (params:
+// DaemonFileParams, result: DaemonCheckResult) and "shutdown". Imported packages are cached between
+// requests to respond quickly, so the daemon should be restarted when dependencies were changed.
+// It returns when "shutdown" was requested or the reader reached EOF.
+func (gen *Gen) Daemon(in io.Reader, out io.Writer) error {
+	d := &daemon{gen: *gen, out: json.NewEncoder(out)}
+	if d.gen.Importer == nil {
+		d.gen.Importer = importer.For("source", nil)
+	}
+	// Output to stdout would break the protocol
+	d.gen.Out = d.gen.warnOut()
+	// Translated files are not moved
+	d.gen.noFixImports = true
+
+	s := bufio.NewScanner(in)
+	s.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		shutdown, err := d.handle(line)
+		if err != nil {
+			return err
+		}
+		if shutdown {
+			gen.lg().log("Daemon was shut down")
+			return nil
+		}
+	}
+	return errors.Wrap(s.Err(), "Cannot read JSON-RPC request")
+}
@@ -0,0 +1,72 @@
+package trygo
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// writeBlocksDOT writes Graphviz DOT graph of block trees collected by phase-1. Blocks are boxes connected
+// to their children and translation points are ellipses connected to the blocks where nil checks are
+// inserted.
+func writeBlocksDOT(out io.Writer, pkg *Package) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "digraph %s {\n", strconv.Quote(pkg.Node.Name))
+	fmt.Fprintln(w, "  node [shape=box fontname=\"monospace\"];")
+
+	blockID, transID := 0, 0
+	var visit func(tree *blockTree) string
+	visit = func(tree *blockTree) string {
+		id := fmt.Sprintf("b%d", blockID)
+		blockID++
+		kind := strings.TrimPrefix(reflect.TypeOf(tree.ast).String(), "*ast.")
+		label := fmt.Sprintf("%s\n%s\n%d statement(s)", kind, relpath(pkg.Files.Position(tree.ast.Pos()).String()), len(tree.stmts()))
+		fmt.Fprintf(w, "  %s [label=%s];\n", id, strconv.Quote(label))
+
+		for _, trans := range tree.transPoints {
+			tid := fmt.Sprintf("t%d", transID)
+			transID++
+			label := fmt.Sprintf("%s() (%s)\n%s\nstatement #%d", trans.funcName(), TransKind(trans.kind), relpath(pkg.Files.Position(trans.pos).String()), trans.blockIndex)
+			fmt.Fprintf(w, "  %s [shape=ellipse label=%s];\n", tid, strconv.Quote(label))
+			fmt.Fprintf(w, "  %s -> %s [style=dashed];\n", id, tid)
+		}
+		for _, child := range tree.children {
+			fmt.Fprintf(w, "  %s -> %s;\n", id, visit(child))
+		}
+		return id
+	}
+	for _, root := range pkg.blockTrees {
+		visit(root)
+	}
+
+	fmt.Fprintln(w, "}")
+	return errors.Wrap(w.Flush(), "Cannot write DOT graph of blocks")
+}
+
+// dumpBlocks writes DOT graph of block trees of the package to '{DumpBlocksDir}/{pkgdir}.dot'. It does
+// nothing when DumpBlocksDir is not set or nothing was translated.
+func (pkg *Package) dumpBlocks() error {
+	if pkg.dumpBlocksDir == "" || pkg.blockTrees == nil {
+		return nil
+	}
+	if err := os.MkdirAll(pkg.dumpBlocksDir, 0755); err != nil {
+		return errors.Wrapf(err, "Cannot create directory to dump blocks %q", pkg.dumpBlocksDir)
+	}
+	path := filepath.Join(pkg.dumpBlocksDir, pkg.dumpName()+".dot")
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot create file to dump blocks %q", path)
+	}
+	defer f.Close()
+	if err := writeBlocksDOT(f, pkg); err != nil {
+		return err
+	}
+	pkg.lg.log("DOT graph of blocks was dumped to", relpath(path))
+	return nil
+}
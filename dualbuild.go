@@ -0,0 +1,252 @@
+package trygo
+
+import (
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// In dual-build layout, generated files are put next to TryGo sources. TryGo sources are tagged with
+// `//go:build trygo` and generated files with `//go:build !trygo` so that the directory can be built
+// as a normal Go package while TryGo sources remain in the same directory.
+
+const (
+	dualBuildTag = "trygo"
+	// dualBuildFileNameTemplate is a default FileNameTemplate in dual-build layout. Generated files must
+	// have names different from their sources.
+	dualBuildFileNameTemplate = "{name}_trygo.go"
+)
+
+// buildConstraintOf returns the //go:build comment and its parsed expression in the file. It returns
+// nil when the file has no //go:build line.
+func buildConstraintOf(file *ast.File) (*ast.Comment, constraint.Expr, error) {
+	for _, g := range file.Comments {
+		if g.Pos() >= file.Package {
+			break
+		}
+		for _, c := range g.List {
+			if !constraint.IsGoBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				return nil, nil, err
+			}
+			return c, expr, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// hasPlusBuildLine returns true when the file has legacy // +build line before its package clause.
+func hasPlusBuildLine(file *ast.File) bool {
+	for _, g := range file.Comments {
+		if g.Pos() >= file.Package {
+			return false
+		}
+		for _, c := range g.List {
+			if constraint.IsPlusBuild(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mentionsTag returns true when the expression refers the build tag.
+func mentionsTag(expr constraint.Expr, tag string) bool {
+	found := false
+	expr.Eval(func(t string) bool {
+		if t == tag {
+			found = true
+		}
+		return false
+	})
+	return found
+}
+
+// isDualBuildSource returns true when the constraint requires 'trygo' tag at top level. It means the
+// file is a TryGo source in dual-build layout.
+func isDualBuildSource(expr constraint.Expr) bool {
+	switch expr := expr.(type) {
+	case *constraint.TagExpr:
+		return expr.Tag == dualBuildTag
+	case *constraint.AndExpr:
+		return isDualBuildSource(expr.X)
+	default:
+		return false
+	}
+}
+
+// invertDualBuildConstraint replaces the leading 'trygo' tag of the constraint with '!trygo'.
+func invertDualBuildConstraint(expr constraint.Expr) constraint.Expr {
+	switch expr := expr.(type) {
+	case *constraint.TagExpr:
+		return &constraint.NotExpr{X: expr}
+	case *constraint.AndExpr:
+		return &constraint.AndExpr{X: invertDualBuildConstraint(expr.X), Y: expr.Y}
+	default:
+		return expr
+	}
+}
+
+// dualBuildTagged returns the content of the TryGo source file with 'trygo' build tag added. It returns
+// nil when the file needs no tag since it has no pseudo-function call, it was generated by trygo or it
+// already mentions the tag.
+func dualBuildTagged(path string) ([]byte, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot read source for dual-build layout: %s", path)
+	}
+	if !ContainsTrySource(src) {
+		return nil, nil
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if isGeneratedFile(file) {
+		return nil, nil
+	}
+	c, expr, err := buildConstraintOf(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid //go:build line in %s", path)
+	}
+
+	var tagged []byte
+	if c == nil {
+		if hasPlusBuildLine(file) {
+			return nil, errors.Errorf("%s has // +build line but no //go:build line. Run gofmt to add //go:build line before generating files in dual-build layout", path)
+		}
+		tagged = append([]byte("//go:build "+dualBuildTag+"\n\n"), src...)
+	} else {
+		if mentionsTag(expr, dualBuildTag) {
+			return nil, nil
+		}
+		expr = &constraint.AndExpr{X: &constraint.TagExpr{Tag: dualBuildTag}, Y: expr}
+		start, end := fset.Position(c.Pos()).Offset, fset.Position(c.End()).Offset
+		tagged = make([]byte, 0, len(src)+len(dualBuildTag)+4)
+		tagged = append(tagged, src[:start]...)
+		tagged = append(tagged, "//go:build "+expr.String()...)
+		tagged = append(tagged, src[end:]...)
+	}
+	return tagged, nil
+}
+
+// untaggedDualBuildSources returns TryGo sources in the package directory which are not tagged with 'trygo'
+// yet. The returned map is from file path to its tagged content. When the directory has target files,
+// only the files are returned. Nothing is written to the files.
+func (gen *Gen) untaggedDualBuildSources(dir string) (map[string][]byte, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	targets, onlyTargets := gen.targetFiles[dir]
+	untagged := map[string][]byte{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		if _, ok := targets[name]; onlyTargets && !ok {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		tagged, err := dualBuildTagged(path)
+		if err != nil {
+			return nil, err
+		}
+		if tagged != nil {
+			untagged[path] = tagged
+		}
+	}
+	return untagged, nil
+}
+
+// parseTaggedSources replaces ASTs of the untagged TryGo sources in the package with ASTs parsed from
+// their tagged contents so that generated files have '!trygo' build tag.
+func (pkg *Package) parseTaggedSources() error {
+	for _, path := range sortedFilePaths(pkg.Node.Files) {
+		src, ok := pkg.untagged[path]
+		if !ok {
+			continue
+		}
+		f, err := parser.ParseFile(pkg.Files, path, src, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		pkg.Node.Files[path] = f
+	}
+	return nil
+}
+
+// tagDualBuildSources adds 'trygo' build tag to TryGo sources of the package. It is called after the
+// package was written so that sources are not modified when generation failed.
+func (gen *Gen) tagDualBuildSources(pkg *Package) error {
+	paths := make([]string, 0, len(pkg.untagged))
+	for path := range pkg.untagged {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, pkg.untagged[path], info.Mode().Perm()); err != nil {
+			return errors.Wrapf(err, "Cannot add build tag to %s", path)
+		}
+		gen.notice("Added '" + dualBuildTag + "' build tag to " + relpath(path))
+	}
+	pkg.untagged = nil
+	return nil
+}
+
+// setDualBuildTargets restricts target files of the package to TryGo sources tagged with 'trygo' or to be
+// tagged. It returns false when the package has no such file.
+func (pkg *Package) setDualBuildTargets() (bool, error) {
+	targets := map[string]struct{}{}
+	for path, f := range pkg.Node.Files {
+		_, expr, err := buildConstraintOf(f)
+		if err != nil {
+			return false, errors.Wrapf(err, "Invalid //go:build line in %s", path)
+		}
+		if _, ok := pkg.untagged[path]; !ok && (expr == nil || !isDualBuildSource(expr)) {
+			continue
+		}
+		name := filepath.Base(path)
+		if pkg.targets == nil || pkg.isTarget(path) {
+			targets[name] = struct{}{}
+		}
+	}
+	pkg.targets = targets
+	return len(targets) > 0, nil
+}
+
+// invertDualBuildConstraints replaces 'trygo' build tag with '!trygo' in translated target files so
+// that generated files are built instead of TryGo sources.
+func (pkg *Package) invertDualBuildConstraints() error {
+	for _, path := range sortedFilePaths(pkg.Node.Files) {
+		if !pkg.isTarget(path) {
+			continue
+		}
+		c, expr, err := buildConstraintOf(pkg.Node.Files[path])
+		if err != nil {
+			return errors.Wrapf(err, "Invalid //go:build line in %s", path)
+		}
+		if c == nil || !isDualBuildSource(expr) {
+			continue
+		}
+		c.Text = "//go:build " + invertDualBuildConstraint(expr).String()
+	}
+	return nil
+}
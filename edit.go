@@ -0,0 +1,148 @@
+package trygo
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Edit is a byte-range edit to an original TryGo source file. Applying all edits of a file to the
+// original source results in the translated Go source. Editor integrations can apply them as minimal
+// patches instead of replacing whole file content.
+type Edit struct {
+	// File is a path to the original TryGo source file.
+	File string
+	// Offset is a byte offset in the original file where the edit starts.
+	Offset int
+	// Length is a number of bytes replaced by the edit in the original file.
+	Length int
+	// Replacement is a text which replaces the range.
+	Replacement string
+}
+
+// splitLines splits the text into lines. Each line contains its trailing newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines returns pairs of indices of lines which are common to a and b. The pairs are the longest
+// common subsequence of the lines, calculated with Myers' difference algorithm.
+func matchLines(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	trace := [][]int{}
+
+Loop:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+off] < v[k+1+off]) {
+				x = v[k+1+off]
+			} else {
+				x = v[k-1+off] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+off] = x
+			if x >= n && y >= m {
+				break Loop
+			}
+		}
+	}
+
+	matches := [][2]int{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+off] < v[k+1+off]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+off]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
+
+// lineEdits calculates line-wise edits to change the text before to after.
+func lineEdits(file, before, after string) []Edit {
+	a, b := splitLines(before), splitLines(after)
+
+	offsets := make([]int, 0, len(a)+1)
+	o := 0
+	for _, l := range a {
+		offsets = append(offsets, o)
+		o += len(l)
+	}
+	offsets = append(offsets, o)
+
+	edits := []Edit{}
+	i, j := 0, 0
+	for _, match := range append(matchLines(a, b), [2]int{len(a), len(b)}) {
+		if match[0] > i || match[1] > j {
+			edits = append(edits, Edit{
+				File:        file,
+				Offset:      offsets[i],
+				Length:      offsets[match[0]] - offsets[i],
+				Replacement: strings.Join(b[j:match[1]], ""),
+			})
+		}
+		i, j = match[0]+1, match[1]+1
+	}
+	return edits
+}
+
+// Edits returns a list of byte-range edits to the original TryGo source files for translating them into
+// Go. Edits are sorted by file paths and offsets, and do not overlap each other. Note that offsets are
+// relative to the original file content, so edits in the same file should be applied from the last one.
+func (pkg *Package) Edits() ([]Edit, error) {
+	paths := make([]string, 0, len(pkg.Node.Files))
+	for path := range pkg.Node.Files {
+		if pkg.isTarget(path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	edits := []Edit{}
+	for _, path := range paths {
+		src := pkg.sourceOf(path)
+		orig, err := ioutil.ReadFile(src)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot read source file %q to calculate edits", src)
+		}
+		var buf bytes.Buffer
+		if err := pkg.writeGo(&buf, pkg.Node.Files[path]); err != nil {
+			return nil, err
+		}
+		es := lineEdits(src, string(orig), buf.String())
+		pkg.lg.log("Calculated", pkg.lg.hi(len(es)), "edit(s) for", relpath(src))
+		edits = append(edits, es...)
+	}
+	return edits, nil
+}
@@ -0,0 +1,153 @@
+package trygo
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Patterns of //go:embed directives are relative to the package directory. Since generated package is
+// put in the output directory, files matched by the patterns must exist in the output directory as well.
+// Missing files are copied from the source package directory. When a pattern matches no file even in
+// the source directory, generation fails since the generated package cannot be built.
+
+type embedPattern struct {
+	pattern string
+	file    string
+	line    int
+}
+
+func (pat *embedPattern) String() string {
+	return strconv.Quote(pat.pattern) + " at " + pat.file + ":" + strconv.Itoa(pat.line)
+}
+
+// parseEmbedArgs splits arguments of //go:embed directive. Arguments are separated by spaces and
+// may be quoted with "..." or `...`.
+func parseEmbedArgs(s string) ([]string, error) {
+	args := []string{}
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return args, nil
+		}
+
+		switch s[0] {
+		case '`':
+			i := strings.IndexByte(s[1:], '`')
+			if i < 0 {
+				return nil, errors.Errorf("Unterminated raw string in //go:embed arguments: %s", s)
+			}
+			args = append(args, s[1:i+1])
+			s = s[i+2:]
+		case '"':
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(s) {
+				return nil, errors.Errorf("Unterminated string in //go:embed arguments: %s", s)
+			}
+			arg, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid string in //go:embed arguments: %s", s[:i+1])
+			}
+			args = append(args, arg)
+			s = s[i+1:]
+		default:
+			i := strings.IndexAny(s, " \t")
+			if i < 0 {
+				i = len(s)
+			}
+			args = append(args, s[:i])
+			s = s[i:]
+		}
+	}
+}
+
+// embedPatternsOf collects patterns of all //go:embed directives in the package.
+func embedPatternsOf(pkg *Package) ([]*embedPattern, error) {
+	pats := []*embedPattern{}
+	for path, file := range pkg.Node.Files {
+		if !pkg.isTarget(path) {
+			continue
+		}
+		for _, g := range file.Comments {
+			for _, c := range g.List {
+				if !strings.HasPrefix(c.Text, "//go:embed ") {
+					continue
+				}
+				pos := pkg.Files.Position(c.Pos())
+				args, err := parseEmbedArgs(strings.TrimPrefix(c.Text, "//go:embed "))
+				if err != nil {
+					return nil, errors.Wrapf(err, "At %s", pos)
+				}
+				for _, arg := range args {
+					pats = append(pats, &embedPattern{arg, pos.Filename, pos.Line})
+				}
+			}
+		}
+	}
+	sort.Slice(pats, func(i, j int) bool {
+		return pats[i].String() < pats[j].String()
+	})
+	return pats, nil
+}
+
+// matchEmbedPattern returns paths of files or directories matched by the pattern in the directory.
+func matchEmbedPattern(dir string, pattern string) ([]string, error) {
+	pattern = strings.TrimPrefix(pattern, "all:")
+	return filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+}
+
+// relocateEmbeddedFiles ensures that patterns of //go:embed directives in generated packages match files
+// in their output directories. Files missing in output directories are copied from source directories.
+func (gen *Gen) relocateEmbeddedFiles(pkgs []*Package) error {
+	lg := gen.lg()
+	for _, pkg := range pkgs {
+		pats, err := embedPatternsOf(pkg)
+		if err != nil {
+			return err
+		}
+		for _, pat := range pats {
+			if matched, err := matchEmbedPattern(pkg.Path, pat.pattern); err == nil && len(matched) > 0 {
+				lg.log("//go:embed pattern", pat, "matches files in output directory", relpath(pkg.Path))
+				continue
+			}
+
+			srcs, err := matchEmbedPattern(pkg.Birth, pat.pattern)
+			if err != nil {
+				return errors.Wrapf(err, "Invalid //go:embed pattern %s", pat)
+			}
+			if len(srcs) == 0 {
+				return errors.Errorf("//go:embed pattern %s matches no file in source directory %s. Generated package at %s cannot be built", pat, pkg.Birth, pkg.Path)
+			}
+
+			for _, src := range srcs {
+				rel, err := filepath.Rel(pkg.Birth, src)
+				if err != nil {
+					return err
+				}
+				dst := filepath.Join(pkg.Path, rel)
+				info, err := os.Stat(src)
+				if err != nil {
+					return err
+				}
+				lg.log("Copy embedded file", relpath(src), "->", relpath(dst), "for //go:embed pattern", pat)
+				if info.IsDir() {
+					err = copyDir(src, dst, gen.OutDir)
+				} else {
+					err = copyFile(src, dst)
+				}
+				if err != nil {
+					return errors.Wrapf(err, "Cannot copy embedded file for //go:embed pattern %s", pat)
+				}
+			}
+		}
+	}
+	return nil
+}
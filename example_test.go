@@ -19,7 +19,7 @@ func ExampleGen() {
 
 	// Generate() outputs translated file paths by default. If you don't want them, please set
 	// ioutil.Discard as writer.
-	gen.Writer = ioutil.Discard
+	gen.Out = ioutil.Discard
 
 	// Translate TryGo package into Go and generate it at outDir with output verification.
 	// It generates testdata/example/out.
@@ -0,0 +1,50 @@
+package trygo
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"go/printer"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Explain writes each translation point in the package to the writer with its position, kind and the Go
+// code generated for it. The package must be translated before calling this method.
+//
+//	/path/to/foo.go:10:7: try() (assignment)
+//		n, err := strconv.Atoi(s)
+//		if err != nil {
+//			return 0, err
+//		}
+func (pkg *Package) Explain(out io.Writer) error {
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	pts := append([]*transPoint{}, pkg.transPoints...)
+	sort.SliceStable(pts, func(i, j int) bool {
+		l, r := pkg.Files.Position(pts[i].pos), pkg.Files.Position(pts[j].pos)
+		if l.Filename != r.Filename {
+			return l.Filename < r.Filename
+		}
+		return l.Offset < r.Offset
+	})
+
+	for _, trans := range pts {
+		pos := pkg.Files.Position(trans.pos)
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%s: %s() (%s)\n", relpath(pos.String()), trans.funcName(), TransKind(trans.kind))
+		for _, stmt := range trans.generated {
+			var code bytes.Buffer
+			if err := cfg.Fprint(&code, pkg.Files, stmt); err != nil {
+				return errors.Wrapf(err, "Cannot print code generated for %s() at %s", trans.funcName(), pos)
+			}
+			for _, line := range strings.Split(code.String(), "\n") {
+				fmt.Fprintf(&buf, "\t%s\n", line)
+			}
+		}
+		if _, err := out.Write(buf.Bytes()); err != nil {
+			return errors.Wrap(err, "Cannot write explanation of translation")
+		}
+	}
+	return nil
+}
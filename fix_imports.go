@@ -1,10 +1,19 @@
 package trygo
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	"go/ast"
 	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os/exec"
+	pathpkg "path"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -13,8 +22,8 @@ import (
 // Considering translation, the import paths must be fixed not to break compilation.
 
 type importError struct {
-	msg  string
-	node ast.Node
+	msg string
+	pos token.Position
 }
 
 func (err *importError) Error() string {
@@ -23,15 +32,21 @@ func (err *importError) Error() string {
 
 type importsFixer struct {
 	transMap  map[string]string
+	transPkgs map[string]*Package
+	importMap map[string]string
+	rewrites  []ImportRewrite
 	ctx       build.Context
-	pathToDir map[string]string
+	resolved  map[string]*resolvedImport
 	count     int
 	errs      []*importError
+	lg        logger
+	// fset is a file set of the package whose imports are being fixed. Each package has its own file set.
+	fset *token.FileSet
 }
 
 func (fixer *importsFixer) errAt(node ast.Node, msg string) {
-	err := &importError{msg, node}
-	log(ftl(err))
+	err := &importError{msg, fixer.fset.Position(node.Pos())}
+	fixer.lg.log(fixer.lg.ftl(err))
 	fixer.errs = append(fixer.errs, err)
 }
 
@@ -39,21 +54,140 @@ func (fixer *importsFixer) errfAt(node ast.Node, format string, args ...interfac
 	fixer.errAt(node, fmt.Sprintf(format, args...))
 }
 
-func (fixer *importsFixer) resolveImportPath(path string, pkgDir string) (string, error) {
-	if p, ok := fixer.pathToDir[path]; ok {
-		return p, nil
+// resolvedImport is a result of resolving import path.
+type resolvedImport struct {
+	// dir is a directory path of the imported package
+	dir string
+	// modPath and modDir are the module path and the root directory of module which contains the imported
+	// package. They are empty when the package is not in module (e.g. GOPATH mode).
+	modPath string
+	modDir  string
+}
+
+// resolveWithGoList resolves given import paths at once by `go list` command. `go list` understands
+// module-based projects and nested modules unlike go/build. Import paths which could not be resolved
+// are not cached and resolved with go/build later.
+func (fixer *importsFixer) resolveWithGoList(paths []string, pkgDir string) {
+	unresolved := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if _, ok := fixer.resolved[p]; !ok {
+			unresolved = append(unresolved, p)
+		}
+	}
+	if len(unresolved) == 0 {
+		return
+	}
+
+	args := append([]string{"list", "-e", "-find", "-json", "--"}, unresolved...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = pkgDir
+	out, err := cmd.Output()
+	if err != nil {
+		fixer.lg.log("`go list` failed at", relpath(pkgDir), "so fall back into go/build:", err)
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var listed struct {
+			ImportPath string
+			Dir        string
+			Module     *struct {
+				Path string
+				Dir  string
+			}
+			Error *struct {
+				Err string
+			}
+		}
+		if err := dec.Decode(&listed); err != nil {
+			if err != io.EOF {
+				fixer.lg.log("Broken output from `go list`:", err)
+			}
+			return
+		}
+		if listed.Error != nil || listed.Dir == "" {
+			continue
+		}
+		r := &resolvedImport{dir: listed.Dir}
+		if listed.Module != nil {
+			r.modPath = listed.Module.Path
+			r.modDir = listed.Module.Dir
+		}
+		fixer.resolved[listed.ImportPath] = r
+		fixer.lg.log("Import path", fixer.lg.hi(listed.ImportPath), "was resolved to", fixer.lg.hi(r.dir), "by `go list`")
+	}
+}
+
+func (fixer *importsFixer) resolveImportPath(path string, pkgDir string) (*resolvedImport, error) {
+	if r, ok := fixer.resolved[path]; ok {
+		return r, nil
 	}
 	p, err := fixer.ctx.Import(path, pkgDir, build.FindOnly)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	fixer.pathToDir[path] = p.Dir
-	log("Import path", hi(path), "was resolved to", hi(p.Dir))
-	return p.Dir, nil
+	r := &resolvedImport{dir: p.Dir}
+	fixer.resolved[path] = r
+	fixer.lg.log("Import path", fixer.lg.hi(path), "was resolved to", fixer.lg.hi(p.Dir))
+	return r, nil
+}
+
+// mapImportPath maps import path with the longest matching prefix in importMap. When no prefix matches,
+// it returns false as the second return value.
+func (fixer *importsFixer) mapImportPath(path string) (string, bool) {
+	longest := ""
+	for prefix := range fixer.importMap {
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	if longest == "" {
+		return "", false
+	}
+	mapped := fixer.importMap[longest] + strings.TrimPrefix(path, longest)
+	fixer.lg.log("Import path", fixer.lg.hi(path), "was mapped to", fixer.lg.hi(mapped), "with prefix", longest)
+	return mapped, true
+}
+
+// translatedImportPath returns an import path of the translated package for the given import path. When
+// the package is not translated, it returns false as the second return value.
+func (fixer *importsFixer) translatedImportPath(path string, resolved *resolvedImport) (string, bool) {
+	srcDir := resolved.dir
+	destDir, ok := fixer.transMap[srcDir]
+	if !ok {
+		return "", false
+	}
+
+	if mapped, ok := fixer.mapImportPath(path); ok {
+		return mapped, true
+	}
+
+	if rel, err := filepath.Rel(resolved.modDir, destDir); resolved.modDir != "" && err == nil && !strings.HasPrefix(rel, "..") {
+		// In module, import path is module path followed by relative path from module root
+		//   modPath: example.com/foo
+		//   modDir: /path/to/foo
+		//   destDir: /path/to/foo/outdir/some/pkg
+		//   transPath: example.com/foo/outdir/some/pkg
+		return pathpkg.Join(resolved.modPath, filepath.ToSlash(rel)), true
+	}
+
+	// path: trygo/some/pkg
+	// srcDir: /path/to/trygo/some/pkg
+	// destDir: /path/to/outdir/some/pkg
+
+	// prefix: /path/to/
+	prefix := strings.TrimSuffix(srcDir, path)
+
+	// transPath: outdir/some/pkg
+	return strings.TrimPrefix(destDir, prefix), true
 }
 
 func (fixer *importsFixer) fixImport(node *ast.ImportSpec, pkgDir string) bool {
-	log("Looking import spec", hi(node.Path.Value))
+	fixer.lg.log("Looking import spec", fixer.lg.hi(node.Path.Value))
 
 	path, err := strconv.Unquote(node.Path.Value)
 	if err != nil {
@@ -62,7 +196,12 @@ func (fixer *importsFixer) fixImport(node *ast.ImportSpec, pkgDir string) bool {
 		panic("Import path is broken Go string: " + node.Path.Value)
 	}
 
-	srcDir, err := fixer.resolveImportPath(path, pkgDir)
+	if path == "C" {
+		// Pseudo package for cgo never needs to be fixed
+		return false
+	}
+
+	resolved, err := fixer.resolveImportPath(path, pkgDir)
 	if err != nil {
 		// This error may happen in normal case when translating TryGo code does not contain any try() call.
 		// In the case, try() call elimination returns early just after stage 1 and type check is not performed.
@@ -71,74 +210,366 @@ func (fixer *importsFixer) fixImport(node *ast.ImportSpec, pkgDir string) bool {
 		return false
 	}
 
-	destDir, ok := fixer.transMap[srcDir]
+	srcDir := resolved.dir
+	transPath, ok := fixer.translatedImportPath(path, resolved)
 	if !ok {
 		return false
 	}
 
-	// path: trygo/some/pkg
-	// srcDir: /path/to/trygo/some/pkg
-	// destDir: /path/to/outdir/some/pkg
-
-	// prefix: /path/to/
-	prefix := strings.TrimSuffix(srcDir, path)
-
-	// transPath: outdir/some/pkg
-	transPath := strings.TrimPrefix(destDir, prefix)
-
 	// Finally replace import path with translated directory
 	prev := node.Path.Value
 	node.Path.Value = strconv.Quote(transPath)
-	log("Fix imoprt path:", hi(prev), "->", hi(node.Path.Value))
+	fixer.lg.log("Fix imoprt path:", fixer.lg.hi(prev), "->", fixer.lg.hi(node.Path.Value))
 	fixer.count++
+
+	// When base name of new import path is different from its package name, add an alias explicitly so
+	// that readers and tools can know which name references the package.
+	//   "path/to/outdir/gen" -> foo "path/to/outdir/gen"
+	if p, ok := fixer.transPkgs[srcDir]; ok && node.Name == nil && pathpkg.Base(transPath) != p.Node.Name {
+		name := p.Node.Name
+		node.Name = newIdent(name, node.Path.Pos())
+		fixer.lg.log("Add alias", fixer.lg.hi(name), "to import", fixer.lg.hi(node.Path.Value))
+	}
+
 	return true
 }
 
+// rewriteImport applies user-supplied import rewrite rules to the import spec. The first matching rule
+// is applied.
+func (fixer *importsFixer) rewriteImport(node *ast.ImportSpec) bool {
+	path, err := strconv.Unquote(node.Path.Value)
+	if err != nil {
+		panic("Import path is broken Go string: " + node.Path.Value)
+	}
+	for _, r := range fixer.rewrites {
+		if path != r.From && !strings.HasPrefix(path, r.From+"/") {
+			continue
+		}
+		prev := node.Path.Value
+		node.Path.Value = strconv.Quote(r.To + strings.TrimPrefix(path, r.From))
+		fixer.lg.log("Rewrite import path:", fixer.lg.hi(prev), "->", fixer.lg.hi(node.Path.Value))
+		fixer.count++
+		return true
+	}
+	return false
+}
+
 func (fixer *importsFixer) fixPackage(pkg *Package) {
-	log("Fix imports:", hi(pkg.Node.Name))
-	for fpath, file := range pkg.Node.Files {
-		log("Fix imports in file:", hi(fpath))
+	fixer.lg.log("Fix imports:", fixer.lg.hi(pkg.Node.Name))
+	fixer.fset = pkg.Files
+	paths := []string{}
+	for _, file := range pkg.fileNodes() {
 		for _, node := range file.Imports {
-			if fixer.fixImport(node, pkg.Path) {
+			if p, err := strconv.Unquote(node.Path.Value); err == nil && p != "C" {
+				paths = append(paths, p)
+			}
+		}
+	}
+	fixer.resolveWithGoList(paths, pkg.Birth)
+
+	for _, fpath := range sortedFilePaths(pkg.Node.Files) {
+		file := pkg.Node.Files[fpath]
+		fixer.lg.log("Fix imports in file:", fixer.lg.hi(fpath))
+		fixer.fixImportComment(pkg, fpath, file)
+		for _, node := range file.Imports {
+			if node.Name != nil && node.Name.Name == "." {
+				// Verify before fixing import paths since the verification resolves the original paths
+				fixer.verifyDotImport(pkg, file, node)
+			}
+		}
+		origPaths := map[*ast.ImportSpec]string{}
+		for _, node := range file.Imports {
+			path := node.Path.Value
+			changed := false
+			if fixer.fixImport(node, pkg.Birth) {
+				pkg.modified = true
+				changed = true
+
+				if node.Name != nil && node.Name.Name == "_" {
+					// Blank import only needs its path fixed for side effects of the translated package
+					fixer.lg.log("Blank import was fixed:", fixer.lg.hi(path), "->", fixer.lg.hi(node.Path.Value))
+				}
+			}
+			if fixer.rewriteImport(node) {
 				pkg.modified = true
+				changed = true
 			}
+			if changed {
+				pkg.fixedImports = append(pkg.fixedImports, node.Pos())
+				origPaths[node] = path
+			}
+		}
+		fixer.addAliasesOnClash(file, origPaths, pkg.Birth)
+	}
+}
+
+// importCommentOf finds a canonical import comment like `package foo // import "example.com/foo"` in the
+// file and returns the comment and its import path.
+func importCommentOf(fset *token.FileSet, file *ast.File) (*ast.Comment, string) {
+	for _, g := range file.Comments {
+		for _, c := range g.List {
+			if c.Pos() < file.Name.End() {
+				continue
+			}
+			if fset.Position(c.Pos()).Line != fset.Position(file.Name.Pos()).Line {
+				return nil, ""
+			}
+			text := c.Text
+			if strings.HasPrefix(text, "//") {
+				text = text[2:]
+			} else {
+				text = strings.TrimSuffix(text[2:], "*/")
+			}
+			text = strings.TrimSpace(text)
+			if !strings.HasPrefix(text, "import ") {
+				return nil, ""
+			}
+			p, err := strconv.Unquote(strings.TrimSpace(strings.TrimPrefix(text, "import ")))
+			if err != nil {
+				return nil, ""
+			}
+			return c, p
 		}
 	}
+	return nil, ""
 }
 
-func fixImports(pkgs []*Package) error {
+// fixImportComment rewrites canonical import comment of the file consistently with the output path. When
+// the new import path cannot be determined, the comment is dropped since stale canonical import comment
+// breaks build of the generated package.
+func (fixer *importsFixer) fixImportComment(pkg *Package, fpath string, file *ast.File) {
+	// Comments may not be parsed in the AST. Parse package clause with comments separately to find out
+	// the canonical import comment.
+	fset := token.NewFileSet()
+	clause, err := parser.ParseFile(fset, fpath, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return
+	}
+	c, canonical := importCommentOf(fset, clause)
+	if c == nil {
+		return
+	}
+	fixer.lg.log("Canonical import comment", fixer.lg.hi(canonical), "found in", relpath(fpath))
+	pkg.modified = true
+
+	existing, _ := importCommentOf(pkg.Files, file)
+
+	fixer.resolveWithGoList([]string{canonical}, pkg.Birth)
+	r, err := fixer.resolveImportPath(canonical, pkg.Birth)
+	if err != nil || r.dir != pkg.Birth {
+		fixer.lg.log("Drop canonical import comment", fixer.lg.hi(canonical), "since it does not point the package")
+		removeComment(file, existing)
+		return
+	}
+	transPath, ok := fixer.translatedImportPath(canonical, r)
+	if !ok {
+		removeComment(file, existing)
+		return
+	}
+
+	text := fmt.Sprintf("// import %q", transPath)
+	if existing != nil {
+		// Rewrite the comment in place to keep the order of comments in the file
+		existing.Text = text
+	} else {
+		file.Comments = append(file.Comments, &ast.CommentGroup{
+			List: []*ast.Comment{{Slash: file.Name.End() + 1, Text: text}},
+		})
+	}
+	fixer.lg.log("Canonical import comment was rewritten:", fixer.lg.hi(text))
+}
+
+// removeComment removes given comment from the file. A comment group which becomes empty is also removed.
+func removeComment(file *ast.File, c *ast.Comment) {
+	if c == nil {
+		return
+	}
+	groups := make([]*ast.CommentGroup, 0, len(file.Comments))
+	for _, g := range file.Comments {
+		for i, cm := range g.List {
+			if cm == c {
+				g.List = append(g.List[:i], g.List[i+1:]...)
+				break
+			}
+		}
+		if len(g.List) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	file.Comments = groups
+}
+
+// verifyDotImport verifies that names used in the file via dot import of translated package are still
+// resolved. Names which are neither declared in the importing package nor universe scope must be exported
+// by the translated package. The verification is skipped when names of other imported packages cannot be
+// known.
+func (fixer *importsFixer) verifyDotImport(pkg *Package, file *ast.File, node *ast.ImportSpec) {
+	for _, spec := range file.Imports {
+		if spec != node && spec.Name != nil && spec.Name.Name == "." {
+			// Names may come from other dot imports. Cannot verify
+			fixer.lg.log("Skip verification of dot import", fixer.lg.hi(node.Path.Value), "since other dot import exists")
+			return
+		}
+	}
+
+	p, err := strconv.Unquote(node.Path.Value)
+	if err != nil {
+		panic("Import path is broken Go string: " + node.Path.Value)
+	}
+	r, err := fixer.resolveImportPath(p, pkg.Birth)
+	if err != nil {
+		return
+	}
+	imported, ok := fixer.transPkgs[r.dir]
+	if !ok {
+		return
+	}
+
+	exported := map[string]struct{}{}
+	for _, f := range imported.Node.Files {
+		for name := range f.Scope.Objects {
+			if ast.IsExported(name) {
+				exported[name] = struct{}{}
+			}
+		}
+	}
+
+	declared := map[string]struct{}{}
+	for _, f := range pkg.Node.Files {
+		for name := range f.Scope.Objects {
+			declared[name] = struct{}{}
+		}
+	}
+	for _, spec := range file.Imports {
+		if spec.Name != nil {
+			declared[spec.Name.Name] = struct{}{}
+			continue
+		}
+		name, ok := fixer.packageNameOf(spec.Path.Value, pkg.Birth)
+		if !ok {
+			fixer.lg.log("Skip verification of dot import", fixer.lg.hi(node.Path.Value), "since package name of", fixer.lg.hi(spec.Path.Value), "is unknown")
+			return
+		}
+		declared[name] = struct{}{}
+	}
+
+	for _, ident := range file.Unresolved {
+		if ident.Name == "try" {
+			// try() was eliminated by translation
+			continue
+		}
+		if _, ok := declared[ident.Name]; ok {
+			continue
+		}
+		if types.Universe.Lookup(ident.Name) != nil {
+			continue
+		}
+		if _, ok := exported[ident.Name]; !ok {
+			fixer.errfAt(ident, "Name %q is not resolved via dot import of translated package %s", ident.Name, node.Path.Value)
+		}
+	}
+	fixer.lg.log("Dot import was verified:", fixer.lg.hi(node.Path.Value))
+}
+
+// packageNameOf returns the name of package imported with the quoted import path. The name is taken from
+// the translated package or from package clauses of the imported package. It returns false as the second
+// return value when the name cannot be known.
+func (fixer *importsFixer) packageNameOf(quoted string, pkgDir string) (string, bool) {
+	path, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", false
+	}
+	if path == "C" {
+		return "C", true
+	}
+	r, err := fixer.resolveImportPath(path, pkgDir)
+	if err != nil {
+		return "", false
+	}
+	if p, ok := fixer.transPkgs[r.dir]; ok {
+		return p.Node.Name, true
+	}
+	imported, err := fixer.ctx.ImportDir(r.dir, 0)
+	if err != nil || imported.Name == "" {
+		return "", false
+	}
+	return imported.Name, true
+}
+
+// addAliasesOnClash adds an explicit alias of its package name to changed import when base name of its
+// new path clashes with base name of other import path in the same file. Without the alias, readers and tools cannot tell
+// which import is referenced by the name. origPaths maps the changed imports to their quoted paths in
+// TryGo source. Since the alias is the package name, references in the file are still resolved.
+func (fixer *importsFixer) addAliasesOnClash(file *ast.File, origPaths map[*ast.ImportSpec]string, pkgDir string) {
+	bases := map[string]int{}
+	for _, node := range file.Imports {
+		p, _ := strconv.Unquote(node.Path.Value)
+		bases[pathpkg.Base(p)]++
+	}
+	for _, node := range file.Imports {
+		orig, ok := origPaths[node]
+		if !ok || node.Name != nil {
+			continue
+		}
+		p, _ := strconv.Unquote(node.Path.Value)
+		base := pathpkg.Base(p)
+		if bases[base] <= 1 {
+			continue
+		}
+		name, ok := fixer.packageNameOf(orig, pkgDir)
+		if !ok || name == base {
+			// The import is referenced by its base name. Other clashing imports are aliased instead
+			continue
+		}
+		node.Name = newIdent(name, node.Path.Pos())
+		fixer.lg.log("Add alias", fixer.lg.hi(name), "to import", fixer.lg.hi(node.Path.Value), "since its base name clashes with other import")
+	}
+}
+
+// ImportRewrite is a rule to rewrite import paths in generated files. When an import path is equal to From
+// or starts with From followed by '/', the From part is replaced with To.
+type ImportRewrite struct {
+	From string
+	To   string
+}
+
+// fixImports fixes imports of the translated packages. others are packages translated previously. Their
+// imports are not fixed but imports of them in the translated packages are fixed.
+func fixImports(pkgs, others []*Package, importMap map[string]string, rewrites []ImportRewrite, lg logger) error {
 	l := len(pkgs)
-	log("Fix imports in", l, "packages")
-	m := make(map[string]string, l)
-	for _, pkg := range pkgs {
+	lg.log("Fix imports in", l, "packages")
+	m := make(map[string]string, l+len(others))
+	transPkgs := make(map[string]*Package, l+len(others))
+	for _, pkg := range append(others, pkgs...) {
 		m[pkg.Birth] = pkg.Path
+		if !strings.HasSuffix(pkg.Node.Name, "_test") {
+			transPkgs[pkg.Birth] = pkg
+		}
 	}
 
-	fixer := &importsFixer{m, build.Default, map[string]string{}, 0, nil}
+	fixer := &importsFixer{m, transPkgs, importMap, rewrites, build.Default, map[string]*resolvedImport{}, 0, nil, lg, nil}
 	for _, pkg := range pkgs {
 		fixer.fixPackage(pkg)
 	}
 
 	if len(fixer.errs) > 0 {
-		fset := pkgs[0].Files
 		if len(fixer.errs) == 1 {
-			pos := fset.Position(fixer.errs[0].node.Pos())
-			err := errors.Errorf("Import error while fixing import paths: At %s: %s", pos, fixer.errs[0])
-			log(ftl(err))
+			err := errors.Errorf("Import error while fixing import paths: At %s: %s", fixer.errs[0].pos, fixer.errs[0])
+			lg.log(lg.ftl(err))
 			return err
 		}
 
 		var b strings.Builder
 		fmt.Fprintf(&b, "%d import error(s) while fixing import paths:", len(fixer.errs))
 		for _, err := range fixer.errs {
-			fmt.Fprintf(&b, "\n  %s at %s", err.msg, fset.Position(err.node.Pos()))
+			fmt.Fprintf(&b, "\n  %s at %s", err.msg, err.pos)
 		}
 
 		msg := b.String()
-		log(ftl(msg))
+		lg.log(lg.ftl(msg))
 		return errors.New(msg)
 	}
 
-	log("Fix imports done.", fixer.count, "imports were fixed")
+	lg.log("Fix imports done.", fixer.count, "imports were fixed")
 	return nil
 }
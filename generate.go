@@ -5,10 +5,13 @@ import (
 	"github.com/pkg/errors"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 var cwd string
@@ -24,46 +27,392 @@ func init() {
 type Gen struct {
 	// OutDir is a directory path to output directory. This value must be an absolute path
 	OutDir string
-	// Writer is a writer to output messages
-	Writer io.Writer
+	// Out is a writer to output paths of generated packages and output of `go test`. When nil, stdout
+	// is used.
+	Out io.Writer
+	// Logger receives debug logs while generation. When nil, no log is output unless enabled by InitLog.
+	Logger Logger
+	// Warn is a writer to output warnings, notices and timings. When nil, stderr is used.
+	Warn io.Writer
+	// Err is a writer to output error messages reported by commands run by Gen such as `go test`. When
+	// nil, stderr is used.
+	Err io.Writer
+	// FollowSymlinks is a flag to follow symbolic links to directories while collecting package directories.
+	// When false, symbolic links to directories are skipped. When true, directories pointed by symbolic links
+	// are walked and each directory is visited only once so that cyclic links don't cause infinite loop.
+	// Symbolic links to files are collected as regular files regardless of this flag.
+	FollowSymlinks bool
+	// GoGenerateFileOnly is a flag to generate only the file named by $GOFILE when trygo is run from
+	// `go generate` instead of all files in the package directory.
+	GoGenerateFileOnly bool
+	// Quiet is a flag not to output paths of generated packages to Out.
+	Quiet bool
+	// TraceTimings is a flag to output elapsed times of phases (parse, phase-1, type check, phase-2 and
+	// write) of each generated package to Warn. The same information is available via Package.Report().
+	TraceTimings bool
+	// EmitASTDir is a directory path to dump AST of each file before phase-1, after phase-1 and after
+	// phase-2 with ast.Fprint() for diagnosing translation bugs. Dumps are written to
+	// '{EmitASTDir}/{pkgdir}/{file}.{stage}.ast'. When empty, AST is not dumped.
+	EmitASTDir string
+	// DumpBlocksDir is a directory path to dump Graphviz DOT graph of block trees and translation points
+	// collected by phase-1 to '{DumpBlocksDir}/{pkgdir}.dot'. It shows where each nil check is inserted.
+	// When empty, nothing is dumped.
+	DumpBlocksDir string
+	// EmitPhase1Dir is a directory path to write Go source of each file after try() call elimination and
+	// before nil check insertion to '{EmitPhase1Dir}/{pkgdir}/{file}' for debugging. It tells which phase
+	// produced bad output. When empty, nothing is written.
+	EmitPhase1Dir string
+	// RuntimeHelpers is a flag to generate code using helpers in github.com/rhysd/trygo/trygoruntime package
+	// to keep generated code short. Zero values of unknown types are generated as
+	// trygoruntime.Zero[T]() (requires Go 1.18 or later), errors caught by expect() are reported with
+	// trygoruntime.Report() and errors are wrapped with trygoruntime.Wrap(). Generated packages import
+	// the helper package.
+	RuntimeHelpers bool
+	// NoTypeCheck is a flag to skip type check after try() call elimination for low latency such as
+	// editor integrations. Zero values are generated from result types of functions like *new(T) and
+	// types of translated calls are not checked. Since the number of results of function calls is unknown,
+	// toplevel try() call is assumed to return only error unless the function is declared in the same
+	// package. Errors in generated code are reported by Go compiler.
+	NoTypeCheck bool
+	// Standalone is a flag to translate sources in best-effort mode without resolving their imports. Imports
+	// which cannot be resolved are treated as empty packages, type errors are ignored and import paths
+	// are not fixed. It is useful to translate snippets where the full package context is not available.
+	// Note that generated code may be incorrect when types in the translated calls are unknown.
+	Standalone bool
+	// Importer is an importer used to type-check packages while translation. When nil, imported packages
+	// are parsed from source for each translated package. Long-running processes such as editor daemons
+	// can share an importer which caches imported packages to keep translations fast. Note that changes
+	// of imported packages are not reflected while the importer caches them.
+	Importer types.Importer
+	// OnTranslate is a hook called for each translation point before inserting `if err != nil` check. The
+	// returned Decision can reject the translation or wrap the error returned at the point. It is useful
+	// to enforce policies such as forbidding try() in some packages. When nil, all points are translated
+	// as usual.
+	OnTranslate func(TransPoint) Decision
+	// Explain is a flag to output each translation point with its position, kind and the Go code which
+	// was generated for it to Out. It is useful to audit translations without diffing files.
+	Explain bool
+	// FileNameTemplate is a template of generated file names. "{name}" in the template is replaced with
+	// the source file name without ".go" extension. For example, "{name}_trygo.go" generates foo_trygo.go
+	// from foo.go. "_test" suffix of test files is kept at the end of name. When empty, generated files
+	// have the same names as source files.
+	FileNameTemplate string
+	// Flatten is a flag to write all generated files directly in OutDir instead of mirroring directory
+	// structure of sources. All packages must have the same package name since they are put in one
+	// directory. When file names conflict, the file is prefixed with its source directory name.
+	Flatten bool
+	// OutPathTemplate is a template of paths of generated files. "{outdir}" is replaced with OutDir,
+	// "{relpkg}" with the source package directory relative to the common ancestor of it and OutDir,
+	// "{pkgdir}" with the source package directory, "{pkgname}" with the package name and "{filename}"
+	// with the generated file name. Since all files in a package must be put in one directory, the
+	// template must end with "/{filename}". For example, "{pkgdir}/gen/{filename}" puts generated files in
+	// 'gen' directory of each source package. When empty, "{outdir}/{relpkg}/{filename}" is used. It cannot
+	// be used with Flatten.
+	OutPathTemplate string
+	// DualBuild is a flag to write generated files next to their TryGo sources. TryGo sources are tagged
+	// with `//go:build trygo` in place after their packages were written and generated files are tagged
+	// with `//go:build !trygo`, so the source directory can be built as normal Go while TryGo sources
+	// remain editable. Parsing and checking packages never modify sources. Only files which contain
+	// pseudo-function calls are tagged and translated. OutDir is ignored. When FileNameTemplate is empty,
+	// "{name}_trygo.go" is used. It cannot be used with Flatten nor OutPathTemplate.
+	DualBuild bool
+	// ImportMap is a map from import path prefix of translated package to import path prefix used in
+	// generated files. For example, {"example.com/foo": "example.com/gen/foo"} rewrites import of
+	// "example.com/foo/bar" to "example.com/gen/foo/bar" when the package was translated. When no prefix
+	// matches, the import path is derived from the output directory.
+	ImportMap map[string]string
+	// ImportRewrites is a list of rules to rewrite import paths in generated files. Unlike ImportMap, the
+	// rules are applied to all imports including packages which are not translated. For example, it can
+	// swap a helper package only for TryGo with its runtime equivalent.
+	ImportRewrites []ImportRewrite
+	// CheckReverseDeps is a flag to search packages which are not translated but import translated packages
+	// in the repository (module) containing translated packages. Such packages are reported as warnings
+	// since they still import original TryGo sources.
+	CheckReverseDeps bool
+	// CopyAssets is a flag to copy non-source files in package directories to output directories. Files in
+	// testdata directory, templates or files read at runtime are copied so that generated packages can be
+	// tested and run in the output directories.
+	CopyAssets bool
+	// Build is a flag to run `go build ./...` in OutDir after generation. It detects errors which type check
+	// on verification cannot detect. Positions in compiler errors are mapped back to TryGo sources.
+	Build bool
+	// Plugins is a list of paths to Go plugins which rewrite AST of packages between try() call elimination
+	// and nil check insertion. Each plugin must export 'Rewrite' function with signature
+	// func(*token.FileSet, *ast.Package) error.
+	Plugins []string
+	// Passes is a pipeline of translation run against each package. When nil, DefaultPasses() is used.
+	// Passes loaded from Plugins are inserted after TryCallElimination.
+	Passes []Pass
+	// PreHooks is a list of commands run before writing generated files. Paths of files to be generated
+	// are passed to them.
+	PreHooks []Hook
+	// PostHooks is a list of commands run after writing generated files. Paths of generated files are
+	// passed to them. For example, they can format the files or inject license headers to them.
+	PostHooks []Hook
+	// OkError is a Go expression of error returned when ok() gets false. For example, "ErrNotFound" or
+	// "errors.New(\"not ok\")". Identifiers in the expression must be available in files where ok() is
+	// used. When empty, ok() returns zero values of all results of the function.
+	OkError string
+	// NotFoundError is a Go expression of error returned when try() takes map index and the key is not
+	// found in the map. For example, "ErrNotFound". When empty, an error created with fmt.Errorf() is
+	// returned.
+	NotFoundError string
+	// ClosedError is a Go expression of error returned when try() takes channel receive and the channel
+	// is closed. For example, "io.EOF". When empty, an error created with fmt.Errorf() is returned.
+	ClosedError string
+	// ExpectHandler is a Go expression of function which receives an error caught by expect(). For example,
+	// "metrics.ReportError". When empty, the error is output with log.Printf().
+	ExpectHandler string
+	// WrapReplacedError makes an error passed to try() as the second argument like `try(f(), ErrFoo)` wrap
+	// the original error with fmt.Errorf() and %w verb. When false, the original error is discarded.
+	WrapReplacedError bool
+	// PreflightTypeCheck makes translation type-check TryGo source before eliminating try() calls. Type
+	// errors in the source are reported against untouched code with clean messages.
+	PreflightTypeCheck bool
+	// KeepGoing makes translation and generation continue even if some packages failed. Other packages
+	// are still translated and written, then *PartialError is returned with errors of the failed
+	// packages. Imports of the failed packages in other packages are not rewritten.
+	KeepGoing bool
+	// Strict makes translation report all pseudo-function calls which cannot be translated with their
+	// reasons instead of stopping at the first one.
+	Strict bool
+	// CacheDir is a directory path to cache translation results of packages across invocations. Packages
+	// whose sources, imported packages and translation options are unchanged are restored from the cache
+	// instead of being translated again. DefaultCacheDir() returns the standard location. Results are not
+	// cached when OnTranslate, Passes, Plugins, Explain, Build, ManifestPath or debug outputs are set. Packages
+	// returned by TranslatePackages, TranslatePackagesWithReport and Watch are always translated since
+	// TransPoints(), Report() and Validate() need translation points. When empty, nothing is cached.
+	CacheDir string
+	// GoList is a flag to discover packages with `go list -find` instead of walking directories. Discovery
+	// matches the go tool: build constraints are respected, directories such as testdata are skipped and
+	// patterns such as ./... or import paths can be given as paths. Ignore files and FollowSymlinks are
+	// not applied. Paths of Go files are handled as usual.
+	GoList bool
+	// BatchSize is the maximum number of package directories generated at once. Packages are ordered so that
+	// dependencies come first and each batch is translated, written and released before the next batch,
+	// so memory stays bounded on very large inputs. Hooks run per batch. It cannot be used with Flatten nor
+	// Build. When zero, all packages are generated at once.
+	BatchSize int
+	// ManifestPath is a file path to write JSON manifest of generated files. Paths in the manifest are
+	// relative to the directory of the manifest file. When empty, no manifest is written.
+	ManifestPath string
+	// targetFiles is a map from package directory to names of files to be generated. It is set when
+	// file paths are given to PackageDirs(). Packages not in this map are entirely generated.
+	targetFiles map[string]map[string]struct{}
+	// noFixImports is true when translated packages are not moved so that import paths need not to be
+	// fixed. It is set by daemon to respond quickly.
+	noFixImports bool
+	// watched is a map from source directory to package generated by Watch. Imports of them in packages
+	// generated later are fixed even if they are not generated again.
+	watched map[string][]*Package
+	// batchStubs is a map from source directory to stubs of packages generated in batches. Imports of them
+	// in packages of the current batch are fixed. It is set while generating packages in batches.
+	batchStubs map[string][]*Package
+	// cacheGenerated is true while generating packages which are not returned to callers. Translation
+	// results are cached only then since packages restored from the cache have no translation points.
+	cacheGenerated bool
+	// goGenerate is an environment of `go generate` which runs trygo. It is nil when trygo was not run
+	// from `go generate`.
+	goGenerate *goGenerateEnv
+}
+
+// goGenerateEnv is an environment given by `go generate` to the command in //go:generate directive.
+type goGenerateEnv struct {
+	// dir is a directory of the package containing the directive.
+	dir string
+	// file is a base name of the file containing the directive ($GOFILE).
+	file string
+	// line is a line number of the directive ($GOLINE).
+	line string
+	// pkg is a name of the package containing the directive ($GOPACKAGE).
+	pkg string
+}
+
+func (env *goGenerateEnv) String() string {
+	return env.file + ":" + env.line
+}
+
+// lookupGoGenerateEnv returns the environment of `go generate`. `go generate` always sets $GOFILE,
+// $GOLINE, $GOPACKAGE and $DOLLAR. When some of them are missing, trygo was not run from `go generate`.
+func lookupGoGenerateEnv() (*goGenerateEnv, bool) {
+	env := &goGenerateEnv{dir: cwd}
+	for _, v := range []struct {
+		name string
+		dst  *string
+	}{
+		{"GOFILE", &env.file},
+		{"GOLINE", &env.line},
+		{"GOPACKAGE", &env.pkg},
+		{"DOLLAR", nil},
+	} {
+		s, ok := os.LookupEnv(v.name)
+		if !ok {
+			return nil, false
+		}
+		if v.dst != nil {
+			*v.dst = s
+		}
+	}
+	return env, true
 }
 
 func (gen *Gen) packageDirsForGoGenerate() ([]string, error) {
-	if _, ok := os.LookupEnv("GOFILE"); !ok {
-		return nil, errors.New("`trygo` was not run from `go generate` and no path is given. Nothing to generate")
+	lg := gen.lg()
+	env, ok := lookupGoGenerateEnv()
+	if !ok {
+		return nil, errors.New("`trygo` was not run from `go generate` and no path is given. Nothing to generate. $GOFILE, $GOLINE, $GOPACKAGE and $DOLLAR must be set by `go generate`")
+	}
+	gen.goGenerate = env
+	lg.log("Collect package dir for `go generate`:", cwd, "at", lg.hi(env), "in package", lg.hi(env.pkg))
+
+	gen.targetFiles = map[string]map[string]struct{}{}
+	if gen.GoGenerateFileOnly {
+		lg.log("Only", lg.hi(env.file), "in package", lg.hi(env.pkg), "will be generated")
+		gen.targetFiles[cwd] = map[string]struct{}{filepath.Base(env.file): {}}
 	}
-	log("Collect package dir for `go generate`:", cwd)
 	return []string{cwd}, nil
 }
 
+// inOutDir returns whether the path is the output directory or is under it.
+func (gen *Gen) inOutDir(path string) bool {
+	return gen.OutDir != "" && (path == gen.OutDir || strings.HasPrefix(path, gen.OutDir+string(filepath.Separator)))
+}
+
+// walkPackageDirs walks the directory tree at root and collects directories containing Go files into saw.
+// display is a path of root shown to users. It is different from root only when walking a directory
+// pointed by a symbolic link. visited remembers real paths of walked directories to detect cycles of
+// symbolic links.
+func (gen *Gen) walkPackageDirs(root, display string, rules ignoreRules, saw, visited map[string]struct{}) error {
+	lg := gen.lg()
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		p = filepath.Join(display, strings.TrimPrefix(p, root))
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !gen.FollowSymlinks {
+				if st, err := os.Stat(p); err == nil && st.IsDir() {
+					lg.log("Skip symbolic link to directory:", relpath(p))
+					return nil
+				}
+				// Symbolic links to files are collected as regular files
+			} else {
+				real, err := filepath.EvalSymlinks(p)
+				if err != nil {
+					return err
+				}
+				if info, err = os.Stat(real); err != nil {
+					return err
+				}
+				if info.IsDir() {
+					if rules.ignored(p, true) {
+						lg.log("Ignored by ignore file:", relpath(p))
+						return nil
+					}
+					lg.log("Follow symbolic link", relpath(p), "->", relpath(real))
+					return gen.walkPackageDirs(real, p, rules, saw, visited)
+				}
+			}
+		}
+
+		if rules.ignored(p, info.IsDir()) {
+			lg.log("Ignored by ignore file:", relpath(p))
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if gen.inOutDir(p) && !gen.DualBuild {
+				// Previously generated files in output directory must not be translated again
+				lg.log("Skip output directory:", relpath(p))
+				return filepath.SkipDir
+			}
+			if gen.FollowSymlinks {
+				real, err := filepath.EvalSymlinks(p)
+				if err != nil {
+					return err
+				}
+				if gen.inOutDir(real) && !gen.DualBuild {
+					lg.log("Skip output directory pointed by symbolic link:", relpath(p))
+					return filepath.SkipDir
+				}
+				if _, ok := visited[real]; ok {
+					lg.log("Skip directory already visited via symbolic link:", relpath(p))
+					return filepath.SkipDir
+				}
+				visited[real] = struct{}{}
+			}
+			rules, err = rules.readIgnoreFiles(p, lg)
+			return err
+		}
+		if !strings.HasSuffix(p, ".go") {
+			return nil
+		}
+		saw[filepath.Dir(p)] = struct{}{}
+		return nil
+	})
+}
+
 func (gen *Gen) packageDirsFromPaths(paths []string) ([]string, error) {
-	log("Collect package dir for given paths:", hi(paths))
+	lg := gen.lg()
+	lg.log("Collect package dir for given paths:", lg.hi(paths))
 
 	saw := map[string]struct{}{}
+	visited := map[string]struct{}{}
+	files := map[string]map[string]struct{}{}
+	patterns := []string{}
 	for _, path := range paths {
+		if gen.GoList {
+			if s, err := os.Stat(path); err != nil || !s.IsDir() && !strings.HasSuffix(path, ".go") {
+				// Package patterns like ./... or import paths
+				patterns = append(patterns, path)
+				continue
+			}
+		}
 		if !filepath.IsAbs(path) {
 			path = filepath.Join(cwd, path)
 		}
-		if err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if info.IsDir() {
-				return nil
-			}
-			if !strings.HasSuffix(p, ".go") {
-				return nil
+		if s, err := os.Stat(path); err == nil && !s.IsDir() && strings.HasSuffix(path, ".go") {
+			// Only the file is translated. Other files in the same directory are parsed as the package
+			// context but not generated
+			dir, name := filepath.Split(path)
+			dir = filepath.Clean(dir)
+			if _, ok := files[dir]; !ok {
+				files[dir] = map[string]struct{}{}
 			}
-			if gen.OutDir != "" && strings.HasPrefix(p, gen.OutDir) {
-				// When the Go file is in output directory, it is ignored
-				return nil
+			files[dir][name] = struct{}{}
+			lg.log("File", lg.hi(name), "in", relpath(dir), "is given")
+			continue
+		}
+		if gen.GoList {
+			// Directories are listed recursively as they are walked
+			if err := gen.goListPackageDirs(path, []string{"./..."}, saw); err != nil {
+				return nil, err
 			}
-			saw[filepath.Dir(p)] = struct{}{}
-			return nil
-		}); err != nil {
+			continue
+		}
+		if err := gen.walkPackageDirs(path, path, nil, saw, visited); err != nil {
 			return nil, errors.Wrapf(err, "Cannot read directory %q", path)
 		}
 	}
+	if len(patterns) > 0 {
+		if err := gen.goListPackageDirs(cwd, patterns, saw); err != nil {
+			return nil, err
+		}
+	}
+
+	gen.targetFiles = map[string]map[string]struct{}{}
+	for dir, names := range files {
+		if _, ok := saw[dir]; ok {
+			// The directory itself is also given. All files in it are translated
+			continue
+		}
+		gen.targetFiles[dir] = names
+		saw[dir] = struct{}{}
+	}
 
 	l := len(saw)
 	if l == 0 {
@@ -74,13 +423,19 @@ func (gen *Gen) packageDirsFromPaths(paths []string) ([]string, error) {
 	for dir := range saw {
 		dirs = append(dirs, dir)
 	}
+	sort.Strings(dirs)
 
 	return dirs, nil
 }
 
-// PackageDirs collects package directories under given paths. If paths argument is empty, it collects
-// a package directory as `go generate` runs trygo. If no Go package is found or pacakge directory
-// cannot be read, this function returns an error.
+// PackageDirs collects package directories under given paths. When a path to Go file is given, the directory
+// containing the file is collected as package directory and only the file is generated at later generation
+// with other files in the package as context. If paths argument is empty, it collects
+// a package directory as `go generate` runs trygo. Files and directories matched by patterns in .gitignore
+// or .trygoignore are skipped while walking. The output directory and directories in it are also skipped not
+// to translate generated files again. When GoList is set, packages are listed by `go list -find` instead of
+// walking directories. If no Go package is found or pacakge directory cannot be read, this function returns
+// an error.
 func (gen *Gen) PackageDirs(paths []string) ([]string, error) {
 	if len(paths) == 0 {
 		return gen.packageDirsForGoGenerate()
@@ -88,11 +443,56 @@ func (gen *Gen) PackageDirs(paths []string) ([]string, error) {
 	return gen.packageDirsFromPaths(paths)
 }
 
+// checkOutPathTemplate checks OutPathTemplate is valid.
+func (gen *Gen) checkOutPathTemplate() error {
+	if gen.DualBuild && (gen.Flatten || gen.OutPathTemplate != "") {
+		return errors.New("Dual-build layout cannot be used with flattening output directory nor output path template")
+	}
+	tmpl := gen.OutPathTemplate
+	if tmpl == "" {
+		return nil
+	}
+	if gen.Flatten {
+		return errors.New("Output path template cannot be used with flattening output directory")
+	}
+	dir := strings.TrimSuffix(filepath.ToSlash(tmpl), "/{filename}")
+	if dir == filepath.ToSlash(tmpl) || strings.Contains(dir, "{filename}") {
+		return errors.Errorf("Output path template must end with /{filename} and contain {filename} only once: %q", tmpl)
+	}
+	return nil
+}
+
 // outDirPath calculates output directory where a translated package should be generated for given path.
 // It consists the same directory structure as given path in output directory. For example, when input
 // path is /path/to/src/foo and output path is /path/to/out, the output directory for the input path
-// will be /path/to/out/src/foo.
-func (gen *Gen) outDirPath(inpath string) string {
+// will be /path/to/out/src/foo. When OutPathTemplate is set, the directory follows the template. In
+// dual-build layout, the directory is the input path.
+func (gen *Gen) outDirPath(inpath, pkgName string) string {
+	if gen.DualBuild {
+		return inpath
+	}
+	if gen.Flatten {
+		return gen.OutDir
+	}
+	if gen.OutPathTemplate != "" {
+		dir := strings.TrimSuffix(filepath.ToSlash(gen.OutPathTemplate), "/{filename}")
+		dir = strings.NewReplacer(
+			"{outdir}", filepath.ToSlash(gen.OutDir),
+			"{relpkg}", strings.TrimPrefix(filepath.ToSlash(gen.relPkgDir(inpath)), "/"),
+			"{pkgdir}", filepath.ToSlash(inpath),
+			"{pkgname}", pkgName,
+		).Replace(dir)
+		dir = filepath.FromSlash(dir)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(cwd, dir)
+		}
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(gen.OutDir, gen.relPkgDir(inpath))
+}
+
+// relPkgDir returns the package directory relative to the common ancestor of it and output directory.
+func (gen *Gen) relPkgDir(inpath string) string {
 	// outDir: /repo/out
 	// package: /repo/foo/bar
 
@@ -102,74 +502,439 @@ func (gen *Gen) outDirPath(inpath string) string {
 	}
 	// d: /repo
 
-	// part: /foo/bar
-	part := strings.TrimPrefix(inpath, d)
+	// return: /foo/bar
+	return strings.TrimPrefix(inpath, d)
+}
 
-	// return: /repo/out/foo/bar
-	return filepath.Join(gen.OutDir, part)
+func (gen *Gen) lg() logger {
+	if gen.Logger == nil {
+		return logger{defaultLogger}
+	}
+	return logger{gen.Logger}
+}
+
+func (gen *Gen) out() io.Writer {
+	if gen.Out == nil {
+		return os.Stdout
+	}
+	return gen.Out
+}
+
+func (gen *Gen) errOut() io.Writer {
+	if gen.Err == nil {
+		return os.Stderr
+	}
+	return gen.Err
+}
+
+func (gen *Gen) warnOut() io.Writer {
+	if gen.Warn == nil {
+		return os.Stderr
+	}
+	return gen.Warn
+}
+
+func (gen *Gen) warn(msg string) {
+	gen.lg().log("Warning:", msg)
+	fmt.Fprintln(gen.warnOut(), "Warning:", msg)
+}
+
+func (gen *Gen) notice(msg string) {
+	gen.lg().log("Notice:", msg)
+	fmt.Fprintln(gen.warnOut(), "Notice:", msg)
+}
+
+// fileNameTemplate returns FileNameTemplate with default template of dual-build layout.
+func (gen *Gen) fileNameTemplate() string {
+	if gen.FileNameTemplate == "" && gen.DualBuild {
+		return dualBuildFileNameTemplate
+	}
+	return gen.FileNameTemplate
+}
+
+// outFileName returns a file name of generated file from the source file name following FileNameTemplate.
+func (gen *Gen) outFileName(name string) (string, error) {
+	tmpl := gen.fileNameTemplate()
+	if !strings.Contains(tmpl, "{name}") || !strings.HasSuffix(tmpl, ".go") {
+		return "", errors.Errorf("File name template must contain {name} and end with .go: %q", tmpl)
+	}
+	stem := strings.TrimSuffix(name, ".go")
+	test := strings.HasSuffix(stem, "_test")
+	if test {
+		stem = strings.TrimSuffix(stem, "_test")
+	}
+	out := strings.Replace(tmpl, "{name}", stem, -1)
+	if test {
+		out = strings.TrimSuffix(out, ".go") + "_test.go"
+	}
+	return out, nil
+}
+
+func checkFlattenPackageNames(pkgs []*Package) error {
+	name := ""
+	for _, pkg := range pkgs {
+		n := strings.TrimSuffix(pkg.Node.Name, "_test")
+		if name == "" {
+			name = n
+			continue
+		}
+		if n != name {
+			return errors.Errorf("Packages cannot be flattened into one directory since their names are different: %q at %s and %q", pkg.Node.Name, pkg.Birth, name)
+		}
+	}
+	return nil
+}
+
+// renameFlattenConflicts renames output files which have the same path in flattened output directory.
+// Conflicting file is prefixed with base name of its source directory like foo_bar.go.
+func renameFlattenConflicts(pkgs []*Package) {
+	used := map[string]struct{}{}
+	for _, pkg := range pkgs {
+		for _, path := range sortedFilePaths(pkg.Node.Files) {
+			to := path
+			dir, name := filepath.Split(path)
+			prefix := filepath.Base(pkg.Birth)
+			for i := 1; ; i++ {
+				if _, ok := used[to]; !ok {
+					break
+				}
+				to = filepath.Join(dir, prefix+"_"+name)
+				prefix = fmt.Sprintf("%s%d", filepath.Base(pkg.Birth), i)
+			}
+			used[to] = struct{}{}
+			if to != path {
+				pkg.renameFile(path, to)
+			}
+		}
+	}
+}
+
+// checkOutputCollisions detects output paths which are shared by multiple sources. They would silently
+// overwrite each other on writing files.
+func (gen *Gen) checkOutputCollisions(pkgs []*Package) error {
+	dirs := map[string]map[string]struct{}{}
+	files := map[string][]string{}
+	for _, pkg := range pkgs {
+		if _, ok := dirs[pkg.Path]; !ok {
+			dirs[pkg.Path] = map[string]struct{}{}
+		}
+		dirs[pkg.Path][pkg.Birth] = struct{}{}
+		for path := range pkg.Node.Files {
+			if pkg.isTarget(path) {
+				files[path] = append(files[path], pkg.sourceOf(path))
+			}
+		}
+	}
+
+	msgs := []string{}
+	if !gen.Flatten {
+		// Packages in different directories must not be mixed in one output directory
+		for out, set := range dirs {
+			if len(set) > 1 {
+				srcs := make([]string, 0, len(set))
+				for src := range set {
+					srcs = append(srcs, src)
+				}
+				sort.Strings(srcs)
+				msgs = append(msgs, fmt.Sprintf("output directory %s is shared by %s", out, strings.Join(srcs, ", ")))
+			}
+		}
+	}
+	for out, srcs := range files {
+		if len(srcs) > 1 {
+			sort.Strings(srcs)
+			msgs = append(msgs, fmt.Sprintf("output file %s is shared by %s", out, strings.Join(srcs, ", ")))
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+	sort.Strings(msgs)
+	return errors.Errorf("%d collision(s) of output paths were detected:\n  %s", len(msgs), strings.Join(msgs, "\n  "))
 }
 
 // ParsePackages parses given package directories and returns parsed packages.
 // Output directory where translated package is put is calculated based on output directory.
+// Each package directory is parsed with its own token.FileSet so that the packages can be processed
+// independently. When KeepGoing is true, directories which failed to be parsed are skipped and parsed
+// packages are returned with *PartialError.
 func (gen *Gen) ParsePackages(pkgDirs []string) ([]*Package, error) {
+	lg := gen.lg()
+	if err := gen.checkOutPathTemplate(); err != nil {
+		return nil, err
+	}
 	parsed := make([]*Package, 0, len(pkgDirs))
-	fset := token.NewFileSet()
+	failed := []error{}
 	for _, dir := range pkgDirs {
-		pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+		// Each package directory has its own file set so that packages do not share any state and can be
+		// processed independently
+		fset := token.NewFileSet()
+		var untagged map[string][]byte
+		if gen.DualBuild {
+			u, err := gen.untaggedDualBuildSources(dir)
+			if err != nil {
+				return nil, err
+			}
+			untagged = u
+		}
+		start := time.Now()
+		pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseComments)
+		elapsed := time.Since(start)
 		if err != nil {
-			return nil, err
+			if !gen.KeepGoing {
+				return nil, err
+			}
+			lg.log("Keep going after failure of parsing", dir, err)
+			failed = append(failed, err)
+			continue
 		}
-		for _, pkg := range pkgs {
-			parsed = append(parsed, NewPackage(pkg, dir, gen.outDirPath(dir), fset))
+		names := make([]string, 0, len(pkgs))
+		for name := range pkgs {
+			names = append(names, name)
 		}
+		sort.Strings(names)
+
+		targets, onlyTargets := gen.targetFiles[dir]
+		for _, n := range names {
+			pkg := pkgs[n]
+			if env := gen.goGenerate; env != nil && env.dir == dir && env.pkg != pkg.Name {
+				// Only the package invoking `go generate` is translated. For example, external test package
+				// foo_test is not translated by //go:generate directive in package foo
+				lg.log("Skip package", pkg.Name, "since $GOPACKAGE is", env.pkg)
+				continue
+			}
+			if !gen.skipGeneratedFiles(pkg) {
+				lg.log("Skip package", pkg.Name, "since all files in it were generated by trygo")
+				continue
+			}
+			p := NewPackage(pkg, dir, gen.outDirPath(dir, pkg.Name), fset)
+			p.lg = gen.lg()
+			p.addTiming(PhaseParse, elapsed)
+			if onlyTargets {
+				found := false
+				for path := range pkg.Files {
+					if _, ok := targets[filepath.Base(path)]; ok {
+						found = true
+						break
+					}
+				}
+				if !found {
+					lg.log("Skip package", pkg.Name, "since it contains no given file")
+					continue
+				}
+				p.targets = targets
+			}
+			if gen.DualBuild {
+				for path := range pkg.Files {
+					if src, ok := untagged[path]; ok {
+						if p.untagged == nil {
+							p.untagged = map[string][]byte{}
+						}
+						p.untagged[path] = src
+					}
+				}
+				ok, err := p.setDualBuildTargets()
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					lg.log("Skip package", pkg.Name, "since it contains no file tagged with", dualBuildTag)
+					continue
+				}
+			}
+			parsed = append(parsed, p)
+		}
+	}
+	if len(failed) > 0 {
+		return parsed, &PartialError{failed, parsed}
 	}
 	return parsed, nil
 }
 
 // TranslatePackages translates all packages specified with directory paths. It returns slice of Package
 // which represent translated packages. When parsing Go(TryGo) sources failed or the translations failed,
-// this function returns an error.
+// this function returns an error. When KeepGoing is true and translations of some packages failed, it
+// returns successfully translated packages with *PartialError.
 func (gen *Gen) TranslatePackages(pkgDirs []string) ([]*Package, error) {
-	log("Parse package directories:", pkgDirs)
+	gen.lg().log("Parse package directories:", pkgDirs)
+
+	// Errors of failed packages with KeepGoing
+	var failed []error
 
 	parsed, err := gen.ParsePackages(pkgDirs)
 	if err != nil {
-		return nil, err
+		p, ok := err.(*PartialError)
+		if !ok {
+			return nil, err
+		}
+		failed = p.Errs
+	}
+
+	if gen.Flatten {
+		if err := checkFlattenPackageNames(parsed); err != nil {
+			return nil, err
+		}
+	}
+
+	if gen.DualBuild {
+		for _, pkg := range parsed {
+			if err := pkg.parseTaggedSources(); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Translate all parsed ASTs per package
-	if err := Translate(parsed); err != nil {
+	if err := gen.translate(parsed); err != nil {
+		p, ok := err.(*PartialError)
+		if !ok {
+			return nil, err
+		}
+		failed = append(failed, p.Errs...)
+		parsed = p.Translated
+	}
+
+	if gen.DualBuild {
+		for _, pkg := range parsed {
+			if err := pkg.invertDualBuildConstraints(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if gen.fileNameTemplate() != "" {
+		for _, pkg := range parsed {
+			for _, path := range sortedFilePaths(pkg.Node.Files) {
+				dir, name := filepath.Split(path)
+				renamed, err := gen.outFileName(name)
+				if err != nil {
+					return nil, err
+				}
+				pkg.renameFile(path, filepath.Join(dir, renamed))
+			}
+		}
+	}
+
+	if gen.Flatten {
+		renameFlattenConflicts(parsed)
+	}
+
+	if err := gen.checkOutputCollisions(parsed); err != nil {
 		return nil, err
 	}
 
+	if len(failed) > 0 {
+		return parsed, &PartialError{failed, parsed}
+	}
 	return parsed, nil
 }
 
+// generatePackages translates packages in given directories and writes generated files and other files
+// required to build them to output directories. It returns the translated packages. When KeepGoing is
+// true, successfully translated packages are generated and returned with *PartialError.
+func (gen *Gen) generatePackages(pkgDirs []string) ([]*Package, error) {
+	pkgs, partial := gen.TranslatePackages(pkgDirs)
+	if _, ok := partial.(*PartialError); partial != nil && !ok {
+		return nil, partial
+	}
+	gen.lg().log("Translation done:", len(pkgs), "packages")
+
+	if err := gen.runHooks(gen.PreHooks, pkgs); err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range pkgs {
+		if err := pkg.Write(); err != nil {
+			return nil, err
+		}
+		if gen.DualBuild {
+			if err := gen.tagDualBuildSources(pkg); err != nil {
+				return nil, err
+			}
+		}
+		if !gen.Quiet {
+			fmt.Fprintln(gen.out(), pkg.Path)
+		}
+	}
+
+	if err := gen.copyCompanionFiles(pkgs); err != nil {
+		return nil, err
+	}
+
+	if gen.CopyAssets {
+		if err := gen.copyAssets(pkgs); err != nil {
+			return nil, errors.Wrap(err, "Cannot copy assets")
+		}
+	}
+
+	if err := gen.relocateEmbeddedFiles(pkgs); err != nil {
+		return nil, err
+	}
+
+	if err := gen.runHooks(gen.PostHooks, pkgs); err != nil {
+		return nil, err
+	}
+
+	return pkgs, partial
+}
+
 // GeneratePackages translates all TryGo packages specified with directory paths and generates translated
-// Go files with the same directory structures under output directory.
+// Go files with the same directory structures under output directory. Non-Go source files required for
+// building the packages such as assembly and files embedded with //go:embed are copied to the output
+// directories. When ManifestPath is set, JSON manifest of the generated files is written to the path
+// after generation.
 // When 'verify' argument is set to true, translated packages are verified with type checks after
 // generating the Go files. When the verification reports some errors, generated Go files would be broken.
 // This verification is mainly used for debugging.
 // When parsing Go(TryGo) sources failed or the translations failed, translated Go file could not
-// be written, this function returns an error.
+// be written, this function returns an error. When KeepGoing is true and translations of some packages
+// failed, other packages are generated and *PartialError is returned.
 func (gen *Gen) GeneratePackages(pkgDirs []string, verify bool) error {
-	pkgs, err := gen.TranslatePackages(pkgDirs)
-	if err != nil {
+	gen.cacheGenerated = true
+	defer func() { gen.cacheGenerated = false }()
+
+	if gen.BatchSize > 0 {
+		return gen.generateInBatches(pkgDirs, verify)
+	}
+
+	pkgs, partial := gen.generatePackages(pkgDirs)
+	if _, ok := partial.(*PartialError); partial != nil && !ok {
+		return partial
+	}
+	if err := gen.finishBatch(pkgs, verify); err != nil {
 		return err
 	}
-	log("Translation done:", len(pkgs), "packages")
 
-	for _, pkg := range pkgs {
-		if err := pkg.Write(); err != nil {
+	var m *Manifest
+	if gen.ManifestPath != "" {
+		base, err := gen.manifestBase()
+		if err != nil {
+			return err
+		}
+		if m, err = newManifest(pkgs, base); err != nil {
 			return err
 		}
-		fmt.Fprintln(gen.Writer, pkg.Path)
+	}
+	if err := gen.finishGeneration(pkgs, m); err != nil {
+		return err
+	}
+
+	return partial
+}
+
+// finishBatch outputs timings of the generated packages and verifies them when 'verify' is true.
+func (gen *Gen) finishBatch(pkgs []*Package, verify bool) error {
+	if gen.TraceTimings {
+		for _, pkg := range pkgs {
+			fmt.Fprintln(gen.warnOut(), "Timing:", pkg.Report())
+		}
 	}
 
 	if verify {
 		for _, pkg := range pkgs {
 			if !pkg.modified {
-				log("Skip verification of unmodified package", pkg.Node.Name, "translated from", relpath(pkg.Birth))
+				gen.lg().log("Skip verification of unmodified package", pkg.Node.Name, "translated from", relpath(pkg.Birth))
 				continue
 			}
 			if err := pkg.Verify(); err != nil {
@@ -181,6 +946,43 @@ func (gen *Gen) GeneratePackages(pkgDirs []string, verify bool) error {
 	return nil
 }
 
+// manifestBase returns a directory path which paths in the manifest are relative to.
+func (gen *Gen) manifestBase() (string, error) {
+	path, err := filepath.Abs(gen.ManifestPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(path), nil
+}
+
+// finishGeneration runs steps after all packages were generated. It reports reverse dependencies, writes
+// the manifest when it is not nil and builds the output directory.
+func (gen *Gen) finishGeneration(pkgs []*Package, m *Manifest) error {
+	if gen.CheckReverseDeps {
+		for _, msg := range gen.findReverseDeps(pkgs) {
+			gen.warn(msg)
+		}
+	}
+
+	if m != nil {
+		path, err := filepath.Abs(gen.ManifestPath)
+		if err != nil {
+			return err
+		}
+		if err := m.writeFile(path, gen.lg()); err != nil {
+			return err
+		}
+	}
+
+	if gen.Build {
+		if err := gen.buildOutput(pkgs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Generate collects all TryGo packages under given paths, translates all the TryGo packages specified
 // with directory paths and generates translated Go files with the same directory structures under
 // output directory.
@@ -188,33 +990,43 @@ func (gen *Gen) GeneratePackages(pkgDirs []string, verify bool) error {
 // generating the Go files. When the verification reports some errors, generated Go files would be broken.
 // This verification is mainly used for debugging.
 // When collecting TryGo packages from paths failed, packages parsing TryGo sources failed or the translations
-// failed, translated Go file could not be written, this function returns an error.
+// failed, translated Go file could not be written, this function returns an error. When run from
+// `go generate`, the error is wrapped with the position of //go:generate directive. Use errors.Cause() to
+// get the original error.
 func (gen *Gen) Generate(paths []string, verify bool) error {
-	log("Start translation and generation for", paths)
+	lg := gen.lg()
+	lg.log("Start translation and generation for", paths)
 
 	dirs, err := gen.PackageDirs(paths)
 	if err != nil {
 		return err
 	}
-	log("Package directories:", hi(dirs))
+	lg.log("Package directories:", lg.hi(dirs))
 
 	if err := os.MkdirAll(gen.OutDir, 0755); err != nil {
 		return errors.Wrapf(err, "Cannot create output directory %q", gen.OutDir)
 	}
-	log("Created outdir:", hi(gen.OutDir))
+	lg.log("Created outdir:", lg.hi(gen.OutDir))
 
-	return gen.GeneratePackages(dirs, verify)
+	if err := gen.GeneratePackages(dirs, verify); err != nil {
+		if env := gen.goGenerate; env != nil {
+			return errors.Wrapf(err, "Generation by //go:generate directive at %s in package %s failed", env, env.pkg)
+		}
+		return err
+	}
+	return nil
 }
 
 // Check checks packages in given paths. Nothing is generated. When check was OK, it returns nil.
 func (gen *Gen) Check(paths []string) error {
-	log("Start check for", paths)
+	lg := gen.lg()
+	lg.log("Start check for", paths)
 
 	dirs, err := gen.PackageDirs(paths)
 	if err != nil {
 		return err
 	}
-	log("Package directories:", hi(dirs))
+	lg.log("Package directories:", lg.hi(dirs))
 
 	pkgs, err := gen.ParsePackages(dirs)
 	if err != nil {
@@ -224,6 +1036,45 @@ func (gen *Gen) Check(paths []string) error {
 	return Check(pkgs)
 }
 
+// CheckReport is the same as Check but writes problems found by the check to w as a report in the format.
+// Available formats are "sarif" (SARIF 2.1.0 log), "checkstyle" (checkstyle XML), "junit" (JUnit XML
+// which has one test case per package) and "github" (`::error` workflow commands of GitHub Actions). The
+// report is written even when no problem was found. It returns an error when some problem was found.
+func (gen *Gen) CheckReport(paths []string, format string, w io.Writer) error {
+	lg := gen.lg()
+	lg.log("Start check with", format, "report for", paths)
+
+	write, ok := reportWriters[format]
+	if !ok {
+		return errors.Errorf("Unknown report format %q. Available formats are \"sarif\", \"checkstyle\", \"junit\" and \"github\"", format)
+	}
+
+	dirs, err := gen.PackageDirs(paths)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := gen.ParsePackages(dirs)
+	if err != nil {
+		return err
+	}
+
+	results := make([]*checkResult, 0, len(pkgs))
+	num := 0
+	for _, pkg := range pkgs {
+		diags := gen.CheckPackages([]*Package{pkg})
+		results = append(results, &checkResult{pkg, diags})
+		num += len(diags)
+	}
+	if err := write(w, results); err != nil {
+		return errors.Wrapf(err, "Cannot write %s report", format)
+	}
+	if num > 0 {
+		return errors.Errorf("%d problem(s) were found by check", num)
+	}
+	return nil
+}
+
 // NewGen creates a new Gen instance with given output directory. All translated packages are generated
 // under the output directory. When the output directory does not exist, it is automatically created.
 func NewGen(outDir string) (*Gen, error) {
@@ -233,5 +1084,6 @@ func NewGen(outDir string) (*Gen, error) {
 	if !filepath.IsAbs(outDir) {
 		outDir = filepath.Join(cwd, outDir)
 	}
-	return &Gen{outDir, os.Stdout}, nil
+	outDir = filepath.Clean(outDir)
+	return &Gen{OutDir: outDir, Out: os.Stdout}, nil
 }
@@ -1,14 +1,22 @@
 package trygo_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"github.com/rhysd/go-fakeio"
 	"github.com/rhysd/go-tmpenv"
 	"github.com/rhysd/trygo"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestGenerateOK(t *testing.T) {
@@ -88,6 +96,60 @@ func TestGenerateOK(t *testing.T) {
 	}
 }
 
+func TestGenerateInBatches(t *testing.T) {
+	base := filepath.Join("testdata", "gen", "ok")
+	os.RemoveAll(filepath.Join(base, "HAVE", "nested"))
+	manifest, err := ioutil.TempFile("", "trygo-batch-manifest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Close()
+	defer os.Remove(manifest.Name())
+
+	gen, err := trygo.NewGen(filepath.Join(base, "HAVE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	gen.BatchSize = 1
+	gen.ManifestPath = manifest.Name()
+
+	// Package 'b' imports package 'a' in the other batch
+	if err := gen.Generate([]string{filepath.Join(base, "nested")}, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{filepath.Join("a", "foo.go"), filepath.Join("b", "bar.go")} {
+		want, err := ioutil.ReadFile(filepath.Join(base, "WANT", "nested", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := ioutil.ReadFile(filepath.Join(base, "HAVE", "nested", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, have) {
+			t.Fatalf("Translation result does not match at %s\nwanted:\n%s\nbut have:\n%s\n", f, want, have)
+		}
+	}
+
+	b, err := ioutil.ReadFile(manifest.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m trygo.Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 || path.Base(m.Files[0].Source) != "foo.go" || path.Base(m.Files[1].Source) != "bar.go" {
+		t.Fatal("Files in all batches should be in manifest:", string(b))
+	}
+
+	gen.Flatten = true
+	if err := gen.Generate([]string{filepath.Join(base, "nested")}, false); err == nil || !strings.Contains(err.Error(), "batches") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
 func TestGenerateGoGenerateOK(t *testing.T) {
 	defer os.Chdir(cwd)
 
@@ -96,9 +158,12 @@ func TestGenerateGoGenerateOK(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	tmp := tmpenv.New("GOFILE")
+	tmp := tmpenv.New("GOFILE", "GOLINE", "GOPACKAGE", "DOLLAR")
 	defer tmp.Restore()
 	os.Setenv("GOFILE", "foo.go")
+	os.Setenv("GOLINE", "3")
+	os.Setenv("GOPACKAGE", "foo")
+	os.Setenv("DOLLAR", "$")
 
 	gen, err := trygo.NewGen(".")
 	if err != nil {
@@ -159,6 +224,184 @@ func TestGenerateNewGenError(t *testing.T) {
 	}
 }
 
+func TestGenCheckReport(t *testing.T) {
+	paths := []string{
+		filepath.Join("testdata", "trans", "error", "noreturn"),
+		filepath.Join("testdata", "trans", "ok", "assign", "src"),
+	}
+	for _, tc := range []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: "checkstyle",
+			want: []string{
+				`<checkstyle version="4.3">`,
+				`<file name="testdata/trans/error/noreturn/err.go">`,
+				`<error line="8" column="2" severity="error" message="The function returns nothing.`,
+				`source="trygo.untranslatable-call"`,
+			},
+		},
+		{
+			format: "junit",
+			want: []string{
+				`<testsuites name="trygo" tests="2" failures="1">`,
+				`<testcase name="testdata/trans/error/noreturn" classname="foo">`,
+				`<failure message="1 problem(s) were found" type="check">testdata/trans/error/noreturn/err.go:8:2: The function returns nothing.`,
+				`<testcase name="testdata/trans/ok/assign/src" classname="main"></testcase>`,
+			},
+		},
+		{
+			format: "github",
+			want: []string{
+				"::error title=trygo (untranslatable-call),file=testdata/trans/error/noreturn/err.go,line=8,col=2::The function returns nothing.",
+			},
+		},
+		{
+			format: "sarif",
+			want: []string{
+				`"version": "2.1.0"`,
+				`"ruleId": "untranslatable-call"`,
+				`"uri": "testdata/trans/error/noreturn/err.go"`,
+			},
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := (&trygo.Gen{}).CheckReport(paths, tc.format, &buf)
+			if err == nil || !strings.Contains(err.Error(), "1 problem(s) were found") {
+				t.Fatal("Unexpected error:", err)
+			}
+			have := buf.String()
+			for _, want := range tc.want {
+				if !strings.Contains(have, want) {
+					t.Errorf("Wanted %q to be included in report:\n%s", want, have)
+				}
+			}
+		})
+	}
+
+	err := (&trygo.Gen{}).CheckReport(paths, "unknown", ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), `Unknown report format "unknown"`) {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestGenStagedPaths(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	root, err := ioutil.TempDir("", "trygo-staged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		t.Fatal(err)
+	}
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatal(args, err, string(out))
+		}
+	}
+	git("init", "-q")
+
+	files := map[string]string{}
+	for _, f := range []string{"a/a.go", "a/b.go", "b/b.go", "out/a/a.go", "c/readme.txt"} {
+		files[f] = "package foo\n"
+	}
+	writeFiles(t, root, files)
+	// b/b.go is not staged
+	git("add", "a/a.go", "a/b.go", "out/a/a.go", "c/readme.txt")
+
+	gen := &trygo.Gen{OutDir: filepath.Join(root, "out")}
+	have, err := gen.StagedPaths(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "a")}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("Wanted %v but got %v", want, have)
+	}
+
+	git("rm", "-q", "-r", "--cached", ".")
+	have, err = gen.StagedPaths(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have) != 0 {
+		t.Fatal("No path should be returned when nothing is staged:", have)
+	}
+}
+
+func TestGenChangedPaths(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	root, err := ioutil.TempDir("", "trygo-since")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		t.Fatal(err)
+	}
+
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=foo", "-c", "user.email=foo@example.com"}, args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatal(args, err, string(out))
+		}
+	}
+	write := func(path, content string) {
+		writeFiles(t, root, map[string]string{path: content})
+	}
+
+	write("go.mod", "module example.com/m\n\ngo 1.16\n")
+	write("a/a.go", "package a\n")
+	write("b/b.go", "package b\n\nimport _ \"example.com/m/a\"\n")
+	write("c/c.go", "package c\n\nimport _ \"example.com/m/b\"\n")
+	write("d/d.go", "package d\n")
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+
+	gen := &trygo.Gen{}
+	have, err := gen.ChangedPaths(root, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have) != 0 {
+		t.Fatal("No path should be returned when nothing was changed:", have)
+	}
+
+	// a is changed and e is untracked. b and c depend on a
+	write("a/a.go", "package a\n\nconst A = 1\n")
+	write("e/e.go", "package e\n")
+	have, err = gen.ChangedPaths(filepath.Join(root, "d"), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{}
+	for _, d := range []string{"a", "b", "c", "e"} {
+		want = append(want, filepath.Join(root, d))
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("Wanted %v but got %v", want, have)
+	}
+
+	if _, err := gen.ChangedPaths(root, "unknown-ref"); err == nil {
+		t.Fatal("Error did not occur for unknown ref")
+	}
+}
+
 func TestGenPackageDirsOutdirIsInInpath(t *testing.T) {
 	inpath := filepath.Join(cwd, "testdata", "gen", "pkgdirs", "outpath-is-in-inpath")
 	outdir := filepath.Join(inpath, "out") // Out path is subdirectory of input path
@@ -180,3 +423,1733 @@ func TestGenPackageDirsOutdirIsInInpath(t *testing.T) {
 		t.Fatal("output directory must not be translated")
 	}
 }
+
+func TestGenPackageDirsIgnoreFiles(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":              "# comment\n/build/\n*_gen\n",
+		".trygoignore":            "scratch\n!scratch/keep/\n",
+		"foo.go":                  "package foo\n",
+		"build/foo.go":            "package foo\n",
+		"sub/x_gen/foo.go":        "package foo\n",
+		"sub/build/foo.go":        "package foo\n",
+		"scratch/foo.go":          "package foo\n",
+		"scratch/keep/foo.go":     "package foo\n",
+		"nested/.trygoignore":     "*.go\n",
+		"nested/foo.go":           "package foo\n",
+		"nested/deeper/.keep":     "",
+		"nested/deeper/foo.go.md": "",
+	})
+	defer os.RemoveAll(root)
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, err := gen.PackageDirs([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct{}{
+		root:                                {},
+		filepath.Join(root, "sub", "build"): {},
+	}
+	if len(dirs) != len(want) {
+		t.Fatal("Unexpected package dirs:", dirs)
+	}
+	for _, d := range dirs {
+		if _, ok := want[d]; !ok {
+			t.Fatal("Unexpected package dir", d, "in", dirs)
+		}
+	}
+}
+
+func TestGenPackageDirsSymlinks(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"pkg/foo.go":    "package foo\n",
+		"shared/foo.go": "package foo\n",
+	})
+	defer os.RemoveAll(root)
+	if err := os.Symlink(filepath.Join(root, "shared"), filepath.Join(root, "pkg", "shared")); err != nil {
+		t.Skip("symbolic link is not available:", err)
+	}
+	// Cyclic link
+	if err := os.Symlink(root, filepath.Join(root, "shared", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	// Link to Go file
+	if err := os.Mkdir(filepath.Join(root, "pkg", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "shared", "foo.go"), filepath.Join(root, "pkg", "sub", "foo.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		follow bool
+		want   []string
+	}{
+		{false, []string{"pkg", "pkg/sub", "shared"}},
+		{true, []string{"pkg", "pkg/shared", "pkg/sub"}},
+	} {
+		gen, err := trygo.NewGen(filepath.Join(root, "out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.FollowSymlinks = tc.follow
+
+		dirs, err := gen.PackageDirs([]string{filepath.Join(root, "pkg"), filepath.Join(root, "shared")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dirs) != len(tc.want) {
+			t.Fatal("Unexpected package dirs with follow =", tc.follow, dirs)
+		}
+		for _, w := range tc.want {
+			w = filepath.Join(root, filepath.FromSlash(w))
+			found := false
+			for _, d := range dirs {
+				if d == w {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatal(w, "is not included with follow =", tc.follow, dirs)
+			}
+		}
+	}
+}
+
+func TestGenPackageDirsGoList(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command is not available:", err)
+	}
+
+	root := writeTree(t, map[string]string{
+		"go.mod":                "module example.com/m\n",
+		"foo/foo.go":            "package foo\n",
+		"foo/bar/bar.go":        "package bar\n",
+		"ignored/ignored.go":    "//go:build ignore\n\npackage ignored\n",
+		"testdata/data/data.go": "package data\n",
+		"out/foo/foo.go":        "package foo\n",
+		"nogo/README.txt":       "not a package\n",
+	})
+	defer os.RemoveAll(root)
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.GoList = true
+
+	dirs, err := gen.PackageDirs([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "foo"), filepath.Join(root, "foo", "bar")}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Fatalf("Wanted %v but got %v", want, dirs)
+	}
+
+	if _, err := gen.PackageDirs([]string{filepath.Join(root, "nogo")}); err == nil {
+		t.Fatal("Error should occur when no package is found")
+	}
+}
+
+func TestGenerateFileArgs(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-files-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+
+	file := filepath.Join("testdata", "gen", "files", "a.go")
+	if err := gen.Generate([]string{file}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var written []string
+	if err := filepath.Walk(outDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			written = append(written, filepath.Base(p))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(written) != 1 || written[0] != "a.go" {
+		t.Fatal("Only a.go should be generated but generated files are", written)
+	}
+}
+
+func TestGenerateGoGenerateFileOnly(t *testing.T) {
+	tmp := tmpenv.New("GOFILE", "GOPACKAGE", "GOLINE", "DOLLAR")
+	defer tmp.Restore()
+	os.Setenv("GOFILE", "generate.go")
+	os.Setenv("GOPACKAGE", "trygo")
+	os.Setenv("GOLINE", "10")
+	os.Setenv("DOLLAR", "$")
+
+	gen, err := trygo.NewGen(filepath.Join(cwd, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.GoGenerateFileOnly = true
+
+	dirs, err := gen.PackageDirs([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs, err := gen.ParsePackages(dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pkgs) != 1 || pkgs[0].Node.Name != "trygo" {
+		t.Fatal("Only package in $GOPACKAGE should be parsed:", pkgs)
+	}
+}
+
+func TestGenerateGoGenerateEnv(t *testing.T) {
+	tmp := tmpenv.New("GOFILE", "GOPACKAGE", "GOLINE", "DOLLAR")
+	defer tmp.Restore()
+	os.Setenv("GOFILE", "generate_test.go")
+	os.Setenv("GOPACKAGE", "trygo_test")
+	os.Setenv("GOLINE", "10")
+	os.Setenv("DOLLAR", "$")
+
+	gen, err := trygo.NewGen(filepath.Join(cwd, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, err := gen.PackageDirs([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := gen.ParsePackages(dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the invoking package is translated even if all files are generated
+	if len(pkgs) != 1 || pkgs[0].Node.Name != "trygo_test" {
+		t.Fatal("Only package in $GOPACKAGE should be parsed:", pkgs)
+	}
+
+	// $DOLLAR is always set by `go generate`
+	os.Unsetenv("DOLLAR")
+	if _, err := gen.PackageDirs([]string{}); err == nil || !strings.Contains(err.Error(), "not run from `go generate`") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestGenerateQuiet(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-quiet-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gen.Out = &buf
+	gen.Quiet = true
+
+	if err := gen.Generate([]string{filepath.Join("testdata", "gen", "ok", "simple")}, false); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("Nothing should be output in quiet mode:", buf.String())
+	}
+}
+
+func TestGenerateManifest(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-manifest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	gen.ManifestPath = filepath.Join(outDir, "manifest.json")
+
+	if err := gen.Generate([]string{filepath.Join("testdata", "gen", "ok", "multiple")}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(gen.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m trygo.Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Files) != 2 {
+		t.Fatal("Two files should be in manifest:", string(b))
+	}
+	for i, name := range []string{"bar.go", "foo.go"} {
+		f := m.Files[i]
+		if filepath.IsAbs(f.Source) || filepath.IsAbs(f.Output) {
+			t.Error("Paths in manifest should be relative at", i, f.Source, f.Output)
+		}
+		if path.Base(f.Source) != name || path.Base(f.Output) != name {
+			t.Error("Unexpected source or output path at", i, f.Source, f.Output)
+		}
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(f.Output))); err != nil {
+			t.Error("Output file in manifest does not exist:", err)
+		}
+		if len(f.SHA256) != 64 {
+			t.Error("Unexpected hash:", f.SHA256)
+		}
+		if f.NumTrans == 0 {
+			t.Error("Number of translations should not be zero for", name)
+		}
+	}
+}
+
+func TestGenerateCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "trygo-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	outDir, err := ioutil.TempDir("", "trygo-cache-out-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	dir := filepath.Join(cwd, "testdata", "gen", "ok", "simple")
+	newGen := func(okErr string) *trygo.Gen {
+		gen, err := trygo.NewGen(outDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.CacheDir = cacheDir
+		gen.OkError = okErr
+		return gen
+	}
+	generate := func(okErr string) string {
+		gen := newGen(okErr)
+		var buf bytes.Buffer
+		gen.Out = &buf
+		if err := gen.GeneratePackages([]string{dir}, false); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(strings.TrimSpace(buf.String()), "foo.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	want := generate("")
+	entries, err := filepath.Glob(filepath.Join(cacheDir, "*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatal("One cache entry should be stored:", entries)
+	}
+
+	// Rewrite the cached result to check it is reused instead of translating the package again
+	b, err := ioutil.ReadFile(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.Replace(b, []byte("func main()"), []byte("func cachedMain()"), 1)
+	if err := ioutil.WriteFile(entries[0], b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if have := generate(""); !strings.Contains(have, "func cachedMain()") {
+		t.Fatal("Cached result was not reused:", have)
+	}
+
+	// Different options must not hit the entry
+	if have := generate("ErrNotOk"); have != want {
+		t.Fatalf("Cache entry for different options was used. wanted:\n%s\nhave:\n%s", want, have)
+	}
+
+	// Packages returned to callers need translation points so they must not be restored from the cache
+	pkgs, err := newGen("").TranslatePackages([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || len(pkgs[0].TransPoints()) == 0 {
+		t.Fatal("Translation points should be collected:", pkgs)
+	}
+	var buf bytes.Buffer
+	if err := pkgs[0].WriteFileTo(&buf, filepath.Join(pkgs[0].Path, "foo.go")); err != nil {
+		t.Fatal(err)
+	}
+	if have := buf.String(); strings.Contains(have, "func cachedMain()") {
+		t.Fatal("Cached result was used for returned package:", have)
+	}
+
+	if err := trygo.CleanCache(cacheDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Fatal("Cache directory should be removed:", err)
+	}
+}
+
+func TestGenerateKeepGoing(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-keep-going-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gen.Out = &buf
+	gen.KeepGoing = true
+
+	dirs := []string{
+		filepath.Join(cwd, "testdata", "trans", "error", "num-try-args"),
+		filepath.Join(cwd, "testdata", "gen", "ok", "simple"),
+	}
+	err = gen.GeneratePackages(dirs, false)
+	perr, ok := err.(*trygo.PartialError)
+	if !ok {
+		t.Fatalf("Partial error should be returned but got %v", err)
+	}
+	if len(perr.Errs) != 1 || !strings.Contains(perr.Errs[0].Error(), "num-try-args") {
+		t.Fatal("Unexpected errors:", perr.Errs)
+	}
+	if len(perr.Translated) != 1 || perr.Translated[0].Birth != dirs[1] {
+		t.Fatal("Unexpected translated packages:", perr.Translated)
+	}
+
+	out := strings.TrimSpace(buf.String())
+	if _, err := os.Stat(filepath.Join(out, "foo.go")); err != nil {
+		t.Fatal("Successfully translated package should be generated:", err, out)
+	}
+
+	gen.KeepGoing = false
+	if err := gen.GeneratePackages(dirs, false); err == nil {
+		t.Fatal("Error should occur without keep-going mode")
+	} else if _, ok := err.(*trygo.PartialError); ok {
+		t.Fatal("Partial error should not be returned without keep-going mode:", err)
+	}
+}
+
+func TestParsePackagesFileSetPerPackage(t *testing.T) {
+	gen, err := trygo.NewGen("out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(cwd, "testdata", "gen", "ok", "nested")
+	pkgs, err := gen.ParsePackages([]string{filepath.Join(base, "a"), filepath.Join(base, "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatal("Two packages should be parsed:", pkgs)
+	}
+	if pkgs[0].Files == pkgs[1].Files {
+		t.Fatal("File set should not be shared between packages")
+	}
+	for _, pkg := range pkgs {
+		for path, f := range pkg.Node.Files {
+			if have := pkg.Files.Position(f.Package).Filename; have != path {
+				t.Errorf("Position in %s is not resolved with file set of its package: %s", path, have)
+			}
+		}
+	}
+}
+
+func TestGenerateFileNameTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		tmpl string
+		want []string
+	}{
+		{"{name}_trygo.go", []string{"bar_trygo.go", "foo_trygo.go"}},
+		{"{name}.gen.go", []string{"bar.gen.go", "foo.gen.go"}},
+		{"{name}.go", []string{"bar.go", "foo.go"}},
+	} {
+		t.Run(tc.tmpl, func(t *testing.T) {
+			outDir, err := ioutil.TempDir("", "trygo-naming-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(outDir)
+
+			gen, err := trygo.NewGen(outDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gen.Out = ioutil.Discard
+			gen.FileNameTemplate = tc.tmpl
+
+			pkgs, err := gen.TranslatePackages([]string{filepath.Join(cwd, "testdata", "gen", "ok", "multiple")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pkgs) != 1 {
+				t.Fatal(pkgs)
+			}
+			for _, name := range tc.want {
+				if _, ok := pkgs[0].Node.Files[filepath.Join(pkgs[0].Path, name)]; !ok {
+					t.Error(name, "is not generated:", pkgs[0].Node.Files)
+				}
+			}
+		})
+	}
+
+	gen, err := trygo.NewGen("out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.FileNameTemplate = "foo.go"
+	if _, err := gen.TranslatePackages([]string{filepath.Join(cwd, "testdata", "gen", "ok", "multiple")}); err == nil || !strings.Contains(err.Error(), "must contain {name}") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestGenerateFlatten(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-flatten-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	gen.Flatten = true
+
+	if err := gen.Generate([]string{filepath.Join("testdata", "gen", "flatten")}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	es, err := ioutil.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(es))
+	for _, e := range es {
+		names = append(names, e.Name())
+	}
+	// One of conflicting foo.go files is prefixed with its directory name
+	if len(names) != 2 || names[1] != "foo.go" || (names[0] != "a_foo.go" && names[0] != "b_foo.go") {
+		t.Fatal("Unexpected generated files:", names)
+	}
+
+	err = gen.Generate([]string{filepath.Join("testdata", "gen", "ok", "nested")}, false)
+	if err == nil || !strings.Contains(err.Error(), "names are different") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestGenerateOutPathTemplate(t *testing.T) {
+	root, err := ioutil.TempDir("", "trygo-outpath-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "src", "foo")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	code := "package foo\n\nimport \"os\"\n\nfunc F() error {\n\ttry(os.Chdir(\"foo\"))\n\treturn nil\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(src, "foo.go"), []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		tmpl string
+		want string
+	}{
+		{"{outdir}/{relpkg}/{filename}", filepath.Join(root, "out", "src", "foo", "foo.go")},
+		{"{pkgdir}/gen/{filename}", filepath.Join(src, "gen", "foo.go")},
+		{"{outdir}/{pkgname}/{filename}", filepath.Join(root, "out", "foo", "foo.go")},
+	} {
+		t.Run(tc.tmpl, func(t *testing.T) {
+			gen, err := trygo.NewGen(filepath.Join(root, "out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			gen.Out = ioutil.Discard
+			gen.OutPathTemplate = tc.tmpl
+			if err := gen.Generate([]string{src}, false); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(tc.want); err != nil {
+				t.Fatal("File was not generated at expected path:", err)
+			}
+		})
+	}
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.OutPathTemplate = "{outdir}/{filename}/foo.go"
+	if err := gen.Generate([]string{src}, false); err == nil || !strings.Contains(err.Error(), "must end with /{filename}") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestGenerateDualBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trygo-dualbuild-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"foo.go": "package foo\n\nimport \"os\"\n\nfunc F() error {\n\ttry(os.Chdir(\"foo\"))\n\treturn nil\n}\n",
+		"bar.go": "//go:build !windows\n\npackage foo\n\nimport \"os\"\n\nfunc G() error {\n\ttry(os.Chdir(\"bar\"))\n\treturn nil\n}\n",
+		"baz.go": "package foo\n\nfunc H() int { return 42 }\n",
+	}
+	for name, code := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sources are not modified by check
+	gen, err := trygo.NewGen(filepath.Join(dir, "unused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.DualBuild = true
+	if err := gen.Check([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := string(b); have != want {
+			t.Errorf("%q was modified by check:\n%s", name, have)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		gen, err := trygo.NewGen(filepath.Join(dir, "unused"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.Out = ioutil.Discard
+		gen.Warn = ioutil.Discard
+		gen.DualBuild = true
+		if err := gen.Generate([]string{dir}, false); err != nil {
+			t.Fatal(i, err)
+		}
+
+		for name, want := range map[string]string{
+			"foo.go":       "//go:build trygo\n",
+			"bar.go":       "//go:build trygo && !windows\n",
+			"baz.go":       "package foo\n",
+			"foo_trygo.go": "//go:build !trygo\n",
+			"bar_trygo.go": "//go:build !trygo && !windows\n",
+		} {
+			b, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(i, err)
+			}
+			s := string(b)
+			if !strings.Contains(s, want) {
+				t.Errorf("%d: %q does not contain %q:\n%s", i, name, want, s)
+			}
+			if strings.HasSuffix(name, "_trygo.go") && strings.Contains(s, "try(") {
+				t.Errorf("%d: %q was not translated:\n%s", i, name, s)
+			}
+			if strings.Count(s, "//go:build") > 1 {
+				t.Errorf("%d: %q has multiple //go:build lines:\n%s", i, name, s)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "baz_trygo.go")); err == nil {
+			t.Error(i, "File without try() was generated")
+		}
+	}
+
+	// Sources are not tagged when generation failed
+	broken := "package foo\n\nimport \"os\"\n\nfunc I() error {\n\ttry(os.Chdir(42))\n\treturn nil\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "qux.go"), []byte(broken), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gen, err = trygo.NewGen(filepath.Join(dir, "unused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	gen.Warn = ioutil.Discard
+	gen.DualBuild = true
+	if err := gen.Generate([]string{dir}, false); err == nil {
+		t.Fatal("Generation should fail")
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "qux.go")); err != nil {
+		t.Fatal(err)
+	} else if have := string(b); have != broken {
+		t.Fatal("Source was tagged though generation failed:", have)
+	}
+
+	gen, err = trygo.NewGen(filepath.Join(dir, "unused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.DualBuild = true
+	gen.Flatten = true
+	if err := gen.Generate([]string{dir}, false); err == nil || !strings.Contains(err.Error(), "Dual-build layout cannot be used") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestGenerateImportMap(t *testing.T) {
+	gen, err := trygo.NewGen(filepath.Join(cwd, "testdata", "gen", "ok", "HAVE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.ImportMap = map[string]string{
+		"github.com/rhysd/trygo/testdata/gen":            "example.com/wrong",
+		"github.com/rhysd/trygo/testdata/gen/ok/nested2": "example.com/gen/nested2",
+	}
+
+	pkgs, err := gen.TranslatePackages([]string{
+		filepath.Join(cwd, "testdata", "gen", "ok", "nested2"),
+		filepath.Join(cwd, "testdata", "gen", "ok", "nested2", "x"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.Node.Name != "b" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := pkg.WriteFileTo(&buf, filepath.Join(pkg.Path, "b.go")); err != nil {
+			t.Fatal(err)
+		}
+		if have := buf.String(); !strings.Contains(have, `a "example.com/gen/nested2"`) {
+			t.Fatal("Import path was not mapped:", have)
+		}
+		return
+	}
+	t.Fatal("Package b was not translated:", pkgs)
+}
+
+func TestGenerateImportRewrites(t *testing.T) {
+	gen, err := trygo.NewGen(filepath.Join(cwd, "testdata", "gen", "ok", "HAVE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.ImportRewrites = []trygo.ImportRewrite{
+		{From: "o", To: "wrong"},
+		{From: "os", To: "example.com/os"},
+	}
+
+	pkgs, err := gen.TranslatePackages([]string{filepath.Join(cwd, "testdata", "gen", "ok", "simple")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := pkgs[0].WriteFileTo(&buf, filepath.Join(pkgs[0].Path, "foo.go")); err != nil {
+		t.Fatal(err)
+	}
+	if have := buf.String(); !strings.Contains(have, `"example.com/os"`) {
+		t.Fatal("Import path was not rewritten:", have)
+	}
+}
+
+func TestGenerateOutputCollision(t *testing.T) {
+	root, err := ioutil.TempDir("", "trygo-collision-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// Both x/foo and sub/x/foo are mapped to sub/out/x/foo
+	writeFiles(t, root, map[string]string{
+		"x/foo/foo.go":     "package foo\n",
+		"sub/x/foo/foo.go": "package foo\n",
+	})
+
+	gen, err := trygo.NewGen(filepath.Join(root, "sub", "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+
+	err = gen.Generate([]string{filepath.Join(root, "x"), filepath.Join(root, "sub", "x")}, false)
+	if err == nil {
+		t.Fatal("Collision was not detected")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		"collision(s) of output paths",
+		filepath.Join(root, "x", "foo"),
+		filepath.Join(root, "sub", "x", "foo"),
+	} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("%q is not included in error message %q", want, msg)
+		}
+	}
+}
+
+func TestGenPackageDirsSkipOutDir(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"out/foo/foo.go": "package foo\n",
+		"outx/foo.go":    "package foo\n",
+		"out/foo.go":     "package foo\n",
+	})
+	defer os.RemoveAll(root)
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out") + string(filepath.Separator))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, err := gen.PackageDirs([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// out/ and out/foo/ are skipped but outx/ is not skipped
+	if len(dirs) != 1 || dirs[0] != filepath.Join(root, "outx") {
+		t.Fatal("Unexpected package dirs:", dirs)
+	}
+
+	// Generated packages must not be collected even if a directory in output directory is given
+	if dirs, err := gen.PackageDirs([]string{filepath.Join(root, "out", "foo")}); err == nil {
+		t.Fatal("Error should occur since no package is collected but got", dirs)
+	}
+}
+
+func TestGenerateImportAlias(t *testing.T) {
+	gen, err := trygo.NewGen(filepath.Join(cwd, "testdata", "gen", "ok", "HAVE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.ImportMap = map[string]string{
+		"github.com/rhysd/trygo/testdata/gen/alias/lib": "example.com/gen/renamed",
+	}
+
+	pkgs, err := gen.TranslatePackages([]string{
+		filepath.Join(cwd, "testdata", "gen", "alias", "lib"),
+		filepath.Join(cwd, "testdata", "gen", "alias", "user"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.Node.Name != "user" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := pkg.WriteFileTo(&buf, filepath.Join(pkg.Path, "user.go")); err != nil {
+			t.Fatal(err)
+		}
+		if have := buf.String(); !strings.Contains(have, `lib "example.com/gen/renamed"`) {
+			t.Fatal("Alias was not added to import:", have)
+		}
+		return
+	}
+	t.Fatal("Package user was not translated:", pkgs)
+}
+
+func TestGenerateImportAliasOnClash(t *testing.T) {
+	gen, err := trygo.NewGen(filepath.Join(cwd, "testdata", "gen", "ok", "HAVE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both new import paths end with "pkg"
+	gen.ImportMap = map[string]string{
+		"github.com/rhysd/trygo/testdata/gen/alias/lib": "example.com/a/pkg",
+	}
+	gen.ImportRewrites = []trygo.ImportRewrite{
+		{From: "github.com/rhysd/trygo/testdata/gen/alias/util", To: "example.com/b/pkg"},
+	}
+
+	pkgs, err := gen.TranslatePackages([]string{
+		filepath.Join(cwd, "testdata", "gen", "alias", "lib"),
+		filepath.Join(cwd, "testdata", "gen", "alias", "clash"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.Node.Name != "clash" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := pkg.WriteFileTo(&buf, filepath.Join(pkg.Path, "clash.go")); err != nil {
+			t.Fatal(err)
+		}
+		have := buf.String()
+		for _, want := range []string{`lib "example.com/a/pkg"`, `util "example.com/b/pkg"`, "lib.Mkdir()", "util.Check()"} {
+			if !strings.Contains(have, want) {
+				t.Errorf("%q is not included in output: %s", want, have)
+			}
+		}
+		return
+	}
+	t.Fatal("Package clash was not translated:", pkgs)
+}
+
+func TestGenerateImportsInModule(t *testing.T) {
+	files := moduleFiles()
+	// Package user uses try() with a function of package lib translated together
+	files["user/user.go"] = "package user\n\nimport \"example.com/mod/lib\"\n\nfunc Run() error {\n\ttry(lib.Mkdir())\n\treturn nil\n}\n"
+	root := writeTree(t, files)
+	defer os.RemoveAll(root)
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs, err := gen.TranslatePackages([]string{filepath.Join(root, "lib"), filepath.Join(root, "user")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.Node.Name != "user" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := pkg.WriteFileTo(&buf, filepath.Join(pkg.Path, "user.go")); err != nil {
+			t.Fatal(err)
+		}
+		have := buf.String()
+		if !strings.Contains(have, `"example.com/mod/out/lib"`) {
+			t.Fatal("Import path was not resolved in module:", have)
+		}
+		if strings.Contains(have, "try(") {
+			t.Fatal("try() call using imported package in module was not translated:", have)
+		}
+		return
+	}
+	t.Fatal("Package user was not translated:", pkgs)
+}
+
+func TestGenerateWarnReverseDeps(t *testing.T) {
+	root := writeTree(t, moduleFiles())
+	defer os.RemoveAll(root)
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, warn bytes.Buffer
+	gen.Out = &out
+	gen.Warn = &warn
+	gen.CheckReverseDeps = true
+
+	if err := gen.Generate([]string{filepath.Join(root, "lib")}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{filepath.Join(root, "user"), `"example.com/mod/lib"`} {
+		if !strings.Contains(warn.String(), want) {
+			t.Fatalf("%q is not included in warning %q", want, warn.String())
+		}
+	}
+	if strings.Contains(out.String(), "Warning:") {
+		t.Fatal("Warning was output to Out:", out.String())
+	}
+	if want := filepath.Join(root, "out", "lib") + "\n"; out.String() != want {
+		t.Fatalf("Wanted only generated path %q in Out but got %q", want, out.String())
+	}
+}
+
+func TestGenerateCgo(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-cgo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	gen.Flatten = true
+
+	base := filepath.Join(cwd, "testdata", "trans", "ok", "cgo")
+	if err := gen.Generate([]string{filepath.Join(base, "src")}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(outDir, "ok.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := string(b)
+
+	b, err = ioutil.ReadFile(filepath.Join(base, "want", "src", "ok.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Generated file has header comment
+	want := "// Code generated by trygo. DO NOT EDIT.\n\n" + string(b)
+
+	if have != want {
+		t.Fatalf("Generated cgo source is unexpected.\nWanted:\n%s\n\nHave:\n%s\n", want, have)
+	}
+}
+
+func TestGenerateCopyCompanionFiles(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-companion-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	gen.Flatten = true
+
+	src := filepath.Join(cwd, "testdata", "gen", "companion")
+	if err := gen.Generate([]string{src}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := ioutil.ReadFile(filepath.Join(src, "add_amd64.s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := ioutil.ReadFile(filepath.Join(outDir, "add_amd64.s"))
+	if err != nil {
+		t.Fatal("Assembly file was not copied:", err)
+	}
+	if !bytes.Equal(want, have) {
+		t.Fatalf("Copied file is unexpected.\nWanted:\n%s\n\nHave:\n%s\n", want, have)
+	}
+}
+
+func TestGenerateCopyAssets(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"pkg/foo.go":             "package foo\n",
+		"pkg/template.html":      "<p>hello</p>\n",
+		"pkg/testdata/input.txt": "input\n",
+		"pkg/assets/style.css":   "p {}\n",
+		"pkg/sub/sub.go":         "package sub\n",
+		"pkg/.hidden":            "hidden\n",
+	})
+	defer os.RemoveAll(root)
+
+	for _, copyAssets := range []bool{false, true} {
+		outDir := filepath.Join(root, "out")
+		gen, err := trygo.NewGen(outDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.Out = ioutil.Discard
+		gen.CopyAssets = copyAssets
+
+		if err := gen.Generate([]string{filepath.Join(root, "pkg")}, false); err != nil {
+			t.Fatal(err)
+		}
+
+		for path, copied := range map[string]bool{
+			"pkg/template.html":      copyAssets,
+			"pkg/testdata/input.txt": copyAssets,
+			"pkg/assets/style.css":   copyAssets,
+			"pkg/.hidden":            false,
+		} {
+			_, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(path)))
+			if copied && err != nil {
+				t.Error(path, "should be copied with CopyAssets =", copyAssets, err)
+			}
+			if !copied && err == nil {
+				t.Error(path, "should not be copied with CopyAssets =", copyAssets)
+			}
+		}
+
+		if err := os.RemoveAll(outDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGenerateEmbeddedFiles(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-embed-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	gen.Flatten = true
+
+	if err := gen.Generate([]string{filepath.Join(cwd, "testdata", "gen", "embed")}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{"hello.txt", "static/a.txt", "static/sub/b.txt"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(f))); err != nil {
+			t.Error("Embedded file", f, "was not copied:", err)
+		}
+	}
+}
+
+func TestGenerateEmbeddedFilesMissing(t *testing.T) {
+	root, err := ioutil.TempDir("", "trygo-embed-missing-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	src := "package foo\n\nimport _ \"embed\"\n\n//go:embed missing.txt\nvar s string\n"
+	if err := ioutil.WriteFile(filepath.Join(root, "foo.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+
+	err = gen.Generate([]string{root}, false)
+	if err == nil {
+		t.Fatal("Error should occur")
+	}
+	if msg := err.Error(); !strings.Contains(msg, `//go:embed pattern "missing.txt"`) || !strings.Contains(msg, "matches no file") {
+		t.Fatal("Unexpected error:", msg)
+	}
+}
+
+func TestGenerateBuild(t *testing.T) {
+	root, err := ioutil.TempDir("", "trygo-build-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	src := `package foo
+
+import "strconv"
+
+func Parse(s string) (int, error) {
+	i := try(strconv.Atoi(s))
+	return add(i, 1), nil
+}
+
+// Body is missing. It passes type check but compiler reports an error
+func add(a, b int) int
+`
+	writeFiles(t, root, map[string]string{
+		"go.mod":     "module example.com/build\n",
+		"foo/foo.go": src,
+	})
+	srcPath := filepath.Join(root, "foo", "foo.go")
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	gen.Build = true
+
+	err = gen.Generate([]string{filepath.Join(root, "foo")}, true)
+	if err == nil {
+		t.Fatal("Build error should be reported")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "Build of generated packages failed") {
+		t.Fatal("Unexpected error:", msg)
+	}
+	// Line 14 in generated file is mapped to line 11 in source since `if err != nil` check was inserted
+	if !strings.Contains(msg, srcPath+":11:") || !strings.Contains(msg, "missing function body") {
+		t.Fatal("Position of compiler error was not mapped to source:", msg)
+	}
+}
+
+func TestGenTest(t *testing.T) {
+	testSrc := `package foo
+
+import (
+	"strconv"
+	"testing"
+)
+
+func parse(s string) (int, error) {
+	i := try(strconv.Atoi(s))
+	return i, nil
+}
+
+func TestParse(t *testing.T) {
+	if i, _ := parse("42"); i != 0 {
+		t.Fatal("unexpected", i)
+	}
+}
+`
+	root := writeTree(t, map[string]string{
+		"go.mod":          "module example.com/test\n",
+		"foo/foo.go":      "package foo\n",
+		"foo/foo_test.go": testSrc,
+	})
+	defer os.RemoveAll(root)
+
+	var buf bytes.Buffer
+	gen := &trygo.Gen{Out: &buf, Err: &buf}
+	err := gen.Test([]string{filepath.Join(root, "foo")}, []string{"-count=1"})
+	if err == nil {
+		t.Fatal("Failing test should cause an error:", buf.String())
+	}
+	out := buf.String()
+
+	// Line 18 in generated test file is mapped to line 15 in TryGo source
+	want := filepath.Join(root, "foo", "foo_test.go") + ":15: unexpected 42"
+	if !strings.Contains(out, want) {
+		t.Fatalf("Output does not contain %q: %s", want, out)
+	}
+
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatal("Temporary directory was not removed:", entries)
+	}
+}
+
+func TestGenBuild(t *testing.T) {
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func parse(s string) (int, error) {
+	i := try(strconv.Atoi(s))
+	return i, nil
+}
+
+func main() {
+	fmt.Println(parse("42"))
+}
+`
+	brokenSrc := `package broken
+
+import "strconv"
+
+func parse(s string) (int, error) {
+	i := try(strconv.Atoi(s))
+	return i + "oops", nil
+}
+`
+	root := writeTree(t, map[string]string{
+		"go.mod":           "module example.com/build\n",
+		"hello/main.go":    mainSrc,
+		"broken/broken.go": brokenSrc,
+	})
+	defer os.RemoveAll(root)
+
+	bin := filepath.Join(root, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	gen := &trygo.Gen{Out: &buf, Err: &buf}
+	if err := gen.GoBuild([]string{filepath.Join(root, "hello")}, nil, bin); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	entries, err := ioutil.ReadDir(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), "hello") {
+		t.Fatal("Executable was not copied:", entries)
+	}
+
+	buf.Reset()
+	err = gen.GoBuild([]string{filepath.Join(root, "broken")}, nil, bin)
+	if err == nil {
+		t.Fatal("Broken package should cause an error:", buf.String())
+	}
+	want := filepath.Join(root, "broken", "broken.go") + ":7"
+	if msg := err.Error() + buf.String(); !strings.Contains(msg, want) {
+		t.Fatalf("Error does not contain %q: %s", want, msg)
+	}
+
+	entries, err = ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatal("Temporary directory was not removed:", entries)
+	}
+}
+
+func TestGenerateHooks(t *testing.T) {
+	for _, stdin := range []bool{false, true} {
+		outDir, err := ioutil.TempDir("", "trygo-hooks-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(outDir)
+
+		gen, err := trygo.NewGen(outDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.Out = ioutil.Discard
+		gen.Flatten = true
+
+		record := `printf '%s\n' "$@" > "$0"`
+		if stdin {
+			record = `cat > "$0"`
+		}
+		// Paths passed to pre hooks point files which are written later
+		check := `while read -r f; do test -e "$f" && echo "$f" >> "$0"; done < "$1"; true`
+		gen.PreHooks = []trygo.Hook{{Command: []string{"sh", "-c", record, "pre.txt"}, Stdin: stdin}}
+		gen.PostHooks = []trygo.Hook{
+			{Command: []string{"sh", "-c", record, "post.txt"}, Stdin: stdin},
+			{Command: []string{"sh", "-c", check, "exist.txt", "pre.txt"}, Stdin: true},
+		}
+
+		if err := gen.Generate([]string{filepath.Join(cwd, "testdata", "gen", "ok", "simple")}, false); err != nil {
+			t.Fatal(err)
+		}
+
+		want := filepath.Join(outDir, "foo.go") + "\n"
+		for _, name := range []string{"pre.txt", "post.txt", "exist.txt"} {
+			b, err := ioutil.ReadFile(filepath.Join(outDir, name))
+			if err != nil {
+				t.Fatal(name, "was not created by hook with stdin =", stdin, err)
+			}
+			if have := string(b); have != want {
+				t.Fatalf("Files passed to hook are unexpected in %s with stdin = %v: %q", name, stdin, have)
+			}
+		}
+	}
+}
+
+func TestGenerateHookFailure(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-hooks-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	gen.PostHooks = []trygo.Hook{{Command: []string{"sh", "-c", "echo oops; exit 1"}}}
+
+	err = gen.Generate([]string{filepath.Join(cwd, "testdata", "gen", "ok", "simple")}, false)
+	if err == nil {
+		t.Fatal("Error should occur")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "Hook `sh -c echo oops; exit 1` failed") || !strings.Contains(msg, "oops") {
+		t.Fatal("Unexpected error:", msg)
+	}
+}
+
+func TestGenerateDeterministicOrder(t *testing.T) {
+	src := filepath.Join("testdata", "gen", "ok", "nested")
+
+	var first string
+	for i := 0; i < 5; i++ {
+		outDir, err := ioutil.TempDir("", "trygo-order-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(outDir)
+
+		gen, err := trygo.NewGen(outDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		gen.Out = &buf
+
+		if err := gen.Generate([]string{src}, false); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) < 2 {
+			t.Fatal("Multiple packages should be generated:", lines)
+		}
+		if !sort.StringsAreSorted(lines) {
+			t.Fatal("Generated paths are not sorted:", lines)
+		}
+
+		have := strings.Join(lines, "\n")
+		have = strings.Replace(have, outDir, "{out}", -1)
+		if i == 0 {
+			first = have
+		} else if have != first {
+			t.Fatalf("Output changed between runs:\nFirst:\n%s\n\nNow:\n%s", first, have)
+		}
+	}
+}
+
+func TestGenerateReproducibleAcrossLocations(t *testing.T) {
+	generate := func() map[string]string {
+		root := writeTree(t, moduleFiles())
+		defer os.RemoveAll(root)
+
+		out := filepath.Join(root, "out")
+		gen, err := trygo.NewGen(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.Out = ioutil.Discard
+		gen.ManifestPath = filepath.Join(out, "manifest.json")
+		if err := gen.Generate([]string{filepath.Join(root, "lib"), filepath.Join(root, "user")}, false); err != nil {
+			t.Fatal(err)
+		}
+
+		generated := map[string]string{}
+		if err := filepath.Walk(out, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			if strings.Contains(string(b), root) {
+				t.Errorf("Absolute path %q leaked into %s:\n%s", root, p, b)
+			}
+			rel, err := filepath.Rel(out, p)
+			if err != nil {
+				return err
+			}
+			generated[filepath.ToSlash(rel)] = string(b)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return generated
+	}
+
+	want, have := generate(), generate()
+	if len(want) != 3 {
+		t.Fatal("Two Go files and manifest should be generated:", want)
+	}
+	for p, w := range want {
+		if h, ok := have[p]; !ok || h != w {
+			t.Errorf("Output %s is different between locations:\nFirst:\n%s\n\nSecond:\n%s", p, w, h)
+		}
+	}
+}
+
+func TestGenerateSkipGeneratedFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "trygo-generated-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Out = ioutil.Discard
+	if err := gen.Generate([]string{filepath.Join("testdata", "gen", "ok", "simple")}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Feed the generated files back to trygo by accident
+	gen, err = trygo.NewGen(filepath.Join(root, "out2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, warn bytes.Buffer
+	gen.Out = &out
+	gen.Warn = &warn
+	if err := gen.Generate([]string{filepath.Join(root, "out1")}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(warn.String(), "Notice: Skip ") || !strings.Contains(warn.String(), "since it was generated by trygo") {
+		t.Fatal("Notice for skipping generated files was not output:", warn.String())
+	}
+	if out.Len() != 0 {
+		t.Fatal("Nothing should be generated:", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "out2")); err == nil {
+		entries, _ := ioutil.ReadDir(filepath.Join(root, "out2"))
+		if len(entries) != 0 {
+			t.Fatal("Nothing should be generated in output directory:", entries)
+		}
+	}
+}
+
+func TestGenerateTraceTimings(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-timings-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, warn bytes.Buffer
+	gen.Out = &out
+	gen.Warn = &warn
+	gen.TraceTimings = true
+
+	dir := filepath.Join(cwd, "testdata", "gen", "ok", "simple")
+	if err := gen.GeneratePackages([]string{dir}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := warn.String()
+	if !strings.HasPrefix(msg, "Timing: ") {
+		t.Fatalf("Timings were not output: %q", msg)
+	}
+	for _, phase := range []string{"parse=", "phase-1=", "typecheck=", "phase-2=", "write=", "total="} {
+		if !strings.Contains(msg, phase) {
+			t.Errorf("%q is not included in timings %q", phase, msg)
+		}
+	}
+	if strings.Contains(out.String(), "Timing:") {
+		t.Fatal("Timings were output to Out:", out.String())
+	}
+
+	pkgs, err := gen.TranslatePackages([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := pkgs[0].Report()
+	phases := []trygo.Phase{}
+	for _, timing := range r.Timings {
+		phases = append(phases, timing.Phase)
+	}
+	want := []trygo.Phase{trygo.PhaseParse, trygo.PhaseElimination, trygo.PhaseTypeCheck, trygo.PhaseInsertion}
+	if !reflect.DeepEqual(phases, want) {
+		t.Fatalf("Wanted phases %v but got %v", want, phases)
+	}
+	if r.Birth != dir || r.Total() <= 0 {
+		t.Fatal("Unexpected report:", r)
+	}
+}
+
+func TestTranslatePackagesWithReport(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "trygo-report-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	gen, err := trygo.NewGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warn bytes.Buffer
+	gen.Warn = &warn
+
+	dirs := []string{
+		filepath.Join(cwd, "testdata", "gen", "ok", "nested", "a"),
+		filepath.Join(cwd, "testdata", "gen", "ok", "nested", "b"),
+	}
+	pkgs, r, err := gen.TranslatePackagesWithReport(dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || len(r.Packages) != 2 {
+		t.Fatal("Unexpected packages:", pkgs, r.Packages)
+	}
+
+	want := map[trygo.TransKind]int{
+		trygo.TransToplevelCall: 3,
+		trygo.TransAssign:       4,
+	}
+	if !reflect.DeepEqual(r.Kinds, want) {
+		t.Errorf("Wanted kinds %v but got %v", want, r.Kinds)
+	}
+	files := []string{
+		filepath.Join(dirs[0], "foo.go"),
+		filepath.Join(dirs[1], "bar.go"),
+	}
+	if !reflect.DeepEqual(r.ModifiedFiles, files) {
+		t.Errorf("Wanted modified files %v but got %v", files, r.ModifiedFiles)
+	}
+	if r.FixedImports != 1 || r.Packages[0].FixedImports != 0 || r.Packages[1].FixedImports != 1 {
+		t.Errorf("Wanted 1 fixed import in package b but got %d", r.FixedImports)
+	}
+	if r.Duration <= 0 {
+		t.Error("Duration is not measured:", r.Duration)
+	}
+	if len(r.Warnings) != 0 {
+		t.Error("Unexpected warnings:", r.Warnings)
+	}
+}
+
+func TestGenerateWatch(t *testing.T) {
+	files := moduleFiles()
+	files["other/other.go"] = "package other\n\nimport \"os\"\n\nfunc Rmdir() error {\n\ttry(os.Remove(\"other\"))\n\treturn nil\n}\n"
+	root := writeTree(t, files)
+	defer os.RemoveAll(root)
+
+	lib, user := files["lib/lib.go"], files["user/user.go"]
+	write := func(path, content string) {
+		writeFiles(t, root, map[string]string{path: content})
+	}
+
+	gen, err := trygo.NewGen(filepath.Join(root, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Quiet = true
+
+	type change struct {
+		names []string
+		err   error
+	}
+	changes := make(chan change, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- gen.Watch(ctx, []string{root}, func(pkgs []*trygo.Package, err error) {
+			names := []string{}
+			for _, pkg := range pkgs {
+				names = append(names, pkg.Node.Name)
+			}
+			sort.Strings(names)
+			changes <- change{names, err}
+		})
+	}()
+
+	wait := func(want ...string) {
+		select {
+		case c := <-changes:
+			if c.err != nil {
+				t.Fatal(c.err)
+			}
+			if !reflect.DeepEqual(c.names, want) {
+				t.Fatalf("Wanted packages %v to be generated but got %v", want, c.names)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timeout while waiting for generation of", want)
+		}
+	}
+
+	wait("lib", "other", "user")
+
+	// Only the changed package is generated. Its import of other watched package is still fixed
+	write("user/user.go", user+"\nfunc Run2() error {\n\treturn nil\n}\n")
+	wait("user")
+	b, err := ioutil.ReadFile(filepath.Join(root, "out", "user", "user.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := string(b); !strings.Contains(have, `"example.com/mod/out/lib"`) || !strings.Contains(have, "Run2") {
+		t.Fatal("Generated file is unexpected:", have)
+	}
+
+	// Packages depending on the changed package are also generated
+	write("lib/lib.go", lib+"\nfunc Rmdir() error {\n\treturn nil\n}\n")
+	wait("lib", "user")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateWatchDualBuild(t *testing.T) {
+	src := "//go:build trygo\n\npackage foo\n\nimport \"os\"\n\nfunc F() error {\n\ttry(os.Chdir(\"foo\"))\n\treturn nil\n}\n"
+	root := writeTree(t, map[string]string{"foo.go": src})
+	defer os.RemoveAll(root)
+
+	gen, err := trygo.NewGen(filepath.Join(root, "unused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Quiet = true
+	gen.DualBuild = true
+
+	changes := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- gen.Watch(ctx, []string{root}, func(pkgs []*trygo.Package, err error) {
+			changes <- err
+		})
+	}()
+
+	wait := func() {
+		select {
+		case err := <-changes:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timeout while waiting for generation")
+		}
+	}
+
+	wait()
+
+	// Generated files written next to sources must not trigger generation again
+	select {
+	case err := <-changes:
+		t.Fatal("Package was generated again without change of sources:", err)
+	case <-time.After(time.Second):
+	}
+
+	writeFiles(t, root, map[string]string{"foo.go": src + "\nfunc G() error {\n\treturn nil\n}\n"})
+	wait()
+	b, err := ioutil.ReadFile(filepath.Join(root, "foo_trygo.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := string(b); !strings.Contains(have, "func G()") {
+		t.Fatal("Generated file is unexpected:", have)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,49 @@
+package trygo
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// Files written by trygo start with a header comment which marks them as generated. Go tools such as
+// linters recognize the header. trygo also uses it to detect generated files accidentally given as
+// inputs, for example when the output directory is passed to trygo again.
+
+const (
+	generatedMarker = "// Code generated by trygo. DO NOT EDIT."
+	generatedHeader = generatedMarker + "\n\n"
+	// generatedHeaderLines is a number of lines added to generated files by the header
+	generatedHeaderLines = 2
+)
+
+// isGeneratedFile returns true when the file has the header comment put by trygo before its package clause.
+func isGeneratedFile(file *ast.File) bool {
+	for _, g := range file.Comments {
+		if g.Pos() >= file.Package {
+			return false
+		}
+		for _, c := range g.List {
+			if strings.TrimSpace(c.Text) == generatedMarker {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipGeneratedFiles removes files generated by trygo from the package. It returns false when no file
+// remains in the package.
+func (gen *Gen) skipGeneratedFiles(pkg *ast.Package) bool {
+	for _, path := range sortedFilePaths(pkg.Files) {
+		if isGeneratedFile(pkg.Files[path]) {
+			msg := "Skip " + path + " since it was generated by trygo"
+			if gen.DualBuild {
+				gen.lg().log(msg) // Generated files are always next to sources in dual-build layout
+			} else {
+				gen.notice(msg)
+			}
+			delete(pkg.Files, path)
+		}
+	}
+	return len(pkg.Files) > 0
+}
@@ -0,0 +1,164 @@
+package trygo
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// For pre-commit hooks and incremental CI, only packages containing Go files changed in git are processed
+// so that trygo is cheap enough even in large repositories.
+
+// runGit runs git command in the directory and returns its stdout.
+func runGit(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "`git %s` failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// gitFileList runs git command which outputs NUL-separated file paths relative to the repository root.
+func gitFileList(dir string, args ...string) ([]string, error) {
+	out, err := runGit(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// gitRoot returns the root directory of git repository containing the directory.
+func gitRoot(dir string) (string, error) {
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(strings.TrimSpace(string(out))), nil
+}
+
+// packageDirsOfFiles returns sorted directories containing Go files in the paths relative to the
+// repository root. Files in output directory are ignored since they are generated, except for dual-build
+// layout. Directories which no longer exist are also ignored.
+func (gen *Gen) packageDirsOfFiles(root string, files []string) []string {
+	lg := gen.lg()
+	dirs := map[string]struct{}{}
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".go") {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(f))
+		if !gen.DualBuild && gen.OutDir != "" && strings.HasPrefix(path, gen.OutDir+string(filepath.Separator)) {
+			lg.log("Skip changed file in output directory:", path)
+			continue
+		}
+		dir := filepath.Dir(path)
+		if _, ok := dirs[dir]; ok {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			lg.log("Skip directory which no longer exists:", dir)
+			continue
+		}
+		dirs[dir] = struct{}{}
+	}
+
+	paths := make([]string, 0, len(dirs))
+	for d := range dirs {
+		paths = append(paths, d)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// StagedPaths returns directories of packages which contain Go files staged in git repository at dir.
+// Deleted files are not included. Files in output directory are ignored since they are generated, except
+// for dual-build layout. The returned paths are absolute and sorted. It returns an empty slice when no Go
+// file is staged.
+func (gen *Gen) StagedPaths(dir string) ([]string, error) {
+	root, err := gitRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := gitFileList(dir, "diff", "--cached", "--name-only", "--diff-filter=ACMR", "-z")
+	if err != nil {
+		return nil, err
+	}
+	paths := gen.packageDirsOfFiles(root, files)
+	gen.lg().log("Package directories of staged files:", paths)
+	return paths, nil
+}
+
+// ChangedPaths returns directories of packages which contain Go files changed since the git ref in
+// repository at dir, and directories of packages which depend on them directly or indirectly. Changes in
+// working tree and untracked files are also included. Dependents are searched under the repository root
+// by their imports. The returned paths are absolute and sorted. It returns an empty slice when no Go file
+// was changed.
+func (gen *Gen) ChangedPaths(dir, ref string) ([]string, error) {
+	lg := gen.lg()
+
+	root, err := gitRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := gitFileList(dir, "diff", "--name-only", "--diff-filter=ACMRD", "-z", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitFileList(root, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	changed := gen.packageDirsOfFiles(root, append(files, untracked...))
+	lg.log("Package directories changed since", ref, ":", changed)
+	if len(changed) == 0 {
+		return changed, nil
+	}
+
+	imports := gen.importsUnder(root)
+	seen := map[string]struct{}{}
+	queue := []string{}
+	for _, d := range changed {
+		seen[d] = struct{}{}
+		queue = append(queue, d)
+	}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		path, ok := importPathOfDir(d)
+		if !ok {
+			continue
+		}
+		for importer, paths := range imports {
+			if _, ok := seen[importer]; ok {
+				continue
+			}
+			if _, ok := paths[path]; !ok {
+				continue
+			}
+			lg.log("Package at", relpath(importer), "depends on changed package", path)
+			seen[importer] = struct{}{}
+			queue = append(queue, importer)
+		}
+	}
+
+	paths := make([]string, 0, len(seen))
+	for d := range seen {
+		paths = append(paths, d)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,83 @@
+package trygo
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GoBuild translates TryGo packages in given paths into a temporary directory and runs `go build` for
+// the translated packages as Test does. args are passed to `go build`. Compiler errors are written to
+// Err with positions mapped back to TryGo sources. Executables built from main packages are copied to
+// binDir with names of their source directories. When binDir is empty, the current directory is used.
+// It returns an error when translation failed or `go build` failed.
+func (gen *Gen) GoBuild(paths []string, args []string, binDir string) error {
+	lg := gen.lg()
+	lg.log("Start build for", paths, "with args", args)
+
+	if binDir == "" {
+		binDir = cwd
+	}
+	if !filepath.IsAbs(binDir) {
+		binDir = filepath.Join(cwd, binDir)
+	}
+
+	dirs, err := gen.PackageDirs(paths)
+	if err != nil {
+		return err
+	}
+
+	tmp, pkgs, err := gen.generateTemp(dirs, "_trygo_build")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	bin, err := ioutil.TempDir("", "trygo-bin")
+	if err != nil {
+		return errors.Wrap(err, "Cannot create temporary directory for executables")
+	}
+	defer os.RemoveAll(bin)
+
+	// Trailing separator makes `go build` put executables of all main packages in the directory
+	buildArgs := append(append([]string{"build"}, args...), "-o", bin+string(filepath.Separator), "./...")
+	if err := gen.runGo(pkgs, tmp, buildArgs); err != nil {
+		return errors.Wrap(err, "`go build` failed")
+	}
+
+	// `go build` names executables after their output directories. Name them after source directories
+	names := map[string]string{}
+	for _, pkg := range pkgs {
+		if pkg.Node.Name == "main" {
+			names[filepath.Base(pkg.Path)] = filepath.Base(pkg.Birth)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(bin)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		ext := ""
+		if strings.HasSuffix(name, ".exe") {
+			ext = ".exe"
+		}
+		src, ok := names[strings.TrimSuffix(name, ext)]
+		if !ok {
+			continue
+		}
+		dst := filepath.Join(binDir, src+ext)
+		lg.log("Copy executable", name, "->", relpath(dst))
+		if err := copyFile(filepath.Join(bin, name), dst); err != nil {
+			return err
+		}
+		if !gen.Quiet {
+			fmt.Fprintln(gen.out(), dst)
+		}
+	}
+	return nil
+}
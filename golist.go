@@ -0,0 +1,78 @@
+package trygo
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// With Gen.GoList, packages are discovered by `go list -find` instead of walking directories so that the
+// discovery matches the go tool. Build constraints are respected, directories such as testdata are not
+// collected and patterns like ./... or import paths can be given.
+
+// goListPackage is a package output by `go list -json`. Only fields used by trygo are defined.
+type goListPackage struct {
+	Dir            string
+	ImportPath     string
+	GoFiles        []string
+	CgoFiles       []string
+	TestGoFiles    []string
+	XTestGoFiles   []string
+	IgnoredGoFiles []string
+	Error          *struct {
+		Err string
+	}
+}
+
+func (p *goListPackage) numGoFiles() int {
+	return len(p.GoFiles) + len(p.CgoFiles) + len(p.TestGoFiles) + len(p.XTestGoFiles)
+}
+
+// goListPackageDirs collects directories of packages matched by the patterns with `go list -find -json`
+// run in the directory into saw. Packages in output directory are skipped not to translate generated files
+// again.
+func (gen *Gen) goListPackageDirs(dir string, patterns []string, saw map[string]struct{}) error {
+	lg := gen.lg()
+	args := append([]string{"list", "-e", "-find", "-json"}, patterns...)
+	lg.log("Collect package dirs with `go`", lg.hi(args), "in", relpath(dir))
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.Wrapf(err, "`go %s` failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg goListPackage
+		if err := dec.Decode(&pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrap(err, "Cannot parse output of `go list`")
+		}
+
+		if pkg.numGoFiles() == 0 && len(pkg.IgnoredGoFiles) > 0 {
+			lg.log("Skip package", pkg.ImportPath, "since build constraints exclude all Go files")
+			continue
+		}
+		if pkg.Error != nil {
+			return errors.Errorf("Cannot find package %q: %s", pkg.ImportPath, pkg.Error.Err)
+		}
+		if pkg.numGoFiles() == 0 {
+			continue
+		}
+		if gen.OutDir != "" && !gen.DualBuild && (pkg.Dir == gen.OutDir || strings.HasPrefix(pkg.Dir, gen.OutDir+string(filepath.Separator))) {
+			lg.log("Skip package in output directory:", relpath(pkg.Dir))
+			continue
+		}
+		saw[pkg.Dir] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package trygo
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// generateTemp translates packages in the directories into a new temporary directory. The temporary
+// directory is created in the repository root (the directory containing go.mod) so that imports between
+// packages are resolved. Caller must remove the returned directory.
+func (gen *Gen) generateTemp(dirs []string, prefix string) (string, []*Package, error) {
+	// Directory starting with '_' is ignored by Go toolchain while matching ./... pattern in the repository
+	tmp, err := ioutil.TempDir(repositoryRoot(dirs[0]), prefix)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Cannot create temporary directory")
+	}
+	gen.lg().log("Temporary output directory:", relpath(tmp))
+
+	// Tests and programs usually need their fixtures so assets are copied
+	g := *gen
+	g.OutDir = tmp
+	g.Quiet = true
+	g.CopyAssets = true
+	g.Build = false
+	g.CheckReverseDeps = false
+	g.ManifestPath = ""
+	g.cacheGenerated = true
+	pkgs, err := g.generatePackages(dirs)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", nil, err
+	}
+	return tmp, pkgs, nil
+}
+
+// runGo runs `go` command with the arguments in the directory. Stdout and stderr of the command are
+// written to Out and Err respectively with positions mapped back to TryGo sources.
+func (gen *Gen) runGo(pkgs []*Package, dir string, args []string) error {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	if _, err := io.WriteString(gen.out(), remapOutput(pkgs, dir, stdout.String())); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(gen.errOut(), remapOutput(pkgs, dir, stderr.String())); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// Test translates TryGo packages in given paths into a temporary directory and runs `go test` for the
+// translated packages. args are passed to `go test`. Stdout and stderr of `go test` are written to Out
+// and Err respectively with positions mapped back to TryGo sources. The temporary directory is created in the repository root
+// (the directory containing go.mod) so that imports between packages are resolved, and removed after
+// the test. It returns an error when translation failed or `go test` failed.
+func (gen *Gen) Test(paths []string, args []string) error {
+	lg := gen.lg()
+	lg.log("Start test for", paths, "with args", args)
+
+	dirs, err := gen.PackageDirs(paths)
+	if err != nil {
+		return err
+	}
+
+	tmp, pkgs, err := gen.generateTemp(dirs, "_trygo_test")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := gen.runGo(pkgs, tmp, append(append([]string{"test"}, args...), "./...")); err != nil {
+		return errors.Wrap(err, "`go test` failed")
+	}
+	return nil
+}
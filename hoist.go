@@ -0,0 +1,300 @@
+package trygo
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+)
+
+// Hoisting nested pseudo-function calls.
+//
+// Pseudo-function calls nested in expressions cannot be translated in place since `if err != nil`
+// check must be put before the statement. Such calls are hoisted into temporary variables defined
+// before the statement. Function calls, method calls, receive operations and binary logical operations
+// are evaluated in lexical left-to-right order in Go. To keep the order, such expressions evaluated
+// before the last hoisted pseudo-function call are also hoisted.
+//
+//   x := g() + try(f()) + try(h())
+//
+//   ->
+//
+//   _0 := g()
+//   _1 := try(f())
+//   _2 := try(h())
+//   x := _0 + _1 + _2
+//
+// Each hoisted `:=` statement is a statement at toplevel of the block so it is translated as usual.
+
+// pureBuiltins is a set of builtin functions which have no side effect. Calls of them are not hoisted
+// since hoisting would change constant expressions such as len("foo") into variables.
+var pureBuiltins = map[string]struct{}{
+	"len":     {},
+	"cap":     {},
+	"real":    {},
+	"imag":    {},
+	"complex": {},
+	"min":     {},
+	"max":     {},
+	"new":     {},
+	"make":    {},
+}
+
+var exprType = reflect.TypeOf((*ast.Expr)(nil)).Elem()
+
+// orderedExpr is an expression whose evaluation order is specified in the statement.
+type orderedExpr struct {
+	expr   ast.Expr
+	parent ast.Node
+	pseudo bool
+}
+
+// hoistablePseudoCall returns true when the expression is a call of pseudo-function which evaluates to
+// a value. throw() is not a value.
+func (tce *tryCallElimination) hoistablePseudoCall(expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Fun.(*ast.Ident)
+	return ok && ident.Name != "throw" && tce.isPseudoFunc(ident)
+}
+
+// findPseudoCall returns the first pseudo-function call in the node except for function literals.
+func (tce *tryCallElimination) findPseudoCall(node ast.Node) *ast.CallExpr {
+	var found *ast.CallExpr
+	ast.Inspect(node, func(n ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		if e, ok := n.(ast.Expr); ok && tce.hoistablePseudoCall(e) {
+			found = e.(*ast.CallExpr)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// isOrderedExpr returns true when evaluation order of the expression is specified by Go spec.
+func isOrderedExpr(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.CallExpr:
+		if ident, ok := expr.Fun.(*ast.Ident); ok && ident.Obj == nil {
+			if _, ok := pureBuiltins[ident.Name]; ok {
+				return false
+			}
+		}
+		return true
+	case *ast.UnaryExpr:
+		return expr.Op == token.ARROW
+	case *ast.BinaryExpr:
+		return expr.Op == token.LAND || expr.Op == token.LOR
+	default:
+		return false
+	}
+}
+
+// topExprsOf returns expressions at toplevel of the statement which are translated in place without
+// hoisting. It returns false when nested pseudo-function calls in the statement cannot be hoisted.
+func (tce *tryCallElimination) topExprsOf(stmt ast.Stmt) (map[ast.Expr]struct{}, bool) {
+	tops := map[ast.Expr]struct{}{}
+	switch stmt := stmt.(type) {
+	case *ast.ExprStmt:
+		switch x := stmt.X.(type) {
+		case *ast.CallExpr:
+			if ident, ok := x.Fun.(*ast.Ident); ok && tce.isPseudoFunc(ident) {
+				tops[x] = struct{}{}
+			}
+		case *ast.UnaryExpr:
+			if x.Op != token.ARROW {
+				return nil, false
+			}
+		default:
+			// Not a valid statement
+			return nil, false
+		}
+	case *ast.AssignStmt:
+		if len(stmt.Rhs) == 1 && tce.hoistablePseudoCall(stmt.Rhs[0]) {
+			tops[stmt.Rhs[0]] = struct{}{}
+		}
+	case *ast.DeclStmt:
+		decl, ok := stmt.Decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.VAR {
+			return nil, false
+		}
+		for _, spec := range decl.Specs {
+			if spec, ok := spec.(*ast.ValueSpec); ok && len(spec.Values) == 1 && tce.hoistablePseudoCall(spec.Values[0]) {
+				tops[spec.Values[0]] = struct{}{}
+			}
+		}
+	case *ast.GoStmt:
+		// The call itself is evaluated later. Only the function value and arguments are evaluated
+		tops[stmt.Call] = struct{}{}
+	case *ast.DeferStmt:
+		tops[stmt.Call] = struct{}{}
+	case *ast.ReturnStmt, *ast.SendStmt, *ast.IncDecStmt:
+		// Nothing is translated in place
+	default:
+		// Conditions of if, for and switch statements may be evaluated multiple times or may not be
+		// evaluated. They cannot be hoisted
+		return nil, false
+	}
+	return tops, true
+}
+
+// orderedExprsOf returns expressions in the statement whose evaluation order is specified in the order
+// of evaluation. It returns false when some pseudo-function call cannot be hoisted.
+func (tce *tryCallElimination) orderedExprsOf(stmt ast.Stmt, tops map[ast.Expr]struct{}) ([]orderedExpr, bool) {
+	ordered := []orderedExpr{}
+	stack := []ast.Node{}
+	ok := true
+
+	// leave is called after visiting children of the node. Operands are evaluated before the node
+	leave := func(node ast.Node) {
+		stack = stack[:len(stack)-1]
+		expr, isExpr := node.(ast.Expr)
+		if !isExpr || !isOrderedExpr(expr) {
+			return
+		}
+		if _, top := tops[expr]; top {
+			return
+		}
+		ordered = append(ordered, orderedExpr{expr, stack[len(stack)-1], tce.hoistablePseudoCall(expr)})
+	}
+
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		if node == nil {
+			leave(stack[len(stack)-1])
+			return true
+		}
+
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			// Body of function literal is not evaluated here. It is visited as other blocks later
+			return false
+		case *ast.BinaryExpr:
+			if node.Op != token.LAND && node.Op != token.LOR {
+				break
+			}
+			// Right operand of && and || may not be evaluated. It must not be hoisted
+			if call := tce.findPseudoCall(node.Y); call != nil {
+				tce.errfAt(call, "%s() in right operand of '%s' is not available since the operand may not be evaluated", call.Fun.(*ast.Ident).Name, node.Op)
+				ok = false
+				return false
+			}
+			stack = append(stack, node)
+			ast.Inspect(node.X, visit)
+			leave(node)
+			return false
+		case *ast.CallExpr:
+			if ident, isIdent := node.Fun.(*ast.Ident); !isIdent || !tce.isPseudoFunc(ident) || len(node.Args) < 2 {
+				break
+			}
+			// The second argument of try() and tryOr() is evaluated only on error. It must not be hoisted
+			stack = append(stack, node)
+			ast.Inspect(node.Args[0], visit)
+			leave(node)
+			return false
+		}
+
+		stack = append(stack, node)
+		return true
+	}
+	ast.Inspect(stmt, visit)
+
+	return ordered, ok
+}
+
+// replaceChildExpr replaces the expression which is a direct child of the parent node with new one.
+func replaceChildExpr(parent ast.Node, old, new ast.Expr) bool {
+	v := reflect.ValueOf(parent).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch {
+		case f.Type() == exprType:
+			if !f.IsNil() && f.Interface() == old {
+				f.Set(reflect.ValueOf(new))
+				return true
+			}
+		case f.Kind() == reflect.Slice && f.Type().Elem() == exprType:
+			for j := 0; j < f.Len(); j++ {
+				if f.Index(j).Interface() == old {
+					f.Index(j).Set(reflect.ValueOf(new))
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hoistNestedCalls hoists pseudo-function calls nested in expressions of the statement at toplevel of
+// current block into temporary variables defined before the statement. Expressions which must be
+// evaluated before the calls are also hoisted to keep the order of evaluation.
+func (tce *tryCallElimination) hoistNestedCalls(stmt ast.Stmt) {
+	tops, ok := tce.topExprsOf(stmt)
+	if !ok {
+		return
+	}
+	ordered, ok := tce.orderedExprsOf(stmt, tops)
+	if !ok {
+		return
+	}
+
+	last := -1
+	for i, o := range ordered {
+		if o.pseudo {
+			last = i
+		}
+	}
+	if last < 0 {
+		return
+	}
+
+	// Expressions evaluated before the last pseudo-function call are hoisted. When an expression is
+	// hoisted, expressions in it are hoisted together
+	hoisted := []orderedExpr{}
+	for i := last; i >= 0; i-- {
+		o := ordered[i]
+		inner := false
+		for _, h := range hoisted {
+			if h.expr.Pos() <= o.expr.Pos() && o.expr.End() <= h.expr.End() {
+				inner = true
+				break
+			}
+		}
+		if !inner {
+			hoisted = append(hoisted, o)
+		}
+	}
+
+	for i := len(hoisted) - 1; i >= 0; i-- {
+		h := hoisted[i]
+		pos := h.expr.Pos()
+		tmp := tce.newTempIdent(pos)
+		if !replaceChildExpr(h.parent, h.expr, newIdent(tmp.Name, pos)) {
+			panic("Hoisted expression was not found in its parent node: " + reflect.TypeOf(h.parent).String())
+		}
+		def := &ast.AssignStmt{
+			Lhs:    []ast.Expr{tmp},
+			Tok:    token.DEFINE,
+			TokPos: pos,
+			Rhs:    []ast.Expr{h.expr},
+		}
+		tce.lg.log(tce.lg.hi("Hoist expression"), reflect.TypeOf(h.expr), "at", tce.logPos(h.expr), "into", tmp.Name)
+
+		// Inserted := statement is a new statement at toplevel of the block. It is visited before the
+		// current statement as the compound assignment does
+		tce.insertTempDef(def)
+		tce.blkIndex--
+		tce.visitStmt(def)
+		tce.blkIndex++
+		if tce.err != nil {
+			return
+		}
+	}
+}
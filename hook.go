@@ -0,0 +1,74 @@
+package trygo
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Hook is a command run before or after generating files. Paths of generated files are passed to the
+// command. The command runs in the output directory.
+type Hook struct {
+	// Command is a command name and its arguments.
+	Command []string
+	// Stdin is a flag to pass the paths via stdin separated by newlines instead of command arguments.
+	Stdin bool
+}
+
+func (hook *Hook) String() string {
+	return strings.Join(hook.Command, " ")
+}
+
+func (hook *Hook) run(dir string, files []string, lg logger) error {
+	if len(hook.Command) == 0 {
+		return errors.New("Command of hook is empty")
+	}
+
+	args := hook.Command[1:]
+	if !hook.Stdin {
+		args = append(args[:len(args):len(args)], files...)
+	}
+	cmd := exec.Command(hook.Command[0], args...)
+	cmd.Dir = dir
+	if hook.Stdin {
+		cmd.Stdin = strings.NewReader(strings.Join(files, "\n") + "\n")
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	lg.log("Run hook", lg.hi(hook), "with", len(files), "files")
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "Hook `%s` failed. Output:\n%s", hook, out.String())
+	}
+	return nil
+}
+
+// outputFiles returns sorted paths of files to be generated from given packages.
+func outputFiles(pkgs []*Package) []string {
+	files := []string{}
+	for _, pkg := range pkgs {
+		for path := range pkg.Node.Files {
+			if pkg.isTarget(path) {
+				files = append(files, path)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (gen *Gen) runHooks(hooks []Hook, pkgs []*Package) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	files := outputFiles(pkgs)
+	for i := range hooks {
+		if err := hooks[i].run(gen.OutDir, files, gen.lg()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
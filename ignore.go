@@ -0,0 +1,104 @@
+package trygo
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Ignore files are read while walking directories to collect packages. Patterns follow .gitignore
+// syntax partially: blank lines and lines starting with '#' are skipped, '!' negates a pattern, trailing
+// '/' matches only directories, and a pattern containing '/' is matched relative to the directory where
+// the ignore file is put. Otherwise the pattern is matched against base name at any depth.
+var ignoreFileNames = []string{".gitignore", ".trygoignore"}
+
+type ignorePattern struct {
+	// base is a directory path where the ignore file containing this pattern is put
+	base     string
+	glob     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func (pat *ignorePattern) match(path string, isDir bool) bool {
+	if pat.dirOnly && !isDir {
+		return false
+	}
+	if !strings.HasPrefix(path, pat.base+string(filepath.Separator)) {
+		// Patterns are only effective under the directory of the ignore file
+		return false
+	}
+	rel := filepath.ToSlash(strings.TrimPrefix(path, pat.base+string(filepath.Separator)))
+	if !pat.anchored {
+		rel = filepath.Base(rel)
+	}
+	ok, err := filepath.Match(pat.glob, rel)
+	return err == nil && ok
+}
+
+type ignoreRules []*ignorePattern
+
+// ignored returns whether the given path should be ignored. As .gitignore, the last matching pattern wins.
+func (rules ignoreRules) ignored(path string, isDir bool) bool {
+	ignored := false
+	for _, pat := range rules {
+		if pat.match(path, isDir) {
+			ignored = !pat.negate
+		}
+	}
+	return ignored
+}
+
+func parseIgnorePattern(line, base string) *ignorePattern {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	pat := &ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		pat.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pat.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		pat.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+	pat.glob = line
+	return pat
+}
+
+// readIgnoreFiles reads ignore files in the given directory and appends the patterns to the rules.
+func (rules ignoreRules) readIgnoreFiles(dir string, lg logger) (ignoreRules, error) {
+	for _, name := range ignoreFileNames {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if pat := parseIgnorePattern(s.Text(), dir); pat != nil {
+				rules = append(rules, pat)
+			}
+		}
+		err = s.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		lg.log("Read ignore file", lg.hi(relpath(filepath.Join(dir, name))))
+	}
+	return rules, nil
+}
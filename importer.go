@@ -0,0 +1,257 @@
+package trygo
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"go/build"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Type-checking imported packages from source re-checks the entire dependency graph on every run and
+// dominates the translation time. Instead, packages are imported from export data compiled by the go
+// tool, which is cached in the build cache. Imported TryGo packages cannot be compiled so their export data
+// is not available. In the case the source importer is used for all imports of the package since types
+// imported by the two importers are not identical.
+
+// listExportData returns a map from import path to the file path of its export data for all dependencies
+// of the package in the directory including dependencies of its tests. Dependencies are compiled by
+// `go list -export` if necessary.
+func listExportData(dir string) (map[string]string, error) {
+	cmd := exec.Command("go", "list", "-e", "-export", "-deps", "-test", "-f", "{{.ImportPath}}\t{{.Export}}", ".")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "`go list -export` failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	exports := map[string]string{}
+	for _, l := range strings.Split(string(out), "\n") {
+		ss := strings.SplitN(l, "\t", 2)
+		if len(ss) != 2 || ss[1] == "" || strings.Contains(ss[0], " ") {
+			// Test variants like "foo [foo.test]" are not imported by path
+			continue
+		}
+		exports[ss[0]] = ss[1]
+	}
+	return exports, nil
+}
+
+// importPaths returns import paths in all files of the package.
+func (pkg *Package) importPaths() []string {
+	paths := []string{}
+	saw := map[string]struct{}{}
+	for _, f := range pkg.fileNodes() {
+		for _, spec := range f.Imports {
+			p, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			if _, ok := saw[p]; !ok {
+				saw[p] = struct{}{}
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
+
+// newExportDataImporter returns an importer which imports packages from export data compiled by the go
+// tool in the directory. When export data of some of the import paths is not available, it returns the
+// source importer.
+func newExportDataImporter(dir string, paths []string, lg logger) types.Importer {
+	exports, err := listExportData(dir)
+	if err != nil {
+		lg.log("Import packages from source since export data is not available:", err)
+		return importer.For("source", nil)
+	}
+	if p, ok := missingExportData(exports, paths); ok {
+		lg.log("Import packages from source since export data of", lg.hi(p), "is not available")
+		return importer.For("source", nil)
+	}
+	lg.log("Import packages from export data of", len(exports), "packages")
+	return exportDataImporter(exports)
+}
+
+// missingExportData returns the first import path in paths whose export data is not in exports.
+func missingExportData(exports map[string]string, paths []string) (string, bool) {
+	for _, p := range paths {
+		if p == "C" || p == "unsafe" {
+			continue
+		}
+		if _, ok := exports[p]; !ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// exportDataImporter returns an importer which imports packages from the export data files. exports is a
+// map from import path to the file path of its export data.
+func exportDataImporter(exports map[string]string) types.Importer {
+	return importer.ForCompiler(token.NewFileSet(), "gc", func(path string) (io.ReadCloser, error) {
+		f, ok := exports[path]
+		if !ok {
+			return nil, errors.Errorf("Export data of package %q is not found", path)
+		}
+		return os.Open(f)
+	})
+}
+
+// siblings is a set of packages translated together where some of them import others. TryGo packages
+// cannot be imported from their source nor from export data since try() calls are not valid Go. Instead,
+// they are imported from their type information after phase-1. Other packages are imported by importers
+// shared by all the packages so that types imported by them are identical.
+type siblings struct {
+	// dirs is a map from import path to package directory of packages translated together.
+	dirs map[string]string
+	// checked is a map from package directory to its type-checked package.
+	checked map[string]*types.Package
+	// exports is a map from import path to the file path of its export data for all dependencies of the
+	// packages. It is nil when Gen.Importer is set.
+	exports map[string]string
+	// exportImporter and sourceImporter are importers shared by the packages. When Gen.Importer is set,
+	// both are the importer.
+	exportImporter types.Importer
+	sourceImporter types.Importer
+	lg             logger
+}
+
+// importerFor returns an importer for the package. Like newExportDataImporter, packages are imported from
+// source when export data of some of its imports except for packages translated together is not available.
+func (s *siblings) importerFor(pkg *Package) types.Importer {
+	paths := []string{}
+	for _, p := range pkg.importPaths() {
+		if _, ok := s.dirs[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	base := s.exportImporter
+	if s.exports != nil {
+		if p, ok := missingExportData(s.exports, paths); ok {
+			s.lg.log("Import packages from source for", pkg.Birth, "since export data of", s.lg.hi(p), "is not available")
+			base = s.sourceImporter
+		}
+	}
+	return &siblingImporter{base, s}
+}
+
+// imported returns whether the package in the directory is imported by other packages translated together.
+func (s *siblings) imported(dir string) bool {
+	for _, d := range s.dirs {
+		if d == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// siblingImporter imports packages translated together from their type information after phase-1 and
+// imports other packages with its base importer.
+type siblingImporter struct {
+	base     types.Importer
+	siblings *siblings
+}
+
+func (imp *siblingImporter) Import(path string) (*types.Package, error) {
+	return imp.ImportFrom(path, "", 0)
+}
+
+func (imp *siblingImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if d, ok := imp.siblings.dirs[path]; ok {
+		if p, ok := imp.siblings.checked[d]; ok {
+			return p, nil
+		}
+	}
+	if from, ok := imp.base.(types.ImporterFrom); ok {
+		return from.ImportFrom(path, dir, mode)
+	}
+	return imp.base.Import(path)
+}
+
+// importSiblings returns the packages sorted so that imported packages are translated before packages
+// importing them, and a set of them to create their importers. It returns nil set when no package imports
+// other packages in pkgs.
+func (gen *Gen) importSiblings(pkgs []*Package) ([]*Package, *siblings) {
+	if len(pkgs) < 2 || gen.NoTypeCheck || gen.Standalone {
+		return pkgs, nil
+	}
+	lg := gen.lg()
+
+	byDir := map[string][]*Package{}
+	dirs := []string{}
+	for _, pkg := range pkgs {
+		if _, ok := byDir[pkg.Birth]; !ok {
+			dirs = append(dirs, pkg.Birth)
+		}
+		byDir[pkg.Birth] = append(byDir[pkg.Birth], pkg)
+	}
+
+	// Resolve import paths in the same way as fixing imports
+	resolver := &importsFixer{ctx: build.Default, resolved: map[string]*resolvedImport{}, lg: lg}
+	paths := map[string]string{}
+	deps := map[string]map[string]struct{}{}
+	for _, dir := range dirs {
+		imports := []string{}
+		for _, pkg := range byDir[dir] {
+			for _, p := range pkg.importPaths() {
+				if p != "C" && p != "unsafe" {
+					imports = append(imports, p)
+				}
+			}
+		}
+		resolver.resolveWithGoList(imports, dir)
+		deps[dir] = map[string]struct{}{}
+		for _, p := range imports {
+			r, err := resolver.resolveImportPath(p, dir)
+			if err != nil || r.dir == dir {
+				continue
+			}
+			if _, ok := byDir[r.dir]; ok {
+				paths[p] = r.dir
+				deps[dir][r.dir] = struct{}{}
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return pkgs, nil
+	}
+	lg.log("Packages import other packages translated together:", paths)
+
+	sorted := make([]*Package, 0, len(pkgs))
+	for _, dir := range orderByDependencies(dirs, deps) {
+		sorted = append(sorted, byDir[dir]...)
+	}
+
+	s := &siblings{dirs: paths, checked: map[string]*types.Package{}, lg: lg}
+	if gen.Importer != nil {
+		s.exportImporter, s.sourceImporter = gen.Importer, gen.Importer
+		return sorted, s
+	}
+	// Export data of dependencies is shared by all the packages. Packages whose dependencies cannot be
+	// compiled fall back to the source importer in importerFor()
+	exports := map[string]string{}
+	for _, dir := range dirs {
+		e, err := listExportData(dir)
+		if err != nil {
+			lg.log("Export data of dependencies of", relpath(dir), "is not available:", err)
+			continue
+		}
+		for p, f := range e {
+			exports[p] = f
+		}
+	}
+	lg.log("Import packages from export data of", len(exports), "packages")
+	s.exports = exports
+	s.exportImporter = exportDataImporter(exports)
+	s.sourceImporter = importer.For("source", nil)
+	return sorted, s
+}
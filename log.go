@@ -3,53 +3,91 @@ package trygo
 import (
 	"fmt"
 	"github.com/fatih/color"
+	"io"
 	stdlog "log"
+	"os"
 	"path/filepath"
 	"strings"
 )
 
 var (
-	logEnabled bool
-	yellow     = color.New(color.FgYellow)
-	red        = color.New(color.FgRed)
-	green      = color.New(color.FgGreen)
+	yellow = color.New(color.FgYellow)
+	red    = color.New(color.FgRed)
+	green  = color.New(color.FgGreen)
 )
 
+// Logger is an interface to receive debug logs of translation and code generation. It can be set to
+// Gen.Logger per Gen instance so that each instance can capture its logs independently.
+type Logger interface {
+	// Log receives one log message. The message does not end with newline.
+	Log(msg string)
+}
+
+type writerLogger struct {
+	l *stdlog.Logger
+}
+
+func (w *writerLogger) Log(msg string) {
+	// 3 means a caller of logger.log()
+	w.l.Output(3, msg)
+}
+
+// NewLogger creates a Logger instance which outputs logs to the writer. Each log line is prefixed with
+// the file name and line number where the log was output.
+func NewLogger(w io.Writer) Logger {
+	return &writerLogger{stdlog.New(w, "", stdlog.Lshortfile)}
+}
+
+// defaultLogger is used by Gen instances whose Logger is not set. It is set by InitLog.
+var defaultLogger Logger
+
 // InitLog initializes logging instance. When true is given as enabled, all logs are output to stderr
 // while code generations.
+//
+// Deprecated: Set Gen.Logger to a logger created by NewLogger instead. InitLog only enables logs of Gen
+// instances whose Logger is nil.
 func InitLog(enabled bool) {
-	logEnabled = enabled
-	if !enabled {
-		return
+	if enabled {
+		defaultLogger = NewLogger(os.Stderr)
+	} else {
+		defaultLogger = nil
 	}
-	stdlog.SetFlags(stdlog.Lshortfile)
 }
 
-func log(v ...interface{}) {
-	if logEnabled {
-		stdlog.Output(2, fmt.Sprintln(v...))
+// logger is a wrapper of Logger. Its zero value disables logging.
+type logger struct {
+	l Logger
+}
+
+func (lg logger) enabled() bool {
+	return lg.l != nil
+}
+
+func (lg logger) log(v ...interface{}) {
+	if lg.l != nil {
+		lg.l.Log(strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
 	}
 }
 
-func logf(format string, v ...interface{}) {
-	if logEnabled {
-		stdlog.Output(2, fmt.Sprintf(format+"\n", v...))
+func (lg logger) logf(format string, v ...interface{}) {
+	if lg.l != nil {
+		lg.l.Log(fmt.Sprintf(format, v...))
 	}
 }
 
 // hi highlights text in log message with yellow color
 //
-//   log("Hellow", hi("important"), "message")
-func hi(v ...interface{}) string {
-	if !logEnabled {
+//   lg.log("Hellow", lg.hi("important"), "message")
+func (lg logger) hi(v ...interface{}) string {
+	if lg.l == nil {
 		return ""
 	}
 	return yellow.Sprint(v...)
 }
 
 // ftl is for fatal message. This function should be used only for fatal error information
-func ftl(v ...interface{}) string {
-	if !logEnabled {
+func (lg logger) ftl(v ...interface{}) string {
+	if lg.l == nil {
 		return ""
 	}
 	return red.Sprint(v...)
@@ -57,16 +95,13 @@ func ftl(v ...interface{}) string {
 
 // dbg is for debugging. This function should not be used usually, but used for temporary highlighting
 // for debugging.
-func dbg(v ...interface{}) {
-	if logEnabled {
-		stdlog.Output(2, green.Sprintln(v...))
+func (lg logger) dbg(v ...interface{}) {
+	if lg.l != nil {
+		lg.l.Log(strings.TrimSuffix(green.Sprintln(v...), "\n"))
 	}
 }
 
 func relpath(abspath string) string {
-	if !logEnabled {
-		return abspath
-	}
 	if !filepath.IsAbs(abspath) {
 		return abspath
 	}
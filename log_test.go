@@ -2,42 +2,54 @@ package trygo
 
 import (
 	"bytes"
-	stdlog "log"
-	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 )
 
+type testLogger struct {
+	msgs []string
+}
+
+func (l *testLogger) Log(msg string) {
+	l.msgs = append(l.msgs, msg)
+}
+
 func TestLogInitLog(t *testing.T) {
-	saved := logEnabled
+	saved := defaultLogger
 	defer func() {
-		logEnabled = saved
+		defaultLogger = saved
 	}()
 
 	InitLog(false)
-	if logEnabled {
+	if (&Gen{}).lg().enabled() {
 		t.Fatal("log should be disabled")
 	}
 	InitLog(true)
-	if !logEnabled {
+	if !(&Gen{}).lg().enabled() {
 		t.Fatal("log should be enabled")
 	}
+	l := &testLogger{}
+	if lg := (&Gen{Logger: l}).lg(); lg.l != l {
+		t.Fatal("Logger of Gen should be used instead of default logger:", lg.l)
+	}
 }
 
-func TestLogLogOutput(t *testing.T) {
-	saved := logEnabled
-	defer func() {
-		logEnabled = saved
-		stdlog.SetOutput(os.Stderr)
-	}()
-	InitLog(true)
+func TestLogEnabled(t *testing.T) {
+	if (logger{}).enabled() {
+		t.Fatal("log should be disabled")
+	}
+	if !(logger{&testLogger{}}).enabled() {
+		t.Fatal("log should be enabled")
+	}
+}
 
+func TestLogLogOutput(t *testing.T) {
 	var buf bytes.Buffer
-	stdlog.SetOutput(&buf)
+	lg := logger{NewLogger(&buf)}
 
-	log("hello", hi("yellow"), ftl("red!"))
-	logf("Answer: %d", 42)
+	lg.log("hello", lg.hi("yellow"), lg.ftl("red!"))
+	lg.logf("Answer: %d", 42)
 
 	stderr := buf.String()
 
@@ -53,20 +65,16 @@ func TestLogLogOutput(t *testing.T) {
 	if !strings.Contains(stderr, "Answer: 42") {
 		t.Fatal("formatted", stderr)
 	}
+	if !strings.Contains(stderr, "log_test.go:") {
+		t.Fatal("caller position", stderr)
+	}
 }
 
 func TestLogDbgOutput(t *testing.T) {
-	saved := logEnabled
-	defer func() {
-		logEnabled = saved
-		stdlog.SetOutput(os.Stderr)
-	}()
-	InitLog(true)
-
 	var buf bytes.Buffer
-	stdlog.SetOutput(&buf)
+	lg := logger{NewLogger(&buf)}
 
-	dbg("hello", "hi!", "goodbye")
+	lg.dbg("hello", "hi!", "goodbye")
 
 	stderr := buf.String()
 
@@ -76,19 +84,6 @@ func TestLogDbgOutput(t *testing.T) {
 }
 
 func TestLogRelpath(t *testing.T) {
-	saved := logEnabled
-	defer func() {
-		logEnabled = saved
-	}()
-	logEnabled = false
-
-	have := relpath("foo/bar")
-	want := "foo/bar"
-	if have != want {
-		t.Fatal("It should return the same value when log is disabled")
-	}
-
-	logEnabled = true
 	for p, want := range map[string]string{
 		filepath.Join(cwd, "foo/bar"): "./foo/bar",
 		"foo/bar":                     "foo/bar",
@@ -105,22 +100,34 @@ func TestLogRelpath(t *testing.T) {
 }
 
 func TestLogNoOutputOnDisabled(t *testing.T) {
-	saved := logEnabled
-	defer func() {
-		logEnabled = saved
-		stdlog.SetOutput(os.Stderr)
-	}()
-	InitLog(false)
+	lg := logger{}
 
-	var buf bytes.Buffer
-	stdlog.SetOutput(&buf)
+	// Should not panic
+	lg.log("hello", lg.hi("world"), lg.ftl("goodbye"))
+	lg.logf("Answer is %d", 42)
+	lg.dbg("This is", "debug", "message")
 
-	log("hello", hi("world"), ftl("goodbye"))
-	logf("Answer is %d", 42)
-	dbg("This is", "debug", "message")
+	if s := lg.hi("world") + lg.ftl("goodbye"); s != "" {
+		t.Fatal("Highlighted text should be empty when logging is disabled:", s)
+	}
+}
 
-	stderr := buf.String()
-	if stderr != "" {
-		t.Fatal("Log is output even if logging is disabled:", stderr)
+func TestLogPerGen(t *testing.T) {
+	l1, l2 := &testLogger{}, &testLogger{}
+	pkg1 := parsePackageForTest(t, pluginTestSrc)
+	pkg2 := parsePackageForTest(t, pluginTestSrc)
+
+	if err := (&Gen{Logger: l1}).translate([]*Package{pkg1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Gen{}).translate([]*Package{pkg2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(strings.Join(l1.msgs, "\n"), "try() call elimination") {
+		t.Fatal("Logs of translation were not captured:", l1.msgs)
+	}
+	if len(l2.msgs) != 0 {
+		t.Fatal("Logs of other Gen instance were captured:", l2.msgs)
 	}
 }
@@ -0,0 +1,82 @@
+package trygo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// ManifestFile describes one generated Go file in manifest.
+type ManifestFile struct {
+	// Source is a file path to TryGo source which the file was translated from. It is relative to the
+	// directory of manifest file and separated by slashes.
+	Source string `json:"source"`
+	// Output is a file path to the generated Go file. It is relative to the directory of manifest file
+	// and separated by slashes.
+	Output string `json:"output"`
+	// SHA256 is a hex-encoded SHA256 hash of content of the generated Go file.
+	SHA256 string `json:"sha256"`
+	// NumTrans is a number of try() calls translated in the file.
+	NumTrans int `json:"translations"`
+}
+
+// Manifest is a machine-readable list of generated files. Build systems can use this to track generated
+// artifacts and clean up them. Since paths in manifest are relative, manifest does not depend on the
+// location of the repository and can be committed.
+type Manifest struct {
+	Files []*ManifestFile `json:"files"`
+}
+
+// manifestPath converts the path to a path relative to the base directory separated by slashes.
+func manifestPath(base, path string) string {
+	if rel, err := filepath.Rel(base, path); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+func newManifest(pkgs []*Package, base string) (*Manifest, error) {
+	m := &Manifest{Files: []*ManifestFile{}}
+	for _, pkg := range pkgs {
+		counts := map[string]int{}
+		for _, p := range pkg.transPoints {
+			counts[pkg.Files.Position(p.pos).Filename]++
+		}
+
+		for path := range pkg.Node.Files {
+			if !pkg.isTarget(path) {
+				continue
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Cannot read generated file %q for manifest", path)
+			}
+			sum := sha256.Sum256(b)
+			src := pkg.sourceOf(path)
+			m.Files = append(m.Files, &ManifestFile{
+				Source:   manifestPath(base, src),
+				Output:   manifestPath(base, path),
+				SHA256:   hex.EncodeToString(sum[:]),
+				NumTrans: counts[src],
+			})
+		}
+	}
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Source < m.Files[j].Source
+	})
+	return m, nil
+}
+
+func (m *Manifest) writeFile(path string, lg logger) error {
+	lg.log("Write manifest to", lg.hi(relpath(path)))
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	return errors.Wrapf(ioutil.WriteFile(path, b, 0644), "Cannot write manifest file %q", path)
+}
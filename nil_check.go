@@ -2,10 +2,15 @@ package trygo
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	"go/ast"
+	"go/parser"
 	"go/token"
 	"go/types"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 // Nil check insertion.
@@ -13,9 +18,18 @@ import (
 //
 //   - Insert `if _err$n != nil { return $zerovals, _err$n }`.
 //   - Replace '_' ignoring variables inserted by try() call elimination with _err$n variables.
-//   - Inserts `var _err$n error` for assignments.
+//   - Inserts `var _err$n error` for assignments. When the function in try() returns a concrete error
+//     type such as *MyError, the variable has the concrete type so that nil check is done against it.
 //   - On toplevel try(f()) call expression statement, the function call is replaced with
 //     `if $ignores, err := f(); err != nil { ... }`.
+//   - For ok() calls, `if !_ok$n { return $zerovals }` is inserted instead. When error for ok() is
+//     configured, it is returned as the last return value.
+//   - For expect() calls, `if _err$n != nil { $handler(_err$n) }` is inserted. It does not return.
+//   - For try() with an error value as the second argument, the value is returned instead of the error.
+//     When wrapping is configured, `fmt.Errorf("%w: %v", $replaced, _err$n)` is returned.
+//   - For tryOr() calls, `if _err$n != nil { $lhs = $fallback }` is inserted. It does not return.
+//   - throw(err) statement is replaced with `if err != nil { return $zerovals, err }`. When the argument
+//     is not a variable, it is evaluated once with `if _err$n := $arg; _err$n != nil { ... }`.
 
 func newIdent(name string, pos token.Pos) *ast.Ident {
 	i := ast.NewIdent(name)
@@ -23,15 +37,269 @@ func newIdent(name string, pos token.Pos) *ast.Ident {
 	return i
 }
 
+var (
+	posType          = reflect.TypeOf(token.NoPos)
+	objectType       = reflect.TypeOf((*ast.Object)(nil))
+	commentGroupType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+// copyValueAt deep-copies given value of AST node. All valid positions in the copied value are set to the
+// given position. Objects are shared with the original node and comments are not copied.
+func copyValueAt(v reflect.Value, pos token.Pos) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == objectType {
+			return v
+		}
+		if v.Type() == commentGroupType {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValueAt(v.Elem(), pos))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValueAt(v.Elem(), pos))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			c.Field(i).Set(copyValueAt(v.Field(i), pos))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValueAt(v.Index(i), pos))
+		}
+		return c
+	default:
+		if v.Type() == posType && token.Pos(v.Int()).IsValid() {
+			return reflect.ValueOf(pos)
+		}
+		return v
+	}
+}
+
+// copyExprAt deep-copies given expression node putting it at the given position. Reusing an AST node
+// at a different place confuses printer since positions of the node are inconsistent with surrounding
+// nodes.
+func copyExprAt(expr ast.Expr, pos token.Pos) ast.Expr {
+	return copyValueAt(reflect.ValueOf(&expr).Elem(), pos).Interface().(ast.Expr)
+}
+
+// runtimePkgPath is an import path of the helper package used by generated code with Gen.RuntimeHelpers.
+const runtimePkgPath = "github.com/rhysd/trygo/trygoruntime"
+
+var (
+	errorType      = types.Universe.Lookup("error").Type()
+	errorInterface = errorType.Underlying().(*types.Interface)
+)
+
+// checkedTypeOf returns the last result type of the function call in try() or ok(). It is nil when the
+// type is unknown. For example, types of cgo are not resolved with fake "C" package.
+func checkedTypeOf(trans *transPoint, info *types.Info) types.Type {
+	ty := info.Types[trans.call].Type
+	if tpl, ok := ty.(*types.Tuple); ok && tpl.Len() > 0 {
+		ty = tpl.At(tpl.Len() - 1).Type()
+	}
+	if b, ok := ty.(*types.Basic); ok && b.Kind() == types.Invalid {
+		return nil
+	}
+	// ok value of comma-ok expression may be untyped bool
+	return types.Default(ty)
+}
+
+// lastResultTypeOf returns the last result type of the function where try() is called. When try() is
+// called in a deferred function literal, it is the type of the named result of the enclosing function.
+// It returns nil when the function returns nothing.
+func lastResultTypeOf(trans *transPoint, info *types.Info) types.Type {
+	if trans.errResult != nil {
+		return info.Defs[trans.errResult].Type()
+	}
+	var sig *types.Signature
+	switch f := trans.fun.(type) {
+	case *ast.FuncDecl:
+		sig = info.Defs[f.Name].Type().(*types.Signature)
+	case *ast.FuncLit:
+		sig = info.Types[f].Type.(*types.Signature)
+	}
+	rets := sig.Results()
+	if rets.Len() == 0 {
+		return nil
+	}
+	return rets.At(rets.Len() - 1).Type()
+}
+
+// errorTypesOf returns the last result type of the function where try() is called and the type of error
+// returned from the function call in try(). The error type is nil when it is unknown.
+func errorTypesOf(trans *transPoint, info *types.Info) (types.Type, types.Type) {
+	return lastResultTypeOf(trans, info), checkedTypeOf(trans, info)
+}
+
+// checkErrorTypes checks that the function where try() is called returns a type implementing error as
+// its last return value and that the error returned from the function call in try() can be returned
+// as it. When the error is replaced with the second argument of try(), the argument is returned instead.
+// wrap is true when the replaced error wraps the original one. It returns a message of the problem or an
+// empty string when no problem was found.
+func checkErrorTypes(trans *transPoint, info *types.Info, wrap bool) string {
+	ret, err := errorTypesOf(trans, info)
+	str := func(ty types.Type) string {
+		return types.TypeString(ty, (*types.Package).Name)
+	}
+	if !types.Implements(ret, errorInterface) {
+		return fmt.Sprintf("The function does not return error as last return value. Last return type is %q", str(ret))
+	}
+	if trans.kind == transKindThrow {
+		if err == nil {
+			return ""
+		}
+		if !types.Implements(err, errorInterface) {
+			return fmt.Sprintf("Value passed to throw() must implement error but its type is %q", str(err))
+		}
+		if !types.AssignableTo(err, ret) {
+			return fmt.Sprintf("Error type %q passed to throw() is not assignable to last return type %q", str(err), str(ret))
+		}
+		return ""
+	}
+	if trans.replaced != nil {
+		if err != nil && !trans.commaOk() && !types.Implements(err, errorInterface) {
+			return fmt.Sprintf("The function called in try() does not return error as last return value. Last return type is %q", str(err))
+		}
+		rep := types.Default(info.Types[trans.replaced].Type)
+		if !types.Implements(rep, errorInterface) {
+			return fmt.Sprintf("Second argument of try() must be error value but its type is %q", str(rep))
+		}
+		if wrap {
+			rep = errorType // Wrapped error is created with fmt.Errorf()
+		}
+		if !types.AssignableTo(rep, ret) {
+			return fmt.Sprintf("Error type %q replacing error in try() is not assignable to last return type %q", str(rep), str(ret))
+		}
+		return ""
+	}
+	if kind := commaOkExprKind(trans.call); kind != "" {
+		// Error for failed comma-ok expression is generated as error interface value
+		if !types.AssignableTo(errorType, ret) {
+			return fmt.Sprintf("Error for failed %s cannot be returned as last return type %q", kind, str(ret))
+		}
+		return ""
+	}
+	if err == nil {
+		return ""
+	}
+	if !types.Implements(err, errorInterface) {
+		return fmt.Sprintf("The function called in try() does not return error as last return value. Last return type is %q", str(err))
+	}
+	if !types.AssignableTo(err, ret) {
+		return fmt.Sprintf("Error type %q returned from the function called in try() is not assignable to last return type %q", str(err), str(ret))
+	}
+	return ""
+}
+
+// checkTransTypes checks types at the translation point of try(), ok() or expect(). hasOkErr is true
+// when error for ok() is configured. wrap is true when the error replacing the original error in try()
+// wraps the original one.
+func checkTransTypes(trans *transPoint, info *types.Info, hasOkErr, wrap bool) string {
+	if trans.ok {
+		return checkOkTypes(trans, info, hasOkErr)
+	}
+	if trans.expect {
+		return checkExpectTypes(trans, info)
+	}
+	if trans.fallback != nil {
+		return checkTryOrTypes(trans, info)
+	}
+	return checkErrorTypes(trans, info, wrap)
+}
+
+// checkTryOrTypes checks that the function call in tryOr() returns a value and error and that the
+// fallback value can be assigned as the value. Like expect(), the function where tryOr() is called may
+// return anything.
+func checkTryOrTypes(trans *transPoint, info *types.Info) string {
+	str := func(ty types.Type) string {
+		return types.TypeString(ty, (*types.Package).Name)
+	}
+	tpl, ok := info.Types[trans.call].Type.(*types.Tuple)
+	if !ok {
+		return "" // Type is unknown. For example, types of cgo are not resolved
+	}
+	if tpl.Len() != 2 {
+		return fmt.Sprintf("The function called in tryOr() must return a value and error but it returns %d values", tpl.Len())
+	}
+	if ty := checkedTypeOf(trans, info); !trans.commaOk() && !types.Implements(ty, errorInterface) {
+		return fmt.Sprintf("The function called in tryOr() does not return error as last return value. Last return type is %q", str(ty))
+	}
+	val, fallback := tpl.At(0).Type(), info.Types[trans.fallback].Type
+	if !types.AssignableTo(fallback, val) {
+		return fmt.Sprintf("Fallback value of type %q passed to tryOr() is not assignable to type %q", str(fallback), str(val))
+	}
+	return ""
+}
+
+// checkExpectTypes checks that the function call in expect() returns error as its last return value.
+// Unlike try(), the function where expect() is called may return anything since expect() does not
+// return from it.
+func checkExpectTypes(trans *transPoint, info *types.Info) string {
+	ty := checkedTypeOf(trans, info)
+	if ty == nil || types.Implements(ty, errorInterface) {
+		return ""
+	}
+	return fmt.Sprintf("The function called in expect() does not return error as last return value. Last return type is %q", types.TypeString(ty, (*types.Package).Name))
+}
+
+// checkOkTypes checks that the function call in ok() returns bool as its last return value. When hasErr
+// is true, the function where ok() is called must return a type implementing error as its last return
+// value to return the error for ok(). It returns a message of the problem or an empty string when no
+// problem was found.
+func checkOkTypes(trans *transPoint, info *types.Info, hasErr bool) string {
+	str := func(ty types.Type) string {
+		return types.TypeString(ty, (*types.Package).Name)
+	}
+	if ty := checkedTypeOf(trans, info); ty != nil {
+		if b, ok := ty.Underlying().(*types.Basic); !ok || b.Info()&types.IsBoolean == 0 {
+			return fmt.Sprintf("The function called in ok() does not return bool as last return value. Last return type is %q", str(ty))
+		}
+	}
+	if !hasErr {
+		return ""
+	}
+	ret := lastResultTypeOf(trans, info)
+	if ret == nil {
+		return "The function returns nothing. Error for ok() cannot be returned"
+	}
+	if !types.Implements(ret, errorInterface) {
+		return fmt.Sprintf("The function does not return error as last return value. Error for ok() cannot be returned. Last return type is %q", str(ret))
+	}
+	return ""
+}
+
 type nilCheckInsertion struct {
 	pkg      *ast.Package
 	fileset  *token.FileSet
 	roots    []*blockTree
 	blk      *blockTree
+	stmts    *stmtEditor
 	offset   int
 	varID    int
 	typeInfo *types.Info
 	pkgTypes *types.Package
+	okError  ast.Expr
+	notFound ast.Expr
+	closed   ast.Expr
+	expect   ast.Expr
+	wrap     bool
+	decide   func(TransPoint) Decision
+	untyped  bool
+	helpers  bool
+	lg       logger
+	err      error
 }
 
 func (nci *nilCheckInsertion) nodePos(node ast.Node) token.Position {
@@ -39,18 +307,37 @@ func (nci *nilCheckInsertion) nodePos(node ast.Node) token.Position {
 }
 
 func (nci *nilCheckInsertion) logPos(node ast.Node) string {
-	if !logEnabled {
+	if !nci.lg.enabled() {
 		return ""
 	}
 	return relpath(nci.nodePos(node).String())
 }
 
+func (nci *nilCheckInsertion) errAt(pos token.Pos, msg string) {
+	nci.err = errors.Errorf("%s: %v: Error: %s", nci.fileset.Position(pos), nci.pkg.Name, msg)
+	nci.lg.log(nci.lg.ftl(nci.err))
+}
+
+func (nci *nilCheckInsertion) errfAt(pos token.Pos, format string, args ...interface{}) {
+	nci.errAt(pos, fmt.Sprintf(format, args...))
+}
+
 func (nci *nilCheckInsertion) genErrIdent(pos token.Pos) *ast.Ident {
 	i := newIdent(fmt.Sprintf("_err%d", nci.varID), pos)
 	nci.varID++
 	return i
 }
 
+// genCheckedIdent generates a variable to receive the value checked by try() or ok().
+func (nci *nilCheckInsertion) genCheckedIdent(trans *transPoint, pos token.Pos) *ast.Ident {
+	if !trans.commaOk() {
+		return nci.genErrIdent(pos)
+	}
+	i := newIdent(fmt.Sprintf("_ok%d", nci.varID), pos)
+	nci.varID++
+	return i
+}
+
 func (nci *nilCheckInsertion) typeInfoFor(node ast.Expr) types.Type {
 	t, ok := nci.typeInfo.Types[node]
 	if !ok {
@@ -68,33 +355,90 @@ func (nci *nilCheckInsertion) funcTypeOf(node ast.Node) (*types.Signature, *ast.
 			panic(fmt.Sprintf("Type check was OK but type cannot be resolved for function '%s' at %s", decl.Name.Name, nci.nodePos(decl)))
 		}
 		ty := obj.Type().(*types.Signature)
-		log("Function type of func", decl.Name.Name, "->", ty)
+		nci.lg.log("Function type of func", decl.Name.Name, "->", ty)
 		return ty, decl.Type
 	}
 
 	lit := node.(*ast.FuncLit)
 	ty := nci.typeInfoFor(lit).(*types.Signature)
-	log("Function type of func literal at", nci.logPos(lit), "->", ty)
+	nci.lg.log("Function type of func literal at", nci.logPos(lit), "->", ty)
 	return ty, lit.Type
 }
 
+// fileAt returns a file node which contains given position.
+func (nci *nilCheckInsertion) fileAt(pos token.Pos) *ast.File {
+	for _, f := range nci.pkg.Files {
+		if f.Pos() <= pos && pos < f.End() {
+			return f
+		}
+	}
+	return nil
+}
+
+// typeExprOf returns a type expression of given type at the position. Packages in the type
+// are qualified with names imported in the file. It returns nil when the type cannot be referred in the
+// file since its package is not imported.
+func (nci *nilCheckInsertion) typeExprOf(ty types.Type, pos token.Pos) ast.Expr {
+	if ty == errorType {
+		return newIdent("error", pos)
+	}
+
+	file := nci.fileAt(pos)
+	resolved := true
+	s := types.TypeString(ty, func(p *types.Package) string {
+		if p == nci.pkgTypes {
+			return ""
+		}
+		if file != nil {
+			for _, spec := range file.Imports {
+				if path, err := strconv.Unquote(spec.Path.Value); err != nil || path != p.Path() {
+					continue
+				}
+				if spec.Name == nil {
+					return p.Name()
+				}
+				if spec.Name.Name == "." {
+					return ""
+				}
+				return spec.Name.Name
+			}
+		}
+		resolved = false
+		return p.Name()
+	})
+	if !resolved {
+		return nil
+	}
+
+	expr, err := parser.ParseExpr(s)
+	if err != nil {
+		panic(fmt.Sprintf("Cannot parse string representation of type %q: %s", s, err))
+	}
+	nci.lg.log("Type expression for type", nci.lg.hi(s), "was generated")
+	return copyExprAt(expr, pos)
+}
+
 // If previous translation exists in the same block and some statements were already inserted,
 // the offset is automatically adjusted.
 func (nci *nilCheckInsertion) insertStmtAt(idx int, stmt ast.Stmt) {
-	logf("Insert statement at index %d with offset %d", idx, nci.offset)
-	nci.blk.insertStmtAt(idx+nci.offset, stmt)
+	nci.lg.logf("Insert statement at index %d with offset %d", idx, nci.offset)
+	nci.stmts.insertAt(idx+nci.offset, stmt)
 	nci.offset++
 }
 
 func (nci *nilCheckInsertion) removeStmtAt(idx int) {
-	logf("Remove statement at index %d with offset %d", idx, nci.offset)
-	nci.blk.removeStmtAt(idx + nci.offset)
+	nci.lg.logf("Remove statement at index %d with offset %d", idx, nci.offset)
+	nci.stmts.removeAt(idx + nci.offset)
 	nci.offset--
 }
 
+// zeroValueOf returns an expression of zero value of the type. typeNode is the AST node of the type in
+// source which is reused when the zero value cannot be represented without the type name. When no
+// literal is known for the type, *new(T), which is equivalent to `var zero T`, is used as fallback so that
+// any type can be handled.
 func (nci *nilCheckInsertion) zeroValueOf(ty types.Type, typeNode ast.Expr, pos token.Pos) (expr ast.Expr) {
 	tyStr := ty.String()
-	log("Zero value will be calculated for", hi(tyStr))
+	nci.lg.log("Zero value will be calculated for", nci.lg.hi(tyStr))
 	switch ty := ty.(type) {
 	case *types.Basic:
 		switch ty.Kind() {
@@ -128,79 +472,530 @@ func (nci *nilCheckInsertion) zeroValueOf(ty types.Type, typeNode ast.Expr, pos
 			}
 		case types.UnsafePointer:
 			expr = newIdent("nil", pos)
-		case types.UntypedBool, types.UntypedInt, types.UntypedFloat, types.UntypedComplex,
-			types.UntypedString, types.UntypedNil, types.UntypedRune:
-			panic("Untyped types must not appear while calculating zero values since they are calculated from function return types:" + reflect.TypeOf(ty).String())
+		case types.Invalid:
+			if nci.untyped {
+				if expr = untypedZeroValueOf(typeNode, pos); expr != nil {
+					break
+				}
+			}
+			if nci.helpers {
+				// trygoruntime.Zero[T]()
+				expr = nci.runtimeCall(&ast.IndexExpr{
+					X:      nci.runtimeFunc("Zero", pos),
+					Lbrack: pos,
+					Index:  copyExprAt(typeNode, pos),
+					Rbrack: pos,
+				}, nil, pos)
+				break
+			}
+			// Type is unknown. For example, types of cgo are not resolved with fake "C" package. Generate
+			// *new(T) which is a zero value of any type T.
+			expr = newZeroValueOf(typeNode, pos)
 		default:
-			panic("Unreachable")
+			// Untyped types must not appear since zero values are calculated from function return types
+			nci.lg.log("Unexpected basic type", nci.lg.hi(tyStr), "falls back to *new(T)")
+			expr = newZeroValueOf(typeNode, pos)
 		}
 	case *types.Slice, *types.Pointer, *types.Signature, *types.Interface, *types.Map, *types.Chan:
 		expr = newIdent("nil", pos)
 	case *types.Struct, *types.Array:
-		// To create CompositeLit for zero value of immediate struct, we reuse the AST node from return type of
-		// function declaration because reconstruct immediate struct type AST node from *types.Struct needs bunch
-		// of code for constructing ast.Expr from types.Type generally.
-		// Note that position of AST node is not correct.
-		expr = &ast.CompositeLit{Type: typeNode}
-		log("AST type node at", nci.logPos(typeNode), "is reused to generate zero value of", reflect.TypeOf(typeNode))
+		expr = nci.compositeZeroValueOf(ty, typeNode, pos)
 	case *types.Named:
 		u := ty.Underlying()
-		if _, ok := u.(*types.Struct); ok {
-			// When the underlying type is struct, CompositeLit should be used for zero value. To create it, we reuse
-			// the AST node from return type of function declaration because it may contain package name like pkg.S.
-			// There is no API to get package(pkg) and name(S) separately from types.Named. We need to parse string
-			// representation. Reusing the AST node is better than parsing.
-			// Note that position of AST node is not correct.
-			expr = &ast.CompositeLit{Type: typeNode}
-			log("AST type node at", nci.logPos(typeNode), "is reused to generate zero value of *types.Named")
+		if isCompositeType(u) {
+			// The named type is used for CompositeLit instead of its underlying type
+			expr = nci.compositeZeroValueOf(ty, typeNode, pos)
 			break
 		}
 		expr = nci.zeroValueOf(u, typeNode, pos)
-	case *types.Tuple:
-		panic("Cannot obtain zero value of tuple: " + tyStr)
 	default:
-		panic("Cannot obtain zero value of tuple: " + tyStr + ": " + reflect.TypeOf(ty).String())
+		if isTypeParam(ty) {
+			// No literal represents zero value of type parameter since its type set may contain any type
+			expr = newZeroValueOf(typeNode, pos)
+			nci.lg.log("AST type node at", nci.logPos(typeNode), "is reused to generate zero value of type parameter")
+			break
+		}
+		if u := ty.Underlying(); u != nil && u != ty {
+			// For example, alias type is resolved to its actual type
+			if isCompositeType(u) {
+				expr = nci.compositeZeroValueOf(ty, typeNode, pos)
+			} else {
+				expr = nci.zeroValueOf(u, typeNode, pos)
+			}
+			break
+		}
+		// Tuple and unknown kinds of types
+		nci.lg.log("Unexpected type", nci.lg.hi(tyStr), "of", reflect.TypeOf(ty), "falls back to *new(T)")
+		expr = newZeroValueOf(typeNode, pos)
 	}
 
-	log("Zero value:", hi(tyStr), "->", hi(reflect.TypeOf(expr)))
+	nci.lg.log("Zero value:", nci.lg.hi(tyStr), "->", nci.lg.hi(reflect.TypeOf(expr)))
 	return
 }
 
-func (nci *nilCheckInsertion) insertIfNilChkStmtAfter(index int, errIdent *ast.Ident, init ast.Stmt, fun ast.Node) {
+// isCompositeType returns true when zero value of the type is represented with CompositeLit.
+func isCompositeType(ty types.Type) bool {
+	switch ty.(type) {
+	case *types.Struct, *types.Array:
+		return true
+	default:
+		return false
+	}
+}
+
+// literalTypeExprOf returns a type expression of the type as typeExprOf does. Anonymous struct types and
+// array types are constructed explicitly so that field tags and nested anonymous structs are kept in the
+// same forms as they are written in source. It returns nil when some type cannot be referred in the
+// file at the position.
+func (nci *nilCheckInsertion) literalTypeExprOf(ty types.Type, pos token.Pos) ast.Expr {
+	switch ty := ty.(type) {
+	case *types.Struct:
+		fields := make([]*ast.Field, 0, ty.NumFields())
+		for i := 0; i < ty.NumFields(); i++ {
+			v := ty.Field(i)
+			t := nci.literalTypeExprOf(v.Type(), pos)
+			if t == nil {
+				return nil
+			}
+			f := &ast.Field{Type: t}
+			if !v.Embedded() {
+				f.Names = []*ast.Ident{newIdent(v.Name(), pos)}
+			}
+			if tag := ty.Tag(i); tag != "" {
+				lit := strconv.Quote(tag)
+				if strconv.CanBackquote(tag) {
+					lit = "`" + tag + "`"
+				}
+				f.Tag = &ast.BasicLit{Kind: token.STRING, Value: lit, ValuePos: pos}
+			}
+			fields = append(fields, f)
+		}
+		return &ast.StructType{Struct: pos, Fields: &ast.FieldList{Opening: pos, List: fields, Closing: pos}}
+	case *types.Array:
+		elem := nci.literalTypeExprOf(ty.Elem(), pos)
+		if elem == nil {
+			return nil
+		}
+		n := &ast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(ty.Len(), 10), ValuePos: pos}
+		return &ast.ArrayType{Lbrack: pos, Len: n, Elt: elem}
+	default:
+		return nci.typeExprOf(ty, pos)
+	}
+}
+
+// compositeZeroValueOf returns CompositeLit of zero value of struct or array type like T{}. The type
+// expression is constructed from the type with package names imported in the file at the position.
+// Reusing the AST node of the type in source does not work when the node cannot be put in CompositeLit
+// such as parenthesized type (T). The AST node is reused only when the type cannot be referred at the
+// position.
+func (nci *nilCheckInsertion) compositeZeroValueOf(ty types.Type, typeNode ast.Expr, pos token.Pos) ast.Expr {
+	t := nci.literalTypeExprOf(ty, pos)
+	if t == nil {
+		// The AST node is copied to put it at the position of nil check
+		t = copyExprAt(typeNode, pos)
+		nci.lg.log("AST type node at", nci.logPos(typeNode), "is reused to generate zero value of", ty)
+	}
+	return &ast.CompositeLit{Type: t, Lbrace: pos, Rbrace: pos}
+}
+
+// newZeroValueOf returns *new(T) expression which is a zero value of any type T.
+func newZeroValueOf(typeNode ast.Expr, pos token.Pos) ast.Expr {
+	return &ast.StarExpr{
+		Star: pos,
+		X: &ast.CallExpr{
+			Fun:    newIdent("new", pos),
+			Lparen: pos,
+			Args:   []ast.Expr{copyExprAt(typeNode, pos)},
+			Rparen: pos,
+		},
+	}
+}
+
+// posAfter returns the position at the end of the last line of given node. Nodes inserted after the node
+// are put at the position so that comments in the line are kept attached to the node on printing.
+func (nci *nilCheckInsertion) posAfter(node ast.Node) token.Pos {
+	end := node.End()
+	f := nci.fileset.File(end)
+	if f == nil {
+		return end
+	}
+	line := f.Line(end)
+	if line >= f.LineCount() {
+		return token.Pos(f.Base() + f.Size())
+	}
+	return f.LineStart(line+1) - 1
+}
+
+// errResultBody returns the body of nil check in a function literal called by defer statement. It sets
+// the error to the named result of the enclosing function unless the result already has an error, then
+// returns from the function literal.
+func (nci *nilCheckInsertion) errResultBody(result *ast.Ident, err ast.Expr, pos token.Pos) []ast.Stmt {
+	nci.lg.log("Error is set to named result", nci.lg.hi(result.Name), "of enclosing function")
+	return []ast.Stmt{
+		&ast.IfStmt{
+			If: pos,
+			Cond: &ast.BinaryExpr{
+				X:     newIdent(result.Name, pos),
+				Y:     newIdent("nil", pos),
+				Op:    token.EQL,
+				OpPos: pos,
+			},
+			Body: &ast.BlockStmt{
+				Lbrace: pos,
+				List: []ast.Stmt{
+					&ast.AssignStmt{
+						Lhs:    []ast.Expr{newIdent(result.Name, pos)},
+						Tok:    token.ASSIGN,
+						TokPos: pos,
+						Rhs:    []ast.Expr{err},
+					},
+				},
+				Rbrace: pos,
+			},
+		},
+		&ast.ReturnStmt{Return: pos},
+	}
+}
+
+// importName returns a name to refer the package at the path in the file. When the package is not
+// imported in the file yet, it is newly imported.
+func (nci *nilCheckInsertion) importName(file *ast.File, path string) string {
+	for _, spec := range file.Imports {
+		if p, err := strconv.Unquote(spec.Path.Value); err != nil || p != path {
+			continue
+		}
+		if spec.Name == nil {
+			return filepath.Base(path)
+		}
+		if n := spec.Name.Name; n != "_" && n != "." {
+			return n
+		}
+	}
+
+	nci.lg.log("Add import", nci.lg.hi(path), "to file", nci.lg.hi(file.Name.Name))
+	spec := &ast.ImportSpec{
+		Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)},
+	}
+	file.Imports = append(file.Imports, spec)
+
+	// Add the import to the first import declaration. `import "C"` is skipped since it has a preamble
+	// of cgo
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT {
+			break // Import declarations are always at the top of file
+		}
+		if len(decl.Specs) == 1 && decl.Specs[0].(*ast.ImportSpec).Path.Value == `"C"` {
+			continue
+		}
+		if !decl.Lparen.IsValid() {
+			// Surround the single import with parens to add more imports
+			decl.Lparen = decl.Specs[0].Pos()
+			decl.Rparen = decl.Specs[0].End()
+		}
+		decl.Specs = append(decl.Specs, spec)
+		return filepath.Base(path)
+	}
+
+	decl := &ast.GenDecl{Tok: token.IMPORT, Specs: []ast.Spec{spec}}
+	file.Decls = append([]ast.Decl{decl}, file.Decls...)
+	return filepath.Base(path)
+}
+
+// isSideEffectFree returns true when evaluating the expression twice is safe. It is a variable or a
+// literal.
+func isSideEffectFree(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.Ident, *ast.BasicLit:
+		return true
+	default:
+		return false
+	}
+}
+
+// commaOkErrorOf returns an error expression for failed comma-ok expression. For type assertion, it
+// describes the dynamic type of the operand. Since the operand is evaluated twice, the dynamic type is
+// only described when the operand is a variable like `fmt.Errorf("interface conversion: %T is not T", x)`.
+// For map index, the key is described in the same manner unless an error is configured. For channel
+// receive, the error tells that the channel was closed unless an error is configured.
+func (nci *nilCheckInsertion) commaOkErrorOf(expr ast.Expr, pos token.Pos) ast.Expr {
+	var format string
+	var args []ast.Expr
+	switch expr := expr.(type) {
+	case *ast.TypeAssertExpr:
+		ty := types.ExprString(expr.Type)
+		if isSideEffectFree(expr.X) {
+			format = "interface conversion: %T is not " + ty
+			args = []ast.Expr{copyExprAt(expr.X, pos)}
+		} else {
+			format = "interface conversion: interface is not " + ty
+		}
+	case *ast.IndexExpr:
+		if nci.notFound != nil {
+			return copyExprAt(nci.notFound, pos)
+		}
+		if isSideEffectFree(expr.Index) {
+			format = "key %v not found in map"
+			args = []ast.Expr{copyExprAt(expr.Index, pos)}
+		} else {
+			format = "key not found in map"
+		}
+	case *ast.UnaryExpr:
+		if nci.closed != nil {
+			return copyExprAt(nci.closed, pos)
+		}
+		format = "receive from closed channel"
+	default:
+		panic("Unreachable: Unknown comma-ok expression: " + reflect.TypeOf(expr).String())
+	}
+
+	return nci.errorfCall(format, args, pos)
+}
+
+// runtimeFunc builds a selector expression of the function in trygoruntime package like
+// `trygoruntime.Wrap`. The package is imported when it is not imported yet.
+func (nci *nilCheckInsertion) runtimeFunc(name string, pos token.Pos) ast.Expr {
+	return &ast.SelectorExpr{
+		X:   newIdent(nci.importName(nci.fileAt(pos), runtimePkgPath), pos),
+		Sel: newIdent(name, pos),
+	}
+}
+
+// runtimeCall builds a call expression of the function in trygoruntime package.
+func (nci *nilCheckInsertion) runtimeCall(fun ast.Expr, args []ast.Expr, pos token.Pos) ast.Expr {
+	return &ast.CallExpr{Fun: fun, Lparen: pos, Args: args, Rparen: pos}
+}
+
+// errorfCall builds `fmt.Errorf(format, args...)` call expression. "fmt" package is imported when it is
+// not imported yet.
+func (nci *nilCheckInsertion) errorfCall(format string, args []ast.Expr, pos token.Pos) ast.Expr {
+	fmtName := nci.importName(nci.fileAt(pos), "fmt")
+	lit := &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(format), ValuePos: pos}
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   newIdent(fmtName, pos),
+			Sel: newIdent("Errorf", pos),
+		},
+		Lparen: pos,
+		Args:   append([]ast.Expr{lit}, args...),
+		Rparen: pos,
+	}
+}
+
+// expectBody returns the body of the check for expect() call. It calls the configured handler with the
+// error. When no handler is configured, the error is output with its position in TryGo source like
+// `log.Printf("file.go:12: %v", err)`.
+func (nci *nilCheckInsertion) expectBody(trans *transPoint, err ast.Expr, pos token.Pos) []ast.Stmt {
+	call := &ast.CallExpr{
+		Lparen: pos,
+		Args:   []ast.Expr{err},
+		Rparen: pos,
+	}
+	if nci.expect != nil {
+		call.Fun = copyExprAt(nci.expect, pos)
+	} else if nci.helpers {
+		// trygoruntime.Report(err, "file.go:12")
+		src := nci.fileset.Position(trans.pos)
+		callsite := fmt.Sprintf("%s:%d", filepath.Base(src.Filename), src.Line)
+		call.Fun = nci.runtimeFunc("Report", pos)
+		call.Args = []ast.Expr{err, &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(callsite), ValuePos: pos}}
+	} else {
+		src := nci.fileset.Position(trans.pos)
+		format := fmt.Sprintf("%s:%d: %%v", filepath.Base(src.Filename), src.Line)
+		call.Fun = &ast.SelectorExpr{
+			X:   newIdent(nci.importName(nci.fileAt(pos), "log"), pos),
+			Sel: newIdent("Printf", pos),
+		}
+		call.Args = []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(format), ValuePos: pos}, err}
+	}
+	return []ast.Stmt{&ast.ExprStmt{X: call}}
+}
+
+// zeroValuesOf returns zero values of first n results of the function.
+func (nci *nilCheckInsertion) zeroValuesOf(fun ast.Node, n int, pos token.Pos) []ast.Expr {
 	funcTy, funcTyNode := nci.funcTypeOf(fun)
-	pos := errIdent.NamePos
 	rets := funcTy.Results()
-	retLen := rets.Len()
-	retVals := make([]ast.Expr, 0, retLen)
-	for i := 0; i < retLen-1; i++ { // -1 since last type is 'error'
-		ret := rets.At(i).Type()
-		node := funcTyNode.Results.List[i].Type
-		retVals = append(retVals, nci.zeroValueOf(ret, node, pos))
+	nodes := resultTypeNodes(funcTyNode)
+	vals := make([]ast.Expr, 0, rets.Len())
+	for i := 0; i < n; i++ {
+		vals = append(vals, nci.zeroValueOf(rets.At(i).Type(), nodes[i], pos))
+	}
+	return vals
+}
+
+// resultTypeNodes returns AST nodes of result types of the function type. One field can declare
+// multiple results like (a, b T) so each type node is repeated for the names.
+func resultTypeNodes(ty *ast.FuncType) []ast.Expr {
+	nodes := []ast.Expr{}
+	if ty.Results == nil {
+		return nodes
+	}
+	for _, field := range ty.Results.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			nodes = append(nodes, field.Type)
+		}
+	}
+	return nodes
+}
+
+// commaOkBody returns the body of the check for comma-ok value. The error is returned as the last return
+// value. When the error is nil, zero values of all results are returned.
+func (nci *nilCheckInsertion) commaOkBody(trans *transPoint, err ast.Expr, pos token.Pos) []ast.Stmt {
+	if err == nil {
+		n, _ := nci.funcTypeOf(trans.fun)
+		return []ast.Stmt{
+			&ast.ReturnStmt{
+				Results: nci.zeroValuesOf(trans.fun, n.Results().Len(), pos),
+				Return:  pos,
+			},
+		}
+	}
+
+	if trans.errResult != nil {
+		return nci.errResultBody(trans.errResult, err, pos)
+	}
+
+	n, _ := nci.funcTypeOf(trans.fun)
+	retVals := nci.zeroValuesOf(trans.fun, n.Results().Len()-1, pos) // -1 since last type is 'error'
+	return []ast.Stmt{
+		&ast.ReturnStmt{
+			Results: append(retVals, err),
+			Return:  pos,
+		},
+	}
+}
+
+// replacedErrorOf returns the error value passed to try() as the second argument. When wrapping is
+// configured, the original error is wrapped like `fmt.Errorf("%w: %v", $replaced, err)`. err is nil for
+// comma-ok expression since it has no original error.
+func (nci *nilCheckInsertion) replacedErrorOf(trans *transPoint, err ast.Expr, pos token.Pos) ast.Expr {
+	rep := copyExprAt(trans.replaced, pos)
+	if !nci.wrap || err == nil {
+		return rep
+	}
+	return nci.errorfCall("%w: %v", []ast.Expr{rep, err}, pos)
+}
+
+// wrappedErrorOf wraps the error returned at the translation point with the message decided by
+// Gen.OnTranslate like `fmt.Errorf("$msg: %w", err)`.
+func (nci *nilCheckInsertion) wrappedErrorOf(trans *transPoint, err ast.Expr, pos token.Pos) ast.Expr {
+	if trans.wrapMsg == "" || err == nil {
+		return err
+	}
+	if nci.helpers {
+		msg := &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(trans.wrapMsg), ValuePos: pos}
+		return nci.runtimeCall(nci.runtimeFunc("Wrap", pos), []ast.Expr{err, msg}, pos)
+	}
+	return nci.errorfCall(strings.Replace(trans.wrapMsg, "%", "%%", -1)+": %w", []ast.Expr{err}, pos)
+}
+
+// fallbackBody returns the body of the check for tryOr() call. It assigns the fallback value to the
+// variable receiving the value of tryOr() like `x = $fallback`.
+func (nci *nilCheckInsertion) fallbackBody(trans *transPoint, pos token.Pos) []ast.Stmt {
+	var lhs ast.Expr
+	switch node := trans.node.(type) {
+	case *ast.ValueSpec:
+		lhs = node.Names[0]
+	case *ast.AssignStmt:
+		lhs = node.Lhs[0]
+	default:
+		panic("Unreachable: tryOr() is only available in value spec or assignment: " + reflect.TypeOf(node).String())
+	}
+	return []ast.Stmt{
+		&ast.AssignStmt{
+			Lhs:    []ast.Expr{copyExprAt(lhs, pos)},
+			Tok:    token.ASSIGN,
+			TokPos: pos,
+			Rhs:    []ast.Expr{copyExprAt(trans.fallback, pos)},
+		},
+	}
+}
+
+func (nci *nilCheckInsertion) insertIfNilChkStmtAfter(index int, errIdent *ast.Ident, init ast.Stmt, trans *transPoint) {
+	// Nodes in the `if` statement are put after the translated statement or the init statement so that
+	// their positions are consistent with the order in source
+	ifPos := errIdent.NamePos
+	var pos token.Pos
+	switch {
+	case init != nil:
+		pos = init.End()
+	case trans.kind == transKindThrow:
+		// throw() statement was removed and the `if` statement is put at the place
+		ifPos = trans.pos
+		pos = ifPos
+	default:
+		ifPos = nci.posAfter(nci.stmts.at(index + nci.offset))
+		pos = ifPos
+	}
+	errIdent = newIdent(errIdent.Name, pos)
+
+	var body []ast.Stmt
+	var cond ast.Expr = &ast.BinaryExpr{
+		X:     errIdent,
+		Y:     newIdent("nil", pos),
+		Op:    token.NEQ,
+		OpPos: pos,
+	}
+	if trans.commaOk() {
+		cond = &ast.UnaryExpr{
+			OpPos: pos,
+			Op:    token.NOT,
+			X:     errIdent,
+		}
+	}
+	if trans.expect {
+		body = nci.expectBody(trans, newIdent(errIdent.Name, pos), pos)
+	} else if trans.fallback != nil {
+		body = nci.fallbackBody(trans, pos)
+	} else if trans.commaOk() {
+		var err ast.Expr
+		if trans.replaced != nil {
+			err = nci.replacedErrorOf(trans, nil, pos)
+		} else if !trans.ok {
+			err = nci.commaOkErrorOf(trans.call, pos)
+		} else if nci.okError != nil {
+			err = copyExprAt(nci.okError, pos)
+		}
+		body = nci.commaOkBody(trans, nci.wrappedErrorOf(trans, err, pos), pos)
+	} else if trans.errResult != nil {
+		var err ast.Expr = newIdent(errIdent.Name, pos)
+		if trans.replaced != nil {
+			err = nci.replacedErrorOf(trans, err, pos)
+		}
+		body = nci.errResultBody(trans.errResult, nci.wrappedErrorOf(trans, err, pos), pos)
+	} else {
+		var err ast.Expr = errIdent
+		if trans.replaced != nil {
+			err = nci.replacedErrorOf(trans, err, pos)
+		}
+		n, _ := nci.funcTypeOf(trans.fun)
+		retVals := nci.zeroValuesOf(trans.fun, n.Results().Len()-1, pos) // -1 since last type is 'error'
+		retVals = append(retVals, nci.wrappedErrorOf(trans, err, pos))
+		body = []ast.Stmt{
+			&ast.ReturnStmt{
+				Results: retVals,
+				Return:  pos,
+			},
+		}
 	}
-	retVals = append(retVals, errIdent)
 
 	stmt := &ast.IfStmt{
-		If:   pos,
+		If:   ifPos,
 		Init: init,
-		Cond: &ast.BinaryExpr{
-			X:     errIdent,
-			Y:     newIdent("nil", pos),
-			Op:    token.NEQ,
-			OpPos: pos,
-		},
+		Cond: cond,
 		Body: &ast.BlockStmt{
 			Lbrace: pos,
-			List: []ast.Stmt{
-				&ast.ReturnStmt{
-					Results: retVals,
-					Return:  pos,
-				},
-			},
+			List:   body,
+			Rbrace: pos,
 		},
 	}
 
 	nci.insertStmtAt(index+1, stmt)
-	log("Inserted `if` statement for nil check at index", index+1, "of block at", nci.logPos(nci.blk.ast))
+	nci.lg.log("Inserted `if` statement for nil check at index", index+1, "of block at", nci.logPos(nci.blk.ast))
 }
 
 func (nci *nilCheckInsertion) transValueSpec(node *ast.ValueSpec, trans *transPoint) {
@@ -211,11 +1006,11 @@ func (nci *nilCheckInsertion) transValueSpec(node *ast.ValueSpec, trans *transPo
 	//   if err != nil {
 	//     return $zerovals, err
 	//   }
-	errIdent := nci.genErrIdent(node.Pos())
-	log(hi("Start value spec (var =)"), "translation", errIdent.Name)
+	errIdent := nci.genCheckedIdent(trans, node.Names[len(node.Names)-1].Pos())
+	nci.lg.log(nci.lg.hi("Start value spec (var =)"), "translation", errIdent.Name)
 	node.Names[len(node.Names)-1] = errIdent
-	nci.insertIfNilChkStmtAfter(trans.blockIndex, errIdent, nil, trans.fun)
-	log(hi("End value spec (var =)"), "translation", errIdent.Name)
+	nci.insertIfNilChkStmtAfter(trans.blockIndex, errIdent, nil, trans)
+	nci.lg.log(nci.lg.hi("End value spec (var =)"), "translation", errIdent.Name)
 	return
 }
 
@@ -228,11 +1023,11 @@ func (nci *nilCheckInsertion) transAssign(node *ast.AssignStmt, trans *transPoin
 	//     return $zerovals, err
 	//   }
 	if node.Tok == token.DEFINE {
-		errIdent := nci.genErrIdent(node.Pos())
-		log(hi("Start define statement(:=)"), "translation", errIdent.Name)
+		errIdent := nci.genCheckedIdent(trans, node.Lhs[len(node.Lhs)-1].Pos())
+		nci.lg.log(nci.lg.hi("Start define statement(:=)"), "translation", errIdent.Name)
 		node.Lhs[len(node.Lhs)-1] = errIdent
-		nci.insertIfNilChkStmtAfter(trans.blockIndex, errIdent, nil, trans.fun)
-		log(hi("End define statement(:=)"), "translation", errIdent.Name)
+		nci.insertIfNilChkStmtAfter(trans.blockIndex, errIdent, nil, trans)
+		nci.lg.log(nci.lg.hi("End define statement(:=)"), "translation", errIdent.Name)
 		return
 	}
 
@@ -246,17 +1041,29 @@ func (nci *nilCheckInsertion) transAssign(node *ast.AssignStmt, trans *transPoin
 	//   }
 	// Tok is token.EQ
 	pos := node.Pos()
-	errIdent := nci.genErrIdent(pos)
-	log(hi("Start assign statement(=)"), "translation", errIdent.Name)
+	ty := checkedTypeOf(trans, nci.typeInfo)
+	if ty == nil {
+		ty = errorType
+		if trans.commaOk() {
+			ty = types.Typ[types.Bool]
+		}
+	}
+	tyExpr := nci.typeExprOf(ty, pos)
+	if tyExpr == nil {
+		nci.errfAt(trans.pos, "Type %q returned from the function called in try() cannot be referred since its package is not imported in the file", ty)
+		return
+	}
+	errIdent := nci.genCheckedIdent(trans, node.Lhs[len(node.Lhs)-1].Pos())
+	nci.lg.log(nci.lg.hi("Start assign statement(=)"), "translation", errIdent.Name)
 	decl := &ast.DeclStmt{
 		Decl: &ast.GenDecl{
 			Tok: token.VAR,
 			Specs: []ast.Spec{
 				&ast.ValueSpec{
 					Names: []*ast.Ident{
-						errIdent,
+						newIdent(errIdent.Name, pos),
 					},
-					Type: newIdent("error", pos),
+					Type: tyExpr,
 				},
 			},
 			TokPos: pos,
@@ -266,8 +1073,8 @@ func (nci *nilCheckInsertion) transAssign(node *ast.AssignStmt, trans *transPoin
 	nci.insertStmtAt(trans.blockIndex, decl)
 
 	node.Lhs[len(node.Lhs)-1] = errIdent
-	nci.insertIfNilChkStmtAfter(trans.blockIndex, errIdent, nil, trans.fun)
-	log(hi("End assign statement(=)"), "translation", errIdent.Name)
+	nci.insertIfNilChkStmtAfter(trans.blockIndex, errIdent, nil, trans)
+	nci.lg.log(nci.lg.hi("End assign statement(=)"), "translation", errIdent.Name)
 }
 
 func (nci *nilCheckInsertion) transToplevelExpr(trans *transPoint) {
@@ -277,7 +1084,7 @@ func (nci *nilCheckInsertion) transToplevelExpr(trans *transPoint) {
 	//   if $ignores, err := f(...); err != nil {
 	//     return $zerovals, err
 	//   }
-	log(hi("Start toplevel try()"), "translation")
+	nci.lg.log(nci.lg.hi("Start toplevel try()"), "translation")
 
 	// Remove the *ast.ExprStmt at first
 	nci.removeStmtAt(trans.blockIndex)
@@ -289,9 +1096,13 @@ func (nci *nilCheckInsertion) transToplevelExpr(trans *transPoint) {
 	numIgnores := 0
 	if tpl, ok := ty.(*types.Tuple); ok {
 		numIgnores = tpl.Len() - 1 // - 1 means omitting last 'error' type
+	} else if isCgoCall(trans.call.(*ast.CallExpr)) { // Comma-ok expression is not available at toplevel
+		// Type of C function call is unknown with fake "C" package. C function call with error always
+		// returns a pair of its result and errno. Void function returns _Ctype_void as result.
+		numIgnores = 1
 	}
 
-	log("Insert `if $ignores, err := ...; err != nil` check for", trans.kind, "with", numIgnores, "'_' var at", nci.logPos(trans.call))
+	nci.lg.log("Insert `if $ignores, err := ...; err != nil` check for", trans.kind, "with", numIgnores, "'_' var at", nci.logPos(trans.call))
 
 	pos := trans.pos
 	lhs := make([]ast.Expr, 0, numIgnores+1) // + 1 means the last 'error' variable
@@ -299,6 +1110,13 @@ func (nci *nilCheckInsertion) transToplevelExpr(trans *transPoint) {
 		lhs = append(lhs, newIdent("_", pos))
 	}
 	errIdent := newIdent("err", pos)
+	if trans.ok {
+		errIdent = newIdent("ok", pos)
+	}
+	if trans.errResult != nil {
+		// Named result of enclosing function may be 'err'. Avoid shadowing it
+		errIdent = nci.genCheckedIdent(trans, pos)
+	}
 	lhs = append(lhs, errIdent)
 
 	// Create err := ...
@@ -310,13 +1128,82 @@ func (nci *nilCheckInsertion) transToplevelExpr(trans *transPoint) {
 	}
 
 	// Insert if err := ...; err != nil { ... }
-	nci.insertIfNilChkStmtAfter(trans.blockIndex, errIdent, assign, trans.fun)
+	nci.insertIfNilChkStmtAfter(trans.blockIndex, errIdent, assign, trans)
 
-	log(hi("End toplevel try()"), "translation")
+	nci.lg.log(nci.lg.hi("End toplevel try()"), "translation")
+}
+
+func (nci *nilCheckInsertion) transThrow(trans *transPoint) {
+	// From:
+	//   _ = err
+	// To:
+	//   if err != nil {
+	//     return $zerovals, err
+	//   }
+	// When the argument of throw() is not a variable:
+	//   if err := $arg; err != nil {
+	//     return $zerovals, err
+	//   }
+	nci.lg.log(nci.lg.hi("Start throw()"), "translation")
+
+	// Remove the `_ = err` statement replaced from throw() at first
+	nci.removeStmtAt(trans.blockIndex)
+
+	if ident, ok := trans.call.(*ast.Ident); ok {
+		nci.insertIfNilChkStmtAfter(trans.blockIndex, ident, nil, trans)
+		nci.lg.log(nci.lg.hi("End throw()"), "translation for variable", ident.Name)
+		return
+	}
+
+	pos := trans.pos
+	errIdent := newIdent("err", pos)
+	if trans.errResult != nil {
+		// Named result of enclosing function may be 'err'. Avoid shadowing it
+		errIdent = nci.genCheckedIdent(trans, pos)
+	}
+	assign := &ast.AssignStmt{
+		Lhs:    []ast.Expr{errIdent},
+		Tok:    token.DEFINE,
+		TokPos: pos,
+		Rhs:    []ast.Expr{trans.call},
+	}
+	nci.insertIfNilChkStmtAfter(trans.blockIndex, errIdent, assign, trans)
+
+	nci.lg.log(nci.lg.hi("End throw()"), "translation")
 }
 
 func (nci *nilCheckInsertion) insertNilCheck(trans *transPoint) {
-	log(hi("Insert if err != nil check for "+trans.kind.String()), "at", nci.logPos(trans.node))
+	nci.lg.log(nci.lg.hi("Insert if err != nil check for "+trans.kind.String()), "at", nci.logPos(trans.node))
+
+	if nci.untyped {
+		nci.lg.log("Skip checking types of", trans.funcName(), "since type check was skipped")
+	} else if msg := checkTransTypes(trans, nci.typeInfo, nci.okError != nil, nci.wrap); msg != "" {
+		nci.errAt(trans.pos, msg)
+		return
+	}
+
+	if nci.decide != nil {
+		d := nci.decide(trans.view(nci.fileset))
+		if d.Reject != "" {
+			nci.errfAt(trans.pos, "Translation of %s() call was rejected: %s", trans.funcName(), d.Reject)
+			return
+		}
+		trans.wrapMsg = d.Wrap
+	}
+
+	if trans.placeholder() != nil {
+		// Remove `_ = $expr` statement put before the translation point at phase-1
+		nci.removeStmtAt(trans.blockIndex - 1)
+	}
+
+	// Statements from the index to the index with adjusted offset after translation are generated
+	start := trans.blockIndex + nci.offset
+	defer func() {
+		if nci.err == nil {
+			stmts := nci.stmts.slice(start, trans.blockIndex+nci.offset+1)
+			trans.generated = append([]ast.Stmt{}, stmts...)
+		}
+	}()
 
 	switch trans.kind {
 	case transKindValueSpec:
@@ -325,6 +1212,8 @@ func (nci *nilCheckInsertion) insertNilCheck(trans *transPoint) {
 		nci.transAssign(trans.node.(*ast.AssignStmt), trans)
 	case transKindToplevelCall:
 		nci.transToplevelExpr(trans)
+	case transKindThrow:
+		nci.transThrow(trans)
 	case transKindExpr:
 		panic("TODO: Translate non-toplevel try() call expressions")
 	default:
@@ -334,24 +1223,37 @@ func (nci *nilCheckInsertion) insertNilCheck(trans *transPoint) {
 
 func (nci *nilCheckInsertion) block(b *blockTree) {
 	nci.blk = b
+	nci.stmts = newStmtEditor(b, nci.lg)
 	nci.offset = 0
 	nci.varID = 0
 
 	pos := nci.logPos(b.ast)
-	log("Start nil check insertion for block at", pos)
+	nci.lg.log("Start nil check insertion for block at", pos)
 	for _, trans := range b.transPoints {
 		nci.insertNilCheck(trans)
+		if nci.err != nil {
+			nci.stmts.flush()
+			return
+		}
 	}
-	log("End nil check insertion for block at", pos)
+	nci.stmts.flush()
+	nci.lg.log("End nil check insertion for block at", pos)
 
-	log("Recursively insert nil check to", hi(len(b.children)), "children in block at", pos)
+	nci.lg.log("Recursively insert nil check to", nci.lg.hi(len(b.children)), "children in block at", pos)
 	for _, child := range b.children {
 		nci.block(child)
+		if nci.err != nil {
+			return
+		}
 	}
 }
 
-func (nci *nilCheckInsertion) translate() {
+func (nci *nilCheckInsertion) translate() error {
 	for _, root := range nci.roots {
 		nci.block(root)
+		if nci.err != nil {
+			return nci.err
+		}
 	}
+	return nil
 }
@@ -12,11 +12,14 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
 // Package represents tranlated package. It contains tokens and AST of all Go files in the package
 type Package struct {
-	// Files is a token file set to get position information of nodes.
+	// Files is a token file set to get position information of nodes. It is not shared with packages in
+	// other directories.
 	Files *token.FileSet
 	// Node is an AST package node which was parsed from TryGo code. AST will be directly modified
 	// by translations.
@@ -30,12 +33,97 @@ type Package struct {
 	Types *types.Package
 	// Flag which is set to true when AST is modified
 	modified bool
+	// targets is a set of file names which should be written. When nil, all files are written.
+	targets map[string]struct{}
+	// transPoints is a list of translation points collected by phase-1
+	transPoints []*transPoint
+	// blockTrees is a list of block trees collected by phase-1. It is non-nil only while nil checks are
+	// not inserted yet.
+	blockTrees []*blockTree
+	// sources is a map from output file path to source file path. It is set after translation.
+	sources map[string]string
+	// untagged is a map from path of TryGo source which is not tagged with 'trygo' yet to its tagged
+	// content in dual-build layout. The sources are tagged after the package was written.
+	untagged map[string][]byte
+	// lg is a logger for the package. It is set by Gen.
+	lg logger
+	// okError is an expression of error returned on false ok(). It is set by Gen.
+	okError ast.Expr
+	// notFoundError is an expression of error returned when key is not found in map index in try(). It
+	// is set by Gen.
+	notFoundError ast.Expr
+	// closedError is an expression of error returned when channel is closed on receive in try(). It is
+	// set by Gen.
+	closedError ast.Expr
+	// expectHandler is an expression of function called with an error caught by expect(). It is set by
+	// Gen.
+	expectHandler ast.Expr
+	// wrapReplacedError is true when an error passed to try() as the second argument wraps the original
+	// error. It is set by Gen.
+	wrapReplacedError bool
+	// strict is true when try() call elimination reports all untranslatable pseudo-function calls. It is
+	// set by Gen.
+	strict bool
+	// warnings is a list of non-fatal problems found while translation.
+	warnings []*Warning
+	// timings is a list of elapsed times of phases of generating the package.
+	timings []Timing
+	// emitASTDir is a directory path to dump AST at each phase for debugging. It is set by Gen.
+	emitASTDir string
+	// dumpBlocksDir is a directory path to dump DOT graph of block trees for debugging. It is set by Gen.
+	dumpBlocksDir string
+	// emitPhase1Dir is a directory path to write source after phase-1 for debugging. It is set by Gen.
+	emitPhase1Dir string
+	// runtimeHelpers is true when generated code uses helpers in trygoruntime package. It is set by Gen.
+	runtimeHelpers bool
+	// noTypeCheck is true when nil checks are inserted without type check. It is set by Gen.
+	noTypeCheck bool
+	// standalone is true when the package is translated without resolving its imports. It is set by Gen.
+	standalone bool
+	// importer is an importer used for type check while translation. It is set by Gen or created on the
+	// first type check.
+	importer types.Importer
+	// typed is a package type-checked after phase-1. It is used for importing the package from other
+	// packages translated together.
+	typed *types.Package
+	// onTranslate is a hook to decide how each translation point is translated. It is set by Gen.
+	onTranslate func(TransPoint) Decision
+	// fixedImports is a list of positions of import specs fixed or rewritten after translation.
+	fixedImports []token.Pos
+}
+
+// sortedFilePaths returns paths of the files in sorted order. Files should be iterated in this order
+// instead of map order so that outputs, logs and errors are reproducible between runs.
+func sortedFilePaths(files map[string]*ast.File) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// fileNodes returns AST nodes of files in the package sorted by their paths.
+func (pkg *Package) fileNodes() []*ast.File {
+	files := make([]*ast.File, 0, len(pkg.Node.Files))
+	for _, path := range sortedFilePaths(pkg.Node.Files) {
+		files = append(files, pkg.Node.Files[path])
+	}
+	return files
+}
+
+// walkFiles walks ASTs of files in the package in sorted order. ast.Walk() is not available for
+// *ast.Package since it visits files in map order.
+func walkFiles(v ast.Visitor, pkg *ast.Package) {
+	for _, path := range sortedFilePaths(pkg.Files) {
+		ast.Walk(v, pkg.Files[path])
+	}
 }
 
 func (pkg *Package) writeGo(out io.Writer, file *ast.File) error {
 	w := bufio.NewWriter(out)
 	if err := format.Node(w, pkg.Files, file); err != nil {
-		if logEnabled {
+		if pkg.lg.enabled() {
 			ast.Fprint(os.Stderr, pkg.Files, file, nil)
 		}
 		panic(fmt.Sprintf("Internal error: Broken Go source: %s: %s", file.Name.Name+".go", err))
@@ -44,7 +132,7 @@ func (pkg *Package) writeGo(out io.Writer, file *ast.File) error {
 }
 
 func (pkg *Package) writeGoFile(fpath string, file *ast.File) error {
-	log("Write translated Go file to", hi(relpath(fpath)))
+	pkg.lg.log("Write translated Go file to", pkg.lg.hi(relpath(fpath)))
 
 	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
 		return err
@@ -56,17 +144,60 @@ func (pkg *Package) writeGoFile(fpath string, file *ast.File) error {
 	}
 	defer f.Close()
 
+	if _, err := io.WriteString(f, generatedHeader); err != nil {
+		return errors.Wrap(err, "Cannot write file")
+	}
 	return pkg.writeGo(f, file)
 }
 
+// sourceOf returns a source file path of the given output file path. When the path is not an output
+// file path, it returns the path as-is.
+func (pkg *Package) sourceOf(path string) string {
+	if src, ok := pkg.sources[path]; ok {
+		return src
+	}
+	return path
+}
+
+// renameFile changes output file path of translated file.
+func (pkg *Package) renameFile(from, to string) {
+	if from == to {
+		return
+	}
+	pkg.lg.log("Rename output file", pkg.lg.hi(relpath(from)), "->", pkg.lg.hi(relpath(to)))
+	pkg.Node.Files[to] = pkg.Node.Files[from]
+	delete(pkg.Node.Files, from)
+	if pkg.sources != nil {
+		pkg.sources[to] = pkg.sourceOf(from)
+		delete(pkg.sources, from)
+	}
+}
+
+func (pkg *Package) isTarget(path string) bool {
+	if pkg.targets == nil {
+		return true
+	}
+	_, ok := pkg.targets[filepath.Base(pkg.sourceOf(path))]
+	return ok
+}
+
+// Write writes all translated Go files in the package to their output paths. When the package was
+// parsed with file paths, only the files are written.
 func (pkg *Package) Write() error {
-	log("Write translated package:", hi(pkg.Birth), "->", hi(pkg.Path))
-	for path, node := range pkg.Node.Files {
+	pkg.lg.log("Write translated package:", pkg.lg.hi(pkg.Birth), "->", pkg.lg.hi(pkg.Path))
+	start := time.Now()
+	for _, path := range sortedFilePaths(pkg.Node.Files) {
+		node := pkg.Node.Files[path]
+		if !pkg.isTarget(path) {
+			pkg.lg.log("Skip writing file not given as target:", relpath(path))
+			continue
+		}
 		// Separate function to writeGoFile() to avoid `defer f.Close()` in loop
 		if err := pkg.writeGoFile(path, node); err != nil {
 			return err
 		}
 	}
+	pkg.addTiming(PhaseWrite, time.Since(start))
 	return nil
 }
 
@@ -80,28 +211,38 @@ func (pkg *Package) WriteFileTo(out io.Writer, fpath string) error {
 	return pkg.writeGo(out, f)
 }
 
+// typesImporter returns an importer used for type check while translation. Unless an importer is set by
+// Gen, packages are imported from export data compiled by the go tool except for standalone mode. The
+// importer is created once per package.
+func (pkg *Package) typesImporter() types.Importer {
+	if pkg.importer == nil {
+		if pkg.standalone {
+			// Package directory is not related to the source in standalone mode. Nothing is compiled there
+			pkg.importer = importer.For("source", nil)
+		} else {
+			pkg.importer = newExportDataImporter(pkg.Birth, pkg.importPaths(), pkg.lg)
+		}
+	}
+	return pkg.importer
+}
+
 // Verify verifies the package is valid by type check. When there are some errors, it returns an error
 // created by unifying all errors into one error.
 func (pkg *Package) Verify() error {
-	log("Verify translated package ", hi(pkg.Node.Name), "at", hi(relpath(pkg.Path)))
+	pkg.lg.log("Verify translated package ", pkg.lg.hi(pkg.Node.Name), "at", pkg.lg.hi(relpath(pkg.Path)))
 	// Verify translated package by type check
 	errs := []error{}
 
 	cfg := &types.Config{
-		Importer:    importer.For("source", nil),
+		Importer:    newExportDataImporter(pkg.Path, pkg.importPaths(), pkg.lg),
 		FakeImportC: true,
 		Error: func(err error) {
-			log(ftl(err))
+			pkg.lg.log(pkg.lg.ftl(err))
 			errs = append(errs, err)
 		},
 	}
 
-	files := make([]*ast.File, 0, len(pkg.Node.Files))
-	for _, f := range pkg.Node.Files {
-		files = append(files, f)
-	}
-
-	typeInfo, _ := cfg.Check(pkg.Path, pkg.Files, files, &types.Info{})
+	typeInfo, _ := cfg.Check(pkg.Path, pkg.Files, pkg.fileNodes(), &types.Info{})
 	if len(errs) > 0 {
 		return unifyTypeErrors("verification after translation", errs)
 	}
@@ -109,7 +250,7 @@ func (pkg *Package) Verify() error {
 
 	// TODO: Add more verification for translation
 
-	log("Package verification OK:", hi(pkg.Node.Name))
+	pkg.lg.log("Package verification OK:", pkg.lg.hi(pkg.Node.Name))
 	return nil
 }
 
@@ -118,6 +259,35 @@ func (pkg *Package) Modified() bool {
 	return pkg.modified
 }
 
+// Warnings returns non-fatal problems found while translating the package. It returns nil when the
+// package was not translated or no problem was found.
+func (pkg *Package) Warnings() []*Warning {
+	if len(pkg.warnings) == 0 {
+		return nil
+	}
+	return pkg.warnings
+}
+
+// TransPoints returns translation points of try() calls in the package in order of their positions.
+// It returns nil when the package was not translated or no try() call was translated.
+func (pkg *Package) TransPoints() []TransPoint {
+	if len(pkg.transPoints) == 0 {
+		return nil
+	}
+	pts := make([]TransPoint, 0, len(pkg.transPoints))
+	for _, p := range pkg.transPoints {
+		pts = append(pts, p.view(pkg.Files))
+	}
+	sort.SliceStable(pts, func(i, j int) bool {
+		l, r := pts[i].Pos, pts[j].Pos
+		if l.Filename != r.Filename {
+			return l.Filename < r.Filename
+		}
+		return l.Offset < r.Offset
+	})
+	return pts
+}
+
 // Should add ParsePackage(pkgDir string, fs *token.FileSet) (*Package, error)?
 
 // NewPackage creates a new Package instance containing additional information to AST node
@@ -14,7 +14,7 @@ import (
 
 func testPackageParseDir(t *testing.T, dir string) (*token.FileSet, *ast.Package) {
 	fs := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fs, dir, nil, 0)
+	pkgs, err := parser.ParseDir(fs, dir, nil, parser.ParseComments)
 	if err != nil {
 		t.Fatalf("Parse error at %q: %s", dir, err)
 	}
@@ -73,3 +73,98 @@ func TestPackageVerifyFailure(t *testing.T) {
 		t.Fatal("Error unexpected:", err)
 	}
 }
+
+func TestPackageTransPoints(t *testing.T) {
+	dir := filepath.Join(cwd, "testdata", "package", "transpoints")
+	fs, pkg := testPackageParseDir(t, dir)
+	dest := filepath.Join(dir, "dest")
+	p := trygo.NewPackage(pkg, dir, dest, fs)
+	if pts := p.TransPoints(); pts != nil {
+		t.Fatal("Translation points before translation:", pts)
+	}
+	if err := trygo.Translate([]*trygo.Package{p}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		kind trygo.TransKind
+		line int
+		fun  string
+		call string
+	}{
+		{trygo.TransToplevelCall, 9, "", "Chdir"},
+		{trygo.TransValueSpec, 14, "f", "Atoi"},
+		{trygo.TransAssign, 15, "f", "Atoi"},
+		{trygo.TransAssign, 16, "f", "Atoi"},
+		{trygo.TransToplevelCall, 18, "f", "Chdir"},
+	}
+
+	pts := p.TransPoints()
+	if len(pts) != len(want) {
+		t.Fatalf("Wanted %d translation points but got %d: %v", len(want), len(pts), pts)
+	}
+	for i, w := range want {
+		pt := pts[i]
+		if pt.Kind != w.kind {
+			t.Errorf("Kind of point #%d: want %s but have %s", i, w.kind, pt.Kind)
+		}
+		if pt.Pos.Filename != filepath.Join(dir, "foo.go") || pt.Pos.Line != w.line {
+			t.Errorf("Position of point #%d: want line %d but have %s", i, w.line, pt.Pos)
+		}
+		switch fun := pt.Func.(type) {
+		case *ast.FuncDecl:
+			if fun.Name.Name != w.fun {
+				t.Errorf("Function of point #%d: want %q but have %q", i, w.fun, fun.Name.Name)
+			}
+		case *ast.FuncLit:
+			if w.fun != "" {
+				t.Errorf("Function of point #%d: want %q but have function literal", i, w.fun)
+			}
+		default:
+			t.Errorf("Unexpected function node of point #%d: %T", i, fun)
+		}
+		if sel, ok := pt.Call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != w.call {
+			t.Errorf("Call of point #%d: want %q but have %#v", i, w.call, pt.Call.Fun)
+		}
+	}
+}
+
+func TestPackageEdits(t *testing.T) {
+	dir := filepath.Join(cwd, "testdata", "package", "transpoints")
+	fs, pkg := testPackageParseDir(t, dir)
+	dest := filepath.Join(dir, "dest")
+	p := trygo.NewPackage(pkg, dir, dest, fs)
+	if err := trygo.Translate([]*trygo.Package{p}); err != nil {
+		t.Fatal(err)
+	}
+
+	edits, err := p.Edits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) == 0 {
+		t.Fatal("No edit was calculated")
+	}
+
+	src := filepath.Join(dir, "foo.go")
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := string(b)
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		if e.File != src {
+			t.Fatalf("Edit for unexpected file: %+v", e)
+		}
+		have = have[:e.Offset] + e.Replacement + have[e.Offset+e.Length:]
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteFileTo(&buf, filepath.Join(dest, "foo.go")); err != nil {
+		t.Fatal(err)
+	}
+	if want := buf.String(); have != want {
+		t.Fatalf("Applying edits did not result in translated source:\nWant:\n%s\n\nHave:\n%s", want, have)
+	}
+}
@@ -0,0 +1,249 @@
+package trygo
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"go/types"
+	"time"
+)
+
+// Pass is a stage of translation pipeline. Passes run in order against each package and modify its AST
+// directly. Built-in passes are TryCallElimination and NilCheckInsertion. Custom passes can be inserted
+// to the pipeline with Gen.Passes.
+// A pass running between TryCallElimination and NilCheckInsertion must not add, remove or reorder
+// statements in blocks containing translated try() calls since nil checks are inserted at positions of
+// the statements. Such change is reported as an error.
+type Pass interface {
+	// Run runs the pass against the package. When it returns an error, translation stops.
+	Run(pkg *Package) error
+}
+
+type tryCallEliminationPass struct{}
+
+func (p tryCallEliminationPass) String() string {
+	return "try() call elimination"
+}
+
+// Run eliminates try() calls in the package (phase-1). Statements containing try() calls are recorded
+// as translation points for NilCheckInsertion.
+func (p tryCallEliminationPass) Run(pkg *Package) error {
+	lg := pkg.lg
+	pkgName := pkg.Node.Name
+	tce := &tryCallElimination{
+		pkg:     pkg.Node,
+		fileset: pkg.Files,
+		lg:      lg,
+		strict:  pkg.strict,
+	}
+
+	lg.log(lg.hi("Phase-1"), "try() call elimination", lg.hi("start: "+pkgName))
+	// Traverse AST for phase-1
+	start := time.Now()
+	walkFiles(tce, pkg.Node)
+	tce.finish()
+	pkg.addTiming(PhaseElimination, time.Since(start))
+	if tce.err != nil {
+		return tce.err
+	}
+	tce.assertPostCondition()
+	lg.log(lg.hi("Phase-1"), "try() call elimination", lg.hi("end: "+pkgName))
+
+	lg.log("Number of translations:", lg.hi(tce.numTrans))
+	if tce.numTrans == 0 {
+		// Nothing was translated. Later nil check insertion can be skipped
+		return nil
+	}
+
+	transPoints := []*transPoint{}
+	for _, root := range tce.roots {
+		transPoints = append(transPoints, root.collectTransPoints()...)
+	}
+	pkg.transPoints = transPoints
+	pkg.blockTrees = tce.roots
+	return nil
+}
+
+type nilCheckInsertionPass struct{}
+
+func (p nilCheckInsertionPass) String() string {
+	return "if err != nil check insertion"
+}
+
+// Run type-checks the package and inserts `if err != nil` checks at translation points recorded by
+// TryCallElimination (phase-2). Imports which became unused are removed.
+func (p nilCheckInsertionPass) Run(pkg *Package) error {
+	lg := pkg.lg
+	if pkg.blockTrees == nil {
+		lg.log("Skip nil check insertion since nothing was translated in", lg.hi(pkg.Node.Name))
+		return nil
+	}
+
+	pkgName := pkg.Node.Name
+	files := pkg.fileNodes()
+
+	var tyInfo *types.Info
+	var tyPkg *types.Package
+	if pkg.noTypeCheck {
+		lg.log(lg.hi("Skip type check"), "after phase-1 and build type information from AST:", pkgName)
+		tyInfo = untypedInfo(pkg)
+	} else {
+		lg.log(lg.hi("Type check"), "after phase-1", lg.hi("start: "+pkgName))
+		start := time.Now()
+		info, ty, err := typeCheck(pkg.transPoints, pkg.Birth, pkg.Files, files, pkg.typesImporter(), pkg.standalone, lg)
+		pkg.addTiming(PhaseTypeCheck, time.Since(start))
+		if err != nil {
+			lg.log(lg.ftl(err))
+			return err
+		}
+		lg.log(lg.hi("Type check"), "after phase-1", lg.hi("end: "+pkgName))
+		tyInfo, tyPkg = info, ty
+		pkg.typed = ty
+		pkg.warnings = append(pkg.warnings, transWarnings(pkg, tyInfo, tyPkg)...)
+	}
+
+	if pkg.strict && !pkg.noTypeCheck {
+		// Report all translation points which cannot be translated before inserting nil checks
+		if diags := transTypeDiagnostics(pkg, pkg.transPoints, tyInfo, pkg.okError != nil, pkg.wrapReplacedError); len(diags) > 0 {
+			return unifyUntranslatable(diags)
+		}
+	}
+
+	nci := &nilCheckInsertion{
+		pkg:      pkg.Node,
+		fileset:  pkg.Files,
+		roots:    pkg.blockTrees,
+		typeInfo: tyInfo,
+		pkgTypes: tyPkg,
+		okError:  pkg.okError,
+		notFound: pkg.notFoundError,
+		closed:   pkg.closedError,
+		expect:   pkg.expectHandler,
+		wrap:     pkg.wrapReplacedError,
+		decide:   pkg.onTranslate,
+		untyped:  pkg.noTypeCheck,
+		helpers:  pkg.runtimeHelpers,
+		lg:       lg,
+	}
+
+	// Traverse blocks for phase-2
+	lg.log(lg.hi("Phase-2"), "if err != nil check insertion", lg.hi("start: "+pkgName))
+	start := time.Now()
+	defer func() { pkg.addTiming(PhaseInsertion, time.Since(start)) }()
+	if err := nci.translate(); err != nil {
+		return err
+	}
+	lg.log(lg.hi("Phase-2"), "if err != nil check insertion", lg.hi("end: "+pkgName))
+	pkg.blockTrees = nil
+
+	if pkg.noTypeCheck {
+		// Names of imports are unknown without type check. Translation itself never makes imports unused
+		pkg.modified = true
+		return nil
+	}
+	for _, f := range files {
+		if n := removeUnusedImports(f, tyInfo, lg); n > 0 {
+			lg.log(lg.hi(n), "unused import(s) were removed")
+		}
+	}
+
+	pkg.modified = true
+	return nil
+}
+
+var (
+	// TryCallElimination is a built-in pass to eliminate try() calls (phase-1).
+	TryCallElimination Pass = tryCallEliminationPass{}
+	// NilCheckInsertion is a built-in pass to insert `if err != nil` checks for try() calls eliminated
+	// by TryCallElimination (phase-2). It must run after TryCallElimination.
+	NilCheckInsertion Pass = nilCheckInsertionPass{}
+)
+
+// DefaultPasses returns a pipeline of translation used by default.
+func DefaultPasses() []Pass {
+	return []Pass{TryCallElimination, NilCheckInsertion}
+}
+
+// passes returns the pipeline of translation with passes loaded from plugins.
+func (gen *Gen) passes() ([]Pass, error) {
+	passes := gen.Passes
+	if passes == nil {
+		passes = DefaultPasses()
+	}
+	if len(gen.Plugins) == 0 {
+		return passes, nil
+	}
+
+	plugins := make([]Pass, 0, len(gen.Plugins))
+	for _, path := range gen.Plugins {
+		r, err := loadPlugin(path, gen.lg())
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, r)
+	}
+
+	idx := 0
+	for i, p := range passes {
+		if p == TryCallElimination {
+			idx = i + 1
+			break
+		}
+	}
+	ret := make([]Pass, 0, len(passes)+len(plugins))
+	ret = append(ret, passes[:idx]...)
+	ret = append(ret, plugins...)
+	ret = append(ret, passes[idx:]...)
+	return ret, nil
+}
+
+// passName returns the name of the pass for messages.
+func passName(pass Pass) string {
+	if s, ok := pass.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("Pass %T", pass)
+}
+
+func isBuiltinPass(pass Pass) bool {
+	return pass == TryCallElimination || pass == NilCheckInsertion
+}
+
+// runPass runs the pass against the package. A custom pass running while translation points are pending
+// is checked not to change statements in blocks containing the translation points.
+func runPass(pass Pass, pkg *Package) error {
+	var snap blockSnapshot
+	if pkg.blockTrees != nil && !isBuiltinPass(pass) {
+		snap = blockSnapshot{}
+		for _, root := range pkg.blockTrees {
+			snap.take(root)
+		}
+	}
+
+	lg := pkg.lg
+	lg.log("Run pass", lg.hi(passName(pass)), "for package", lg.hi(pkg.Node.Name))
+	if err := pass.Run(pkg); err != nil {
+		return err
+	}
+
+	switch pass {
+	case TryCallElimination:
+		if err := pkg.dumpAST(astStagePhase1); err != nil {
+			return err
+		}
+		if err := pkg.dumpBlocks(); err != nil {
+			return err
+		}
+		if err := pkg.dumpPhase1Source(); err != nil {
+			return err
+		}
+	case NilCheckInsertion:
+		if err := pkg.dumpAST(astStagePhase2); err != nil {
+			return err
+		}
+	}
+
+	if tree, ok := snap.changed(); ok {
+		return errors.Errorf("%s changed statements in block at %s which contains translated try() calls", passName(pass), pkg.Files.Position(tree.ast.Pos()))
+	}
+	return nil
+}
@@ -0,0 +1,1138 @@
+package trygo
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type passFunc func(pkg *Package) error
+
+func (f passFunc) Run(pkg *Package) error {
+	return f(pkg)
+}
+
+func TestCustomPass(t *testing.T) {
+	pkg := parsePackageForTest(t, pluginTestSrc)
+
+	ran := []string{}
+	before := passFunc(func(pkg *Package) error {
+		ran = append(ran, "before")
+		return nil
+	})
+	after := passFunc(func(pkg *Package) error {
+		ran = append(ran, "after")
+		// Nil checks were already inserted. Statements can be freely modified
+		for _, f := range pkg.Node.Files {
+			for _, d := range f.Decls {
+				if fun, ok := d.(*ast.FuncDecl); ok {
+					fun.Name.Name = "g"
+					fun.Body.List = append([]ast.Stmt{&ast.EmptyStmt{}}, fun.Body.List...)
+				}
+			}
+		}
+		return nil
+	})
+
+	gen := &Gen{Passes: []Pass{before, TryCallElimination, NilCheckInsertion, after}}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(ran, ",") != "before,after" {
+		t.Fatal("Custom passes did not run in order:", ran)
+	}
+
+	var buf bytes.Buffer
+	for _, f := range pkg.Node.Files {
+		if err := pkg.writeGo(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := buf.String()
+	for _, want := range []string{"func g() error {", `if _, err := fmt.Println("hello"); err != nil {`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is not included in output: %s", want, out)
+		}
+	}
+}
+
+func TestCustomPassError(t *testing.T) {
+	pkg := parsePackageForTest(t, pluginTestSrc)
+
+	fail := passFunc(func(pkg *Package) error {
+		return errors.New("oops")
+	})
+	gen := &Gen{Passes: []Pass{TryCallElimination, fail, NilCheckInsertion}}
+	err := gen.translate([]*Package{pkg})
+	if err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestCustomPassChangingBlock(t *testing.T) {
+	pkg := parsePackageForTest(t, pluginTestSrc)
+
+	insert := passFunc(func(pkg *Package) error {
+		for _, f := range pkg.Node.Files {
+			for _, d := range f.Decls {
+				if fun, ok := d.(*ast.FuncDecl); ok {
+					fun.Body.List = fun.Body.List[1:]
+				}
+			}
+		}
+		return nil
+	})
+	err := translatePackage(pkg, []Pass{TryCallElimination, insert, NilCheckInsertion})
+	if err == nil || !strings.Contains(err.Error(), "Pass trygo.passFunc changed statements in block") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+const okTestSrc = `package foo
+
+import "errors"
+
+var errNotFound = errors.New("not found")
+
+func lookup(m map[string]int, k string) (int, bool) {
+	v, ok := m[k]
+	return v, ok
+}
+
+func f(m map[string]int) (int, error) {
+	n := ok(lookup(m, "foo"))
+	return n, nil
+}
+`
+
+func TestOkError(t *testing.T) {
+	pkg := parsePackageForTest(t, okTestSrc)
+
+	gen := &Gen{OkError: "errNotFound"}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	for _, f := range pkg.Node.Files {
+		if err := pkg.writeGo(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := buf.String()
+	for _, want := range []string{`n, _ok0 := lookup(m, "foo")`, "if !_ok0 {", "return 0, errNotFound"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is not included in output: %s", want, out)
+		}
+	}
+}
+
+func TestOkErrorError(t *testing.T) {
+	for _, tc := range []struct {
+		what string
+		src  string
+		expr string
+		want string
+	}{
+		{
+			what: "invalid expression",
+			src:  okTestSrc,
+			expr: "errors.New(",
+			want: "Invalid expression for error of ok()",
+		},
+		{
+			what: "function does not return error",
+			src:  strings.NewReplacer("(int, error)", "int", "return n, nil", "return n").Replace(okTestSrc),
+			expr: "errNotFound",
+			want: "The function does not return error as last return value. Error for ok() cannot be returned",
+		},
+		{
+			what: "call does not return bool",
+			src:  strings.NewReplacer("(int, bool)", "(int, int)", "v, ok := m[k]\n\treturn v, ok", "return m[k], len(m)").Replace(okTestSrc),
+			want: "The function called in ok() does not return bool as last return value",
+		},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			pkg := parsePackageForTest(t, tc.src)
+			err := (&Gen{OkError: tc.expr}).translate([]*Package{pkg})
+			if err == nil {
+				t.Fatal("Error did not occur")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Wanted %q to be included in error %q", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestCommaOkErrorConfig(t *testing.T) {
+	for _, tc := range []struct {
+		what string
+		gen  *Gen
+		expr string
+		want string
+	}{
+		{
+			what: "key not found",
+			gen:  &Gen{NotFoundError: "errFailed"},
+			expr: `m["foo"]`,
+			want: `n, _ok0 := m["foo"]`,
+		},
+		{
+			what: "closed channel",
+			gen:  &Gen{ClosedError: "errFailed"},
+			expr: "<-ch",
+			want: "n, _ok0 := <-ch",
+		},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			pkg := parsePackageForTest(t, `package foo
+
+import "errors"
+
+var errFailed = errors.New("failed")
+
+func f(m map[string]int, ch chan int) (int, error) {
+	n := try(`+tc.expr+`)
+	return n, nil
+}
+`)
+			if err := tc.gen.translate([]*Package{pkg}); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			for _, f := range pkg.Node.Files {
+				if err := pkg.writeGo(&buf, f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			out := buf.String()
+			for _, want := range []string{tc.want, "if !_ok0 {", "return 0, errFailed"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("%q is not included in output: %s", want, out)
+				}
+			}
+			if strings.Contains(out, `"fmt"`) {
+				t.Errorf("fmt should not be imported: %s", out)
+			}
+		})
+	}
+}
+
+func TestExpectHandler(t *testing.T) {
+	pkg := parsePackageForTest(t, `package foo
+
+import "fmt"
+
+func report(err error) {}
+
+func f() {
+	expect(fmt.Println("hello"))
+}
+`)
+
+	gen := &Gen{ExpectHandler: "report"}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	for _, f := range pkg.Node.Files {
+		if err := pkg.writeGo(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := buf.String()
+	want := "if _, err := fmt.Println(\"hello\"); err != nil {\n\t\treport(err)\n\t}"
+	if !strings.Contains(out, want) {
+		t.Errorf("%q is not included in output: %s", want, out)
+	}
+	if strings.Contains(out, `"log"`) {
+		t.Errorf("log should not be imported: %s", out)
+	}
+}
+
+func TestWrapReplacedError(t *testing.T) {
+	pkg := parsePackageForTest(t, `package foo
+
+import (
+	"errors"
+	"os"
+)
+
+var ErrBroken = errors.New("broken")
+
+func f() error {
+	try(os.Chdir("foo"), ErrBroken)
+	return nil
+}
+`)
+
+	gen := &Gen{WrapReplacedError: true}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	for _, f := range pkg.Node.Files {
+		if err := pkg.writeGo(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := buf.String()
+	want := "if err := os.Chdir(\"foo\"); err != nil {\n\t\treturn fmt.Errorf(\"%w: %v\", ErrBroken, err)\n\t}"
+	if !strings.Contains(out, want) {
+		t.Errorf("%q is not included in output: %s", want, out)
+	}
+	if !strings.Contains(out, `"fmt"`) {
+		t.Errorf("fmt should be imported: %s", out)
+	}
+}
+
+func TestPreflightTypeCheck(t *testing.T) {
+	for _, tc := range []struct {
+		what string
+		src  string
+		want string
+	}{
+		{
+			what: "ok",
+			src: `package foo
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+func f(m map[string]int, i interface{}) (int, error) {
+	try(fmt.Println("hello"))
+	n := try(strconv.Atoi("42"))
+	v := try(m["foo"])
+	s := try(i.(string))
+	x := tryOr(strconv.Atoi(s), 0)
+	expect(os.Chdir("foo"))
+	err := os.Chdir("bar")
+	throw(err)
+	return n + v + x, nil
+}
+`,
+		},
+		{
+			what: "type error",
+			src: `package foo
+
+import "strconv"
+
+func f() (int, error) {
+	n := try(strconv.Atoi(42))
+	return n, nil
+}
+`,
+			want: "pre-flight type check of TryGo source",
+		},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			pkg := parsePackageForTest(t, tc.src)
+			gen := &Gen{PreflightTypeCheck: true}
+			err := gen.translate([]*Package{pkg})
+			if tc.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Error did not occur")
+			}
+			if msg := err.Error(); !strings.Contains(msg, tc.want) || !strings.Contains(msg, "foo.go:6:24") {
+				t.Fatal("Unexpected error:", msg)
+			}
+		})
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	for _, tc := range []struct {
+		what string
+		src  string
+		want []string
+	}{
+		{
+			what: "phase-1",
+			src: `package foo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func f() {
+	try(fmt.Println("a"))
+}
+
+func g() error {
+	if try(strconv.Atoi("1")) > 0 {}
+	try(1 + 2)
+	return nil
+}
+`,
+			want: []string{
+				"3 untranslatable pseudo-function call(s)",
+				"foo.go:9:2: foo: Error: The function returns nothing",
+				"foo.go:13:5: foo: Error: try() call was not translated",
+				"foo.go:14:2: foo: Error: try() call's argument must be function call",
+			},
+		},
+		{
+			what: "phase-2",
+			src: `package foo
+
+import "fmt"
+
+func f() int {
+	try(fmt.Println("a"))
+	return 0
+}
+
+func g() (int, string) {
+	n := try(fmt.Println("b"))
+	return n, ""
+}
+`,
+			want: []string{
+				"2 untranslatable pseudo-function call(s)",
+				"foo.go:6:2: foo: Error: The function does not return error",
+				"foo.go:11:7: foo: Error: The function does not return error",
+			},
+		},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			pkg := parsePackageForTest(t, tc.src)
+			gen := &Gen{Strict: true}
+			err := gen.translate([]*Package{pkg})
+			if err == nil {
+				t.Fatal("Error did not occur")
+			}
+			msg := err.Error()
+			for _, want := range tc.want {
+				if !strings.Contains(msg, want) {
+					t.Errorf("%q is not included in error: %s", want, msg)
+				}
+			}
+		})
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	for _, tc := range []struct {
+		what string
+		src  string
+		want string
+	}{
+		{
+			what: "always nil error",
+			src: `package foo
+
+func g() (int, error) {
+	return 42, nil
+}
+
+func f() error {
+	n := try(g())
+	println(n)
+	return nil
+}
+`,
+			want: "foo.go:8:7: foo: Function g() called in try() always returns nil error",
+		},
+		{
+			what: "shadowed error",
+			src: `package foo
+
+import "os"
+
+type error interface {
+	Error() string
+}
+
+func f() error {
+	try(os.Chdir("foo"))
+	return nil
+}
+`,
+			want: "foo.go:10:2: foo: Name 'error' is shadowed by the declaration at foo.go:5:6",
+		},
+		{
+			what: "discarded tryOr",
+			src: `package foo
+
+import "strconv"
+
+func f() error {
+	_ = tryOr(strconv.Atoi("42"), 0)
+	return nil
+}
+`,
+			want: "foo.go:6:6: foo: Result of tryOr() is discarded",
+		},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			pkg := parsePackageForTest(t, tc.src)
+			var buf bytes.Buffer
+			gen := &Gen{Warn: &buf}
+			if err := gen.translate([]*Package{pkg}); err != nil {
+				t.Fatal(err)
+			}
+			ws := pkg.Warnings()
+			if len(ws) != 1 {
+				t.Fatalf("Wanted 1 warning but got %v", ws)
+			}
+			if msg := ws[0].String(); !strings.Contains(msg, tc.want) {
+				t.Errorf("%q is not included in warning: %s", tc.want, msg)
+			}
+			if out := buf.String(); !strings.Contains(out, "Warning: "+tc.want) {
+				t.Errorf("Warning was not output: %q", out)
+			}
+		})
+	}
+}
+
+func TestNoWarning(t *testing.T) {
+	pkg := parsePackageForTest(t, `package foo
+
+import "strconv"
+
+func g(s string) (int, error) {
+	n := try(strconv.Atoi(s))
+	return n, nil
+}
+
+func f() error {
+	n := try(g("42"))
+	println(n)
+	return nil
+}
+`)
+	gen := &Gen{}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+	if ws := pkg.Warnings(); ws != nil {
+		t.Fatal("Unexpected warnings:", ws)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	pkg := parsePackageForTest(t, `package foo
+
+import (
+	"os"
+	"strconv"
+)
+
+func f(s string) (int, error) {
+	try(os.Chdir("foo"))
+	n := try(strconv.Atoi(s))
+	return n, nil
+}
+`)
+
+	var buf bytes.Buffer
+	gen := &Gen{Out: &buf, Explain: true}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"foo.go:9:2: try() (toplevel call)\n\tif err := os.Chdir(\"foo\"); err != nil {\n\t\treturn 0, err\n\t}\n",
+		"foo.go:10:7: try() (assignment)\n\tn, _err0 := strconv.Atoi(s)\n\tif _err0 != nil {\n\t\treturn 0, _err0\n\t}\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is not included in output: %q", want, out)
+		}
+	}
+	if strings.Index(out, "foo.go:9:2") > strings.Index(out, "foo.go:10:7") {
+		t.Errorf("Translation points are not sorted by position: %q", out)
+	}
+
+	pts := pkg.TransPoints()
+	if len(pts) != 2 {
+		t.Fatal("Wanted 2 translation points:", pts)
+	}
+	for _, p := range pts {
+		if len(p.Generated) == 0 {
+			t.Error("No generated statement at", p.Pos)
+		}
+	}
+}
+
+func TestOnTranslate(t *testing.T) {
+	src := `package foo
+
+import (
+	"os"
+	"strconv"
+)
+
+func f(s string) (int, error) {
+	try(os.Chdir("foo"))
+	n := try(strconv.Atoi(s))
+	return n, nil
+}
+`
+
+	t.Run("wrap", func(t *testing.T) {
+		pkg := parsePackageForTest(t, src)
+		seen := []TransPoint{}
+		gen := &Gen{
+			OnTranslate: func(p TransPoint) Decision {
+				seen = append(seen, p)
+				if p.Kind == TransAssign {
+					return Decision{Wrap: "parse 100% number"}
+				}
+				return Decision{}
+			},
+		}
+		if err := gen.translate([]*Package{pkg}); err != nil {
+			t.Fatal(err)
+		}
+		if len(seen) != 2 {
+			t.Fatal("Hook should be called for each translation point:", seen)
+		}
+
+		var buf bytes.Buffer
+		for _, f := range pkg.Node.Files {
+			if err := pkg.writeGo(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		out := buf.String()
+		for _, want := range []string{
+			"return 0, err\n",
+			"return 0, fmt.Errorf(\"parse 100%% number: %w\", _err0)\n",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%q is not included in output: %s", want, out)
+			}
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		pkg := parsePackageForTest(t, src)
+		gen := &Gen{
+			OnTranslate: func(p TransPoint) Decision {
+				if p.Call != nil && p.Call.Fun.(*ast.SelectorExpr).Sel.Name == "Chdir" {
+					return Decision{Reject: "changing directory is forbidden"}
+				}
+				return Decision{}
+			},
+		}
+		err := gen.translate([]*Package{pkg})
+		if err == nil {
+			t.Fatal("Error did not occur")
+		}
+		want := "foo.go:9:2: foo: Error: Translation of try() call was rejected: changing directory is forbidden"
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q is not included in error: %s", want, err)
+		}
+	})
+}
+
+func TestNoTypeCheck(t *testing.T) {
+	pkg := parsePackageForTest(t, `package foo
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+)
+
+type S struct{}
+
+func pair() (int, error) {
+	return 0, nil
+}
+
+func f(s string) (*S, []int, S, string, url.Userinfo, error) {
+	try(os.Chdir("foo"))
+	try(pair())
+	var n int
+	n = try(strconv.Atoi(s))
+	m := try(url.Parse(s))
+	println(n, m)
+	return nil, nil, S{}, "", url.Userinfo{}, nil
+}
+
+func g() (a, b S, i, j int, err error) {
+	try(os.Chdir("bar"))
+	return
+}
+`)
+	gen := &Gen{NoTypeCheck: true}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	for _, f := range pkg.Node.Files {
+		if err := pkg.writeGo(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := buf.String()
+	zero := "return nil, nil, *new(S), \"\", *new(url.Userinfo), "
+	for _, want := range []string{
+		"if err := os.Chdir(\"foo\"); err != nil {\n\t\t" + zero + "err\n",
+		"if _, err := pair(); err != nil {\n\t\t" + zero + "err\n",
+		"var _err0 error\n\tn, _err0 = strconv.Atoi(s)\n\tif _err0 != nil {\n\t\t" + zero + "_err0\n",
+		"m, _err1 := url.Parse(s)\n\tif _err1 != nil {\n\t\t" + zero + "_err1\n",
+		"if err := os.Chdir(\"bar\"); err != nil {\n\t\treturn *new(S), *new(S), 0, 0, err\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is not included in output: %s", want, out)
+		}
+	}
+}
+
+func TestRuntimeHelpers(t *testing.T) {
+	pkg := parsePackageForTest(t, `package foo
+
+import (
+	"os"
+	"strconv"
+)
+
+type S struct{}
+
+func f(s string) (S, error) {
+	try(os.Chdir("foo"))
+	expect(os.Chdir("bar"))
+	n := try(strconv.Atoi(s))
+	println(n)
+	return S{}, nil
+}
+`)
+	gen := &Gen{
+		NoTypeCheck:    true,
+		RuntimeHelpers: true,
+		OnTranslate: func(p TransPoint) Decision {
+			if p.Kind == TransAssign {
+				return Decision{Wrap: "parse"}
+			}
+			return Decision{}
+		},
+	}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	for _, f := range pkg.Node.Files {
+		if err := pkg.writeGo(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"\"github.com/rhysd/trygo/trygoruntime\"",
+		"return trygoruntime.Zero[S](), err\n",
+		"trygoruntime.Report(err, \"foo.go:12\")\n",
+		"return trygoruntime.Zero[S](), trygoruntime.Wrap(_err0, \"parse\")\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is not included in output: %s", want, out)
+		}
+	}
+}
+
+func TestEmitAST(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trygo-emit-ast-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pkg := parsePackageForTest(t, `package foo
+
+import "os"
+
+func f() error {
+	try(os.Chdir("foo"))
+	return nil
+}
+`)
+	gen := &Gen{EmitASTDir: dir}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		stage string
+		want  string
+		not   string
+	}{
+		{"0-before", `Name: "try"`, "IfStmt"},
+		{"1-phase1", `Name: "Chdir"`, "IfStmt"},
+		{"2-phase2", "IfStmt", ""},
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "foo", "foo.go."+tc.stage+".ast"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := string(b)
+		if !strings.Contains(s, tc.want) {
+			t.Errorf("%q is not included in AST dump at %s", tc.want, tc.stage)
+		}
+		if tc.not != "" && strings.Contains(s, tc.not) {
+			t.Errorf("%q should not be included in AST dump at %s", tc.not, tc.stage)
+		}
+	}
+}
+
+func TestDumpBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trygo-dump-blocks-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pkg := parsePackageForTest(t, `package foo
+
+import "os"
+
+func f(b bool) error {
+	try(os.Chdir("foo"))
+	if b {
+		n := try(os.Getwd())
+		println(n)
+	}
+	return nil
+}
+`)
+	gen := &Gen{DumpBlocksDir: dir}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "foo.dot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	for _, want := range []string{
+		"digraph \"foo\" {\n",
+		`b0 [label="BlockStmt\nfoo.go:5:22\n3 statement(s)"];`,
+		`t0 [shape=ellipse label="try() (toplevel call)\nfoo.go:6:2\nstatement #0"];`,
+		"b0 -> t0 [style=dashed];",
+		`b1 [label="BlockStmt\nfoo.go:7:7\n2 statement(s)"];`,
+		`t1 [shape=ellipse label="try() (assignment)\nfoo.go:8:8\nstatement #0"];`,
+		"b1 -> t1 [style=dashed];",
+		"b0 -> b1;",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is not included in DOT graph: %s", want, out)
+		}
+	}
+}
+
+func TestEmitPhase1Source(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trygo-emit-phase1-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pkg := parsePackageForTest(t, `package foo
+
+import "os"
+
+func f() error {
+	n := try(os.Getwd())
+	println(n)
+	return nil
+}
+`)
+	gen := &Gen{EmitPhase1Dir: dir}
+	if err := gen.translate([]*Package{pkg}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "foo", "foo.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	if want := "n, _ := os.Getwd()\n"; !strings.Contains(out, want) {
+		t.Errorf("%q is not included in source after phase-1: %s", want, out)
+	}
+	if strings.Contains(out, "if err != nil") {
+		t.Errorf("Nil check should not be inserted in source after phase-1: %s", out)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	src := `package foo
+
+import "strconv"
+
+func f(s string) (int, error) {
+	n := try(strconv.Atoi(s))
+	return n, nil
+}
+`
+	for _, tc := range []struct {
+		what    string
+		corrupt func(body *ast.BlockStmt)
+		want    string
+	}{
+		{
+			what:    "not corrupted",
+			corrupt: func(body *ast.BlockStmt) {},
+		},
+		{
+			what: "remaining try() call",
+			corrupt: func(body *ast.BlockStmt) {
+				call := &ast.CallExpr{Fun: ast.NewIdent("try"), Args: []ast.Expr{ast.NewIdent("s")}}
+				body.List = append([]ast.Stmt{&ast.ExprStmt{X: call}}, body.List...)
+			},
+			want: "try() call remains after translation",
+		},
+		{
+			what: "unmatched error ident",
+			corrupt: func(body *ast.BlockStmt) {
+				cond := body.List[1].(*ast.IfStmt).Cond.(*ast.BinaryExpr)
+				cond.X = ast.NewIdent("err")
+			},
+			want: "Variable 'err' checked for try() is not assigned by generated code",
+		},
+		{
+			what: "removed nil check",
+			corrupt: func(body *ast.BlockStmt) {
+				body.List = append(body.List[:1], body.List[2:]...)
+			},
+			want: "Code generated for try() is not put in a row in its block",
+		},
+		{
+			what: "removed generated code",
+			corrupt: func(body *ast.BlockStmt) {
+				body.List = body.List[2:]
+			},
+			want: "Code generated for try() was removed from its block",
+		},
+		{
+			what: "duplicated statement",
+			corrupt: func(body *ast.BlockStmt) {
+				body.List = append(body.List, body.List[1])
+			},
+			want: "Statement appears more than once in AST",
+		},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			pkg := parsePackageForTest(t, src)
+			if err := (&Gen{}).translate([]*Package{pkg}); err != nil {
+				t.Fatal(err)
+			}
+
+			var body *ast.BlockStmt
+			for _, f := range pkg.Node.Files {
+				body = f.Decls[len(f.Decls)-1].(*ast.FuncDecl).Body
+			}
+			tc.corrupt(body)
+
+			vs := pkg.Validate()
+			if tc.want == "" {
+				for _, v := range vs {
+					t.Error(v)
+				}
+				return
+			}
+			if len(vs) == 0 {
+				t.Fatal("No violation was found")
+			}
+			if msg := vs[0].Error(); !strings.Contains(msg, tc.want) {
+				t.Fatalf("Wanted %q in violation but have %q", tc.want, msg)
+			}
+		})
+	}
+}
+
+func TestZeroValueOfAllTypes(t *testing.T) {
+	named := types.NewNamed(types.NewTypeName(token.NoPos, nil, "T", nil), nil, nil)
+	st := types.NewStruct(nil, nil)
+	namedStruct := types.NewNamed(types.NewTypeName(token.NoPos, nil, "S", nil), st, nil)
+	named.SetUnderlying(types.NewArray(namedStruct, 2))
+
+	for _, tc := range []struct {
+		ty   types.Type
+		want string
+	}{
+		{types.Typ[types.Bool], "false"},
+		{types.Typ[types.Int], "0"},
+		{types.Typ[types.Uintptr], "0"},
+		{types.Typ[types.Float32], "0.0"},
+		{types.Typ[types.Complex128], "0i"},
+		{types.Typ[types.String], `""`},
+		{types.Typ[types.UnsafePointer], "nil"},
+		{types.Typ[types.Invalid], "*new(T)"},
+		{types.Typ[types.UntypedInt], "*new(T)"},
+		{types.Typ[types.UntypedNil], "*new(T)"},
+		{types.NewSlice(types.Typ[types.Int]), "nil"},
+		{types.NewPointer(types.Typ[types.Int]), "nil"},
+		{types.NewSignature(nil, nil, nil, false), "nil"},
+		{types.NewInterfaceType(nil, nil), "nil"},
+		{types.NewMap(types.Typ[types.Int], types.Typ[types.Int]), "nil"},
+		{types.NewChan(types.SendRecv, types.Typ[types.Int]), "nil"},
+		{st, "struct{}{}"},
+		{types.NewArray(namedStruct, 2), "[2]S{}"},
+		{named, "T{}"},
+		{namedStruct, "S{}"},
+		{types.NewTuple(types.NewVar(token.NoPos, nil, "x", types.Typ[types.Int])), "*new(T)"},
+	} {
+		t.Run(tc.ty.String(), func(t *testing.T) {
+			nci := &nilCheckInsertion{pkg: &ast.Package{}}
+			expr := nci.zeroValueOf(tc.ty, ast.NewIdent("T"), token.NoPos)
+			var buf bytes.Buffer
+			if err := printer.Fprint(&buf, token.NewFileSet(), expr); err != nil {
+				t.Fatal(err)
+			}
+			// Positions of generated nodes are not valid. Ignore spaces and newlines inserted by printer
+			if have := strings.Join(strings.Fields(buf.String()), ""); have != tc.want {
+				t.Fatalf("Wanted %q but have %q", tc.want, have)
+			}
+		})
+	}
+}
+
+func TestStmtEditor(t *testing.T) {
+	stmt := func(name string) ast.Stmt {
+		return &ast.ExprStmt{X: ast.NewIdent(name)}
+	}
+	blk := &ast.BlockStmt{List: []ast.Stmt{stmt("a"), stmt("b"), stmt("c"), stmt("d")}}
+	ed := newStmtEditor(&blockTree{ast: blk}, logger{})
+
+	ed.insertAt(1, stmt("x")) // a x b c d
+	ed.removeAt(2)            // a x c d
+	ed.insertAt(3, stmt("y")) // a x c y d
+	ed.insertAt(1, stmt("z")) // a z x c y d
+	if s := ed.at(3); s.(*ast.ExprStmt).X.(*ast.Ident).Name != "c" {
+		t.Fatal("Unexpected statement at index 3:", s)
+	}
+	if len(blk.List) != 4 {
+		t.Fatal("Block should not be modified until flush:", len(blk.List))
+	}
+	ed.flush()
+
+	names := []string{}
+	for _, s := range blk.List {
+		names = append(names, s.(*ast.ExprStmt).X.(*ast.Ident).Name)
+	}
+	if have, want := strings.Join(names, " "), "a z x c y d"; have != want {
+		t.Fatalf("Wanted %q but have %q", want, have)
+	}
+}
+
+func TestTypeErrorAtTrans(t *testing.T) {
+	pkg := parsePackageForTest(t, `package foo
+
+import "strconv"
+
+func f(s string) (int, error) {
+	y := try(strconv.Atoi(s)) + try(strconv.Atoi(s))
+	return y, nil
+}
+`)
+	if err := (tryCallEliminationPass{}).Run(pkg); err != nil {
+		t.Fatal(err)
+	}
+	var trans *transPoint
+	for _, tp := range pkg.transPoints {
+		if tp.inserted {
+			trans = tp
+			break
+		}
+	}
+	if trans == nil {
+		t.Fatal("Translation point of hoisted try() call was not found:", pkg.transPoints)
+	}
+
+	// Error at ':=' of inserted statement, which is neither at the call nor at '_' variable
+	err := typeErrorAtTrans(types.Error{Fset: pkg.Files, Pos: trans.node.(*ast.AssignStmt).TokPos, Msg: "no new variables on left side of :="}, pkg.transPoints, nil)
+	if _, ok := err.(*translationTypeError); !ok {
+		t.Fatalf("Error in inserted statement should be caused by translation: %#v", err)
+	}
+
+	arg := trans.call.(*ast.CallExpr).Args[0]
+	err = typeErrorAtTrans(types.Error{Fset: pkg.Files, Pos: arg.Pos(), Msg: "undeclared name: s"}, pkg.transPoints, nil)
+	if _, ok := err.(types.Error); !ok {
+		t.Fatalf("Error in argument of call should exist in TryGo source: %#v", err)
+	}
+}
+
+func TestExportDataImporter(t *testing.T) {
+	dir := filepath.Join("testdata", "trans", "ok", "assign", "src")
+	imp := newExportDataImporter(dir, []string{"fmt"}, logger{})
+	if ty := fmt.Sprintf("%T", imp); strings.Contains(ty, "srcimporter") {
+		t.Fatal("Export data should be used when it is available:", ty)
+	}
+	pkg, err := imp.Import("fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Scope().Lookup("Println") == nil {
+		t.Fatal("Println is not found in fmt package imported from export data")
+	}
+
+	imp = newExportDataImporter(dir, []string{"fmt", "example.com/unknown"}, logger{})
+	if ty := fmt.Sprintf("%T", imp); !strings.Contains(ty, "srcimporter") {
+		t.Fatal("Source importer should be used when export data is not available:", ty)
+	}
+}
+
+func TestStandaloneImporter(t *testing.T) {
+	pkg := parsePackageForTest(t, "package foo\n\nimport \"fmt\"\n\nvar _ = fmt.Println\n")
+	pkg.standalone = true
+	if ty := fmt.Sprintf("%T", pkg.typesImporter()); !strings.Contains(ty, "srcimporter") {
+		t.Fatal("Packages in working directory should not be compiled in standalone mode:", ty)
+	}
+}
+
+func TestSiblingsImporterFor(t *testing.T) {
+	exports, err := listExportData(filepath.Join("testdata", "trans", "ok", "assign", "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &siblings{
+		dirs:           map[string]string{"example.com/lib": "lib"},
+		checked:        map[string]*types.Package{},
+		exports:        exports,
+		exportImporter: exportDataImporter(exports),
+		sourceImporter: importer.For("source", nil),
+	}
+
+	pkg := parsePackageForTest(t, "package foo\n\nimport (\n\t\"example.com/lib\"\n\t\"fmt\"\n)\n\nvar _, _ = lib.F, fmt.Println\n")
+	imp := s.importerFor(pkg).(*siblingImporter)
+	if imp.base != s.exportImporter {
+		t.Fatal("Export data should be used when it is available except for packages translated together")
+	}
+
+	pkg = parsePackageForTest(t, "package foo\n\nimport \"example.com/unknown\"\n\nvar _ = unknown.F\n")
+	imp = s.importerFor(pkg).(*siblingImporter)
+	if imp.base != s.sourceImporter {
+		t.Fatal("Source importer should be used when export data is not available")
+	}
+}
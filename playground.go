@@ -0,0 +1,127 @@
+package trygo
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+)
+
+// maxPlaygroundSource is the maximum size of source accepted by playground server in bytes.
+const maxPlaygroundSource = 1 << 20
+
+// PlaygroundRequest is a JSON request body sent to playground server.
+type PlaygroundRequest struct {
+	// Source is TryGo source to translate.
+	Source string `json:"source"`
+	// Filename is a file name of the source used for positions in diagnostics. When empty, "prog.go" is
+	// used.
+	Filename string `json:"filename,omitempty"`
+}
+
+// PlaygroundDiagnostic is an error or a warning reported by playground server.
+type PlaygroundDiagnostic struct {
+	// Line is a line number of the position where the problem was found. It is 0 when the problem is
+	// not related to any specific position.
+	Line int `json:"line"`
+	// Column is a column number of the position where the problem was found.
+	Column int `json:"column"`
+	// Severity is "error" or "warning".
+	Severity string `json:"severity"`
+	// Message is a description of the problem.
+	Message string `json:"message"`
+}
+
+// PlaygroundResponse is a JSON response body returned from playground server.
+type PlaygroundResponse struct {
+	// Output is translated Go source. It is empty when translation failed.
+	Output string `json:"output"`
+	// Diagnostics is a list of errors and warnings found while translation.
+	Diagnostics []*PlaygroundDiagnostic `json:"diagnostics"`
+}
+
+type playground struct {
+	gen *Gen
+}
+
+// diagnose collects diagnostics for the source which failed to be translated with the error.
+func (pg *playground) diagnose(filename string, src []byte, err error) []*PlaygroundDiagnostic {
+	ds := []*PlaygroundDiagnostic{}
+	if errs, ok := errors.Cause(err).(scanner.ErrorList); ok {
+		for _, e := range errs {
+			ds = append(ds, &PlaygroundDiagnostic{e.Pos.Line, e.Pos.Column, "error", e.Msg})
+		}
+		return ds
+	}
+
+	fset := token.NewFileSet()
+	if f, perr := parser.ParseFile(fset, filename, src, parser.ParseComments); perr == nil {
+		dir := filepath.Dir(filename)
+		node := &ast.Package{Name: f.Name.Name, Files: map[string]*ast.File{filename: f}}
+		gen := *pg.gen
+		gen.Strict = true
+		for _, d := range gen.CheckPackages([]*Package{NewPackage(node, dir, dir, fset)}) {
+			ds = append(ds, &PlaygroundDiagnostic{d.Pos.Line, d.Pos.Column, "error", d.Message})
+		}
+	}
+	if len(ds) == 0 {
+		ds = append(ds, &PlaygroundDiagnostic{Severity: "error", Message: err.Error()})
+	}
+	return ds
+}
+
+func (pg *playground) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lg := pg.gen.lg()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PlaygroundRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPlaygroundSource)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	filename := req.Filename
+	if filename == "" {
+		filename = "prog.go"
+	}
+	filename = filepath.Base(filename)
+	src := []byte(req.Source)
+	lg.log("Playground request for", lg.hi(filename), "with", len(src), "bytes")
+
+	// Copy Gen since it is not safe to translate concurrently with the same instance
+	gen := *pg.gen
+	gen.Out = ioutil.Discard
+	gen.Warn = ioutil.Discard
+	res := &PlaygroundResponse{Diagnostics: []*PlaygroundDiagnostic{}}
+	pkg, out, err := gen.translateFile(filename, src)
+	if err != nil {
+		lg.log("Playground translation failed:", err)
+		res.Diagnostics = pg.diagnose(filename, src, err)
+	} else {
+		res.Output = string(out)
+		for _, warn := range pkg.Warnings() {
+			res.Diagnostics = append(res.Diagnostics, &PlaygroundDiagnostic{warn.Pos.Line, warn.Pos.Column, "warning", warn.Message})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		lg.log("Cannot write playground response:", err)
+	}
+}
+
+// PlaygroundHandler returns an HTTP handler to translate TryGo source for web playground and
+// documentation examples. It accepts POST request with PlaygroundRequest JSON body and returns
+// PlaygroundResponse JSON. Source is translated in standalone mode with configurations of the Gen.
+// Translation errors are returned as diagnostics with status 200.
+func (gen *Gen) PlaygroundHandler() http.Handler {
+	return &playground{gen}
+}
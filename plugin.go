@@ -0,0 +1,88 @@
+package trygo
+
+import (
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/token"
+	"plugin"
+)
+
+// External plugins rewrite AST of packages between phase-1 and phase-2 as passes. It allows to inject custom
+// policies without forking trygo. A plugin is a Go plugin (built with -buildmode=plugin) which exports
+// a function named 'Rewrite' with the following signature:
+//
+//   func Rewrite(fset *token.FileSet, pkg *ast.Package) error
+//
+// The function receives AST of package from which try() calls were eliminated. The AST is type-checked
+// after all plugins ran. Plugins must not add, remove or reorder statements in blocks containing
+// translated try() calls since nil checks are inserted at the positions of the statements in phase-2.
+
+// rewriteFunc is a function to rewrite AST of a package between phase-1 and phase-2.
+type rewriteFunc func(fset *token.FileSet, pkg *ast.Package) error
+
+type rewriter struct {
+	name    string
+	rewrite rewriteFunc
+}
+
+// loadPlugin loads Go plugin at the path and looks up its Rewrite function.
+func loadPlugin(path string, lg logger) (*rewriter, error) {
+	lg.log("Load plugin", relpath(path))
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot load plugin %s", path)
+	}
+	sym, err := p.Lookup("Rewrite")
+	if err != nil {
+		return nil, errors.Wrapf(err, "Plugin %s does not export Rewrite function", path)
+	}
+	switch f := sym.(type) {
+	case func(*token.FileSet, *ast.Package) error:
+		return &rewriter{path, f}, nil
+	case *func(*token.FileSet, *ast.Package) error:
+		return &rewriter{path, *f}, nil
+	default:
+		return nil, errors.Errorf("Rewrite exported by plugin %s must be func(*token.FileSet, *ast.Package) error but it is %T", path, sym)
+	}
+}
+
+// blockSnapshot is a snapshot of statements in blocks which have translation points.
+type blockSnapshot map[*blockTree][]ast.Stmt
+
+func (snap blockSnapshot) take(tree *blockTree) {
+	if len(tree.transPoints) > 0 {
+		stmts := tree.stmts()
+		snap[tree] = append(make([]ast.Stmt, 0, len(stmts)), stmts...)
+	}
+	for _, c := range tree.children {
+		snap.take(c)
+	}
+}
+
+// changed returns the block whose statements were changed since the snapshot was taken.
+func (snap blockSnapshot) changed() (*blockTree, bool) {
+	for tree, prev := range snap {
+		stmts := tree.stmts()
+		if len(stmts) != len(prev) {
+			return tree, true
+		}
+		for i, s := range stmts {
+			if s != prev[i] {
+				return tree, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (r *rewriter) String() string {
+	return "Plugin " + r.name
+}
+
+// Run runs the rewrite function of the plugin against the package.
+func (r *rewriter) Run(pkg *Package) error {
+	if err := r.rewrite(pkg.Files, pkg.Node); err != nil {
+		return errors.Wrapf(err, "Plugin %s failed to rewrite package %s", r.name, pkg.Node.Name)
+	}
+	return nil
+}
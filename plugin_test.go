@@ -0,0 +1,83 @@
+package trygo
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parsePackageForTest(t *testing.T, src string) *Package {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "foo.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &ast.Package{Name: f.Name.Name, Files: map[string]*ast.File{"foo.go": f}}
+	return NewPackage(node, cwd, filepath.Join(cwd, "out"), fset)
+}
+
+const pluginTestSrc = `package foo
+
+import "fmt"
+
+func f() error {
+	try(fmt.Println("hello"))
+	return nil
+}
+`
+
+func TestRewritePlugin(t *testing.T) {
+	pkg := parsePackageForTest(t, pluginTestSrc)
+
+	rename := &rewriter{"rename", func(fset *token.FileSet, pkg *ast.Package) error {
+		ast.Inspect(pkg, func(n ast.Node) bool {
+			if s, ok := n.(*ast.SelectorExpr); ok && s.Sel.Name == "Println" {
+				s.Sel.Name = "Print"
+			}
+			return true
+		})
+		return nil
+	}}
+
+	if err := translatePackage(pkg, []Pass{TryCallElimination, rename, NilCheckInsertion}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := pkg.writeGo(&buf, pkg.Node.Files["foo.go"]); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, `if _, err := fmt.Print("hello"); err != nil {`) {
+		t.Fatal("Rewrite by plugin was not applied:", out)
+	}
+}
+
+func TestRewritePluginChangingBlock(t *testing.T) {
+	pkg := parsePackageForTest(t, pluginTestSrc)
+
+	insert := &rewriter{"insert", func(fset *token.FileSet, pkg *ast.Package) error {
+		for _, f := range pkg.Files {
+			for _, d := range f.Decls {
+				if fun, ok := d.(*ast.FuncDecl); ok {
+					fun.Body.List = append([]ast.Stmt{&ast.EmptyStmt{}}, fun.Body.List...)
+				}
+			}
+		}
+		return nil
+	}}
+
+	err := translatePackage(pkg, []Pass{TryCallElimination, insert, NilCheckInsertion})
+	if err == nil || !strings.Contains(err.Error(), "Plugin insert changed statements in block") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestLoadPluginError(t *testing.T) {
+	if _, err := loadPlugin(filepath.Join("testdata", "not-exist.so"), logger{}); err == nil || !strings.Contains(err.Error(), "Cannot load plugin") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
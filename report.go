@@ -0,0 +1,161 @@
+package trygo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Phase is a phase of generating one package whose elapsed time is measured.
+type Phase string
+
+const (
+	// PhaseParse is a phase to parse TryGo sources.
+	PhaseParse Phase = "parse"
+	// PhaseElimination is a phase to eliminate try() calls (phase-1).
+	PhaseElimination Phase = "phase-1"
+	// PhaseTypeCheck is a phase to type-check the package. It includes pre-flight type check.
+	PhaseTypeCheck Phase = "typecheck"
+	// PhaseInsertion is a phase to insert `if err != nil` checks (phase-2).
+	PhaseInsertion Phase = "phase-2"
+	// PhaseWrite is a phase to write generated files.
+	PhaseWrite Phase = "write"
+)
+
+// Timing is an elapsed time of one phase.
+type Timing struct {
+	// Phase is the measured phase.
+	Phase Phase
+	// Duration is the elapsed time of the phase. When the phase ran multiple times, it is a sum of them.
+	Duration time.Duration
+}
+
+// Report is a summary of generating one package.
+type Report struct {
+	// Package is a name of the package.
+	Package string
+	// Birth is a directory path of TryGo source of the package.
+	Birth string
+	// Path is a directory path where the package is generated.
+	Path string
+	// Timings is a list of elapsed times of phases in order of their first runs. Phases which did not
+	// run are not included.
+	Timings []Timing
+	// Warnings is a list of warnings found while translating the package.
+	Warnings []*Warning
+	// Kinds is a number of translation points per kind of translation.
+	Kinds map[TransKind]int
+	// ModifiedFiles is a list of paths of TryGo source files modified by the translation in sorted order.
+	ModifiedFiles []string
+	// FixedImports is a number of import paths fixed or rewritten in the package.
+	FixedImports int
+}
+
+// Total returns the sum of elapsed times of all phases.
+func (r *Report) Total() time.Duration {
+	var d time.Duration
+	for _, t := range r.Timings {
+		d += t.Duration
+	}
+	return d
+}
+
+func (r *Report) String() string {
+	ss := make([]string, 0, len(r.Timings)+1)
+	for _, t := range r.Timings {
+		ss = append(ss, fmt.Sprintf("%s=%s", t.Phase, t.Duration))
+	}
+	ss = append(ss, fmt.Sprintf("total=%s", r.Total()))
+	return fmt.Sprintf("%s (%s): %s", r.Package, relpath(r.Birth), strings.Join(ss, " "))
+}
+
+// addTiming adds elapsed time of the phase to the package.
+func (pkg *Package) addTiming(phase Phase, d time.Duration) {
+	pkg.lg.log("Phase", pkg.lg.hi(phase), "took", d)
+	for i, t := range pkg.timings {
+		if t.Phase == phase {
+			pkg.timings[i].Duration += d
+			return
+		}
+	}
+	pkg.timings = append(pkg.timings, Timing{phase, d})
+}
+
+// Report returns a summary of generating the package including elapsed times of phases.
+func (pkg *Package) Report() *Report {
+	kinds := map[TransKind]int{}
+	files := map[string]struct{}{}
+	for _, trans := range pkg.transPoints {
+		kinds[TransKind(trans.kind)]++
+		files[pkg.Files.Position(trans.pos).Filename] = struct{}{}
+	}
+	for _, pos := range pkg.fixedImports {
+		files[pkg.Files.Position(pos).Filename] = struct{}{}
+	}
+	modified := make([]string, 0, len(files))
+	for f := range files {
+		modified = append(modified, f)
+	}
+	sort.Strings(modified)
+
+	return &Report{
+		Package:       pkg.Node.Name,
+		Birth:         pkg.Birth,
+		Path:          pkg.Path,
+		Timings:       append([]Timing{}, pkg.timings...),
+		Warnings:      pkg.Warnings(),
+		Kinds:         kinds,
+		ModifiedFiles: modified,
+		FixedImports:  len(pkg.fixedImports),
+	}
+}
+
+// TranslationReport is a summary of translating packages. Wrapping tools can show it to users.
+type TranslationReport struct {
+	// Packages is a list of reports of translated packages.
+	Packages []*Report
+	// Kinds is a number of translation points per kind of translation in all packages.
+	Kinds map[TransKind]int
+	// ModifiedFiles is a list of paths of TryGo source files modified by the translation.
+	ModifiedFiles []string
+	// FixedImports is a number of import paths fixed or rewritten in all packages.
+	FixedImports int
+	// Duration is an elapsed time of the whole translation.
+	Duration time.Duration
+	// Warnings is a list of warnings found while translating all packages.
+	Warnings []*Warning
+}
+
+func newTranslationReport(pkgs []*Package, d time.Duration) *TranslationReport {
+	r := &TranslationReport{
+		Packages:      make([]*Report, 0, len(pkgs)),
+		Kinds:         map[TransKind]int{},
+		ModifiedFiles: []string{},
+		Duration:      d,
+		Warnings:      []*Warning{},
+	}
+	for _, pkg := range pkgs {
+		p := pkg.Report()
+		r.Packages = append(r.Packages, p)
+		for k, n := range p.Kinds {
+			r.Kinds[k] += n
+		}
+		r.ModifiedFiles = append(r.ModifiedFiles, p.ModifiedFiles...)
+		r.FixedImports += p.FixedImports
+		r.Warnings = append(r.Warnings, p.Warnings...)
+	}
+	return r
+}
+
+// TranslatePackagesWithReport is the same as TranslatePackages but also returns a summary of the
+// translation. When KeepGoing is true and translations of some packages failed, the report summarizes
+// successfully translated packages and *PartialError is returned.
+func (gen *Gen) TranslatePackagesWithReport(pkgDirs []string) ([]*Package, *TranslationReport, error) {
+	start := time.Now()
+	pkgs, err := gen.TranslatePackages(pkgDirs)
+	if _, ok := err.(*PartialError); err != nil && !ok {
+		return nil, nil, err
+	}
+	return pkgs, newTranslationReport(pkgs, time.Since(start)), err
+}
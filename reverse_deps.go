@@ -0,0 +1,139 @@
+package trygo
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// When only a part of repository is translated, other packages in the repository keep importing
+// original TryGo packages and fail to build against generated output. Such reverse dependencies are
+// detected by walking the repository root and reported as warnings.
+
+// repositoryRoot finds a root directory to search reverse dependencies. It is a directory containing
+// go.mod. When no go.mod is found, the directory of the given path is returned.
+func repositoryRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// importPathOfDir returns the import path of a package in the directory using `go list`.
+func importPathOfDir(dir string) (string, bool) {
+	cmd := exec.Command("go", "list", "-e", "-find", "-f", "{{.ImportPath}}", ".")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", false
+	}
+	p := strings.TrimSpace(string(out))
+	if p == "" || strings.HasPrefix(p, "_") {
+		// `go list` returns _/path/to/dir for the directory outside GOPATH and module
+		return "", false
+	}
+	return p, true
+}
+
+// importsUnder collects import paths of Go files in each directory under the root. Output directory,
+// testdata, vendor and hidden directories are skipped.
+func (gen *Gen) importsUnder(root string) map[string]map[string]struct{} {
+	imports := map[string]map[string]struct{}{}
+	fset := token.NewFileSet()
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if p != root && (p == gen.OutDir || name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, p, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil
+		}
+		dir := filepath.Dir(p)
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			if _, ok := imports[dir]; !ok {
+				imports[dir] = map[string]struct{}{}
+			}
+			imports[dir][path] = struct{}{}
+		}
+		return nil
+	})
+	return imports
+}
+
+// findReverseDeps finds packages which are not translated but import translated packages. It returns
+// warning messages.
+func (gen *Gen) findReverseDeps(pkgs []*Package) []string {
+	lg := gen.lg()
+	if len(pkgs) == 0 {
+		return nil
+	}
+
+	translated := map[string]string{}
+	dirs := map[string]struct{}{}
+	for _, pkg := range pkgs {
+		dirs[pkg.Birth] = struct{}{}
+		if p, ok := importPathOfDir(pkg.Birth); ok {
+			translated[p] = pkg.Birth
+		}
+	}
+	if len(translated) == 0 {
+		return nil
+	}
+
+	root := repositoryRoot(pkgs[0].Birth)
+	lg.log("Search reverse dependencies of", lg.hi(len(translated)), "translated packages under", relpath(root))
+
+	importers := map[string]map[string]struct{}{}
+	for dir, imports := range gen.importsUnder(root) {
+		if _, ok := dirs[dir]; ok {
+			continue
+		}
+		for path := range imports {
+			if _, ok := translated[path]; !ok {
+				continue
+			}
+			if _, ok := importers[dir]; !ok {
+				importers[dir] = map[string]struct{}{}
+			}
+			importers[dir][path] = struct{}{}
+		}
+	}
+
+	msgs := make([]string, 0, len(importers))
+	for dir, paths := range importers {
+		ps := make([]string, 0, len(paths))
+		for p := range paths {
+			ps = append(ps, strconv.Quote(p))
+		}
+		sort.Strings(ps)
+		msgs = append(msgs, fmt.Sprintf("Package at %s is not translated but imports translated package(s) %s. Its imports still point original TryGo sources", dir, strings.Join(ps, ", ")))
+	}
+	sort.Strings(msgs)
+	return msgs
+}
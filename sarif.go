@@ -0,0 +1,176 @@
+package trygo
+
+import (
+	"encoding/json"
+	"go/token"
+	"io"
+	"path/filepath"
+)
+
+// SARIF 2.1.0 log for uploading diagnostics to code scanning services such as GitHub code scanning.
+// Only properties used by trygo are defined.
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifMessage `json:"insertedContent"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []*sarifReplacement   `json:"replacements"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage           `json:"description"`
+	ArtifactChanges []*sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifResult struct {
+	RuleID    string           `json:"ruleId"`
+	Level     string           `json:"level"`
+	Message   sarifMessage     `json:"message"`
+	Locations []*sarifLocation `json:"locations,omitempty"`
+	Fixes     []*sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool      `json:"tool"`
+	Results []*sarifResult `json:"results"`
+}
+
+type sarifLog struct {
+	Version string      `json:"version"`
+	Schema  string      `json:"$schema"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+// sarifRules is a list of rules of diagnostics.
+var sarifRules = []*sarifRule{
+	{ruleUntranslatable, sarifMessage{"Pseudo-function call cannot be translated"}},
+	{ruleTranslationTypeError, sarifMessage{"Type error caused by translation of pseudo-function call"}},
+	{ruleTypeError, sarifMessage{"Type error in TryGo source"}},
+}
+
+// sarifURI returns a URI of the file. Paths in the current directory are relative so that they are
+// resolved from the repository root in CI.
+func sarifURI(path string) string {
+	if rel, ok := reportPath(path); ok {
+		return rel
+	}
+	return "file://" + filepath.ToSlash(path)
+}
+
+func sarifRegionOf(start, end token.Position) sarifRegion {
+	return sarifRegion{
+		StartLine:   start.Line,
+		StartColumn: start.Column,
+		EndLine:     end.Line,
+		EndColumn:   end.Column,
+	}
+}
+
+func sarifFixOf(fix *SuggestedFix) *sarifFix {
+	changes := []*sarifArtifactChange{}
+	files := map[string]*sarifArtifactChange{}
+	for _, e := range fix.Edits {
+		c, ok := files[e.Pos.Filename]
+		if !ok {
+			c = &sarifArtifactChange{ArtifactLocation: sarifArtifactLocation{sarifURI(e.Pos.Filename)}}
+			files[e.Pos.Filename] = c
+			changes = append(changes, c)
+		}
+		c.Replacements = append(c.Replacements, &sarifReplacement{
+			DeletedRegion:   sarifRegionOf(e.Pos, e.End),
+			InsertedContent: sarifMessage{e.NewText},
+		})
+	}
+	return &sarifFix{Description: sarifMessage{fix.Message}, ArtifactChanges: changes}
+}
+
+// WriteSARIF writes diagnostics as SARIF 2.1.0 log to the writer. The log can be uploaded to code
+// scanning services such as GitHub code scanning. Suggested fixes of the diagnostics are included.
+func WriteSARIF(w io.Writer, diags []*Diagnostic) error {
+	results := make([]*sarifResult, 0, len(diags))
+	for _, d := range diags {
+		r := &sarifResult{
+			RuleID:  d.rule(),
+			Level:   "error",
+			Message: sarifMessage{d.Message},
+		}
+		if d.Pos.IsValid() {
+			r.Locations = []*sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{sarifURI(d.Pos.Filename)},
+					Region:           sarifRegion{StartLine: d.Pos.Line, StartColumn: d.Pos.Column},
+				},
+			}}
+		}
+		for _, f := range d.Fixes {
+			r.Fixes = append(r.Fixes, sarifFixOf(f))
+		}
+		results = append(results, r)
+	}
+
+	log := &sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []*sarifRun{{
+			Tool: sarifTool{
+				Driver: sarifDriver{
+					Name:           "trygo",
+					InformationURI: "https://github.com/rhysd/trygo",
+					Rules:          sarifRules,
+				},
+			},
+			Results: results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
@@ -0,0 +1,125 @@
+package trygo
+
+import (
+	"bufio"
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Errors reported by Go toolchain against generated files point lines of the generated files. They are
+// mapped back to lines of TryGo sources. The map is built by printing the AST with //line directives.
+// Since directives are put only at the beginning of lines, output lines without directives are identical
+// to the generated file.
+
+// sourceLineMap returns a slice which maps (line number - 1) of generated file to position of its source.
+func (pkg *Package) sourceLineMap(file *ast.File) ([]token.Position, error) {
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent | printer.SourcePos, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, pkg.Files, file); err != nil {
+		return nil, err
+	}
+
+	// Lines of the header comment have no source
+	lines := make([]token.Position, generatedHeaderLines)
+	cur := token.Position{}
+	s := bufio.NewScanner(&buf)
+	for s.Scan() {
+		l := s.Text()
+		if strings.HasPrefix(l, "//line ") {
+			d := strings.TrimPrefix(l, "//line ")
+			if i := strings.LastIndexByte(d, ':'); i >= 0 {
+				if n, err := strconv.Atoi(d[i+1:]); err == nil {
+					cur = token.Position{Filename: d[:i], Line: n}
+					continue
+				}
+			}
+		}
+		lines = append(lines, cur)
+		if cur.IsValid() {
+			cur.Line++
+		}
+	}
+	return lines, s.Err()
+}
+
+// sourcePosition returns the position in TryGo source corresponding to the line of the generated file.
+func (pkg *Package) sourcePosition(outPath string, line int) (token.Position, bool) {
+	file, ok := pkg.Node.Files[outPath]
+	if !ok {
+		return token.Position{}, false
+	}
+	lines, err := pkg.sourceLineMap(file)
+	if err != nil || line < 1 || len(lines) < line || !lines[line-1].IsValid() {
+		return token.Position{}, false
+	}
+	return lines[line-1], true
+}
+
+// sourcePositionIn finds the source position corresponding to the line of generated file in the packages.
+// `go test` reports positions in test failures only with file names. When the path is not found, a file
+// which has the same name is searched. The file must be unique.
+func sourcePositionIn(pkgs []*Package, outPath string, line int) (token.Position, bool) {
+	for _, pkg := range pkgs {
+		if pos, ok := pkg.sourcePosition(outPath, line); ok {
+			return pos, true
+		}
+	}
+
+	name := filepath.Base(outPath)
+	found := ""
+	var pkg *Package
+	for _, p := range pkgs {
+		for path := range p.Node.Files {
+			if filepath.Base(path) != name {
+				continue
+			}
+			if found != "" {
+				return token.Position{}, false
+			}
+			found, pkg = path, p
+		}
+	}
+	if found == "" {
+		return token.Position{}, false
+	}
+	return pkg.sourcePosition(found, line)
+}
+
+// displayPath returns path relative to current directory when the path is under it.
+func displayPath(path string) string {
+	if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+var reToolchainPos = regexp.MustCompile(`^(\s*)([^\s:][^:]*\.go):(\d+)(?::\d+)?(:.*)$`)
+
+// remapOutput rewrites positions of generated files in output of Go toolchain run at the directory
+// to positions of their TryGo sources. Lines which don't point generated files are kept as-is.
+func remapOutput(pkgs []*Package, dir string, out string) string {
+	var b strings.Builder
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		l := s.Text()
+		if m := reToolchainPos.FindStringSubmatch(l); m != nil {
+			p := m[2]
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(dir, p)
+			}
+			n, _ := strconv.Atoi(m[3])
+			if pos, ok := sourcePositionIn(pkgs, p, n); ok {
+				l = m[1] + displayPath(pos.Filename) + ":" + strconv.Itoa(pos.Line) + m[4]
+			}
+		}
+		b.WriteString(l)
+		b.WriteRune('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package trygo
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+)
+
+// standaloneImporter is an importer for standalone mode. When an import cannot be resolved, it returns an
+// empty package instead of an error so that type check can continue without the full package context.
+type standaloneImporter struct {
+	imp types.Importer
+	lg  logger
+}
+
+func (imp standaloneImporter) Import(path string) (*types.Package, error) {
+	if p, err := imp.imp.Import(path); err == nil {
+		return p, nil
+	}
+	// Guess package name from import path like example.com/go-foo/v2 -> foo
+	name := pathpkg.Base(path)
+	if strings.HasPrefix(name, "v") && strings.Trim(name[1:], "0123456789") == "" && pathpkg.Dir(path) != "." {
+		name = pathpkg.Base(pathpkg.Dir(path))
+	}
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+	imp.lg.log("Import", imp.lg.hi(path), "is not resolved. Empty package", imp.lg.hi(name), "is used in standalone mode")
+	p := types.NewPackage(path, name)
+	p.MarkComplete()
+	return p, nil
+}
+
+// TranslateFile translates a lone TryGo source file in standalone mode and returns translated Go source.
+// Imports of the file are not resolved and identifiers which cannot be resolved are accepted, so it is
+// available for snippets where the full package context is not available. filename is used for
+// positions in error messages. Translation of try() calls whose types are unknown is best-effort.
+func (gen *Gen) TranslateFile(filename string, src []byte) ([]byte, error) {
+	_, out, err := gen.translateFile(filename, src)
+	return out, err
+}
+
+// translateFile translates the source in standalone mode and returns the translated package with its
+// source.
+func (gen *Gen) translateFile(filename string, src []byte) (*Package, []byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Cannot parse %s", filename)
+	}
+
+	dir := filepath.Dir(filename)
+	node := &ast.Package{Name: f.Name.Name, Files: map[string]*ast.File{filename: f}}
+	pkg := NewPackage(node, dir, dir, fset)
+
+	standalone := gen.Standalone
+	gen.Standalone = true
+	err = gen.translate([]*Package{pkg})
+	gen.Standalone = standalone
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, file := range pkg.Node.Files {
+		if err := pkg.writeGo(&buf, file); err != nil {
+			return nil, nil, err
+		}
+	}
+	return pkg, buf.Bytes(), nil
+}
@@ -0,0 +1,160 @@
+package trygo
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Fixes suggested for problems found at try() call elimination. Edits are built from positions in AST
+// assuming that TryGo source is formatted with gofmt. For example, indentation is made of tabs.
+
+func (tce *tryCallElimination) replaceEdit(pos, end token.Pos, text string) *TextEdit {
+	return &TextEdit{Pos: tce.fileset.Position(pos), End: tce.fileset.Position(end), NewText: text}
+}
+
+func (tce *tryCallElimination) insertEdit(pos token.Pos, text string) *TextEdit {
+	return tce.replaceEdit(pos, pos, text)
+}
+
+// indentAt returns indentation of the line where the node starts.
+func (tce *tryCallElimination) indentAt(pos token.Pos) string {
+	return strings.Repeat("\t", tce.fileset.Position(pos).Column-1)
+}
+
+// addErrorResultFixes returns a fix to add error to the result list of current function which returns
+// nothing. Bare return statements are replaced with `return nil` and `return nil` is added at the end of
+// the function body.
+func (tce *tryCallElimination) addErrorResultFixes() []*SuggestedFix {
+	var ty *ast.FuncType
+	var body *ast.BlockStmt
+	switch f := tce.funcs.top().(type) {
+	case *ast.FuncLit:
+		if _, ok := tce.deferred[f]; ok {
+			// Error result must be added to the enclosing function. Adding it to the function literal
+			// does not make sense since its results are ignored by defer statement
+			return nil
+		}
+		ty, body = f.Type, f.Body
+	case *ast.FuncDecl:
+		ty, body = f.Type, f.Body
+	}
+	if ty == nil || body == nil {
+		return nil
+	}
+
+	edits := []*TextEdit{}
+	if ty.Results == nil {
+		edits = append(edits, tce.insertEdit(ty.Params.End(), " error"))
+	} else {
+		// Empty result list like `func f() () {`
+		edits = append(edits, tce.replaceEdit(ty.Results.Pos(), ty.Results.End(), "error"))
+	}
+
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			if len(node.Results) == 0 {
+				edits = append(edits, tce.replaceEdit(node.Pos(), node.End(), "return nil"))
+			}
+		}
+		return true
+	})
+
+	if len(body.List) == 0 {
+		edits = append(edits, tce.insertEdit(body.Rbrace, " return nil "))
+	} else if _, ok := body.List[len(body.List)-1].(*ast.ReturnStmt); !ok {
+		if tce.fileset.Position(body.Lbrace).Line == tce.fileset.Position(body.Rbrace).Line {
+			edits = append(edits, tce.insertEdit(body.Rbrace, "; return nil "))
+		} else {
+			// Insert after indentation of the line of '}'
+			edits = append(edits, tce.insertEdit(body.Rbrace, "\treturn nil\n"+tce.indentAt(body.Rbrace)))
+		}
+	}
+
+	return []*SuggestedFix{{Message: "Add error to the result list", Edits: edits}}
+}
+
+// unusedName returns a variable name which is not used in current function.
+func (tce *tryCallElimination) unusedName(base string) string {
+	used := map[string]struct{}{}
+	ast.Inspect(tce.funcs[0], func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			used[ident.Name] = struct{}{}
+		}
+		return true
+	})
+	name := base
+	for i := 1; ; i++ {
+		if _, ok := used[name]; !ok {
+			return name
+		}
+		name = base + strconv.Itoa(i)
+	}
+}
+
+// hoistCallFixes returns a fix to hoist the pseudo-function call in a condition of if statement or in a
+// tag of switch statement into a separate assignment before the statement. The call is hoisted only when
+// it is always evaluated once. It returns nil when the call cannot be hoisted.
+func (tce *tryCallElimination) hoistCallFixes(call *ast.CallExpr) []*SuggestedFix {
+	if len(tce.funcs) == 0 {
+		return nil
+	}
+
+	// Find the statement at toplevel of block which contains the call
+	blk := -1
+	for i, n := range tce.parents {
+		switch n.(type) {
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			blk = i
+		}
+	}
+	if blk < 0 || blk+1 >= len(tce.parents) {
+		return nil
+	}
+	stmt := tce.parents[blk+1]
+
+	var cond ast.Expr
+	switch s := stmt.(type) {
+	case *ast.IfStmt:
+		if s.Init == nil {
+			cond = s.Cond
+		}
+	case *ast.SwitchStmt:
+		if s.Init == nil {
+			cond = s.Tag
+		}
+	}
+	if cond == nil || call.Pos() < cond.Pos() || cond.End() < call.End() {
+		return nil
+	}
+	for _, n := range tce.parents[blk+2:] {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return nil
+		case *ast.BinaryExpr:
+			if (n.Op == token.LAND || n.Op == token.LOR) && n.Y.Pos() <= call.Pos() {
+				// Right operand may not be evaluated
+				return nil
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, tce.fileset, call); err != nil {
+		return nil
+	}
+	name := tce.unusedName("v")
+	edits := []*TextEdit{
+		tce.insertEdit(stmt.Pos(), fmt.Sprintf("%s := %s\n%s", name, b.String(), tce.indentAt(stmt.Pos()))),
+		tce.replaceEdit(call.Pos(), call.End(), name),
+	}
+	msg := fmt.Sprintf("Hoist %s() call into a separate statement", call.Fun.(*ast.Ident).Name)
+	return []*SuggestedFix{{Message: msg, Edits: edits}}
+}
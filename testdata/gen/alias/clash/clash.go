@@ -0,0 +1,11 @@
+package clash
+
+import (
+	"github.com/rhysd/trygo/testdata/gen/alias/lib"
+	"github.com/rhysd/trygo/testdata/gen/alias/util"
+)
+
+func Run() error {
+	try(lib.Mkdir())
+	return util.Check()
+}
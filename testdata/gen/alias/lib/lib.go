@@ -0,0 +1,10 @@
+package lib
+
+import (
+	"os"
+)
+
+func Mkdir() error {
+	try(os.Mkdir("lib", 0755))
+	return nil
+}
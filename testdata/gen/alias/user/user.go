@@ -0,0 +1,10 @@
+package user
+
+import (
+	"github.com/rhysd/trygo/testdata/gen/alias/lib"
+)
+
+func Run() error {
+	try(lib.Mkdir())
+	return nil
+}
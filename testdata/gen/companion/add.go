@@ -0,0 +1,12 @@
+package companion
+
+import (
+	"strconv"
+)
+
+func add(a, b int) int
+
+func Add(s string) (int, error) {
+	i := try(strconv.Atoi(s))
+	return add(i, 1), nil
+}
@@ -0,0 +1,17 @@
+package embed
+
+import (
+	"embed"
+	"strconv"
+)
+
+//go:embed hello.txt
+var hello string
+
+//go:embed "static/*.txt" `static/sub`
+var static embed.FS
+
+func Parse() (int, error) {
+	i := try(strconv.Atoi(hello))
+	return i, nil
+}
@@ -0,0 +1,11 @@
+package files
+
+import (
+	"os"
+)
+
+func ReadA(path string) ([]byte, error) {
+	f := try(os.Open(path))
+	defer f.Close()
+	return readAll(f)
+}
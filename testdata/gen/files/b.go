@@ -0,0 +1,11 @@
+package files
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+func readAll(r io.Reader) ([]byte, error) {
+	b := try(ioutil.ReadAll(r))
+	return b, nil
+}
@@ -0,0 +1,10 @@
+package gen
+
+import (
+	"os"
+)
+
+func A() error {
+	try(os.Mkdir("a", 0755))
+	return nil
+}
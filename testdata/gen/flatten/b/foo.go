@@ -0,0 +1,10 @@
+package gen
+
+import (
+	"os"
+)
+
+func B() error {
+	try(os.Mkdir("b", 0755))
+	return nil
+}
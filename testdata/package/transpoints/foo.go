@@ -0,0 +1,20 @@
+package foo
+
+import (
+	"os"
+	"strconv"
+)
+
+var _ = func() error {
+	try(os.Chdir("/"))
+	return nil
+}
+
+func f(s string) (int, error) {
+	var i = try(strconv.Atoi(s))
+	j := try(strconv.Atoi(s))
+	i += try(strconv.Atoi(s))
+	i += j
+	try(os.Chdir(s))
+	return i, nil
+}
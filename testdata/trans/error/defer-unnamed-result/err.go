@@ -0,0 +1,12 @@
+package foo
+
+import (
+	"fmt"
+)
+
+func f() error {
+	defer func() {
+		try(fmt.Println("bye"))
+	}()
+	return nil
+}
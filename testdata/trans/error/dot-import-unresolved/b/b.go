@@ -0,0 +1,9 @@
+package b
+
+import (
+	. "github.com/rhysd/trygo/testdata/trans/error/dot-import-unresolved/a"
+)
+
+func Bar() (int, error) {
+	return Missing()
+}
@@ -0,0 +1,16 @@
+package foo
+
+import (
+	"fmt"
+)
+
+type MyError struct{}
+
+func (err *MyError) Error() string {
+	return "my error"
+}
+
+func f() (int, *MyError) {
+	n := try(fmt.Println("hello"))
+	return n, nil
+}
@@ -0,0 +1,10 @@
+package foo
+
+func f() (int, int) {
+	return 4, 2
+}
+
+func g() {
+	n := expect(f())
+	println(n)
+}
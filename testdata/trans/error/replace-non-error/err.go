@@ -0,0 +1,10 @@
+package foo
+
+import (
+	"os"
+)
+
+func f() error {
+	try(os.Chdir("foo"), "not error")
+	return nil
+}
@@ -0,0 +1,7 @@
+package foo
+
+func f() error {
+	n := 42
+	throw(n)
+	return nil
+}
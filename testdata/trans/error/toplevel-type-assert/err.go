@@ -0,0 +1,6 @@
+package foo
+
+func f(x interface{}) error {
+	try(x.(int))
+	return nil
+}
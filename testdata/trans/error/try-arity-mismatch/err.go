@@ -0,0 +1,10 @@
+package foo
+
+func f() (int, int, error) {
+	return 1, 2, nil
+}
+
+func g() (int, error) {
+	a, b, c := try(f())
+	return a + b + c, nil
+}
@@ -0,0 +1,10 @@
+package foo
+
+func g() error {
+	return nil
+}
+
+func h() (int, error) {
+	d := try(g())
+	return d, nil
+}
@@ -0,0 +1,8 @@
+package foo
+
+import "strconv"
+
+func f(s string) (bool, error) {
+	b := s != "" && try(strconv.ParseBool(s))
+	return b, nil
+}
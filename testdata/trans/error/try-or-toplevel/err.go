@@ -0,0 +1,9 @@
+package foo
+
+import (
+	"strconv"
+)
+
+func f() {
+	tryOr(strconv.Atoi("42"), 0)
+}
@@ -0,0 +1,11 @@
+package foo
+
+import (
+	"os"
+)
+
+func f() error {
+	n := try(os.Chdir("foo"))
+	println(n)
+	return nil
+}
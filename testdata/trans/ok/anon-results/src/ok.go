@@ -0,0 +1,43 @@
+package foo
+
+import (
+	b "bytes"
+	"io"
+	"strconv"
+)
+
+type S struct {
+	x int
+}
+
+func Struct(s string) (struct {
+	A int `json:"a"`
+	b.Buffer
+	N struct{ X int }
+}, error) {
+	try(strconv.Atoi(s))
+	panic("unreachable")
+}
+
+func Array(s string) ([2]struct{ s S }, struct{}, error) {
+	try(strconv.Atoi(s))
+	panic("unreachable")
+}
+
+func Interface(s string) (interface {
+	io.Reader
+	M() int
+}, interface{}, error) {
+	try(strconv.Atoi(s))
+	panic("unreachable")
+}
+
+func Chan(s string) (chan struct{ x int }, <-chan S, chan<- struct{}, error) {
+	try(strconv.Atoi(s))
+	panic("unreachable")
+}
+
+func Others(s string) (*struct{}, []struct{}, map[string]struct{}, func() struct{}, error) {
+	try(strconv.Atoi(s))
+	panic("unreachable")
+}
@@ -0,0 +1,57 @@
+package foo
+
+import (
+	b "bytes"
+	"io"
+	"strconv"
+)
+
+type S struct {
+	x int
+}
+
+func Struct(s string) (struct {
+	A int `json:"a"`
+	b.Buffer
+	N struct{ X int }
+}, error) {
+	if _, err := strconv.Atoi(s); err != nil {
+		return struct {
+			A int `json:"a"`
+			b.Buffer
+			N struct{ X int }
+		}{}, err
+	}
+	panic("unreachable")
+}
+
+func Array(s string) ([2]struct{ s S }, struct{}, error) {
+	if _, err := strconv.Atoi(s); err != nil {
+		return [2]struct{ s S }{}, struct{}{}, err
+	}
+	panic("unreachable")
+}
+
+func Interface(s string) (interface {
+	io.Reader
+	M() int
+}, interface{}, error) {
+	if _, err := strconv.Atoi(s); err != nil {
+		return nil, nil, err
+	}
+	panic("unreachable")
+}
+
+func Chan(s string) (chan struct{ x int }, <-chan S, chan<- struct{}, error) {
+	if _, err := strconv.Atoi(s); err != nil {
+		return nil, nil, nil, err
+	}
+	panic("unreachable")
+}
+
+func Others(s string) (*struct{}, []struct{}, map[string]struct{}, func() struct{}, error) {
+	if _, err := strconv.Atoi(s); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,41 @@
+package main
+
+/*
+#include <stdio.h>
+#include <stdlib.h>
+
+static int add(int a, int b) {
+    return a + b;
+}
+
+static void hello() {
+    puts("hello");
+}
+*/
+import "C"
+
+import (
+	"fmt"
+)
+
+func f() (int, error) {
+	n := try(fmt.Println("hello"))
+	return int(C.add(C.int(n), 1)), nil
+}
+
+func g() (C.int, error) {
+	n := try(fmt.Println("hello"))
+	return C.int(n), nil
+}
+
+func h() (int, error) {
+	n := try(C.add(1, 2))
+	try(C.hello())
+	return int(n), nil
+}
+
+func main() {
+	f()
+	g()
+	h()
+}
@@ -0,0 +1,52 @@
+package main
+
+/*
+#include <stdio.h>
+#include <stdlib.h>
+
+static int add(int a, int b) {
+    return a + b;
+}
+
+static void hello() {
+    puts("hello");
+}
+*/
+import "C"
+
+import (
+	"fmt"
+)
+
+func f() (int, error) {
+	n, _err0 := fmt.Println("hello")
+	if _err0 != nil {
+		return 0, _err0
+	}
+	return int(C.add(C.int(n), 1)), nil
+}
+
+func g() (C.int, error) {
+	n, _err0 := fmt.Println("hello")
+	if _err0 != nil {
+		return *new(C.int), _err0
+	}
+	return C.int(n), nil
+}
+
+func h() (int, error) {
+	n, _err0 := C.add(1, 2)
+	if _err0 != nil {
+		return 0, _err0
+	}
+	if _, err := C.hello(); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func main() {
+	f()
+	g()
+	h()
+}
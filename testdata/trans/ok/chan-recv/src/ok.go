@@ -0,0 +1,22 @@
+package main
+
+func sum(ch <-chan int) (int, error) {
+	total := 0
+	for {
+		var i int
+		i = try(<-ch)
+		total = total + i
+		if total > 100 {
+			break
+		}
+	}
+	first := try(<-ch)
+	return total + first, nil
+}
+
+func drain(ch chan string) {
+	for {
+		s := ok(<-ch)
+		println(s)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+func sum(ch <-chan int) (int, error) {
+	total := 0
+	for {
+		var i int
+		var _ok0 bool
+		i, _ok0 = <-ch
+		if !_ok0 {
+			return 0, fmt.Errorf("receive from closed channel")
+		}
+		total = total + i
+		if total > 100 {
+			break
+		}
+	}
+	first, _ok0 := <-ch
+	if !_ok0 {
+		return 0, fmt.Errorf("receive from closed channel")
+	}
+	return total + first, nil
+}
+
+func drain(ch chan string) {
+	for {
+		s, _ok0 := <-ch
+		if !_ok0 {
+			return
+		}
+		println(s)
+	}
+}
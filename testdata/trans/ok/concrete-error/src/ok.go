@@ -0,0 +1,36 @@
+package main
+
+type MyError struct {
+	msg string
+}
+
+func (err *MyError) Error() string {
+	return err.msg
+}
+
+func parse(s string) (int, *MyError) {
+	if s == "" {
+		return 0, &MyError{"empty"}
+	}
+	return len(s), nil
+}
+
+func validate(s string) *MyError {
+	if s == "" {
+		return &MyError{"empty"}
+	}
+	return nil
+}
+
+func f(s string) (int, *MyError) {
+	n := try(parse(s))
+	try(validate(s))
+	return n, nil
+}
+
+func g(s string) (int, error) {
+	var n int
+	n = try(parse(s))
+	try(validate(s))
+	return n, nil
+}
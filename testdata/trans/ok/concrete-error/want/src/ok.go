@@ -0,0 +1,47 @@
+package main
+
+type MyError struct {
+	msg string
+}
+
+func (err *MyError) Error() string {
+	return err.msg
+}
+
+func parse(s string) (int, *MyError) {
+	if s == "" {
+		return 0, &MyError{"empty"}
+	}
+	return len(s), nil
+}
+
+func validate(s string) *MyError {
+	if s == "" {
+		return &MyError{"empty"}
+	}
+	return nil
+}
+
+func f(s string) (int, *MyError) {
+	n, _err0 := parse(s)
+	if _err0 != nil {
+		return 0, _err0
+	}
+	if err := validate(s); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func g(s string) (int, error) {
+	var n int
+	var _err0 *MyError
+	n, _err0 = parse(s)
+	if _err0 != nil {
+		return 0, _err0
+	}
+	if err := validate(s); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
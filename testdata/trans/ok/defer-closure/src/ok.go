@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func f(path string) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		try(file.Close())
+	}()
+	_, err = fmt.Fprintln(file, "hello")
+	return
+}
+
+func g() (n int, e error) {
+	defer func() {
+		i := try(fmt.Println("bye"))
+		n = n + i
+	}()
+	n = try(fmt.Println("hello"))
+	return
+}
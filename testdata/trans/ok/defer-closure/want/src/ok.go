@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func f(path string) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _err0 := file.Close(); _err0 != nil {
+			if err == nil {
+				err = _err0
+			}
+			return
+		}
+	}()
+	_, err = fmt.Fprintln(file, "hello")
+	return
+}
+
+func g() (n int, e error) {
+	defer func() {
+		i, _err0 := fmt.Println("bye")
+		if _err0 != nil {
+			if e == nil {
+				e = _err0
+			}
+			return
+		}
+		n = n + i
+	}()
+	var _err0 error
+	n, _err0 = fmt.Println("hello")
+	if _err0 != nil {
+		return 0, _err0
+	}
+	return
+}
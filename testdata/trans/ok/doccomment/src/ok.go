@@ -0,0 +1,55 @@
+// Package main is a test for doc comments.
+package main
+
+import (
+	"fmt"
+)
+
+// S is a struct.
+type S struct {
+	// i is a field.
+	i int
+}
+
+// f calls try() at toplevel of function body.
+func f() (int, error) {
+	// Print hello
+	n := try(fmt.Println("hello"))
+	try(fmt.Println("world"))
+	return n, nil
+}
+
+// v is a variable.
+var v = 42
+
+// i calls try() in assignment.
+func i() (n int, err error) {
+	// Assign
+	n = try(fmt.Println("hello")) // trailing comment
+	return
+}
+
+// g calls try() in value spec.
+func g() (int, error) {
+	var n = try(fmt.Println("hello")) // trailing comment
+	return n, nil
+}
+
+/*
+h calls try() in nested blocks.
+*/
+func h() (int, error) {
+	if true {
+		// Nested
+		try(fmt.Println("nested"))
+	}
+	return 0, nil
+}
+
+// main is an entrypoint.
+func main() {
+	f()
+	g()
+	h()
+	i()
+}
@@ -0,0 +1,69 @@
+// Package main is a test for doc comments.
+package main
+
+import (
+	"fmt"
+)
+
+// S is a struct.
+type S struct {
+	// i is a field.
+	i int
+}
+
+// f calls try() at toplevel of function body.
+func f() (int, error) {
+	// Print hello
+	n, _err0 := fmt.Println("hello")
+	if _err0 != nil {
+		return 0, _err0
+	}
+	if _, err := fmt.Println("world"); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// v is a variable.
+var v = 42
+
+// i calls try() in assignment.
+func i() (n int, err error) {
+	// Assign
+	var _err0 error
+	n, _err0 = fmt.Println("hello") // trailing comment
+	if _err0 != nil {
+		return 0, _err0
+	}
+	return
+}
+
+// g calls try() in value spec.
+func g() (int, error) {
+	var n, _err0 = fmt.Println("hello") // trailing comment
+	if _err0 != nil {
+		return 0, _err0
+	}
+	return n, nil
+}
+
+/*
+h calls try() in nested blocks.
+*/
+func h() (int, error) {
+	if true {
+		// Nested
+		if _, err := fmt.Println("nested"); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// main is an entrypoint.
+func main() {
+	f()
+	g()
+	h()
+	i()
+}
@@ -0,0 +1,5 @@
+package c
+
+func Baz() int {
+	return 42
+}
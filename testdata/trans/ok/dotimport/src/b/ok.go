@@ -0,0 +1,12 @@
+package b
+
+import (
+	"github.com/rhysd/trygo/testdata/trans/ok/dotimport/go-c"
+	. "github.com/rhysd/trygo/testdata/trans/ok/dotimport/src/a"
+	_ "github.com/rhysd/trygo/testdata/trans/ok/dotimport/src/a"
+)
+
+func Bar() (int, error) {
+	n := try(Foo())
+	return n + c.Baz(), nil
+}
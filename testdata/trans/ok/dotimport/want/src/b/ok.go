@@ -0,0 +1,15 @@
+package b
+
+import (
+	"github.com/rhysd/trygo/testdata/trans/ok/dotimport/go-c"
+	. "github.com/rhysd/trygo/testdata/trans/ok/dotimport/want/src/a"
+	_ "github.com/rhysd/trygo/testdata/trans/ok/dotimport/want/src/a"
+)
+
+func Bar() (int, error) {
+	n, _err0 := Foo()
+	if _err0 != nil {
+		return 0, _err0
+	}
+	return n + c.Baz(), nil
+}
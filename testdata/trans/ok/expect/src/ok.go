@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func cleanup(f *os.File) {
+	expect(f.Close())
+	n := expect(fmt.Println("closed"))
+	var m int
+	m = expect(fmt.Println("closed", n))
+	println(m)
+}
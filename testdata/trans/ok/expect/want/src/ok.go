@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func cleanup(f *os.File) {
+	if err := f.Close(); err != nil {
+		log.Printf("ok.go:9: %v", err)
+	}
+	n, _err0 := fmt.Println("closed")
+	if _err0 != nil {
+		log.Printf("ok.go:10: %v", _err0)
+	}
+	var m int
+	var _err1 error
+	m, _err1 = fmt.Println("closed", n)
+	if _err1 != nil {
+		log.Printf("ok.go:12: %v", _err1)
+	}
+	println(m)
+}
@@ -0,0 +1,34 @@
+package foo
+
+import (
+	"strconv"
+)
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+type Number interface {
+	~int | ~float64
+}
+
+func Parse[T any](s string, f func(int) T) (T, error) {
+	i := try(strconv.Atoi(s))
+	return f(i), nil
+}
+
+func Sum[N Number](ss []string, conv func(int) N) (N, error) {
+	var sum N
+	for _, s := range ss {
+		i := try(strconv.Atoi(s))
+		sum = sum + conv(i)
+	}
+	return sum, nil
+}
+
+func MakePair[K comparable, V any](k K, s string, f func(int) V) (Pair[K, V], *V, error) {
+	i := try(strconv.Atoi(s))
+	v := f(i)
+	return Pair[K, V]{k, v}, &v, nil
+}
@@ -0,0 +1,43 @@
+package foo
+
+import (
+	"strconv"
+)
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+type Number interface {
+	~int | ~float64
+}
+
+func Parse[T any](s string, f func(int) T) (T, error) {
+	i, _err0 := strconv.Atoi(s)
+	if _err0 != nil {
+		return *new(T), _err0
+	}
+	return f(i), nil
+}
+
+func Sum[N Number](ss []string, conv func(int) N) (N, error) {
+	var sum N
+	for _, s := range ss {
+		i, _err0 := strconv.Atoi(s)
+		if _err0 != nil {
+			return *new(N), _err0
+		}
+		sum = sum + conv(i)
+	}
+	return sum, nil
+}
+
+func MakePair[K comparable, V any](k K, s string, f func(int) V) (Pair[K, V], *V, error) {
+	i, _err0 := strconv.Atoi(s)
+	if _err0 != nil {
+		return Pair[K, V]{}, nil, _err0
+	}
+	v := f(i)
+	return Pair[K, V]{k, v}, &v, nil
+}
@@ -0,0 +1,29 @@
+package foo
+
+import (
+	"strconv"
+)
+
+type S struct{}
+
+type T struct {
+	i int
+}
+
+func Grouped(s string) (a S, b, c T, n, m int, err error) {
+	try(strconv.Atoi(s))
+	return
+}
+
+func GroupedWithError(s string) (x, y S, e1, e2 error) {
+	i := try(strconv.Atoi(s))
+	_ = i
+	return S{}, S{}, nil, strconv.ErrRange
+}
+
+func GroupedDeferred(s string) (x, y T, e1, e2 error) {
+	defer func() {
+		try(strconv.Atoi(s))
+	}()
+	return
+}
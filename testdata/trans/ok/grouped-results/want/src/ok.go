@@ -0,0 +1,39 @@
+package foo
+
+import (
+	"strconv"
+)
+
+type S struct{}
+
+type T struct {
+	i int
+}
+
+func Grouped(s string) (a S, b, c T, n, m int, err error) {
+	if _, err := strconv.Atoi(s); err != nil {
+		return S{}, T{}, T{}, 0, 0, err
+	}
+	return
+}
+
+func GroupedWithError(s string) (x, y S, e1, e2 error) {
+	i, _err0 := strconv.Atoi(s)
+	if _err0 != nil {
+		return S{}, S{}, nil, _err0
+	}
+	_ = i
+	return S{}, S{}, nil, strconv.ErrRange
+}
+
+func GroupedDeferred(s string) (x, y T, e1, e2 error) {
+	defer func() {
+		if _, _err0 := strconv.Atoi(s); _err0 != nil {
+			if e2 == nil {
+				e2 = _err0
+			}
+			return
+		}
+	}()
+	return
+}
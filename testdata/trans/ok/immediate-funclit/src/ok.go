@@ -0,0 +1,18 @@
+package foo
+
+import "strconv"
+
+func f(s string) (int, error) {
+	n := try(func() (int, error) {
+		m := try(strconv.Atoi(s))
+		return m * 2, nil
+	}())
+	total := try(strconv.Atoi(s)) + try(func() (int, error) {
+		return strconv.Atoi(s + "0")
+	}())
+	try(func() error {
+		_ = try(strconv.Atoi(s))
+		return nil
+	}())
+	return n + total, nil
+}
@@ -0,0 +1,39 @@
+package foo
+
+import "strconv"
+
+func f(s string) (int, error) {
+	n, _err0 := func() (int, error) {
+		m, _err0 := strconv.Atoi(s)
+		if _err0 != nil {
+			return 0, _err0
+		}
+		return m * 2, nil
+	}()
+	if _err0 != nil {
+		return 0, _err0
+	}
+	_0, _err1 := strconv.Atoi(s)
+	if _err1 != nil {
+		return 0, _err1
+	}
+	_1, _err2 := func() (int, error) {
+		return strconv.Atoi(s + "0")
+	}()
+	if _err2 != nil {
+		return 0, _err2
+	}
+	total := _0 + _1
+
+	if err := func() error {
+		var _err0 error
+		_, _err0 = strconv.Atoi(s)
+		if _err0 != nil {
+			return _err0
+		}
+		return nil
+	}(); err != nil {
+		return 0, err
+	}
+	return n + total, nil
+}
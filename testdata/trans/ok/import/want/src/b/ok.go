@@ -1,7 +1,7 @@
 package b
 
 import (
-	"github.com/rhysd/trygo/testdata/trans/ok/import/want/src"
+	root "github.com/rhysd/trygo/testdata/trans/ok/import/want/src"
 	"github.com/rhysd/trygo/testdata/trans/ok/import/want/src/a"
 )
 
@@ -0,0 +1,10 @@
+package foo // import "github.com/rhysd/trygo/testdata/trans/ok/importcomment/src"
+
+import (
+	"fmt"
+)
+
+func Foo() (int, error) {
+	n := try(fmt.Println("hello"))
+	return n, nil
+}
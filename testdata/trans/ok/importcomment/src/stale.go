@@ -0,0 +1,3 @@
+package foo /* import "example.com/stale" */
+
+func bar() {}
@@ -0,0 +1,13 @@
+package foo // import "github.com/rhysd/trygo/testdata/trans/ok/importcomment/want/src"
+
+import (
+	"fmt"
+)
+
+func Foo() (int, error) {
+	n, _err0 := fmt.Println("hello")
+	if _err0 != nil {
+		return 0, _err0
+	}
+	return n, nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+)
+
+var users = map[string]int{"alice": 1}
+
+func id(name string) (int, error) {
+	i := try(users[name])
+	var j int
+	j = try(users[strings.ToLower(name)])
+	var k = try(users["bob"])
+	return i + j + k, nil
+}
+
+func has(m map[int]string) {
+	s := ok(m[42])
+	println(s)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var users = map[string]int{"alice": 1}
+
+func id(name string) (int, error) {
+	i, _ok0 := users[name]
+	if !_ok0 {
+		return 0, fmt.Errorf("key %v not found in map", name)
+	}
+	var j int
+	var _ok1 bool
+	j, _ok1 = users[strings.ToLower(name)]
+	if !_ok1 {
+		return 0, fmt.Errorf("key not found in map")
+	}
+	var k, _ok2 = users["bob"]
+	if !_ok2 {
+		return 0, fmt.Errorf("key %v not found in map", "bob")
+	}
+	return i + j + k, nil
+}
+
+func has(m map[int]string) {
+	s, _ok0 := m[42]
+	if !_ok0 {
+		return
+	}
+	println(s)
+}
@@ -0,0 +1,26 @@
+package foo
+
+import (
+	"os"
+	"strconv"
+)
+
+func parse(s, t string) (int, int, error) {
+	x, y := try(strconv.Atoi(s)), try(strconv.Atoi(t))
+	x, y = try(strconv.Atoi(t)), x
+	var n, m = 1, try(strconv.Atoi(s))
+	return x + n, y + m, nil
+}
+
+func env(k1, k2 string) (string, string, error) {
+	v1, v2 := try(lookup(k1)), try(lookup(k2))
+	return v1, v2, nil
+}
+
+func lookup(k string) (string, error) {
+	v, ok := os.LookupEnv(k)
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return v, nil
+}
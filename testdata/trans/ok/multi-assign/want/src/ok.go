@@ -0,0 +1,50 @@
+package foo
+
+import (
+	"os"
+	"strconv"
+)
+
+func parse(s, t string) (int, int, error) {
+	_0, _err0 := strconv.Atoi(s)
+	if _err0 != nil {
+		return 0, 0, _err0
+	}
+	_1, _err1 := strconv.Atoi(t)
+	if _err1 != nil {
+		return 0, 0, _err1
+	}
+	x, y := _0, _1
+	_2, _err2 := strconv.Atoi(t)
+	if _err2 != nil {
+		return 0, 0, _err2
+	}
+	x, y = _2, x
+	_3, _err3 := strconv.Atoi(s)
+	if _err3 != nil {
+		return 0, 0, _err3
+	}
+	var n, m = 1, _3
+	return x + n, y + m, nil
+}
+
+func env(k1, k2 string) (string, string, error) {
+	_0, _err0 := lookup(k1)
+	if _err0 != nil {
+		return "", "", _err0
+	}
+	_1, _err1 := lookup(k2)
+	if _err1 != nil {
+		return "", "", _err1
+	}
+	v1, v2 := _0, _1
+	return v1, v2, nil
+}
+
+func lookup(k string) (string, error) {
+	v, ok := os.LookupEnv(k)
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return v, nil
+}
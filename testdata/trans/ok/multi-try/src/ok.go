@@ -0,0 +1,25 @@
+package foo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func get() int {
+	return 1
+}
+
+func sum(s, t string) (int, error) {
+	total := try(strconv.Atoi(s)) + try(strconv.Atoi(t))
+	fmt.Println(try(strconv.Atoi(s)), try(strconv.Atoi(t)))
+	n := get() * try(strconv.Atoi(s)) + len(t)
+	total += try(strconv.Atoi(s)) * try(strconv.Atoi(t))
+	x := try(strconv.Atoi(strconv.Itoa(try(strconv.Atoi(s)))))
+	var a, b = try(strconv.Atoi(s)), try(strconv.Atoi(t))
+	ch := make(chan int, 1)
+	ch <- try(strconv.Atoi(s))
+	if n > 0 {
+		return total + try(strconv.Atoi(t)), nil
+	}
+	return total + n + x + a + b + <-ch, nil
+}
@@ -0,0 +1,78 @@
+package foo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func get() int {
+	return 1
+}
+
+func sum(s, t string) (int, error) {
+	_0, _err0 := strconv.Atoi(s)
+	if _err0 != nil {
+		return 0, _err0
+	}
+	_1, _err1 := strconv.Atoi(t)
+	if _err1 != nil {
+		return 0, _err1
+	}
+	total := _0 + _1
+	_2, _err2 := strconv.Atoi(s)
+	if _err2 != nil {
+		return 0, _err2
+	}
+	_3, _err3 := strconv.Atoi(t)
+	if _err3 != nil {
+		return 0, _err3
+	}
+	fmt.Println(_2, _3)
+	_4 := get()
+	_5, _err4 := strconv.Atoi(s)
+	if _err4 != nil {
+		return 0, _err4
+	}
+	n := _4*_5 + len(t)
+	_6, _err5 := strconv.Atoi(s)
+	if _err5 != nil {
+		return 0, _err5
+	}
+	_7, _err6 := strconv.Atoi(t)
+	if _err6 != nil {
+		return 0, _err6
+	}
+	_8 := _6 * _7
+	total += _8
+	_9, _err7 := strconv.Atoi(s)
+	if _err7 != nil {
+		return 0, _err7
+	}
+	x, _err8 := strconv.Atoi(strconv.Itoa(_9))
+	if _err8 != nil {
+		return 0, _err8
+	}
+	_10, _err9 := strconv.Atoi(s)
+	if _err9 != nil {
+		return 0, _err9
+	}
+	_11, _err10 := strconv.Atoi(t)
+	if _err10 != nil {
+		return 0, _err10
+	}
+	var a, b = _10, _11
+	ch := make(chan int, 1)
+	_12, _err11 := strconv.Atoi(s)
+	if _err11 != nil {
+		return 0, _err11
+	}
+	ch <- _12
+	if n > 0 {
+		_0, _err0 := strconv.Atoi(t)
+		if _err0 != nil {
+			return 0, _err0
+		}
+		return total + _0, nil
+	}
+	return total + n + x + a + b + <-ch, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+)
+
+type cache map[string]int
+
+func (c cache) get(k string) (int, bool) {
+	v, ok := c[k]
+	return v, ok
+}
+
+func f(c cache) (string, int) {
+	home := ok(os.LookupEnv("HOME"))
+	var v int
+	v = ok(c.get(home))
+	ok(c.get("foo"))
+	return home, v
+}
+
+func g(c cache) {
+	var v, _ = c.get("foo")
+	ok(c.get("bar"))
+	println(v)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+)
+
+type cache map[string]int
+
+func (c cache) get(k string) (int, bool) {
+	v, ok := c[k]
+	return v, ok
+}
+
+func f(c cache) (string, int) {
+	home, _ok0 := os.LookupEnv("HOME")
+	if !_ok0 {
+		return "", 0
+	}
+	var v int
+	var _ok1 bool
+	v, _ok1 = c.get(home)
+	if !_ok1 {
+		return "", 0
+	}
+	if _, ok := c.get("foo"); !ok {
+		return "", 0
+	}
+	return home, v
+}
+
+func g(c cache) {
+	var v, _ = c.get("foo")
+	if _, ok := c.get("bar"); !ok {
+		return
+	}
+	println(v)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+)
+
+type S struct {
+	i int
+}
+
+func f() (S, struct{ s string }, [2]int, error) {
+	if true {
+		try(fmt.Println("nested"))
+	}
+	n := try(fmt.Println(
+		"multi",
+		"line",
+	))
+	var i int
+	i = try(fmt.Println("assign"))
+	i += try(fmt.Println("compound"))
+	fmt.Println(n, i)
+	return S{}, struct{ s string }{}, [2]int{}, nil
+}
+
+func main() {
+	f()
+}
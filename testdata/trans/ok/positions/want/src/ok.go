@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+)
+
+type S struct {
+	i int
+}
+
+func f() (S, struct{ s string }, [2]int, error) {
+	if true {
+		if _, err := fmt.Println("nested"); err != nil {
+			return S{}, struct{ s string }{}, [2]int{}, err
+		}
+	}
+	n, _err0 := fmt.Println(
+		"multi",
+		"line",
+	)
+	if _err0 != nil {
+		return S{}, struct{ s string }{}, [2]int{}, _err0
+	}
+	var i int
+	var _err1 error
+	i, _err1 = fmt.Println("assign")
+	if _err1 != nil {
+		return S{}, struct{ s string }{}, [2]int{}, _err1
+	}
+	_0, _err2 := fmt.Println("compound")
+	if _err2 != nil {
+		return S{}, struct{ s string }{}, [2]int{}, _err2
+	}
+	i += _0
+	fmt.Println(n, i)
+	return S{}, struct{ s string }{}, [2]int{}, nil
+}
+
+func main() {
+	f()
+}
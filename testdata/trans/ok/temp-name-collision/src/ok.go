@@ -0,0 +1,13 @@
+package foo
+
+import (
+	"strconv"
+)
+
+var _1 = 10
+
+func sum(s string) (int, error) {
+	_0 := 5
+	y := try(strconv.Atoi(s)) + try(strconv.Atoi(s))
+	return _0 + _1 + y, nil
+}
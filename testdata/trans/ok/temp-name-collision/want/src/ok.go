@@ -0,0 +1,21 @@
+package foo
+
+import (
+	"strconv"
+)
+
+var _1 = 10
+
+func sum(s string) (int, error) {
+	_0 := 5
+	_2, _err0 := strconv.Atoi(s)
+	if _err0 != nil {
+		return 0, _err0
+	}
+	_3, _err1 := strconv.Atoi(s)
+	if _err1 != nil {
+		return 0, _err1
+	}
+	y := _2 + _3
+	return _0 + _1 + y, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+type MyError struct{}
+
+func (e *MyError) Error() string {
+	return "my error"
+}
+
+type result struct {
+	err error
+}
+
+func validate(n int) error {
+	if n < 0 {
+		return errors.New("negative")
+	}
+	return nil
+}
+
+func check(n int) (int, error) {
+	err := validate(n)
+	// Variable is checked directly
+	throw(err)
+	r := result{validate(n + 1)}
+	throw(r.err)
+	throw(validate(n + 2))
+	return n, nil
+}
+
+func checkConcrete(e *MyError) *MyError {
+	throw(e)
+	return nil
+}
+
+func deferred(n int) (err error) {
+	defer func() {
+		throw(validate(n))
+		fmt.Println("ok")
+	}()
+	return nil
+}
+
+func main() {
+	n, err := check(42)
+	fmt.Println(n, err, checkConcrete(nil), deferred(1))
+}
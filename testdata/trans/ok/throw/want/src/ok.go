@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+type MyError struct{}
+
+func (e *MyError) Error() string {
+	return "my error"
+}
+
+type result struct {
+	err error
+}
+
+func validate(n int) error {
+	if n < 0 {
+		return errors.New("negative")
+	}
+	return nil
+}
+
+func check(n int) (int, error) {
+	err := validate(n)
+	// Variable is checked directly
+	if err != nil {
+		return 0, err
+	}
+	r := result{validate(n + 1)}
+	if err := r.err; err != nil {
+		return 0, err
+	}
+	if err := validate(n + 2); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func checkConcrete(e *MyError) *MyError {
+	if e != nil {
+		return e
+	}
+	return nil
+}
+
+func deferred(n int) (err error) {
+	defer func() {
+		if _err0 := validate(n); _err0 != nil {
+			if err == nil {
+				err = _err0
+			}
+			return
+		}
+		fmt.Println("ok")
+	}()
+	return nil
+}
+
+func main() {
+	n, err := check(42)
+	fmt.Println(n, err, checkConcrete(nil), deferred(1))
+}
@@ -0,0 +1,24 @@
+package foo
+
+import (
+	"strconv"
+
+	try "strings"
+)
+
+type retrier struct{}
+
+func (r retrier) try(n int) int {
+	return n
+}
+
+func parse(s string) (int, error) {
+	var r retrier
+	n := try(strconv.Atoi(try.TrimSpace(s)))
+	return r.try(n), nil
+}
+
+func local() int {
+	try := func(n int) int { return n }
+	return try(1)
+}
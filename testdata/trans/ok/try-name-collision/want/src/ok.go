@@ -0,0 +1,27 @@
+package foo
+
+import (
+	"strconv"
+
+	try "strings"
+)
+
+type retrier struct{}
+
+func (r retrier) try(n int) int {
+	return n
+}
+
+func parse(s string) (int, error) {
+	var r retrier
+	n, _err0 := strconv.Atoi(try.TrimSpace(s))
+	if _err0 != nil {
+		return 0, _err0
+	}
+	return r.try(n), nil
+}
+
+func local() int {
+	try := func(n int) int { return n }
+	return try(1)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const defaultPort = 8080
+
+func port() int {
+	n := tryOr(strconv.Atoi(os.Getenv("PORT")), defaultPort)
+	return n
+}
+
+func hostname() string {
+	var h = tryOr(os.Hostname(), "localhost")
+	return h
+}
+
+func config(m map[string]string) (string, int) {
+	var timeout int
+	timeout = tryOr(strconv.Atoi(m["timeout"]), 30)
+	// Comma-ok expression is also available
+	user := tryOr(m["user"], "guest")
+	return user, timeout
+}
+
+func main() {
+	u, t := config(map[string]string{})
+	fmt.Println(port(), hostname(), u, t)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const defaultPort = 8080
+
+func port() int {
+	n, _err0 := strconv.Atoi(os.Getenv("PORT"))
+	if _err0 != nil {
+		n = defaultPort
+	}
+	return n
+}
+
+func hostname() string {
+	var h, _err0 = os.Hostname()
+	if _err0 != nil {
+		h = "localhost"
+	}
+	return h
+}
+
+func config(m map[string]string) (string, int) {
+	var timeout int
+	var _err0 error
+	timeout, _err0 = strconv.Atoi(m["timeout"])
+	if _err0 != nil {
+		timeout = 30
+	}
+	// Comma-ok expression is also available
+	user, _ok1 := m["user"]
+	if !_ok1 {
+		user = "guest"
+	}
+	return user, timeout
+}
+
+func main() {
+	u, t := config(map[string]string{})
+	fmt.Println(port(), hostname(), u, t)
+}
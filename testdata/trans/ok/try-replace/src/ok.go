@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+)
+
+var ErrConfigBroken = errors.New("config is broken")
+
+type ConfigError struct {
+	Line int
+}
+
+func (e *ConfigError) Error() string {
+	return "config error at line " + strconv.Itoa(e.Line)
+}
+
+func readConfig(path string) ([]byte, error) {
+	f := try(os.Open(path), ErrConfigBroken)
+	var b [64]byte
+	n := try(f.Read(b[:]), io.ErrUnexpectedEOF)
+	try(f.Close(), ErrConfigBroken)
+	return b[:n], nil
+}
+
+func parseLine(s string, line int) (int, error) {
+	// Error value can be any expression
+	n := try(strconv.Atoi(s), &ConfigError{line})
+	return n, nil
+}
+
+func lookup(m map[string]int, k string) (int, error) {
+	v := try(m[k], ErrConfigBroken)
+	return v, nil
+}
+
+func main() {
+	readConfig("config.txt")
+	parseLine("42", 1)
+	lookup(map[string]int{}, "foo")
+}
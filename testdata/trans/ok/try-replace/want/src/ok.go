@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+)
+
+var ErrConfigBroken = errors.New("config is broken")
+
+type ConfigError struct {
+	Line int
+}
+
+func (e *ConfigError) Error() string {
+	return "config error at line " + strconv.Itoa(e.Line)
+}
+
+func readConfig(path string) ([]byte, error) {
+	f, _err0 := os.Open(path)
+	if _err0 != nil {
+		return nil, ErrConfigBroken
+	}
+	var b [64]byte
+	n, _err1 := f.Read(b[:])
+	if _err1 != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err := f.Close(); err != nil {
+		return nil, ErrConfigBroken
+	}
+	return b[:n], nil
+}
+
+func parseLine(s string, line int) (int, error) {
+	// Error value can be any expression
+	n, _err0 := strconv.Atoi(s)
+	if _err0 != nil {
+		return 0, &ConfigError{line}
+	}
+	return n, nil
+}
+
+func lookup(m map[string]int, k string) (int, error) {
+	v, _ok0 := m[k]
+	if !_ok0 {
+		return 0, ErrConfigBroken
+	}
+	return v, nil
+}
+
+func main() {
+	readConfig("config.txt")
+	parseLine("42", 1)
+	lookup(map[string]int{}, "foo")
+}
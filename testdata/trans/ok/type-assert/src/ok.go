@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+)
+
+type S struct {
+	i int
+}
+
+func values() []interface{} {
+	return []interface{}{42, "foo", S{1}}
+}
+
+func f(x interface{}) (S, error) {
+	i := try(x.(int))
+	var s string
+	s = try(values()[1].(string))
+	var st = try(values()[2].(S))
+	_ = try(x.(interface{ Error() string }))
+	println(i, s, os.Args)
+	return st, nil
+}
+
+func g(x interface{}) {
+	i := ok(x.(int))
+	println(i)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type S struct {
+	i int
+}
+
+func values() []interface{} {
+	return []interface{}{42, "foo", S{1}}
+}
+
+func f(x interface{}) (S, error) {
+	i, _ok0 := x.(int)
+	if !_ok0 {
+		return S{}, fmt.Errorf("interface conversion: %T is not int", x)
+	}
+	var s string
+	var _ok1 bool
+	s, _ok1 = values()[1].(string)
+	if !_ok1 {
+		return S{}, fmt.Errorf("interface conversion: interface is not string")
+	}
+	var st, _ok2 = values()[2].(S)
+	if !_ok2 {
+		return S{}, fmt.Errorf("interface conversion: interface is not S")
+	}
+	var _ok3 bool
+	_, _ok3 = x.(interface{ Error() string })
+	if !_ok3 {
+		return S{}, fmt.Errorf("interface conversion: %T is not interface{Error() string}", x)
+	}
+	println(i, s, os.Args)
+	return st, nil
+}
+
+func g(x interface{}) {
+	i, _ok0 := x.(int)
+	if !_ok0 {
+		return
+	}
+	println(i)
+}
@@ -25,3 +25,19 @@ func Bar() error {
 	try(Foo())
 	return nil
 }
+
+type Arr [2]S
+
+type Alias = S
+
+type F func(int) error
+
+func Qux() ((S), [1](S), error) {
+	try(fmt.Println("parenthesized types"))
+	return S{}, [1]S{}, nil
+}
+
+func Baz() (a, b S, arr [2]S, named Arr, alias Alias, f F, fs [3]F, p unsafe.Pointer, err error) {
+	try(fmt.Println("named results"))
+	return
+}
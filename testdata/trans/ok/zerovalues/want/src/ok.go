@@ -36,3 +36,23 @@ func Bar() error {
 	}
 	return nil
 }
+
+type Arr [2]S
+
+type Alias = S
+
+type F func(int) error
+
+func Qux() (S, [1](S), error) {
+	if _, err := fmt.Println("parenthesized types"); err != nil {
+		return S{}, [1]S{}, err
+	}
+	return S{}, [1]S{}, nil
+}
+
+func Baz() (a, b S, arr [2]S, named Arr, alias Alias, f F, fs [3]F, p unsafe.Pointer, err error) {
+	if _, err := fmt.Println("named results"); err != nil {
+		return S{}, S{}, [2]S{}, Arr{}, Alias{}, nil, [3]F{}, nil, err
+	}
+	return
+}
@@ -1,13 +1,16 @@
 package trygo
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
 	"go/ast"
-	"go/importer"
+	"go/parser"
 	"go/token"
 	"go/types"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 type transKind int
@@ -18,6 +21,7 @@ const (
 	transKindAssign
 	transKindToplevelCall
 	transKindExpr
+	transKindThrow
 )
 
 func (kind transKind) String() string {
@@ -30,6 +34,8 @@ func (kind transKind) String() string {
 		return "transToplevelCall"
 	case transKindExpr:
 		return "transExpr"
+	case transKindThrow:
+		return "transThrow"
 	case transKindInvalid:
 		return "transInvalid"
 	default:
@@ -37,6 +43,58 @@ func (kind transKind) String() string {
 	}
 }
 
+// TransKind is a kind of translation point.
+type TransKind int
+
+const (
+	// TransValueSpec is a kind of try() call in var declaration like `var x = try(f())`.
+	TransValueSpec = TransKind(transKindValueSpec)
+	// TransAssign is a kind of try() call in assignment like `x := try(f())` or `x = try(f())`.
+	TransAssign = TransKind(transKindAssign)
+	// TransToplevelCall is a kind of try() call at toplevel of block like `try(f())`.
+	TransToplevelCall = TransKind(transKindToplevelCall)
+	// TransExpr is a kind of try() call in general expression like `g(try(f()))`.
+	TransExpr = TransKind(transKindExpr)
+	// TransThrow is a kind of throw() statement like `throw(err)`.
+	TransThrow = TransKind(transKindThrow)
+)
+
+func (kind TransKind) String() string {
+	switch kind {
+	case TransValueSpec:
+		return "value spec"
+	case TransAssign:
+		return "assignment"
+	case TransToplevelCall:
+		return "toplevel call"
+	case TransExpr:
+		return "expression"
+	case TransThrow:
+		return "throw statement"
+	default:
+		return "invalid"
+	}
+}
+
+// TransPoint is a read-only view of a point where try() call was translated.
+type TransPoint struct {
+	// Kind is a kind of the translation.
+	Kind TransKind
+	// Pos is a position of the try() call in TryGo source.
+	Pos token.Position
+	// Func is a function containing the try() call. It is *ast.FuncDecl or *ast.FuncLit.
+	Func ast.Node
+	// Call is a function call which was an argument of the try() call. It is nil when the argument is
+	// not a function call.
+	Call *ast.CallExpr
+	// Expr is an expression which was an argument of the try() call. It is a function call or a comma-ok
+	// expression such as type assertion. For throw() statement, it is the error value passed to throw().
+	Expr ast.Expr
+	// Generated is a list of Go statements which replaced the statement containing the try() call. It is
+	// nil when the package was not translated yet.
+	Generated []ast.Stmt
+}
+
 type transPoint struct {
 	kind transKind
 	// The target node. It must be one of *ast.ValueSpec, *ast.AssignStmt, *ast.ExprStmt, *ast.CallExpr.
@@ -47,10 +105,90 @@ type transPoint struct {
 	node ast.Node
 	// blockIndex is the index in list of statements at the block when this transPOint was created
 	blockIndex int
-	fun        ast.Node      // *ast.FuncDecl or *ast.FuncLit
-	call       *ast.CallExpr // Function call in try() invocation
+	fun        ast.Node // *ast.FuncDecl or *ast.FuncLit
+	call       ast.Expr // Function call or comma-ok expression in try() invocation
 	parent     ast.Node
 	pos        token.Pos
+	// errResult is a named error result of the enclosing function when try() is used in a function
+	// literal called by defer statement. The error is set to the result instead of being returned.
+	errResult *ast.Ident
+	// ok is true when the translation point is for ok() call. ok() checks the last bool result of the
+	// call instead of error.
+	ok bool
+	// expect is true when the translation point is for expect() call. expect() does not return from the
+	// function on error.
+	expect bool
+	// replaced is an error value passed to try() as the second argument like `try(f(), ErrFoo)`. It is
+	// returned instead of the error from the call. `_ = $replaced` statement is put before the node
+	// until phase-2.
+	replaced ast.Expr
+	// fallback is a value passed to tryOr() as the second argument like `tryOr(f(), 42)`. The value is
+	// assigned instead of the result of the call on error. It is put before the node in the same
+	// manner as replaced.
+	fallback ast.Expr
+	// generated is a list of statements which replaced the node at phase-2. It is set after nil check
+	// was inserted.
+	generated []ast.Stmt
+	// wrapMsg is a message to wrap the error returned at the translation point. It is set by decision of
+	// Gen.OnTranslate.
+	wrapMsg string
+	// inserted is true when the node is a statement inserted at phase-1 to define a temporary variable
+	// for hoisted expression or compound assignment. Its LHS does not exist in TryGo source.
+	inserted bool
+}
+
+// view returns a read-only view of the translation point.
+func (tp *transPoint) view(fset *token.FileSet) TransPoint {
+	call, _ := tp.call.(*ast.CallExpr)
+	return TransPoint{
+		Kind:      TransKind(tp.kind),
+		Pos:       fset.Position(tp.pos),
+		Func:      tp.fun,
+		Call:      call,
+		Expr:      tp.call,
+		Generated: tp.generated,
+	}
+}
+
+// Decision is a decision made by Gen.OnTranslate for a translation point. Zero value means translating
+// the point as usual.
+type Decision struct {
+	// Reject is a reason to reject the translation. When non-empty, translation of the package fails with
+	// an error reported at the translation point.
+	Reject string
+	// Wrap is a message to wrap the error returned at the translation point like
+	// `fmt.Errorf("$Wrap: %w", err)`. When empty, the error is returned as-is.
+	Wrap string
+}
+
+// funcName returns the name of pseudo-function translated at the translation point.
+func (tp *transPoint) funcName() string {
+	switch {
+	case tp.kind == transKindThrow:
+		return "throw"
+	case tp.ok:
+		return "ok"
+	case tp.expect:
+		return "expect"
+	case tp.fallback != nil:
+		return "tryOr"
+	default:
+		return "try"
+	}
+}
+
+// placeholder returns the expression put as `_ = $expr` statement before the node until phase-2. It
+// returns nil when no statement was put.
+func (tp *transPoint) placeholder() ast.Expr {
+	if tp.replaced != nil {
+		return tp.replaced
+	}
+	return tp.fallback
+}
+
+// commaOk returns true when the value checked at the translation point is bool instead of error.
+func (tp *transPoint) commaOk() bool {
+	return tp.ok || tp.kind != transKindThrow && commaOkExprKind(tp.call) != ""
 }
 
 type blockTree struct {
@@ -89,8 +227,8 @@ func (tree *blockTree) setStmts(stmts []ast.Stmt) {
 }
 
 // insertStmtAt inserts given statement *before* given index position of current block
-func (tree *blockTree) insertStmtAt(idx int, stmt ast.Stmt) {
-	logf("Insert %T statement at index %d of block %T", stmt, idx, tree.ast)
+func (tree *blockTree) insertStmtAt(idx int, stmt ast.Stmt, lg logger) {
+	lg.logf("Insert %T statement at index %d of block %T", stmt, idx, tree.ast)
 	prev := tree.stmts()
 	l, r := prev[:idx], prev[idx:]
 	ls := make([]ast.Stmt, 0, len(prev)+1)
@@ -100,11 +238,77 @@ func (tree *blockTree) insertStmtAt(idx int, stmt ast.Stmt) {
 	tree.setStmts(ls)
 }
 
-func (tree *blockTree) removeStmtAt(idx int) {
-	prev := tree.stmts()
-	logf("Remove %T statement at index %d of block %T", prev[idx], idx, tree.ast)
-	l, r := prev[:idx], prev[idx+1:]
-	tree.setStmts(append(l, r...))
+// stmtEditor edits statements of a block in batch. Copying the whole statement list on each insertion
+// is quadratic for blocks with many translation points. Since translation points are processed in order of
+// statements, edited statements are accumulated in head and untouched statements remain in tail. Moving
+// statements from tail to head is amortized and the block is rebuilt only once by flush().
+type stmtEditor struct {
+	tree *blockTree
+	head []ast.Stmt
+	tail []ast.Stmt
+	lg   logger
+}
+
+func newStmtEditor(tree *blockTree, lg logger) *stmtEditor {
+	stmts := tree.stmts()
+	return &stmtEditor{
+		tree: tree,
+		head: make([]ast.Stmt, 0, len(stmts)),
+		tail: stmts,
+		lg:   lg,
+	}
+}
+
+// reach moves statements from tail to head until head has the given number of statements.
+func (ed *stmtEditor) reach(n int) {
+	if len(ed.head) >= n {
+		return
+	}
+	m := n - len(ed.head)
+	if m > len(ed.tail) {
+		panic(fmt.Sprintf("Index %d is out of statements in block %T", n, ed.tree.ast))
+	}
+	ed.head = append(ed.head, ed.tail[:m]...)
+	ed.tail = ed.tail[m:]
+}
+
+// at returns the statement at the index of the edited block.
+func (ed *stmtEditor) at(idx int) ast.Stmt {
+	ed.reach(idx + 1)
+	return ed.head[idx]
+}
+
+// slice returns statements from start to end (exclusive) of the edited block.
+func (ed *stmtEditor) slice(start, end int) []ast.Stmt {
+	ed.reach(end)
+	return ed.head[start:end]
+}
+
+// insertAt inserts the statement *before* the index of the edited block.
+func (ed *stmtEditor) insertAt(idx int, stmt ast.Stmt) {
+	ed.lg.logf("Insert %T statement at index %d of block %T", stmt, idx, ed.tree.ast)
+	ed.reach(idx)
+	if idx == len(ed.head) {
+		ed.head = append(ed.head, stmt)
+		return
+	}
+	// Inserting before already edited statement is rare. Fall back to copying
+	ed.head = append(ed.head, nil)
+	copy(ed.head[idx+1:], ed.head[idx:])
+	ed.head[idx] = stmt
+}
+
+// removeAt removes the statement at the index of the edited block.
+func (ed *stmtEditor) removeAt(idx int) {
+	ed.reach(idx + 1)
+	ed.lg.logf("Remove %T statement at index %d of block %T", ed.head[idx], idx, ed.tree.ast)
+	ed.head = append(ed.head[:idx], ed.head[idx+1:]...)
+}
+
+// flush rebuilds statements of the block with the edits.
+func (ed *stmtEditor) flush() {
+	ed.tree.setStmts(append(ed.head, ed.tail...))
+	ed.head, ed.tail = nil, nil
 }
 
 func (tree *blockTree) isRoot() bool {
@@ -137,158 +341,594 @@ func unifyTypeErrors(phase string, errs []error) error {
 	return errors.New(b.String())
 }
 
-func typeCheck(transPts []*transPoint, pkgDir string, fset *token.FileSet, files []*ast.File) (*types.Info, *types.Package, error) {
-	errs := []error{}
-	cfg := &types.Config{
-		Importer:    importer.For("source", nil),
-		FakeImportC: true,
-		Error: func(err error) {
-			log(ftl(err))
-			errs = append(errs, err)
-		},
+// transPointAt returns the innermost translation point whose node contains the position. It returns nil
+// when no translation point is responsible for the position.
+func transPointAt(transPts []*transPoint, pos token.Pos) *transPoint {
+	var found *transPoint
+	for _, trans := range transPts {
+		if trans.node.Pos() <= pos && pos < trans.node.End() {
+			if found == nil || found.node.Pos() < trans.node.Pos() {
+				found = trans
+			}
+		}
 	}
+	return found
+}
 
+// ignorePos returns the position of '_' variable added to the node at phase-1. It returns token.NoPos
+// when no variable was added.
+func (tp *transPoint) ignorePos() token.Pos {
+	switch node := tp.node.(type) {
+	case *ast.ValueSpec:
+		return node.Names[len(node.Names)-1].Pos()
+	case *ast.AssignStmt:
+		return node.Lhs[len(node.Lhs)-1].Pos()
+	default:
+		return token.NoPos
+	}
+}
+
+// sourceExprs returns expressions in the node which exist in TryGo source as-is. They are operands of
+// the call and, unless the node was inserted at phase-1, variables and type written at LHS.
+func (tp *transPoint) sourceExprs() []ast.Expr {
+	exprs := []ast.Expr{}
+	switch e := tp.call.(type) {
+	case *ast.CallExpr:
+		exprs = append(exprs, e.Args...)
+	case *ast.IndexExpr:
+		exprs = append(exprs, e.X, e.Index)
+	case *ast.TypeAssertExpr:
+		exprs = append(exprs, e.X, e.Type)
+	case *ast.UnaryExpr:
+		exprs = append(exprs, e.X)
+	}
+	if tp.inserted {
+		return exprs
+	}
+	switch node := tp.node.(type) {
+	case *ast.ValueSpec:
+		for _, n := range node.Names[:len(node.Names)-1] {
+			exprs = append(exprs, n)
+		}
+		if node.Type != nil {
+			exprs = append(exprs, node.Type)
+		}
+	case *ast.AssignStmt:
+		exprs = append(exprs, node.Lhs[:len(node.Lhs)-1]...)
+	}
+	return exprs
+}
+
+// inSource returns whether the position is in expressions of the node which exist in TryGo source.
+func (tp *transPoint) inSource(pos token.Pos) bool {
+	for _, e := range tp.sourceExprs() {
+		if e != nil && e.Pos() <= pos && pos < e.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// translationTypeError is a type error caused by translation of pseudo-function call at phase-1 rather
+// than a bug which already exists in TryGo source.
+type translationTypeError struct {
+	err types.Error
+}
+
+func (err *translationTypeError) Error() string {
+	return err.err.Error()
+}
+
+// arityMismatch returns a message describing mismatch between the number of values returned from the
+// call at the translation point and the number of variables assigned to them. It returns an empty
+// string when they match or the number of values is unknown.
+func (tp *transPoint) arityMismatch(info *types.Info) string {
+	// '_' was added to LHS at phase-1
+	var vars int
+	switch node := tp.node.(type) {
+	case *ast.AssignStmt:
+		vars = len(node.Lhs) - 1
+	case *ast.ValueSpec:
+		vars = len(node.Names) - 1
+	default:
+		return ""
+	}
+
+	call, ok := tp.call.(*ast.CallExpr)
+	if !ok {
+		return ""
+	}
+	tv, ok := info.Types[call]
+	if !ok || tv.Type == nil {
+		return ""
+	}
+	rets := 1
+	if tpl, ok := tv.Type.(*types.Tuple); ok {
+		rets = tpl.Len()
+	}
+	if rets == vars+1 {
+		return ""
+	}
+
+	last := "error"
+	if tp.ok {
+		last = "bool"
+	}
+	callee := types.ExprString(call.Fun)
+	if rets == 1 {
+		return fmt.Sprintf("%s() yields no value to assign since %s returns only %s", tp.funcName(), callee, last)
+	}
+	var values string
+	switch rets {
+	case 0:
+		values = "no value"
+	case 2:
+		values = "1 value + " + last
+	default:
+		values = fmt.Sprintf("%d values + %s", rets-1, last)
+	}
+	assigned := "1 variable is assigned"
+	if vars != 1 {
+		assigned = fmt.Sprintf("%d variables are assigned", vars)
+	}
+	return fmt.Sprintf("%s returns %s but %s", callee, values, assigned)
+}
+
+// typeErrorAtTrans maps a type error caused by try() call elimination to the position of the try() call
+// in TryGo source since nodes such as '_' variables and temporary variables added at phase-1 don't exist
+// in the source. Errors in the statement of translation point are caused by the elimination unless they
+// are in expressions which exist in TryGo source as-is. They are returned as *translationTypeError.
+// Other errors are not mapped since they are at correct positions. When the number of values returned
+// from the call does not match the number of assigned variables, the error message is replaced with the
+// counts in TryGo source since the message from go/types counts the '_' variable.
+func typeErrorAtTrans(err error, transPts []*transPoint, info *types.Info) error {
+	terr, ok := err.(types.Error)
+	if !ok {
+		return err
+	}
+	trans := transPointAt(transPts, terr.Pos)
+	if trans == nil || trans.inSource(terr.Pos) {
+		return err
+	}
+	if terr.Pos == trans.call.Pos() || terr.Pos == trans.ignorePos() {
+		if msg := trans.arityMismatch(info); msg != "" {
+			terr.Msg = msg
+		}
+	}
+	terr.Pos = trans.pos
+	terr.Msg = fmt.Sprintf("%s (in translation of %s() call)", terr.Msg, trans.funcName())
+	return &translationTypeError{terr}
+}
+
+// classifyTypeErrors unifies type errors at type check after phase-1 into one error. The errors are
+// classified into ones which exist in TryGo source and ones caused by translation of pseudo-function
+// calls so that users can know which should be fixed in their source.
+func classifyTypeErrors(errs []error) error {
+	var src, trans []error
+	for _, err := range errs {
+		if _, ok := err.(*translationTypeError); ok {
+			trans = append(trans, err)
+		} else {
+			src = append(src, err)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("Type error(s) at type check after phase-1:")
+	for _, c := range []struct {
+		title string
+		errs  []error
+	}{
+		{"Error(s) in TryGo source", src},
+		{"Error(s) caused by translation of pseudo-function calls", trans},
+	} {
+		if len(c.errs) == 0 {
+			continue
+		}
+		b.WriteString("\n  ")
+		b.WriteString(c.title)
+		b.WriteRune(':')
+		for _, err := range c.errs {
+			b.WriteString("\n    ")
+			b.WriteString(err.Error())
+		}
+	}
+	return errors.New(b.String())
+}
+
+// newTypeInfo creates types.Info to collect type information required for inserting nil checks at the
+// translation points.
+func newTypeInfo(transPts []*transPoint) *types.Info {
 	tys := map[ast.Expr]types.TypeAndValue{}
 	for _, trans := range transPts {
 		if lit, ok := trans.fun.(*ast.FuncLit); ok {
 			// For getting the return type of function for building zero values at if err != nil check body
 			tys[lit] = types.TypeAndValue{}
 		}
-		if trans.kind == transKindToplevelCall {
-			// For getting the return type of try(f(..)) at *ast.ExprStmt
-			tys[trans.call] = types.TypeAndValue{}
+		// For getting the return type of try(f(..)). Its last type is the type of error
+		tys[trans.call] = types.TypeAndValue{}
+		if e := trans.placeholder(); e != nil {
+			tys[e] = types.TypeAndValue{}
 		}
 	}
 
-	info := &types.Info{
-		Types: tys,
-		Defs:  map[*ast.Ident]types.Object{},
+	return &types.Info{
+		Types:     tys,
+		Defs:      map[*ast.Ident]types.Object{},
+		Uses:      map[*ast.Ident]types.Object{},
+		Implicits: map[ast.Node]types.Object{},
+	}
+}
+
+// preflightTypeCheck type-checks untouched TryGo source before try() call elimination. Pseudo-functions
+// are treated as undeclared names. Since arguments of calls to undeclared names are still type-checked and
+// errors caused by invalid operands are not reported, only errors which exist in the source regardless of
+// pseudo-functions are reported with clean messages. Errors for undeclared pseudo-functions are ignored.
+func preflightTypeCheck(pkg *Package) error {
+	lg := pkg.lg
+	files := pkg.fileNodes()
+
+	pseudo := map[token.Pos]struct{}{}
+	for _, f := range files {
+		ast.Inspect(f, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpr); ok {
+				if ident, ok := call.Fun.(*ast.Ident); ok && ident.Obj == nil && isPseudoFuncName(ident.Name) {
+					pseudo[ident.Pos()] = struct{}{}
+				}
+			}
+			return true
+		})
+	}
+
+	errs := []error{}
+	cfg := &types.Config{
+		Importer:    pkg.typesImporter(),
+		FakeImportC: true,
+		Error: func(err error) {
+			if terr, ok := err.(types.Error); ok {
+				if _, ok := pseudo[terr.Pos]; ok {
+					return
+				}
+			}
+			lg.log(lg.ftl(err))
+			errs = append(errs, err)
+		},
+	}
+	cfg.Check(pkg.Birth, pkg.Files, files, nil)
+	if len(errs) > 0 {
+		return unifyTypeErrors("pre-flight type check of TryGo source", errs)
+	}
+	return nil
+}
+
+// typeCheck type-checks the package after phase-1. Imports are resolved with imp. When standalone is true,
+// imports which cannot be resolved are replaced with empty packages and type errors are ignored for
+// best-effort translation.
+func typeCheck(transPts []*transPoint, pkgDir string, fset *token.FileSet, files []*ast.File, imp types.Importer, standalone bool, lg logger) (*types.Info, *types.Package, error) {
+	errs := []error{}
+	info := newTypeInfo(transPts)
+	cfg := &types.Config{
+		Importer:    imp,
+		FakeImportC: true,
+		Error: func(err error) {
+			err = typeErrorAtTrans(err, transPts, info)
+			lg.log(lg.ftl(err))
+			errs = append(errs, err)
+		},
+	}
+	if standalone {
+		cfg.Importer = standaloneImporter{cfg.Importer, lg}
+		cfg.Error = func(err error) {
+			lg.log("Ignore type error in standalone mode:", err)
+		}
 	}
 
 	pkg, _ := cfg.Check(pkgDir, fset, files, info)
 	if len(errs) > 0 {
-		return nil, nil, unifyTypeErrors("type check after phase-1", errs)
+		return nil, nil, classifyTypeErrors(errs)
 	}
 
-	if logEnabled {
+	if lg.enabled() {
 		var b strings.Builder
-		b.WriteString(hi("Types for identifiers: "))
-		for ident, obj := range info.Defs {
-			b.WriteString(hi(ident.Name))
+		b.WriteString(lg.hi("Types for identifiers: "))
+		idents := make([]*ast.Ident, 0, len(info.Defs))
+		for ident := range info.Defs {
+			idents = append(idents, ident)
+		}
+		sort.Slice(idents, func(i, j int) bool {
+			return idents[i].Pos() < idents[j].Pos()
+		})
+		for _, ident := range idents {
+			obj := info.Defs[ident]
+			b.WriteString(lg.hi(ident.Name))
 			if obj != nil {
 				b.WriteString(":'" + obj.String() + "'")
 			}
 			b.WriteString(", ")
 		}
-		log(b.String())
-		log(hi("Types for package "+pkg.Name()), pkg.String())
+		lg.log(b.String())
+		lg.log(lg.hi("Types for package "+pkg.Name()), pkg.String())
 	}
 
 	return info, pkg, nil
 }
 
-// translatePackage translates given package from TryGo to Go. Given AST is directly modified. When error
-// occurs, it returns an error and the AST may be incompletely modified.
-func translatePackage(pkg *Package) error {
+// translatePackage translates given package from TryGo to Go by running the passes in order. Given AST is
+// directly modified. When error occurs, it returns an error and the AST may be incompletely modified.
+func translatePackage(pkg *Package, passes []Pass) error {
 	pkgName := pkg.Node.Name
-	log("Translation", hi("start: "+pkgName))
+	lg := pkg.lg
+	lg.log("Translation", lg.hi("start: "+pkgName))
+	for _, pass := range passes {
+		if err := runPass(pass, pkg); err != nil {
+			return err
+		}
+	}
+	lg.log("Translation", lg.hi("end: "+pkgName))
+	return nil
+}
 
-	tce := &tryCallElimination{
-		pkg:     pkg.Node,
-		fileset: pkg.Files,
+// Translate translates all given TryGo packages by modifying given slice of Packages directly. After
+// translation, the given packages are translated to Go packages.
+// Each Package instance's Node and Files fields must be set with the results of an AST and tokens
+// parsed from TryGo source. And Birth must be set correctly as package directory of the TryGo source.
+// When translation failed, it returns an error as soon as possible. Given Package instances may be
+// no longer correct.
+func Translate(pkgs []*Package) error {
+	return (&Gen{}).translate(pkgs)
+}
+
+// TranslateAST translates given TryGo files in the same package by modifying the AST directly. It is
+// useful for tools which already have parsed trees, such as linters and code generators, since nothing
+// is parsed from filesystem. fset must be the token file set used for parsing the files. dir is a
+// package directory of the files used to resolve relative imports and to fix imports after translation.
+func TranslateAST(fset *token.FileSet, files []*ast.File, dir string) error {
+	if len(files) == 0 {
+		return nil
 	}
 
-	log(hi("Phase-1"), "try() call elimination", hi("start: "+pkgName))
-	// Traverse AST for phase-1
-	ast.Walk(tce, pkg.Node)
-	if tce.err != nil {
-		return tce.err
+	name := files[0].Name.Name
+	node := &ast.Package{Name: name, Files: make(map[string]*ast.File, len(files))}
+	for i, f := range files {
+		if f.Name.Name != name {
+			return errors.Errorf("All files must be in the same package but package %q was mixed in package %q", f.Name.Name, name)
+		}
+		path := fset.Position(f.Package).Filename
+		if path == "" {
+			// File was not parsed from any file. Give unique name instead
+			path = fmt.Sprintf("%s%d.go", name, i)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if _, ok := node.Files[path]; ok {
+			return errors.Errorf("File %s is given more than once", path)
+		}
+		node.Files[path] = f
 	}
-	tce.assertPostCondition()
-	log(hi("Phase-1"), "try() call elimination", hi("end: "+pkgName))
 
-	log("Number of translations:", hi(tce.numTrans))
-	if tce.numTrans == 0 {
-		// Nothing was translated. Can skip later process
-		return nil
+	return Translate([]*Package{NewPackage(node, dir, dir, fset)})
+}
+
+// parseErrorExpr parses an expression related to error configured in Gen. It returns nil when it is not
+// configured. what describes the error in an error message.
+func parseErrorExpr(src, what string) (ast.Expr, error) {
+	if src == "" {
+		return nil, nil
 	}
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid expression for %s: %q", what, src)
+	}
+	return expr, nil
+}
+
+// PartialError is an error returned when translations of some packages failed with Gen.KeepGoing. Other
+// packages were translated successfully.
+type PartialError struct {
+	// Errs is a list of errors of the failed packages.
+	Errs []error
+	// Translated is a list of packages which were successfully translated.
+	Translated []*Package
+}
 
-	log(hi("Type check"), "after phase-1", hi("start: "+pkgName))
-	files := make([]*ast.File, 0, len(pkg.Node.Files))
-	for _, f := range pkg.Node.Files {
-		files = append(files, f)
+func (err *PartialError) Error() string {
+	msgs := make([]string, 0, len(err.Errs))
+	for _, e := range err.Errs {
+		msgs = append(msgs, e.Error())
 	}
+	return fmt.Sprintf("Translation of %d package(s) failed:\n  %s", len(err.Errs), strings.Join(msgs, "\n  "))
+}
 
-	transPoints := []*transPoint{}
-	for _, root := range tce.roots {
-		transPoints = append(transPoints, root.collectTransPoints()...)
+// translatePackageWithGen translates one package with configurations of Gen.
+func (gen *Gen) translatePackageWithGen(pkg *Package, passes []Pass) error {
+	if err := restoreCgoPreambles(pkg); err != nil {
+		return err
 	}
+	if gen.PreflightTypeCheck && !gen.Standalone {
+		pkg.lg.log(pkg.lg.hi("Pre-flight type check"), "of", pkg.Node.Name)
+		start := time.Now()
+		err := preflightTypeCheck(pkg)
+		pkg.addTiming(PhaseTypeCheck, time.Since(start))
+		if err != nil {
+			return errors.Wrapf(err, "While translating %s", pkg.Birth)
+		}
+	}
+	if err := pkg.dumpAST(astStageBefore); err != nil {
+		return err
+	}
+	if err := translatePackage(pkg, passes); err != nil {
+		return errors.Wrapf(err, "While translating %s", pkg.Birth)
+	}
+	return nil
+}
 
-	tyInfo, tyPkg, err := typeCheck(transPoints, pkg.Birth, pkg.Files, files)
+// translatePackageCached translates the package or restores its translation result from the cache when
+// Gen.CacheDir is set. Problems of the cache are not fatal since the package can still be translated.
+func (gen *Gen) translatePackageCached(pkg *Package, passes []Pass) error {
+	if !gen.cacheable() {
+		return gen.translatePackageWithGen(pkg, passes)
+	}
+	lg := gen.lg()
+	key, err := gen.cacheKey(pkg)
 	if err != nil {
-		// TODO: More informational error. Which translation failed? Is it related to try() elimination? Or simply original code has type error?
-		log(ftl(err))
+		lg.log("Cannot calculate cache key of", pkg.Birth, err)
+		return gen.translatePackageWithGen(pkg, passes)
+	}
+	if gen.loadCache(pkg, key) {
+		lg.log("Restore translation of", lg.hi(pkg.Birth), "from cache", key)
+		return nil
+	}
+	if err := gen.translatePackageWithGen(pkg, passes); err != nil {
 		return err
 	}
-	log(hi("Type check"), "after phase-1", hi("end: "+pkgName))
-
-	nci := &nilCheckInsertion{
-		pkg:      pkg.Node,
-		fileset:  pkg.Files,
-		roots:    tce.roots,
-		typeInfo: tyInfo,
-		pkgTypes: tyPkg,
+	if err := gen.storeCache(pkg, key); err != nil {
+		lg.log("Cannot store translation of", pkg.Birth, "to cache:", err)
 	}
+	return nil
+}
 
-	// Traverse blocks for phase-2
-	log(hi("Phase-2"), "if err != nil check insertion", hi("start: "+pkgName))
-	nci.translate()
-	log(hi("Phase-2"), "if err != nil check insertion", hi("end: "+pkgName))
+// packagesNotGenerated returns packages in the map from source directory which are not generated with
+// the packages.
+func packagesNotGenerated(m map[string][]*Package, pkgs []*Package) []*Package {
+	if len(m) == 0 {
+		return nil
+	}
+	generating := make(map[string]struct{}, len(pkgs))
+	for _, pkg := range pkgs {
+		generating[pkg.Birth] = struct{}{}
+	}
+	others := []*Package{}
+	for dir, ps := range m {
+		if _, ok := generating[dir]; !ok {
+			others = append(others, ps...)
+		}
+	}
+	return others
+}
 
-	log("Translation", hi("end: "+pkgName))
-	pkg.modified = true
-	return nil
+// watchedPackages returns packages previously generated by Watch which are not generated again with the
+// packages.
+func (gen *Gen) watchedPackages(pkgs []*Package) []*Package {
+	return packagesNotGenerated(gen.watched, pkgs)
 }
 
-// Translate translates all given TryGo packages by modifying given slice of Packages directly. After
-// translation, the given packages are translated to Go packages.
-// Each Package instance's Node and Files fields must be set with the results of an AST and tokens
-// parsed from TryGo source. And Birth must be set correctly as package directory of the TryGo source.
-// When translation failed, it returns an error as soon as possible. Given Package instances may be
-// no longer correct.
-func Translate(pkgs []*Package) error {
-	log("Translate parsed packages:", pkgs)
+// translate translates given packages with configurations of Gen. Translate() is a translate() with
+// default configurations. When Gen.KeepGoing is true, failed packages are skipped and *PartialError is
+// returned after translating other packages.
+func (gen *Gen) translate(pkgs []*Package) error {
+	lg := gen.lg()
+	lg.log("Translate parsed packages:", pkgs)
+
+	passes, err := gen.passes()
+	if err != nil {
+		return err
+	}
+
+	okErr, err := parseErrorExpr(gen.OkError, "error of ok()")
+	if err != nil {
+		return err
+	}
+	notFoundErr, err := parseErrorExpr(gen.NotFoundError, "error of key not found")
+	if err != nil {
+		return err
+	}
+	closedErr, err := parseErrorExpr(gen.ClosedError, "error of closed channel")
+	if err != nil {
+		return err
+	}
+	expectHandler, err := parseErrorExpr(gen.ExpectHandler, "expect() handler")
+	if err != nil {
+		return err
+	}
+
+	// Packages imported by other packages are translated first so that their types can be imported
+	pkgs, siblings := gen.importSiblings(pkgs)
 
 	// Translate try() calls with 2 stages
+	failed := []error{}
+	translated := make([]*Package, 0, len(pkgs))
 	for _, pkg := range pkgs {
-		if err := translatePackage(pkg); err != nil {
-			return errors.Wrapf(err, "While translating %s", pkg.Birth)
+		pkg.lg = lg
+		pkg.okError = okErr
+		pkg.notFoundError = notFoundErr
+		pkg.closedError = closedErr
+		pkg.expectHandler = expectHandler
+		pkg.wrapReplacedError = gen.WrapReplacedError
+		pkg.strict = gen.Strict
+		pkg.onTranslate = gen.OnTranslate
+		pkg.standalone = gen.Standalone
+		pkg.importer = gen.Importer
+		pkg.noTypeCheck = gen.NoTypeCheck
+		pkg.runtimeHelpers = gen.RuntimeHelpers
+		pkg.emitASTDir = gen.EmitASTDir
+		pkg.dumpBlocksDir = gen.DumpBlocksDir
+		pkg.emitPhase1Dir = gen.EmitPhase1Dir
+		translate := gen.translatePackageCached
+		if siblings != nil {
+			pkg.importer = siblings.importerFor(pkg)
+			if siblings.imported(pkg.Birth) {
+				// Types of the package are not restored from cache
+				translate = gen.translatePackageWithGen
+			}
+		}
+		if err := translate(pkg, passes); err != nil {
+			if !gen.KeepGoing {
+				return err
+			}
+			lg.log(lg.ftl(err))
+			lg.log("Keep going after failure of translating", pkg.Birth)
+			failed = append(failed, err)
+			continue
+		}
+		if siblings != nil && pkg.typed != nil && !strings.HasSuffix(pkg.Node.Name, "_test") {
+			siblings.checked[pkg.Birth] = pkg.typed
 		}
+		for _, w := range pkg.warnings {
+			gen.warn(w.String())
+		}
+		if gen.Explain {
+			if err := pkg.Explain(gen.out()); err != nil {
+				return err
+			}
+		}
+		translated = append(translated, pkg)
 	}
-
-	// Fix all import paths considering translations
-	if err := fixImports(pkgs); err != nil {
+	pkgs = translated
+
+	// Fix all import paths considering translations. Imports are not resolved in standalone mode
+	if gen.Standalone {
+		lg.log("Skip fixing imports in standalone mode")
+	} else if gen.noFixImports {
+		lg.log("Skip fixing imports since translated packages are not moved")
+	} else if err := fixImports(pkgs, append(gen.watchedPackages(pkgs), packagesNotGenerated(gen.batchStubs, pkgs)...), gen.ImportMap, gen.ImportRewrites, lg); err != nil {
 		return err
 	}
 
 	// Fix file paths considering translations
 	for _, pkg := range pkgs {
 		files := make(map[string]*ast.File, len(pkg.Node.Files))
+		pkg.sources = make(map[string]string, len(pkg.Node.Files))
 		for path, file := range pkg.Node.Files {
 			outpath := filepath.Join(pkg.Path, filepath.Base(path))
 			files[outpath] = file
+			pkg.sources[outpath] = path
 		}
 		pkg.Node.Files = files
 	}
 
-	if logEnabled {
+	if lg.enabled() {
 		modified := make([]string, 0, len(pkgs))
 		for _, pkg := range pkgs {
 			if pkg.modified {
 				modified = append(modified, pkg.Node.Name)
 			}
 		}
-		log("Translation done. Total packages:", hi(len(pkgs)), "Modified packages:", hi(len(modified)), modified)
+		lg.log("Translation done. Total packages:", lg.hi(len(pkgs)), "Modified packages:", lg.hi(len(modified)), modified)
+	}
+
+	if len(failed) > 0 {
+		return &PartialError{failed, pkgs}
 	}
 	return nil
 }
@@ -296,14 +936,15 @@ func Translate(pkgs []*Package) error {
 // Check checks given packages. It eliminates all try() calls then runs type check against
 // packages. Returning nil means check was OK.
 func Check(pkgs []*Package) error {
-	log("Check parsed packages:", pkgs)
 	for _, pkg := range pkgs {
-		log("Checking packages at", pkg.Birth)
+		lg := pkg.lg
+		lg.log("Checking packages at", pkg.Birth)
 		tce := &tryCallElimination{
 			pkg:     pkg.Node,
 			fileset: pkg.Files,
+			lg:      lg,
 		}
-		ast.Walk(tce, pkg.Node)
+		walkFiles(tce, pkg.Node)
 		if tce.err != nil {
 			return tce.err
 		}
@@ -311,8 +952,7 @@ func Check(pkgs []*Package) error {
 		if err := pkg.Verify(); err != nil {
 			return err
 		}
-		log("Check OK:", pkg.Birth)
+		lg.log("Check OK:", pkg.Birth)
 	}
-	log("All check OK")
 	return nil
 }
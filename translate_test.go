@@ -2,9 +2,14 @@ package trygo_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,7 +43,7 @@ func collectPackagesUnder(dirpath string, t *testing.T) []*trygo.Package {
 		if _, ok := saw[dir]; ok {
 			return nil
 		}
-		pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+		pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseComments)
 		if err != nil {
 			t.Fatal(dirpath, err)
 		}
@@ -80,6 +85,10 @@ func TestTranslationOK(t *testing.T) {
 			}
 
 			for _, pkg := range pkgs {
+				for _, v := range pkg.Validate() {
+					t.Error(v)
+				}
+
 				shouldModified := ""
 
 				fs, err := ioutil.ReadDir(pkg.Path)
@@ -166,3 +175,592 @@ func TestTranslationError(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckPackages(t *testing.T) {
+	base := filepath.Join(cwd, "testdata", "trans", "error")
+	pkgs := append(collectPackagesUnder(filepath.Join(base, "try-outside-func"), t), collectPackagesUnder(filepath.Join(base, "type-check2"), t)...)
+
+	diags := (&trygo.Gen{}).CheckPackages(pkgs)
+
+	want := []struct {
+		file  string
+		line  int
+		phase string
+	}{
+		{filepath.Join(base, "try-outside-func", "err.go"), 7, "try() call elimination"},
+		{filepath.Join(base, "type-check2", "err.go"), 9, "type check"},
+		{filepath.Join(base, "type-check2", "err.go"), 14, "type check"},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("Wanted %d diagnostics but got %d: %v", len(want), len(diags), diags)
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Pos.Filename != w.file || d.Pos.Line != w.line || d.Phase != w.phase || d.Package != "foo" || d.Message == "" {
+			t.Errorf("Unexpected diagnostic #%d: %+v", i, d)
+		}
+	}
+}
+
+func TestCheckPackagesOK(t *testing.T) {
+	pkgs := collectPackagesUnder(filepath.Join(cwd, "testdata", "trans", "ok", "assign", "src"), t)
+	if diags := (&trygo.Gen{}).CheckPackages(pkgs); len(diags) != 0 {
+		t.Fatal("Unexpected diagnostics:", diags)
+	}
+}
+
+func TestCheckPackagesTranslationError(t *testing.T) {
+	base := filepath.Join(cwd, "testdata", "trans", "error")
+	pkgs := append(collectPackagesUnder(filepath.Join(base, "type-check-trans"), t), collectPackagesUnder(filepath.Join(base, "type-check2"), t)...)
+	diags := (&trygo.Gen{}).CheckPackages(pkgs)
+	if len(diags) != 3 {
+		t.Fatal("Wanted 3 diagnostics but got", diags)
+	}
+	for i, want := range []bool{true, false, false} {
+		if d := diags[i]; d.Translation != want {
+			t.Errorf("Translation of diagnostic #%d should be %v: %+v", i, want, d)
+		}
+	}
+}
+
+func TestCheckPackagesErrorTypes(t *testing.T) {
+	dir := filepath.Join(cwd, "testdata", "trans", "error", "error-not-assignable")
+	diags := (&trygo.Gen{}).CheckPackages(collectPackagesUnder(dir, t))
+	if len(diags) != 1 {
+		t.Fatal("Wanted 1 diagnostic but got", diags)
+	}
+	d := diags[0]
+	if d.Pos.Filename != filepath.Join(dir, "err.go") || d.Pos.Line != 14 || d.Phase != "type check" || !strings.Contains(d.Message, `"*foo.MyError"`) {
+		t.Fatalf("Unexpected diagnostic: %+v", d)
+	}
+}
+
+func TestCheckPackagesSuggestedFixes(t *testing.T) {
+	src := `package foo
+
+import "strconv"
+
+func f(s string) {
+	n := try(strconv.Atoi(s))
+	if n > 0 {
+		return
+	}
+	println(n)
+}
+
+func g(s string) (bool, error) {
+	v := s
+	if try(strconv.Atoi(v)) > 0 {
+		return true, nil
+	}
+	return false, nil
+}
+`
+	want := `package foo
+
+import "strconv"
+
+func f(s string) error {
+	n := try(strconv.Atoi(s))
+	if n > 0 {
+		return nil
+	}
+	println(n)
+	return nil
+}
+
+func g(s string) (bool, error) {
+	v := s
+	v1 := try(strconv.Atoi(v))
+	if v1 > 0 {
+		return true, nil
+	}
+	return false, nil
+}
+`
+
+	dir, err := ioutil.TempDir("", "trygo-fixes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "foo.go")
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diags := (&trygo.Gen{Strict: true}).CheckPackages(collectPackagesUnder(dir, t))
+	if len(diags) != 2 {
+		t.Fatal("Wanted 2 diagnostics but got", diags)
+	}
+	edits := []*trygo.TextEdit{}
+	for i, msg := range []string{"Add error to the result list", "Hoist try() call into a separate statement"} {
+		d := diags[i]
+		if len(d.Fixes) != 1 || d.Fixes[0].Message != msg {
+			t.Fatalf("Wanted fix %q for diagnostic #%d: %+v", msg, i, d)
+		}
+		edits = append(edits, d.Fixes[0].Edits...)
+	}
+
+	// Apply edits from the last one not to shift offsets of other edits
+	fixed := src
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		fixed = fixed[:e.Pos.Offset] + e.NewText + fixed[e.End.Offset:]
+	}
+	if fixed != want {
+		t.Fatalf("Fixed source is unexpected. Wanted:\n%s\nbut got:\n%s", want, fixed)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(fixed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if diags := (&trygo.Gen{Strict: true}).CheckPackages(collectPackagesUnder(dir, t)); len(diags) != 0 {
+		t.Fatal("Unexpected diagnostics after applying fixes:", diags)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	dir := filepath.Join(cwd, "testdata", "trans", "error", "noreturn")
+	diags := (&trygo.Gen{}).CheckPackages(collectPackagesUnder(dir, t))
+	if len(diags) != 1 {
+		t.Fatal("Wanted 1 diagnostic but got", diags)
+	}
+
+	var buf bytes.Buffer
+	if err := trygo.WriteSARIF(&buf, diags); err != nil {
+		t.Fatal(err)
+	}
+
+	var log struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name string
+				}
+			}
+			Results []struct {
+				RuleID    string
+				Level     string
+				Message   struct{ Text string }
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine, StartColumn int }
+					}
+				}
+				Fixes []struct {
+					Description struct{ Text string }
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || log.Runs[0].Tool.Driver.Name != "trygo" || len(log.Runs[0].Results) != 1 {
+		t.Fatal("Unexpected SARIF log:", buf.String())
+	}
+	r := log.Runs[0].Results[0]
+	if r.RuleID != "untranslatable-call" || r.Level != "error" || !strings.Contains(r.Message.Text, "The function returns nothing") {
+		t.Error("Unexpected result:", buf.String())
+	}
+	if len(r.Locations) != 1 {
+		t.Fatal("Unexpected locations:", buf.String())
+	}
+	loc := r.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "testdata/trans/error/noreturn/err.go" || loc.Region.StartLine != 8 || loc.Region.StartColumn != 2 {
+		t.Error("Unexpected location:", buf.String())
+	}
+	if len(r.Fixes) != 1 || r.Fixes[0].Description.Text != "Add error to the result list" {
+		t.Error("Unexpected fixes:", buf.String())
+	}
+}
+
+func TestTranslateFileStandalone(t *testing.T) {
+	src := `package snippet
+
+import (
+	"example.com/unknown/go-foo/v2"
+	"strconv"
+)
+
+func f(s string) (int, error) {
+	n := try(strconv.Atoi(s))
+	try(foo.Do(n, undefinedVar))
+	return n, nil
+}
+`
+	gen := &trygo.Gen{}
+	out, err := gen.TranslateFile("snippet.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := string(out)
+	for _, want := range []string{
+		"n, _err0 := strconv.Atoi(s)\n\tif _err0 != nil {\n\t\treturn 0, _err0\n\t}",
+		"if err := foo.Do(n, undefinedVar); err != nil {\n\t\treturn 0, err\n\t}",
+		`"example.com/unknown/go-foo/v2"`,
+	} {
+		if !strings.Contains(have, want) {
+			t.Errorf("%q is not included in output:\n%s", want, have)
+		}
+	}
+	if gen.Standalone {
+		t.Error("Standalone flag should be restored")
+	}
+
+	if _, err := gen.TranslateFile("broken.go", []byte("package broken\n\nfunc f() {")); err == nil {
+		t.Error("Parse error should be reported")
+	}
+}
+
+func TestTranslateAST(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "foo.go", `package foo
+
+import "strconv"
+
+func f(s string) (int, error) {
+	n := try(strconv.Atoi(s))
+	return n, nil
+}
+`, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := trygo.TranslateAST(fset, []*ast.File{f}, cwd); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		t.Fatal(err)
+	}
+	have := buf.String()
+	want := "n, _err0 := strconv.Atoi(s)\n\tif _err0 != nil {\n\t\treturn 0, _err0\n\t}"
+	if !strings.Contains(have, want) {
+		t.Fatalf("%q is not included in translated AST:\n%s", want, have)
+	}
+
+	g, err := parser.ParseFile(fset, "bar.go", "package bar\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = trygo.TranslateAST(fset, []*ast.File{f, g}, cwd)
+	if err == nil || !strings.Contains(err.Error(), "must be in the same package") {
+		t.Fatal("Unexpected error for mixed packages:", err)
+	}
+}
+
+func TestTranslateASTSkipObjectResolution(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "a.go", `package foo
+
+import "strconv"
+
+func f(s string) (int, error) {
+	n := try(strconv.Atoi(s)) + try(strconv.Atoi(s))
+	return n, nil
+}
+`, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := parser.ParseFile(fset, "b.go", "package foo\n\nvar _0 = 1\n", parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := trygo.TranslateAST(fset, []*ast.File{f, g}, cwd); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		t.Fatal(err)
+	}
+	have := buf.String()
+	if strings.Contains(have, "try(") {
+		t.Fatal("try() was not translated:", have)
+	}
+	if strings.Contains(have, "_0") {
+		t.Fatal("Temporary variable clashes with package-level _0:", have)
+	}
+}
+
+func TestTranslateASTCgoWithoutComments(t *testing.T) {
+	dir := filepath.Join(cwd, "testdata", "trans", "ok", "cgo")
+	fset := token.NewFileSet()
+	// Preamble of cgo is lost in AST parsed without comments
+	f, err := parser.ParseFile(fset, filepath.Join(dir, "src", "ok.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := trygo.TranslateAST(fset, []*ast.File{f}, filepath.Join(dir, "src")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join(dir, "want", "src", "ok.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := buf.String(); have != string(want) {
+		t.Fatalf("Preamble was not restored in translated AST.\nWanted:\n%s\n\nHave:\n%s\n", want, have)
+	}
+}
+
+func TestContainsTry(t *testing.T) {
+	for _, tc := range []struct {
+		what string
+		src  string
+		want bool
+	}{
+		{"try() call", "package foo\nfunc f() error {\n\ttry(g())\n\treturn nil\n}\n", true},
+		{"ok() call", "package foo\nfunc f(m map[int]int) error {\n\tv := ok(m[0])\n\treturn nil\n}\n", true},
+		{"no call", "package foo\nfunc f() error {\n\treturn g()\n}\n", false},
+		{"method call", "package foo\nfunc f() error {\n\treturn x.try()\n}\n", false},
+		{"package selector", "package foo\nimport try \"strings\"\nfunc f() string {\n\treturn try.TrimSpace(\" \")\n}\n", false},
+		{"in comment", "package foo\n// try(g())\nfunc f() {}\n", false},
+		{"in string", "package foo\nvar s = \"try(g())\"\n", false},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			if have := trygo.ContainsTrySource([]byte(tc.src)); have != tc.want {
+				t.Errorf("ContainsTrySource() returned %v but wanted %v", have, tc.want)
+			}
+			f, err := parser.ParseFile(token.NewFileSet(), "foo.go", tc.src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := trygo.ContainsTry(f); have != tc.want {
+				t.Errorf("ContainsTry() returned %v but wanted %v", have, tc.want)
+			}
+		})
+	}
+
+	// ok() and try() declared in the same file are not pseudo-functions
+	for _, name := range []string{"ok", "try"} {
+		src := "package foo\nfunc " + name + "(i int) int { return i }\nfunc f() int {\n\treturn " + name + "(1)\n}\n"
+		f, err := parser.ParseFile(token.NewFileSet(), "foo.go", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trygo.ContainsTry(f) {
+			t.Errorf("Call of declared %s() should not be reported", name)
+		}
+	}
+}
+
+func TestPlaygroundHandler(t *testing.T) {
+	srv := httptest.NewServer((&trygo.Gen{}).PlaygroundHandler())
+	defer srv.Close()
+
+	post := func(src string) *trygo.PlaygroundResponse {
+		b, err := json.Marshal(&trygo.PlaygroundRequest{Source: src})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.Post(srv.URL, "application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("Unexpected status:", res.Status)
+		}
+		var ret trygo.PlaygroundResponse
+		if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+			t.Fatal(err)
+		}
+		return &ret
+	}
+
+	res := post(`package main
+
+import "strconv"
+
+func f(s string) (int, error) {
+	n := try(strconv.Atoi(s))
+	_ = tryOr(strconv.Atoi(s), 0)
+	return n, nil
+}
+`)
+	if want := "n, _err0 := strconv.Atoi(s)\n\tif _err0 != nil {\n\t\treturn 0, _err0\n\t}"; !strings.Contains(res.Output, want) {
+		t.Errorf("%q is not included in output:\n%s", want, res.Output)
+	}
+	if len(res.Diagnostics) != 1 || res.Diagnostics[0].Severity != "warning" || res.Diagnostics[0].Line != 7 {
+		t.Errorf("Unexpected diagnostics: %+v", res.Diagnostics)
+	}
+
+	res = post(`package main
+
+import "strconv"
+
+func f(s string) int {
+	return try(strconv.Atoi(s))
+}
+`)
+	if res.Output != "" {
+		t.Errorf("Output should be empty on error: %s", res.Output)
+	}
+	if len(res.Diagnostics) == 0 || res.Diagnostics[0].Severity != "error" || res.Diagnostics[0].Line != 6 {
+		t.Errorf("Unexpected diagnostics: %+v", res.Diagnostics)
+	}
+
+	res = post("package main\n\nfunc f() {")
+	if len(res.Diagnostics) == 0 || res.Diagnostics[0].Line != 3 {
+		t.Errorf("Unexpected diagnostics for parse error: %+v", res.Diagnostics)
+	}
+
+	get, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get.Body.Close()
+	if get.StatusCode != http.StatusMethodNotAllowed {
+		t.Error("GET request should not be allowed:", get.Status)
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trygo-daemon-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	helper := "package foo\n\nimport \"strconv\"\n\nfunc parse(s string) (int, error) {\n\treturn strconv.Atoi(s)\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "helper.go"), []byte(helper), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "foo.go")
+	if err := ioutil.WriteFile(path, []byte("package foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unsaved buffer is sent as source
+	src := "package foo\n\nfunc f(s string) (int, error) {\n\tn := try(parse(s))\n\treturn n, nil\n}\n"
+	bad := "package foo\n\nfunc f(s string) int {\n\treturn try(parse(s))\n}\n"
+	var in bytes.Buffer
+	enc := json.NewEncoder(&in)
+	for i, req := range []interface{}{
+		map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "translate", "params": map[string]interface{}{"path": path, "source": src}},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "check", "params": map[string]interface{}{"path": path, "source": bad}},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 3, "method": "check", "params": map[string]interface{}{"path": path, "source": src}},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 4, "method": "unknown"},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 5, "method": "shutdown"},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 6, "method": "check", "params": map[string]interface{}{"path": path}},
+	} {
+		if err := enc.Encode(req); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := (&trygo.Gen{Warn: ioutil.Discard}).Daemon(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	type response struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	res := []*response{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r response
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, &r)
+	}
+	if len(res) != 5 {
+		t.Fatalf("Wanted 5 responses since daemon was shut down at 5th request but got %d", len(res))
+	}
+
+	var trans trygo.DaemonTranslateResult
+	if err := json.Unmarshal(res[0].Result, &trans); err != nil {
+		t.Fatal(err, string(res[0].Result))
+	}
+	if want := "n, _err0 := parse(s)\n\tif _err0 != nil {\n\t\treturn 0, _err0\n\t}"; !strings.Contains(trans.Code, want) {
+		t.Errorf("%q is not included in translated code:\n%s", want, trans.Code)
+	}
+
+	var check trygo.DaemonCheckResult
+	if err := json.Unmarshal(res[1].Result, &check); err != nil {
+		t.Fatal(err, string(res[1].Result))
+	}
+	if len(check.Diagnostics) != 1 || check.Diagnostics[0].Pos.Line != 4 {
+		t.Errorf("Unexpected diagnostics: %s", res[1].Result)
+	}
+	if err := json.Unmarshal(res[2].Result, &check); err != nil {
+		t.Fatal(err, string(res[2].Result))
+	}
+	if len(check.Diagnostics) != 0 {
+		t.Errorf("Unexpected diagnostics: %s", res[2].Result)
+	}
+
+	if res[3].Error == nil || res[3].Error.Code != -32601 {
+		t.Errorf("Unknown method should be error: %+v", res[3])
+	}
+	if res[4].ID != 5 || res[4].Error != nil {
+		t.Errorf("Unexpected response for shutdown: %+v", res[4])
+	}
+}
+
+type panicPass struct{}
+
+func (p panicPass) Run(pkg *trygo.Package) error {
+	panic("Internal error: Broken Go source")
+}
+
+func TestDaemonRecoverPanic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trygo-daemon-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "foo.go")
+	if err := ioutil.WriteFile(path, []byte("package foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var in bytes.Buffer
+	enc := json.NewEncoder(&in)
+	for i, req := range []interface{}{
+		map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "translate", "params": map[string]interface{}{"path": path}},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "shutdown"},
+	} {
+		if err := enc.Encode(req); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+
+	var out bytes.Buffer
+	gen := &trygo.Gen{Warn: ioutil.Discard, Passes: []trygo.Pass{panicPass{}}}
+	if err := gen.Daemon(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Daemon should continue after panic but responses are: %q", lines)
+	}
+	if !strings.Contains(lines[0], `"code":-32000`) || !strings.Contains(lines[0], "Broken Go source") {
+		t.Errorf("Panic should be responded as error: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"id":2`) {
+		t.Errorf("Unexpected response for shutdown: %s", lines[1])
+	}
+}
@@ -19,6 +19,19 @@ import (
 //   x := try(f())  ->  x, _ := f()
 //   x = try(f())   ->  x, _ = f()
 //   try(f())       ->  f()
+//
+// ok() pseudo-function for functions returning (T, bool) and expect() pseudo-function which does not
+// return on error are eliminated in the same way. try() and ok()
+// can also take a comma-ok expression such as type assertion, map index or channel receive.
+//
+//   x := try(y.(T))  ->  x, _ := y.(T)
+//
+// tryOr() pseudo-function which evaluates to a fallback value on error is eliminated in the same way. The
+// fallback value is kept in '_ = $fallback' statement before the translation point until phase-2.
+//
+// throw() pseudo-function statement for an existing error value is replaced with an assignment to '_'.
+//
+//   throw(err)  ->  _ = err
 
 type nodeStack []ast.Node
 
@@ -52,6 +65,9 @@ type tryCallElimination struct {
 	pkg        *ast.Package
 	fileset    *token.FileSet
 	err        error
+	errPos     token.Position
+	errMsg     string
+	errFixes   []*SuggestedFix
 	file       *ast.File
 	roots      []*blockTree
 	parentBlk  *blockTree
@@ -61,6 +77,18 @@ type tryCallElimination struct {
 	parents    nodeStack
 	funcs      nodeStack
 	numTrans   int
+	deferred   map[*ast.FuncLit]struct{}
+	lg         logger
+	// strict is true when elimination continues after errors to report all problems. The problems are
+	// collected in errs and unified into err by finish().
+	strict   bool
+	errs     []*Diagnostic
+	reported map[token.Pos]struct{}
+	// taken is a set of names declared in package scope or appearing in current file. Temporary variables
+	// never use them not to conflict with variables in user code.
+	taken map[string]struct{}
+	// inserted is a set of statements inserted to define temporary variables.
+	inserted map[ast.Stmt]struct{}
 }
 
 func (tce *tryCallElimination) assertPostCondition() {
@@ -76,71 +104,282 @@ func (tce *tryCallElimination) nodePos(node ast.Node) token.Position {
 }
 
 func (tce *tryCallElimination) logPos(node ast.Node) string {
-	if !logEnabled {
+	if !tce.lg.enabled() {
 		return ""
 	}
 	return relpath(tce.nodePos(node).String())
 }
 
 func (tce *tryCallElimination) errAt(node ast.Node, msg string) {
-	tce.err = errors.Errorf("%s: %v: Error: %s", tce.nodePos(node), tce.pkg.Name, msg)
-	log(ftl(tce.err))
+	tce.errWithFixesAt(node, msg, nil)
+}
+
+// errWithFixesAt is the same as errAt but the error has fixes which editors can apply.
+func (tce *tryCallElimination) errWithFixesAt(node ast.Node, msg string, fixes []*SuggestedFix) {
+	if tce.strict {
+		// The same call may be reported while visiting its children. Report the first reason only
+		if _, ok := tce.reported[node.Pos()]; ok {
+			return
+		}
+		if tce.reported == nil {
+			tce.reported = map[token.Pos]struct{}{}
+		}
+		tce.reported[node.Pos()] = struct{}{}
+		diag := &Diagnostic{
+			Pos:     tce.nodePos(node),
+			Package: tce.pkg.Name,
+			Phase:   checkPhaseTryCall,
+			Message: msg,
+			Fixes:   fixes,
+		}
+		tce.errs = append(tce.errs, diag)
+		tce.lg.log(tce.lg.ftl(diag))
+		return
+	}
+	tce.errPos, tce.errMsg, tce.errFixes = tce.nodePos(node), msg, fixes
+	tce.err = errors.Errorf("%s: %v: Error: %s", tce.errPos, tce.pkg.Name, msg)
+	tce.lg.log(tce.lg.ftl(tce.err))
 }
 
 func (tce *tryCallElimination) errfAt(node ast.Node, format string, args ...interface{}) {
 	tce.errAt(node, fmt.Sprintf(format, args...))
 }
 
+// finish finishes the elimination after walking all files. In strict mode, it reports pseudo-function
+// calls remaining in AST which were not reported yet and unifies all problems into err.
+func (tce *tryCallElimination) finish() {
+	if !tce.strict {
+		return
+	}
+
+	for _, path := range sortedFilePaths(tce.pkg.Files) {
+		ast.Inspect(tce.pkg.Files[path], func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpr); ok {
+				if ident, ok := call.Fun.(*ast.Ident); ok && tce.isPseudoFunc(ident) {
+					tce.errfAt(ident, "%s() call remains after elimination", ident.Name)
+				}
+			}
+			return true
+		})
+	}
+
+	if len(tce.errs) == 0 {
+		return
+	}
+	sortDiagnostics(tce.errs)
+	tce.errPos, tce.errMsg, tce.errFixes = tce.errs[0].Pos, tce.errs[0].Message, tce.errs[0].Fixes
+	tce.err = unifyUntranslatable(tce.errs)
+}
+
 // insertStmt inserts given statement *before* current index of current block
 func (tce *tryCallElimination) insertStmt(stmt ast.Stmt) {
-	tce.currentBlk.insertStmtAt(tce.blkIndex, stmt)
+	tce.currentBlk.insertStmtAt(tce.blkIndex, stmt, tce.lg)
 	// New statement was inserted. Adjust current index
 	tce.blkIndex++
 }
 
-func (tce *tryCallElimination) newTempIdent() *ast.Ident {
-	i := ast.NewIdent(fmt.Sprintf("_%d", tce.varID))
-	tce.varID++
-	return i
+func (tce *tryCallElimination) newTempIdent(pos token.Pos) *ast.Ident {
+	for {
+		name := fmt.Sprintf("_%d", tce.varID)
+		tce.varID++
+		if _, ok := tce.taken[name]; !ok {
+			return newIdent(name, pos)
+		}
+		tce.lg.log("Skip temporary variable name", tce.lg.hi(name), "since it is already used")
+	}
+}
+
+// collectTakenNames collects names in package scope and identifiers in the file for temporary variables.
+func (tce *tryCallElimination) collectTakenNames(file *ast.File) {
+	tce.taken = map[string]struct{}{}
+	idents := func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			tce.taken[ident.Name] = struct{}{}
+		}
+		return true
+	}
+	for _, f := range tce.pkg.Files {
+		if f.Scope == nil {
+			// Objects are not resolved when parsed with parser.SkipObjectResolution
+			ast.Inspect(f, idents)
+			continue
+		}
+		for name := range f.Scope.Objects {
+			tce.taken[name] = struct{}{}
+		}
+	}
+	ast.Inspect(file, idents)
 }
 
-// checkTryCall checks given try() call and returns try() call and inner call (the argument of the try call)
-// since try()'s argument must be function call. When it is not a try() call, it returns nil as first the
-// return value. When it is an invalid try() call, it sets the error to err field and returns false
-// as the third return value.
-func (tce *tryCallElimination) checkTryCall(maybeCall ast.Expr) (tryCall *ast.CallExpr, innerCall *ast.CallExpr, ok bool) {
+// deferredErrResult returns the named error result of the enclosing function when current function
+// is a function literal called by defer statement and returns nothing. try() in the function literal
+// sets the error to the named result instead of returning it.
+func (tce *tryCallElimination) deferredErrResult() *ast.Ident {
+	lit, ok := tce.funcs.top().(*ast.FuncLit)
+	if !ok || len(tce.funcs) < 2 {
+		return nil
+	}
+	if _, ok := tce.deferred[lit]; !ok {
+		return nil
+	}
+	if lit.Type.Results != nil && len(lit.Type.Results.List) > 0 {
+		return nil
+	}
+
+	var rets *ast.FieldList
+	switch f := tce.funcs[len(tce.funcs)-2].(type) {
+	case *ast.FuncLit:
+		rets = f.Type.Results
+	case *ast.FuncDecl:
+		rets = f.Type.Results
+	}
+	if rets == nil || len(rets.List) == 0 {
+		return nil
+	}
+	last := rets.List[len(rets.List)-1]
+	if ident, ok := last.Type.(*ast.Ident); !ok || ident.Name != "error" || len(last.Names) == 0 {
+		return nil
+	}
+	name := last.Names[len(last.Names)-1]
+	if name.Name == "_" {
+		return nil
+	}
+	return name
+}
+
+// commaOkExprKind returns a description of given expression when it is a comma-ok expression which try()
+// and ok() can take instead of function call. Otherwise it returns an empty string.
+func commaOkExprKind(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.TypeAssertExpr:
+		if expr.Type != nil { // x.(type) is only available in type switch
+			return "type assertion"
+		}
+	case *ast.IndexExpr:
+		// Index of slice, array or string is not a comma-ok expression. It is detected by type check
+		return "map index"
+	case *ast.UnaryExpr:
+		if expr.Op == token.ARROW {
+			return "channel receive"
+		}
+	}
+	return ""
+}
+
+// isPseudoFuncName returns true when the name is a name of pseudo-function such as try().
+func isPseudoFuncName(name string) bool {
+	switch name {
+	case "try", "ok", "expect", "tryOr", "throw":
+		return true
+	default:
+		return false
+	}
+}
+
+// isPseudoFunc returns true when the identifier refers try(), ok(), expect(), tryOr() or throw()
+// pseudo-function. Since the names may be declared by users, they are not pseudo-functions when the
+// names are declared in the scope.
+func (tce *tryCallElimination) isPseudoFunc(ident *ast.Ident) bool {
+	switch ident.Name {
+	case "try", "ok", "expect", "tryOr", "throw":
+		if ident.Obj != nil {
+			return false
+		}
+		for _, f := range tce.pkg.Files {
+			if f.Scope != nil && f.Scope.Lookup(ident.Name) != nil {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// checkTryCall checks given try() call and returns try() call and inner expression (the argument of the
+// try call) since try()'s argument must be function call or comma-ok expression. When it is not a try()
+// call, it returns nil as first the return value. When it is an invalid try() call, it sets the error
+// to err field and returns false as the third return value.
+func (tce *tryCallElimination) checkTryCall(maybeCall ast.Expr) (tryCall *ast.CallExpr, inner ast.Expr, ok bool) {
 	outer, ok := maybeCall.(*ast.CallExpr)
 	if !ok {
-		log("Skipped since expression is not a call expression")
+		tce.lg.log("Skipped since expression is not a call expression")
 		return nil, nil, true
 	}
 
 	name, ok := outer.Fun.(*ast.Ident)
 	if !ok {
-		log("Skipped since callee was not var ref")
+		tce.lg.log("Skipped since callee was not var ref")
 		return nil, nil, true
 	}
-	if name.Name != "try" {
-		log("Skipped since RHS is not calling 'try':", name.Name)
+	if !tce.isPseudoFunc(name) || name.Name == "throw" {
+		tce.lg.log("Skipped since RHS is not calling 'try', 'ok', 'expect' nor 'tryOr':", name.Name)
 		return nil, nil, true
 	}
 
-	if len(outer.Args) != 1 {
-		tce.errfAt(outer, "try() should take 1 argument but %d arguments passed", len(outer.Args))
-		return nil, nil, false
+	switch name.Name {
+	case "try":
+		// try() can take an error value which replaces the error as the second argument
+		if len(outer.Args) != 1 && len(outer.Args) != 2 {
+			tce.errfAt(outer, "try() should take 1 or 2 arguments but %d arguments passed", len(outer.Args))
+			return nil, nil, false
+		}
+	case "tryOr":
+		if len(outer.Args) != 2 {
+			tce.errfAt(outer, "tryOr() should take 2 arguments but %d arguments passed", len(outer.Args))
+			return nil, nil, false
+		}
+	default:
+		if len(outer.Args) != 1 {
+			tce.errfAt(outer, "%s() should take 1 argument but %d arguments passed", name.Name, len(outer.Args))
+			return nil, nil, false
+		}
 	}
 
-	inner, ok := outer.Args[0].(*ast.CallExpr)
-	if !ok {
-		tce.errfAt(outer, "try() call's argument must be function call but found %s", reflect.TypeOf(outer.Args[0]))
+	inner = outer.Args[0]
+	if _, ok := inner.(*ast.CallExpr); !ok && commaOkExprKind(inner) == "" {
+		tce.errfAt(outer, "%s() call's argument must be function call or comma-ok expression such as type assertion, map index or channel receive but found %s", name.Name, reflect.TypeOf(inner))
 		return nil, nil, false
 	}
 
 	if len(tce.funcs) == 0 {
-		tce.errAt(outer, "try() function is used outside function")
+		tce.errfAt(outer, "%s() function is used outside function", name.Name)
+		return nil, nil, false
+	}
+
+	if name.Name == "expect" {
+		// expect() is available in any function since it does not return from the function
+		if _, ok := inner.(*ast.CallExpr); !ok {
+			tce.errfAt(outer, "expect() call's argument must be function call but found %s", reflect.TypeOf(inner))
+			return nil, nil, false
+		}
+		tce.lg.log(tce.lg.hi("expect() found:"), inner)
+		return outer, inner, true
+	}
+
+	if name.Name == "tryOr" {
+		// tryOr() is available in any function since it does not return from the function
+		tce.lg.log(tce.lg.hi("tryOr() found:"), inner)
+		return outer, inner, true
+	}
+
+	if name.Name == "ok" {
+		// ok() is available in a function which returns nothing since it returns zero values on false.
+		// Types of the results are checked at phase-2
+		tce.lg.log(tce.lg.hi("ok() found:"), inner)
+		return outer, inner, true
+	}
+
+	if !tce.checkReturnsError(outer, name.Name) {
 		return nil, nil, false
 	}
 
+	tce.lg.log(tce.lg.hi("try() found:"), inner)
+	return outer, inner, true
+}
+
+// checkReturnsError checks that current function can return an error from the pseudo-function call.
+func (tce *tryCallElimination) checkReturnsError(call *ast.CallExpr, name string) bool {
 	var funcTy *ast.FuncType
 	switch f := tce.funcs.top().(type) {
 	case *ast.FuncLit:
@@ -150,60 +389,176 @@ func (tce *tryCallElimination) checkTryCall(maybeCall ast.Expr) (tryCall *ast.Ca
 	}
 
 	if funcTy.Results == nil || len(funcTy.Results.List) == 0 {
-		tce.errAt(outer, "The function returns nothing. try() is not available")
-		return nil, nil, false
+		if tce.deferredErrResult() != nil {
+			tce.lg.log(tce.lg.hi(name + "() found in deferred function"))
+			return true
+		}
+		msg := fmt.Sprintf("The function returns nothing. %s() is not available. In function literal called by defer statement, the enclosing function must have named error result as last return value", name)
+		tce.errWithFixesAt(call, msg, tce.addErrorResultFixes())
+		return false
 	}
-	rets := funcTy.Results.List
+	// Whether the last return type implements error is checked at phase-2 with type information since
+	// it may be a concrete type such as *MyError.
+	return true
+}
 
-	ty := rets[len(rets)-1].Type
-	if ident, ok := ty.(*ast.Ident); !ok || ident.Name != "error" {
-		tce.errfAt(outer, "The function does not return error as last return value. Last return type is %q", ty)
-		return nil, nil, false
+// insertTempDef inserts the definition of temporary variable *before* current index of current block.
+func (tce *tryCallElimination) insertTempDef(def *ast.AssignStmt) {
+	if tce.inserted == nil {
+		tce.inserted = map[ast.Stmt]struct{}{}
 	}
+	tce.inserted[def] = struct{}{}
+	tce.insertStmt(def)
+}
 
-	log(hi("try() found:"), inner.Fun)
-	return outer, inner, true
+// addTransPoint adds the translation point to current block.
+func (tce *tryCallElimination) addTransPoint(p *transPoint) {
+	if s, ok := p.node.(ast.Stmt); ok {
+		if _, ok := tce.inserted[s]; ok {
+			p.inserted = true
+		}
+	}
+	tce.currentBlk.transPoints = append(tce.currentBlk.transPoints, p)
+	tce.lg.log("New TransPoint was added. Now size of points is", len(tce.currentBlk.transPoints))
+	tce.numTrans++
 }
 
 func (tce *tryCallElimination) eliminateTryCall(kind transKind, node ast.Node, maybeTryCall ast.Expr) bool {
-	tryCall, innerCall, ok := tce.checkTryCall(maybeTryCall)
+	tryCall, inner, ok := tce.checkTryCall(maybeTryCall)
 	if !ok || tryCall == nil {
-		log("Skipped since the function call is not try() call or invalid try() call")
+		tce.lg.log("Skipped since the function call is not try() call or invalid try() call")
 		return false
 	}
 
 	pos := tryCall.Pos()
-	log(hi("Eliminate try() call"), "for kind", kind, "at", tce.logPos(tryCall))
+	name := tryCall.Fun.(*ast.Ident).Name
+	tce.lg.log(tce.lg.hi("Eliminate try() call"), "for kind", kind, "at", tce.logPos(tryCall), "pseudo-function:", name)
+
+	// The second argument is an error replacing the original one for try() or a fallback value for tryOr()
+	var second ast.Expr
+	if len(tryCall.Args) == 2 {
+		second = tryCall.Args[1]
+	}
+	if name == "tryOr" && kind == transKindToplevelCall {
+		tce.errAt(tryCall, "tryOr() at toplevel is not available since its value is not used. Use expect() to ignore error instead")
+		return false
+	}
 
-	// Squash try() call with inner call: try(f(...)) -> f(...)
-	*tryCall = *innerCall
+	var expr ast.Expr = tryCall
+	if innerCall, ok := inner.(*ast.CallExpr); ok {
+		// Squash try() call with inner call: try(f(...)) -> f(...)
+		*tryCall = *innerCall
+	} else {
+		// Comma-ok expression cannot be squashed into call expression. Replace try() call with it
+		//   try(x.(T)) -> x.(T)
+		expr = inner
+		switch node := node.(type) {
+		case *ast.ValueSpec:
+			node.Values[0] = inner
+		case *ast.AssignStmt:
+			node.Rhs[0] = inner
+		default:
+			// Value of comma-ok expression must be received. `x.(T)` is not a valid statement
+			tce.errfAt(tryCall, "%[1]s() at toplevel cannot take %[2]s since its value is not used. Assign it to _ like `_ = %[1]s(...)`", name, commaOkExprKind(inner))
+			return false
+		}
+	}
+
+	if second != nil {
+		// Keep the second argument in AST until phase-2 as `_ = $second` statement before the translation
+		// point. Otherwise variables and imports only used in it are reported as unused by type check.
+		// The statement is removed at phase-2.
+		tce.insertStmt(&ast.AssignStmt{
+			Lhs:    []ast.Expr{newIdent("_", second.Pos())},
+			Tok:    token.ASSIGN,
+			TokPos: second.Pos(),
+			Rhs:    []ast.Expr{second},
+		})
+		// Find out untranslated try() calls in the argument
+		ast.Walk(tce, second)
+		if tce.err != nil {
+			return false
+		}
+	}
 
 	p := &transPoint{
 		kind:       kind,
 		node:       node,
 		blockIndex: tce.blkIndex,
 		fun:        tce.funcs.top(),
-		call:       tryCall, // tryCall points inner call here
+		call:       expr, // tryCall points inner call or comma-ok expression here
 		parent:     tce.parents.top(),
 		pos:        pos,
+		ok:         name == "ok",
+		expect:     name == "expect",
 	}
-	tce.currentBlk.transPoints = append(tce.currentBlk.transPoints, p)
+	if name == "tryOr" {
+		p.fallback = second
+	} else {
+		p.replaced = second
+	}
+	if !p.expect && p.fallback == nil {
+		p.errResult = tce.deferredErrResult()
+	}
+	tce.addTransPoint(p)
+	return true
+}
 
-	log("New TransPoint was added. Now size of points is", len(tce.currentBlk.transPoints))
-	tce.numTrans++
+// visitThrow eliminates throw() call statement. It returns false when the statement is not a throw()
+// call. throw(err) is replaced with `_ = err` not to break type check.
+func (tce *tryCallElimination) visitThrow(stmt *ast.ExprStmt) bool {
+	call, ok := stmt.X.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	name, ok := call.Fun.(*ast.Ident)
+	if !ok || name.Name != "throw" || !tce.isPseudoFunc(name) {
+		return false
+	}
+
+	if len(call.Args) != 1 {
+		tce.errfAt(call, "throw() should take 1 argument but %d arguments passed", len(call.Args))
+		return true
+	}
+	if !tce.checkReturnsError(call, "throw") {
+		return true
+	}
+
+	pos := call.Pos()
+	tce.lg.log(tce.lg.hi("Eliminate throw() call"), "at", tce.logPos(call))
 
+	err := call.Args[0]
+	assign := &ast.AssignStmt{
+		Lhs:    []ast.Expr{newIdent("_", pos)},
+		Tok:    token.ASSIGN,
+		TokPos: pos,
+		Rhs:    []ast.Expr{err},
+	}
+	tce.currentBlk.stmts()[tce.blkIndex] = assign
+
+	tce.addTransPoint(&transPoint{
+		kind:       transKindThrow,
+		node:       assign,
+		blockIndex: tce.blkIndex,
+		fun:        tce.funcs.top(),
+		call:       err,
+		parent:     tce.parents.top(),
+		pos:        pos,
+		errResult:  tce.deferredErrResult(),
+	})
 	return true
 }
 
 func (tce *tryCallElimination) visitSpec(spec *ast.ValueSpec) {
 	pos := tce.logPos(spec)
-	log("Value spec at", pos)
+	tce.lg.log("Value spec at", pos)
 
 	if len(spec.Values) != 1 {
 		// In Go, multiple LHS expressions means they does not return multiple values
 		// Note: Following is ill-formed:
 		//   var fromF = F(), try(funcOnlyReturnErr())
-		log("Skipped due to multiple RHS values")
+		// try() calls in multiple RHS values were already hoisted by hoistNestedCalls()
+		tce.lg.log("Skipped due to multiple RHS values")
 		return
 	}
 
@@ -218,20 +573,21 @@ func (tce *tryCallElimination) visitSpec(spec *ast.ValueSpec) {
 	//     var $retvals = try(f(...))
 	//   To:
 	//     $retvals, _ = f(...)
-	spec.Names = append(spec.Names, newIdent("_", spec.Pos()))
+	spec.Names = append(spec.Names, newIdent("_", spec.Names[len(spec.Names)-1].End()))
 
-	log(hi("Value spec translated"), "at", pos, "Added new translation point:", transKindValueSpec)
+	tce.lg.log(tce.lg.hi("Value spec translated"), "at", pos, "Added new translation point:", transKindValueSpec)
 }
 
 func (tce *tryCallElimination) visitAssign(assign *ast.AssignStmt) {
 	pos := tce.logPos(assign)
-	log("Assignment at", pos)
+	tce.lg.log("Assignment at", pos)
 
 	if len(assign.Rhs) != 1 {
 		// In Go, multiple LHS expressions means they does not return multiple values
 		// Note: Following is ill-formed:
 		//   fromF := F(), try(funcOnlyReturnErr())
-		log("Skipped due to multiple RHS values")
+		// try() calls in multiple RHS values were already hoisted by hoistNestedCalls()
+		tce.lg.log("Skipped due to multiple RHS values")
 		return
 	}
 
@@ -241,7 +597,7 @@ func (tce *tryCallElimination) visitAssign(assign *ast.AssignStmt) {
 	default:
 		// This assignment is not at toplevel, for example, `if x := e; ...` or `for x := range e`...
 		// Only toplevel assignments (= or :=) should be translated to avoid wrong if err != nil check insertion
-		log("Skipped non-toplevel assignment at", pos)
+		tce.lg.log("Skipped non-toplevel assignment at", pos)
 		return
 	}
 
@@ -255,8 +611,8 @@ func (tce *tryCallElimination) visitAssign(assign *ast.AssignStmt) {
 		// The inserted assignment statement (:=) is a new translation point to insert if err != nil
 		// check instead of current += assignment.
 		rhs := assign.Rhs[0]
-		tmp := tce.newTempIdent()
-		assign.Rhs[0] = tmp
+		tmp := tce.newTempIdent(assign.Pos())
+		assign.Rhs[0] = newIdent(tmp.Name, rhs.Pos())
 
 		// Note: '_' is inserted by visiting this assignment statement recursively. Here one
 		// element is set to LHS.
@@ -268,7 +624,7 @@ func (tce *tryCallElimination) visitAssign(assign *ast.AssignStmt) {
 		}
 
 		// Insert := statement
-		tce.insertStmt(def)
+		tce.insertTempDef(def)
 
 		// Inserted := statement is a new translation point. Eliminate try() from it instead of
 		// current += assign statement.
@@ -298,17 +654,24 @@ func (tce *tryCallElimination) visitAssign(assign *ast.AssignStmt) {
 	//     $retvals = try(f(...))
 	//   To:
 	//     $retvals, _ = f(...)
-	assign.Lhs = append(assign.Lhs, newIdent("_", assign.Pos()))
+	assign.Lhs = append(assign.Lhs, newIdent("_", assign.Lhs[len(assign.Lhs)-1].End()))
 
-	log(hi("Assignment translated"), "at", hi(pos), "Added new translation point:", transKindAssign)
+	tce.lg.log(tce.lg.hi("Assignment translated"), "at", tce.lg.hi(pos), "Added new translation point:", transKindAssign)
 }
 
 func (tce *tryCallElimination) visitToplevelExpr(stmt *ast.ExprStmt) {
 	pos := tce.logPos(stmt)
-	log("Toplevel call at", pos)
+	tce.lg.log("Toplevel call at", pos)
+
+	if tce.visitThrow(stmt) {
+		return
+	}
 
 	if ok := tce.eliminateTryCall(transKindToplevelCall, stmt, stmt.X); ok {
-		log(hi("Toplevel call translated"), "at", pos, "Added new translation point:", transKindToplevelCall)
+		tce.lg.log(tce.lg.hi("Toplevel call translated"), "at", pos, "Added new translation point:", transKindToplevelCall)
+		// Visit the translated call to find try() calls in function literals such as
+		//   try(func() error { ... }())
+		ast.Walk(tce, stmt.X)
 		return
 	}
 
@@ -324,7 +687,7 @@ func (tce *tryCallElimination) pushBlock(node ast.Stmt) (int, uint) {
 	parent := tce.currentBlk
 	tree := &blockTree{ast: node, parent: parent}
 	if tree.isRoot() {
-		log("New root block added")
+		tce.lg.log("New root block added")
 		tce.roots = append(tce.roots, tree)
 	} else {
 		parent.children = append(parent.children, tree)
@@ -355,20 +718,31 @@ func (tce *tryCallElimination) visitStmts(stmts []ast.Stmt) {
 			return
 		}
 
-		if e, ok := stmt.(*ast.ExprStmt); ok {
-			tce.visitToplevelExpr(e)
-		} else {
-			// Recursively visit
-			ast.Walk(tce, stmt)
-		}
+		tce.visitStmt(stmt)
 		tce.blkIndex++
 	}
 }
 
+// visitStmt visits the statement at toplevel of current block. Pseudo-function calls nested in the
+// statement are hoisted before visiting it.
+func (tce *tryCallElimination) visitStmt(stmt ast.Stmt) {
+	tce.hoistNestedCalls(stmt)
+	if tce.err != nil {
+		return
+	}
+
+	if e, ok := stmt.(*ast.ExprStmt); ok {
+		tce.visitToplevelExpr(e)
+	} else {
+		// Recursively visit
+		ast.Walk(tce, stmt)
+	}
+}
+
 func (tce *tryCallElimination) visitBlockNode(node ast.Stmt, list []ast.Stmt) {
 	pos := tce.logPos(node)
 	ty := reflect.TypeOf(node)
-	log(hi("Block in ", ty, " start"), "at", pos)
+	tce.lg.log(tce.lg.hi("Block in ", ty, " start"), "at", pos)
 
 	tce.parents = tce.parents.push(node)
 	prevIdx, prevVarID := tce.pushBlock(node)
@@ -376,14 +750,19 @@ func (tce *tryCallElimination) visitBlockNode(node ast.Stmt, list []ast.Stmt) {
 	tce.popBlock(prevIdx, prevVarID)
 	tce.parents = tce.parents.pop()
 
-	log(hi("Block in ", ty, " end"), "at", pos)
+	tce.lg.log(tce.lg.hi("Block in ", ty, " end"), "at", pos)
 }
 
 func (tce *tryCallElimination) visitPre(node ast.Node) ast.Visitor {
 	switch node := node.(type) {
 	case *ast.CallExpr:
-		if ident, ok := node.Fun.(*ast.Ident); ok && ident.Name == "try" {
-			tce.errAt(ident, "try() call was not translated. Only try() calls at toplevel call expression, assignments (= or :=), value spec (var or const) are translated")
+		if ident, ok := node.Fun.(*ast.Ident); ok && ident.Name == "throw" && tce.isPseudoFunc(ident) {
+			tce.errAt(ident, "throw() is only available as a statement at toplevel of block")
+			return nil
+		}
+		if ident, ok := node.Fun.(*ast.Ident); ok && tce.isPseudoFunc(ident) {
+			msg := fmt.Sprintf("%[1]s() call was not translated. Only %[1]s() calls in simple statements (expression, assignment, var, return, send, go and defer) at toplevel of block are translated", ident.Name)
+			tce.errWithFixesAt(ident, msg, tce.hoistCallFixes(node))
 			return nil
 		}
 	case *ast.BlockStmt:
@@ -403,13 +782,21 @@ func (tce *tryCallElimination) visitPre(node ast.Node) ast.Visitor {
 		tce.visitAssign(node)
 	case *ast.FuncDecl:
 		tce.funcs = tce.funcs.push(node)
-		log(hi("Start function:"), node.Name.Name)
+		tce.lg.log(tce.lg.hi("Start function:"), node.Name.Name)
 	case *ast.FuncLit:
 		tce.funcs = tce.funcs.push(node)
-		log(hi("Start function literal"))
+		tce.lg.log(tce.lg.hi("Start function literal"))
+	case *ast.DeferStmt:
+		if lit, ok := node.Call.Fun.(*ast.FuncLit); ok {
+			if tce.deferred == nil {
+				tce.deferred = map[*ast.FuncLit]struct{}{}
+			}
+			tce.deferred[lit] = struct{}{}
+		}
 	case *ast.File:
-		log("File:", hi(node.Name.Name+".go"))
+		tce.lg.log("File:", tce.lg.hi(node.Name.Name+".go"))
 		tce.file = node
+		tce.collectTakenNames(node)
 	}
 	return tce
 }
@@ -418,10 +805,10 @@ func (tce *tryCallElimination) visitPost(node ast.Node) {
 	switch node := node.(type) {
 	case *ast.FuncDecl:
 		tce.funcs = tce.funcs.pop()
-		log(hi("End function:"), node.Name.Name)
+		tce.lg.log(tce.lg.hi("End function:"), node.Name.Name)
 	case *ast.FuncLit:
 		tce.funcs = tce.funcs.pop()
-		log(hi("End function literal"))
+		tce.lg.log(tce.lg.hi("End function literal"))
 	}
 }
 
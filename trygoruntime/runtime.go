@@ -0,0 +1,48 @@
+// Package trygoruntime is a tiny helper package which code generated by trygo imports when helper-based
+// code generation is enabled with -runtime-helpers. Helpers keep generated code short and fixes of them
+// can be shipped as library updates without regenerating code.
+package trygoruntime
+
+import (
+	"fmt"
+	"log"
+)
+
+// Wrap wraps the error with the message like `fmt.Errorf("msg: %w", err)`. It returns nil when the error
+// is nil.
+func Wrap(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// CallsiteError is an error caught at a callsite of pseudo-function in TryGo source.
+type CallsiteError struct {
+	// Callsite is a position of the pseudo-function call in TryGo source like "foo.go:12".
+	Callsite string
+	// Err is the original error.
+	Err error
+}
+
+func (err *CallsiteError) Error() string {
+	return err.Callsite + ": " + err.Err.Error()
+}
+
+// Unwrap returns the original error.
+func (err *CallsiteError) Unwrap() error {
+	return err.Err
+}
+
+// At annotates the error with the callsite in TryGo source. It returns nil when the error is nil.
+func At(err error, callsite string) error {
+	if err == nil {
+		return nil
+	}
+	return &CallsiteError{callsite, err}
+}
+
+// Report outputs the error caught by expect() at the callsite with the standard logger.
+func Report(err error, callsite string) {
+	log.Printf("%s: %v", callsite, err)
+}
@@ -0,0 +1,49 @@
+package trygoruntime
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	if err := Wrap(nil, "foo"); err != nil {
+		t.Fatal("nil error should not be wrapped:", err)
+	}
+	orig := errors.New("oops")
+	err := Wrap(orig, "foo")
+	if msg := err.Error(); msg != "foo: oops" {
+		t.Fatal("Unexpected message:", msg)
+	}
+	if !errors.Is(err, orig) {
+		t.Fatal("Original error is not wrapped:", err)
+	}
+}
+
+func TestAt(t *testing.T) {
+	if err := At(nil, "foo.go:1"); err != nil {
+		t.Fatal("nil error should not be annotated:", err)
+	}
+	orig := errors.New("oops")
+	err := At(orig, "foo.go:12")
+	if msg := err.Error(); msg != "foo.go:12: oops" {
+		t.Fatal("Unexpected message:", msg)
+	}
+	var cerr *CallsiteError
+	if !errors.As(err, &cerr) || cerr.Callsite != "foo.go:12" || !errors.Is(err, orig) {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestReport(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	Report(errors.New("oops"), "foo.go:12")
+	if out := buf.String(); !strings.HasSuffix(out, "foo.go:12: oops\n") {
+		t.Fatal("Unexpected output:", out)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build go1.18
+// +build go1.18
+
+package trygoruntime
+
+// Zero returns the zero value of type T. Generated code uses it for zero values of types which are unknown
+// at translation.
+func Zero[T any]() T {
+	var zero T
+	return zero
+}
@@ -0,0 +1,21 @@
+//go:build go1.18
+// +build go1.18
+
+package trygoruntime
+
+import (
+	"testing"
+)
+
+func TestZero(t *testing.T) {
+	type S struct{ I int }
+	if v := Zero[int](); v != 0 {
+		t.Error("Unexpected zero value of int:", v)
+	}
+	if v := Zero[*S](); v != nil {
+		t.Error("Unexpected zero value of *S:", v)
+	}
+	if v := Zero[S](); v != (S{}) {
+		t.Error("Unexpected zero value of S:", v)
+	}
+}
@@ -0,0 +1,167 @@
+// Package trygotest provides a golden test harness for TryGo fixtures. Tools embedding trygo can reuse it
+// to test translations of their own fixtures.
+//
+// Fixtures are put in a base directory as follows. Each directory except for WANT and HAVE is a fixture.
+// It is generated into HAVE directory and the generated Go files are compared with files in WANT directory.
+//
+//	base/
+//	  foo/        TryGo sources of fixture 'foo'
+//	  WANT/foo/   Expected Go files generated from fixture 'foo'
+//	  HAVE/foo/   Actually generated Go files (created by the test)
+package trygotest
+
+import (
+	"bytes"
+	"github.com/rhysd/trygo"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Config is a configuration of the golden test.
+type Config struct {
+	// NewGen creates a generator which generates fixtures into the output directory. Fixtures can be
+	// generated with custom options of trygo.Gen. When nil, trygo.NewGen is used.
+	NewGen func(outDir string) (*trygo.Gen, error)
+	// Verify is a flag to verify generated packages with type check.
+	Verify bool
+	// Update is a flag to update files in WANT directory with generated files instead of comparing them.
+	Update bool
+}
+
+func (cfg *Config) newGen(outDir string) (*trygo.Gen, error) {
+	if cfg.NewGen != nil {
+		return cfg.NewGen(outDir)
+	}
+	return trygo.NewGen(outDir)
+}
+
+// goFilesUnder returns relative paths of Go files under the directory in sorted order.
+func goFilesUnder(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// Run runs golden tests for all fixtures in the base directory with default configuration.
+func Run(t *testing.T, base string) {
+	RunWith(t, base, &Config{})
+}
+
+// RunWith runs golden tests for all fixtures in the base directory with the configuration. Each fixture
+// is run as a subtest named with the fixture directory name.
+func RunWith(t *testing.T, base string, cfg *Config) {
+	es, err := ioutil.ReadDir(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outDir, err := filepath.Abs(filepath.Join(base, "HAVE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range es {
+		name := e.Name()
+		if !e.IsDir() || name == "WANT" || name == "HAVE" {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			runFixture(t, base, outDir, name, cfg)
+		})
+	}
+}
+
+func runFixture(t *testing.T, base, outDir, name string, cfg *Config) {
+	haveDir := filepath.Join(outDir, name)
+	wantDir := filepath.Join(base, "WANT", name)
+	if err := os.RemoveAll(haveDir); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := cfg.newGen(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.Out == nil || gen.Out == os.Stdout {
+		gen.Out = ioutil.Discard
+	}
+	if err := gen.Generate([]string{filepath.Join(base, name)}, cfg.Verify); err != nil {
+		t.Fatal(err)
+	}
+
+	haves, err := goFilesUnder(haveDir)
+	if err != nil {
+		t.Fatal("Cannot read generated files:", err)
+	}
+
+	if cfg.Update {
+		if err := os.RemoveAll(wantDir); err != nil {
+			t.Fatal(err)
+		}
+		for _, rel := range haves {
+			b, err := ioutil.ReadFile(filepath.Join(haveDir, rel))
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(wantDir, rel)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, b, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+
+	wants, err := goFilesUnder(wantDir)
+	if err != nil {
+		t.Fatal("Cannot read wanted files:", err)
+	}
+	if len(wants) == 0 {
+		t.Fatal("No wanted Go file in", wantDir)
+	}
+
+	generated := make(map[string]struct{}, len(haves))
+	for _, rel := range haves {
+		generated[rel] = struct{}{}
+	}
+	for _, rel := range wants {
+		want, err := ioutil.ReadFile(filepath.Join(wantDir, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		havePath := filepath.Join(haveDir, rel)
+		have, err := ioutil.ReadFile(havePath)
+		if err != nil {
+			t.Errorf("Wanted file %s was not generated: %s", rel, err)
+			continue
+		}
+		delete(generated, rel)
+		if !bytes.Equal(want, have) {
+			t.Errorf("Translation result does not match at %s\nwanted:\n%s\nbut have:\n%s\n", havePath, want, have)
+		}
+	}
+	for _, rel := range haves {
+		if _, ok := generated[rel]; ok {
+			t.Errorf("File %s was generated but not wanted", rel)
+		}
+	}
+}
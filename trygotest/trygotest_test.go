@@ -0,0 +1,71 @@
+package trygotest
+
+import (
+	"github.com/rhysd/trygo"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureBase creates a base directory of fixtures in a temporary directory. Fixtures in testdata are not
+// used directly since tests in trygo package generate files in the same HAVE directory concurrently.
+func fixtureBase(t *testing.T, files map[string]string) string {
+	base, err := ioutil.TempDir("", "trygotest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range files {
+		p := filepath.Join(base, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return base
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(filepath.FromSlash(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRunWithCustomGen(t *testing.T) {
+	base := fixtureBase(t, map[string]string{
+		"simple/foo.go":      readFile(t, "../testdata/gen/ok/simple/foo.go"),
+		"WANT/simple/foo.go": readFile(t, "../testdata/gen/ok/WANT/simple/foo.go"),
+	})
+	defer os.RemoveAll(base)
+
+	called := false
+	RunWith(t, base, &Config{
+		NewGen: func(outDir string) (*trygo.Gen, error) {
+			called = true
+			return trygo.NewGen(outDir)
+		},
+		Verify: true,
+	})
+	if !called {
+		t.Fatal("Custom generator was not used")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	base := fixtureBase(t, map[string]string{
+		"foo/foo.go": "package foo\n\nimport \"os\"\n\nfunc F() error {\n\ttry(os.Chdir(\"foo\"))\n\treturn nil\n}\n",
+	})
+	defer os.RemoveAll(base)
+
+	RunWith(t, base, &Config{Update: true})
+	want := readFile(t, filepath.Join(base, "WANT", "foo", "foo.go"))
+	if have := readFile(t, filepath.Join(base, "HAVE", "foo", "foo.go")); want != have {
+		t.Fatalf("WANT file was not updated. wanted:\n%s\nbut have:\n%s", want, have)
+	}
+	// Generated files match to the updated WANT files
+	Run(t, base)
+}
@@ -0,0 +1,14 @@
+//go:build go1.18
+// +build go1.18
+
+package trygo
+
+import (
+	"go/types"
+)
+
+// isTypeParam returns true when the type is a type parameter of generic function or type.
+func isTypeParam(ty types.Type) bool {
+	_, ok := ty.(*types.TypeParam)
+	return ok
+}
@@ -0,0 +1,13 @@
+//go:build !go1.18
+// +build !go1.18
+
+package trygo
+
+import (
+	"go/types"
+)
+
+// isTypeParam always returns false since type parameters are not supported before Go 1.18.
+func isTypeParam(ty types.Type) bool {
+	return false
+}
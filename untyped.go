@@ -0,0 +1,97 @@
+package trygo
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+var invalidType = types.Typ[types.Invalid]
+
+// numResultsOf returns the number of results in the function type node.
+func numResultsOf(ty *ast.FuncType) int {
+	return len(resultTypeNodes(ty))
+}
+
+// invalidTuple returns a tuple of n values whose types are unknown.
+func invalidTuple(n int, pos token.Pos) *types.Tuple {
+	vars := make([]*types.Var, 0, n)
+	for i := 0; i < n; i++ {
+		vars = append(vars, types.NewVar(pos, nil, "", invalidType))
+	}
+	return types.NewTuple(vars...)
+}
+
+// untypedSignature returns a signature built from the function type node. Types of results are unknown
+// but the number of results is correct.
+func untypedSignature(ty *ast.FuncType) *types.Signature {
+	return types.NewSignature(nil, nil, invalidTuple(numResultsOf(ty), ty.Pos()), false)
+}
+
+// untypedInfo builds type information for nil check insertion only from AST without type check. All types
+// are unknown (invalid). Signatures of functions containing translation points have correct numbers of
+// results so that zero values can be generated from their result type nodes like *new(T). Function calls
+// in toplevel try() calls return unknown single value unless the callee is a function declared in the
+// package.
+func untypedInfo(pkg *Package) *types.Info {
+	decls := map[string]*ast.FuncDecl{}
+	for _, f := range pkg.fileNodes() {
+		for _, decl := range f.Decls {
+			if fun, ok := decl.(*ast.FuncDecl); ok && fun.Recv == nil {
+				decls[fun.Name.Name] = fun
+			}
+		}
+	}
+
+	info := &types.Info{
+		Types:     map[ast.Expr]types.TypeAndValue{},
+		Defs:      map[*ast.Ident]types.Object{},
+		Uses:      map[*ast.Ident]types.Object{},
+		Implicits: map[ast.Node]types.Object{},
+	}
+	for _, trans := range pkg.transPoints {
+		switch fun := trans.fun.(type) {
+		case *ast.FuncDecl:
+			info.Defs[fun.Name] = types.NewFunc(fun.Pos(), nil, fun.Name.Name, untypedSignature(fun.Type))
+		case *ast.FuncLit:
+			info.Types[fun] = types.TypeAndValue{Type: untypedSignature(fun.Type)}
+		}
+
+		var ty types.Type = invalidType
+		if call, ok := trans.call.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok {
+				if decl, ok := decls[ident.Name]; ok && numResultsOf(decl.Type) > 1 {
+					ty = invalidTuple(numResultsOf(decl.Type), call.Pos())
+				}
+			}
+		}
+		info.Types[trans.call] = types.TypeAndValue{Type: ty}
+	}
+	return info
+}
+
+// untypedZeroValueOf returns zero value of the type node without type information. Well-known types are
+// guessed from the node. Otherwise it returns nil.
+func untypedZeroValueOf(node ast.Expr, pos token.Pos) ast.Expr {
+	switch node := node.(type) {
+	case *ast.Ident:
+		switch node.Name {
+		case "error", "any":
+			return newIdent("nil", pos)
+		case "bool":
+			return newIdent("false", pos)
+		case "string":
+			return &ast.BasicLit{Kind: token.STRING, Value: `""`, ValuePos: pos}
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64",
+			"uintptr", "byte", "rune", "float32", "float64":
+			return &ast.BasicLit{Kind: token.INT, Value: "0", ValuePos: pos}
+		}
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return newIdent("nil", pos)
+	case *ast.ArrayType:
+		if node.Len == nil {
+			return newIdent("nil", pos) // Slice
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package trygo
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// Translation may leave some imports unused. For example, when a call expression of some package is
+// removed or replaced, the package may be no longer referenced. Unused import breaks compilation of
+// the generated package so they are removed after translation.
+
+// importNameOf returns a name of import spec used in the file. Type information is necessary since
+// package name may be different from the last element of import path.
+func importNameOf(spec *ast.ImportSpec, info *types.Info) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	if obj, ok := info.Implicits[spec]; ok {
+		return obj.Name()
+	}
+	return ""
+}
+
+// usedNames collects all identifiers used as X of selector expressions like X.Sel.
+func usedNames(file *ast.File) map[string]struct{} {
+	used := map[string]struct{}{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				used[ident.Name] = struct{}{}
+			}
+		}
+		return true
+	})
+	return used
+}
+
+// removeUnusedImports removes imports which are no longer used in the file. It returns the number of
+// removed imports.
+func removeUnusedImports(file *ast.File, info *types.Info, lg logger) int {
+	used := usedNames(file)
+	unused := map[*ast.ImportSpec]struct{}{}
+	for _, spec := range file.Imports {
+		name := importNameOf(spec, info)
+		switch name {
+		case "", "_", ".", "C":
+			// Unknown name, side-effect import, dot import and cgo are never removed
+			continue
+		}
+		if spec.Path.Value == `"C"` {
+			continue
+		}
+		if _, ok := used[name]; ok {
+			continue
+		}
+		lg.log("Remove unused import", lg.hi(spec.Path.Value), "in file", lg.hi(file.Name.Name))
+		unused[spec] = struct{}{}
+	}
+
+	if len(unused) == 0 {
+		return 0
+	}
+
+	// Comments of removed imports should be removed together. Otherwise they would be attached to other
+	// declarations on printing.
+	comments := map[*ast.CommentGroup]struct{}{}
+	imports := make([]*ast.ImportSpec, 0, len(file.Imports)-len(unused))
+	for _, spec := range file.Imports {
+		if _, ok := unused[spec]; !ok {
+			imports = append(imports, spec)
+			continue
+		}
+		for _, g := range []*ast.CommentGroup{spec.Doc, spec.Comment} {
+			if g != nil {
+				comments[g] = struct{}{}
+			}
+		}
+	}
+	file.Imports = imports
+
+	decls := make([]ast.Decl, 0, len(file.Decls))
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			decls = append(decls, decl)
+			continue
+		}
+		specs := make([]ast.Spec, 0, len(gen.Specs))
+		for _, spec := range gen.Specs {
+			if _, ok := unused[spec.(*ast.ImportSpec)]; !ok {
+				specs = append(specs, spec)
+			}
+		}
+		if len(specs) == 0 {
+			if gen.Doc != nil {
+				comments[gen.Doc] = struct{}{}
+			}
+			continue
+		}
+		gen.Specs = specs
+		decls = append(decls, gen)
+	}
+	file.Decls = decls
+
+	if len(comments) > 0 {
+		groups := make([]*ast.CommentGroup, 0, len(file.Comments))
+		for _, g := range file.Comments {
+			if _, ok := comments[g]; !ok {
+				groups = append(groups, g)
+			}
+		}
+		file.Comments = groups
+	}
+
+	return len(unused)
+}
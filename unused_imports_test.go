@@ -0,0 +1,68 @@
+package trygo
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestRemoveUnusedImports(t *testing.T) {
+	src := `package foo
+
+import (
+	"fmt"
+	"os" // for Args
+	str "strings"
+	_ "net/http/pprof"
+	. "math"
+	"go/ast"
+)
+
+func f() {
+	fmt.Println(str.ToUpper("hello"), os.Args, Pi)
+	var _ ast.Node
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "foo.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Implicits: map[ast.Node]types.Object{}}
+	cfg := &types.Config{Importer: importer.Default()}
+	if _, err := cfg.Check("foo", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove usages of os and strings as translation does
+	body := file.Decls[1].(*ast.FuncDecl).Body
+	call := body.List[0].(*ast.ExprStmt).X.(*ast.CallExpr)
+	call.Args = call.Args[2:]
+
+	if n := removeUnusedImports(file, info, logger{}); n != 2 {
+		t.Fatal("2 imports should be removed but", n)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	have := buf.String()
+
+	for _, unused := range []string{`"os"`, `str "strings"`, "for Args"} {
+		if strings.Contains(have, unused) {
+			t.Error(unused, "was not removed:", have)
+		}
+	}
+	for _, used := range []string{`"fmt"`, `_ "net/http/pprof"`, `. "math"`, `"go/ast"`} {
+		if !strings.Contains(have, used) {
+			t.Error(used, "was removed:", have)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package trygo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// Violation is a broken invariant of translated AST found by Package.Validate.
+type Violation struct {
+	// Pos is a position where the invariant was broken. It may be invalid when the node was generated
+	// without position.
+	Pos token.Position
+	// Package is a name of package where the invariant was broken.
+	Package string
+	// Message is a description of the broken invariant.
+	Message string
+}
+
+func (v *Violation) Error() string {
+	if !v.Pos.IsValid() {
+		return v.Package + ": Invariant violation: " + v.Message
+	}
+	return v.Pos.String() + ": " + v.Package + ": Invariant violation: " + v.Message
+}
+
+// stmtPlace is a place of statement in a list of statements.
+type stmtPlace struct {
+	list  []ast.Stmt
+	index int
+}
+
+// stmtListOf returns a list of statements directly contained in the node. It returns false when the
+// node cannot contain statements.
+func stmtListOf(node ast.Node) ([]ast.Stmt, bool) {
+	switch node := node.(type) {
+	case *ast.BlockStmt:
+		return node.List, true
+	case *ast.CaseClause:
+		return node.Body, true
+	case *ast.CommClause:
+		return node.Body, true
+	default:
+		return nil, false
+	}
+}
+
+// definedNames returns names assigned or declared by the statement.
+func definedNames(stmt ast.Stmt) []string {
+	names := []string{}
+	switch stmt := stmt.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range stmt.Lhs {
+			if ident, ok := lhs.(*ast.Ident); ok {
+				names = append(names, ident.Name)
+			}
+		}
+	case *ast.DeclStmt:
+		if decl, ok := stmt.Decl.(*ast.GenDecl); ok {
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.ValueSpec); ok {
+					for _, ident := range spec.Names {
+						names = append(names, ident.Name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// checkedIdentOf returns the identifier checked by the condition of `if` statement inserted at phase-2.
+// The condition is `$ident != nil` or `!$ident`.
+func checkedIdentOf(cond ast.Expr) (*ast.Ident, bool) {
+	switch cond := cond.(type) {
+	case *ast.BinaryExpr:
+		if nilIdent, ok := cond.Y.(*ast.Ident); !ok || nilIdent.Name != "nil" || cond.Op != token.NEQ {
+			return nil, false
+		}
+		ident, ok := cond.X.(*ast.Ident)
+		return ident, ok
+	case *ast.UnaryExpr:
+		if cond.Op != token.NOT {
+			return nil, false
+		}
+		ident, ok := cond.X.(*ast.Ident)
+		return ident, ok
+	default:
+		return nil, false
+	}
+}
+
+// Validate walks the translated AST of the package and returns violations of invariants which the
+// translation guarantees. It is a cheap sanity check for tools which run extra passes on the package.
+// The package must be translated before calling this method. Returning an empty slice means no
+// violation was found.
+//
+//   - No call of pseudo-function such as try() remains
+//   - Each inserted nil check refers an error (or bool) value assigned by the generated code
+//   - Each statement generated for a translation point exists exactly once in its block and statements
+//     generated for the same translation point are still put in a row
+func (pkg *Package) Validate() []*Violation {
+	vs := []*Violation{}
+	violate := func(pos token.Pos, format string, args ...interface{}) {
+		vs = append(vs, &Violation{pkg.Files.Position(pos), pkg.Node.Name, fmt.Sprintf(format, args...)})
+	}
+
+	declared := map[string]struct{}{}
+	for _, f := range pkg.fileNodes() {
+		if f.Scope == nil {
+			continue
+		}
+		for name := range f.Scope.Objects {
+			declared[name] = struct{}{}
+		}
+	}
+
+	places := map[ast.Stmt]stmtPlace{}
+	for _, f := range pkg.fileNodes() {
+		ast.Inspect(f, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpr); ok {
+				if ident, ok := call.Fun.(*ast.Ident); ok && isPseudoFuncName(ident.Name) {
+					_, ok := declared[ident.Name]
+					if ident.Obj == nil && !ok {
+						violate(call.Pos(), "%s() call remains after translation", ident.Name)
+					}
+				}
+				return true
+			}
+			list, ok := stmtListOf(node)
+			if !ok {
+				return true
+			}
+			for i, stmt := range list {
+				if _, ok := places[stmt]; ok {
+					violate(stmt.Pos(), "Statement appears more than once in AST")
+					continue
+				}
+				places[stmt] = stmtPlace{list, i}
+			}
+			return true
+		})
+	}
+
+	for _, trans := range pkg.transPoints {
+		if len(trans.generated) == 0 {
+			continue
+		}
+
+		names := map[string]struct{}{}
+		if ident, ok := trans.call.(*ast.Ident); ok && trans.kind == transKindThrow {
+			names[ident.Name] = struct{}{} // throw(err) checks the variable directly
+		}
+		for _, stmt := range trans.generated {
+			ifStmt, ok := stmt.(*ast.IfStmt)
+			if !ok {
+				for _, n := range definedNames(stmt) {
+					names[n] = struct{}{}
+				}
+				continue
+			}
+			if ifStmt.Init != nil {
+				for _, n := range definedNames(ifStmt.Init) {
+					names[n] = struct{}{}
+				}
+			}
+			ident, ok := checkedIdentOf(ifStmt.Cond)
+			if !ok {
+				violate(ifStmt.Pos(), "Condition of nil check inserted for %s() is not a variable check", trans.funcName())
+				continue
+			}
+			if _, ok := names[ident.Name]; !ok {
+				violate(ifStmt.Pos(), "Variable '%s' checked for %s() is not assigned by generated code", ident.Name, trans.funcName())
+			}
+		}
+
+		first, ok := places[trans.generated[0]]
+		if !ok {
+			violate(trans.pos, "Code generated for %s() was removed from its block", trans.funcName())
+			continue
+		}
+		for i, stmt := range trans.generated[1:] {
+			idx := first.index + i + 1
+			if idx >= len(first.list) || first.list[idx] != stmt {
+				violate(trans.pos, "Code generated for %s() is not put in a row in its block", trans.funcName())
+				break
+			}
+		}
+	}
+
+	return vs
+}
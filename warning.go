@@ -0,0 +1,126 @@
+package trygo
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// Warning is a non-fatal problem found while translation. Unlike errors, translation continues and
+// generated code is still valid, but it may not work as intended.
+type Warning struct {
+	// Pos is a position where the problem was found.
+	Pos token.Position
+	// Package is a name of package where the problem was found.
+	Package string
+	// Message is a description of the problem.
+	Message string
+}
+
+func (w *Warning) String() string {
+	return w.Pos.String() + ": " + w.Package + ": " + w.Message
+}
+
+// calleeOf returns the object of the function called at the translation point. It returns nil when
+// the callee is not a named function or method.
+func calleeOf(trans *transPoint, info *types.Info) types.Object {
+	call, ok := trans.call.(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return info.Uses[fun]
+	case *ast.SelectorExpr:
+		return info.Uses[fun.Sel]
+	default:
+		return nil
+	}
+}
+
+// alwaysReturnsNil returns true when all return statements in the function declaration return nil as
+// their last values. Returns in function literals are not related to the function.
+func alwaysReturnsNil(decl *ast.FuncDecl, info *types.Info) bool {
+	if decl.Body == nil {
+		return false // Implemented in assembly
+	}
+	nilObj := types.Universe.Lookup("nil")
+	found, always := false, true
+	ast.Inspect(decl.Body, func(node ast.Node) bool {
+		if !always {
+			return false
+		}
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			found = true
+			if len(node.Results) == 0 {
+				always = false // Named results may be set
+				return false
+			}
+			ident, ok := node.Results[len(node.Results)-1].(*ast.Ident)
+			always = ok && info.Uses[ident] == nilObj
+			return false
+		}
+		return true
+	})
+	return found && always
+}
+
+// transWarnings finds suspicious translations in the package with type information after phase-1.
+//
+//   - try() on a call whose error result is statically always nil. Only functions in the same package
+//     are checked
+//   - 'error' name shadowed at try() call since code generated for it may refer to the name
+//   - tryOr() whose result is discarded since the fallback value is never used
+func transWarnings(pkg *Package, info *types.Info, tyPkg *types.Package) []*Warning {
+	decls := map[types.Object]*ast.FuncDecl{}
+	for _, f := range pkg.fileNodes() {
+		for _, decl := range f.Decls {
+			if fun, ok := decl.(*ast.FuncDecl); ok {
+				decls[info.Defs[fun.Name]] = fun
+			}
+		}
+	}
+	// Functions containing translation points may return non-nil error from nil checks inserted later
+	transFuncs := map[ast.Node]struct{}{}
+	for _, trans := range pkg.transPoints {
+		transFuncs[trans.fun] = struct{}{}
+	}
+	errObj := types.Universe.Lookup("error")
+
+	ws := []*Warning{}
+	warn := func(trans *transPoint, msg string) {
+		ws = append(ws, &Warning{pkg.Files.Position(trans.pos), pkg.Node.Name, msg})
+	}
+	for _, trans := range pkg.transPoints {
+		if !trans.commaOk() && !trans.expect && trans.kind != transKindThrow {
+			if decl, ok := decls[calleeOf(trans, info)]; ok {
+				if _, ok := transFuncs[decl]; !ok && alwaysReturnsNil(decl, info) {
+					warn(trans, "Function "+decl.Name.Name+"() called in "+trans.funcName()+"() always returns nil error. The check is redundant")
+				}
+			}
+		}
+
+		if scope := tyPkg.Scope().Innermost(trans.pos); scope != nil {
+			if _, obj := scope.LookupParent("error", trans.pos); obj != nil && obj != errObj {
+				warn(trans, "Name 'error' is shadowed by the declaration at "+pkg.Files.Position(obj.Pos()).String()+". Code generated for "+trans.funcName()+"() may refer to it instead of built-in error type")
+			}
+		}
+
+		if trans.fallback != nil {
+			var lhs ast.Expr
+			switch node := trans.node.(type) {
+			case *ast.ValueSpec:
+				lhs = node.Names[0]
+			case *ast.AssignStmt:
+				lhs = node.Lhs[0]
+			}
+			if ident, ok := lhs.(*ast.Ident); ok && ident.Name == "_" {
+				warn(trans, "Result of tryOr() is discarded. The fallback value is never used")
+			}
+		}
+	}
+	return ws
+}
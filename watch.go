@@ -0,0 +1,194 @@
+//go:build !js
+// +build !js
+
+package trygo
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watchDebounce is a duration to wait for following events after a file was changed. Editors may
+// change a file with multiple events on saving it.
+const watchDebounce = 100 * time.Millisecond
+
+// watchGraph is a set of watched package directories with their import relations.
+type watchGraph struct {
+	// paths is a map from package directory to its import path. Directories whose import paths are
+	// unknown are not in this map.
+	paths map[string]string
+	// imports is a map from package directory to import paths imported by the package.
+	imports map[string]map[string]struct{}
+}
+
+// importsOfDir returns import paths imported by Go files in the directory.
+func importsOfDir(dir string) map[string]struct{} {
+	imports := map[string]struct{}{}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return imports
+	}
+	fset := token.NewFileSet()
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, e.Name()), nil, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range f.Imports {
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil {
+				imports[p] = struct{}{}
+			}
+		}
+	}
+	return imports
+}
+
+func newWatchGraph(dirs []string) *watchGraph {
+	w := &watchGraph{map[string]string{}, map[string]map[string]struct{}{}}
+	for _, dir := range dirs {
+		if p, ok := importPathOfDir(dir); ok {
+			w.paths[dir] = p
+		}
+		w.imports[dir] = importsOfDir(dir)
+	}
+	return w
+}
+
+// affected returns sorted directories of the changed packages and packages which depend on them
+// directly or indirectly in the watched packages.
+func (w *watchGraph) affected(changed map[string]struct{}) []string {
+	saw := map[string]struct{}{}
+	queue := make([]string, 0, len(changed))
+	for dir := range changed {
+		// Imports of the changed package may be changed
+		w.imports[dir] = importsOfDir(dir)
+		queue = append(queue, dir)
+	}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		if _, ok := saw[dir]; ok {
+			continue
+		}
+		saw[dir] = struct{}{}
+		path, ok := w.paths[dir]
+		if !ok {
+			continue
+		}
+		for d, imports := range w.imports {
+			if _, ok := imports[path]; ok {
+				queue = append(queue, d)
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(saw))
+	for dir := range saw {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// isGeneratedPath returns true when the Go file at the path was generated by trygo.
+func isGeneratedPath(path string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly|parser.ParseComments)
+	return err == nil && isGeneratedFile(f)
+}
+
+// generateWatched generates the packages and remembers them for later generations.
+func (gen *Gen) generateWatched(dirs []string) ([]*Package, error) {
+	pkgs, err := gen.generatePackages(dirs)
+	for _, dir := range dirs {
+		delete(gen.watched, dir)
+	}
+	for _, pkg := range pkgs {
+		gen.watched[pkg.Birth] = append(gen.watched[pkg.Birth], pkg)
+	}
+	return pkgs, err
+}
+
+// Watch generates all TryGo packages under given paths as Generate does, then watches Go files in the
+// package directories. When some files are changed, only the packages containing the files and the
+// packages depending on them in the watched packages are generated again. onChange is called with the
+// generated packages and an error after each generation including the first one. Failure of generation
+// is passed to onChange and watching continues. Directories added after watching started are not
+// watched. Watch blocks until ctx is done and returns nil.
+func (gen *Gen) Watch(ctx context.Context, paths []string, onChange func(pkgs []*Package, err error)) error {
+	lg := gen.lg()
+	lg.log("Start watching", paths)
+
+	dirs, err := gen.PackageDirs(paths)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(gen.OutDir, 0755); err != nil {
+		return errors.Wrapf(err, "Cannot create output directory %q", gen.OutDir)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "Cannot create file watcher")
+	}
+	defer watcher.Close()
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return errors.Wrapf(err, "Cannot watch directory %s", dir)
+		}
+	}
+	graph := newWatchGraph(dirs)
+	lg.log("Watching package directories:", lg.hi(dirs))
+
+	gen.watched = map[string][]*Package{}
+	defer func() { gen.watched = nil }()
+	onChange(gen.generateWatched(dirs))
+
+	changed := map[string]struct{}{}
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			lg.log("Stop watching", paths)
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !strings.HasSuffix(ev.Name, ".go") || ev.Op == fsnotify.Chmod {
+				continue
+			}
+			if isGeneratedPath(ev.Name) {
+				// Generated files are written next to sources in dual-build layout
+				lg.log("Ignore change of generated file:", ev)
+				continue
+			}
+			lg.log("File change was detected:", ev)
+			changed[filepath.Dir(ev.Name)] = struct{}{}
+			timer.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			onChange(nil, errors.Wrap(err, "Error while watching files"))
+		case <-timer.C:
+			targets := graph.affected(changed)
+			changed = map[string]struct{}{}
+			lg.log("Generate packages again:", lg.hi(targets))
+			onChange(gen.generateWatched(targets))
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build js
+// +build js
+
+package trygo
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+// Watch is not available on js since file system notifications are not supported. It always returns an
+// error.
+func (gen *Gen) Watch(ctx context.Context, paths []string, onChange func(pkgs []*Package, err error)) error {
+	return errors.New("Watching files is not supported on js")
+}